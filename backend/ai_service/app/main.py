@@ -27,6 +27,12 @@ app.add_middleware(
 class ParseRequest(BaseModel):
     file_path: str
 
+class ParseTextRequest(BaseModel):
+    text: str
+
+# Longest CV text accepted by /parse-text
+MAX_TEXT_LENGTH = 200_000
+
 # Initialize parser
 parser = ResumeParser()
 
@@ -37,10 +43,17 @@ async def root():
         "version": "1.0.0",
         "endpoints": {
             "parse_cv": "/parse-cv",
-            "test_cv": "/test-cv"
+            "parse_text": "/parse-text",
+            "test_cv": "/test-cv",
+            "health": "/health"
         }
     }
 
+@app.get("/health")
+async def health():
+    """Liveness probe used by the main service's AI client"""
+    return {"status": "ok"}
+
 @app.post("/parse-cv")
 async def parse_cv(request: ParseRequest):
     """Parse CV from file path"""
@@ -55,11 +68,38 @@ async def parse_cv(request: ParseRequest):
 
         # Parse the CV
         cv_data = parser.resume_to_json(request.file_path)
+        confidence = cv_data.pop("confidence", {})
 
         return {
             "status": "success",
             "file_path": request.file_path,
-            "data": cv_data
+            "data": cv_data,
+            "confidence": confidence
+        }
+
+    except HTTPException:
+        raise
+    except Exception as e:
+        raise HTTPException(status_code=500, detail=f"Error parsing CV: {str(e)}")
+
+@app.post("/parse-text")
+async def parse_text(request: ParseTextRequest):
+    """Parse CV from its text, extracted by the main service from DOCX/ODT documents"""
+    try:
+        if not request.text.strip():
+            raise HTTPException(status_code=400, detail="Text is required")
+
+        if len(request.text) > MAX_TEXT_LENGTH:
+            raise HTTPException(status_code=400, detail="Text is too long")
+
+        # Parse the CV
+        cv_data = parser.text_to_json(request.text)
+        confidence = cv_data.pop("confidence", {})
+
+        return {
+            "status": "success",
+            "data": cv_data,
+            "confidence": confidence
         }
 
     except HTTPException:
@@ -1,4 +1,4 @@
-from typing import Optional, List
+from typing import Optional, List, Dict
 from pydantic import BaseModel, Field
 
 
@@ -36,3 +36,4 @@ class ResumeSchema(BaseModel):
     education: List[CVEducationRequest] = Field(default_factory=list, description="Danh sách thông tin học vấn")
     courses: List[CVCourseRequest] = Field(default_factory=list, description="Danh sách khóa học và chứng chỉ")
     skills: List[CVSkillRequest] = Field(default_factory=list, description="Danh sách kỹ năng và năng lực")
+    confidence: Dict[str, float] = Field(default_factory=dict, description="Độ tin cậy từ 0 đến 1 của từng trường đã trích xuất, theo tên trường (full_name, job_title, summary, birthday, gender, email, phone, address, education, courses, skills)")
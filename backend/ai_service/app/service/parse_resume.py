@@ -18,6 +18,10 @@ from schema import ResumeSchema
 # Load environment variables from .env file
 _ = load_dotenv(find_dotenv())
 
+# Các trường có độ tin cậy, theo tên trong ResumeSchema
+CONFIDENCE_FIELDS = ("full_name", "job_title", "summary", "birthday", "gender", "email", "phone", "address",
+                     "education", "courses", "skills")
+
 class ResumeParser:
     def __init__(self, resume_file=None):
         # Lấy biến môi trường với tên chuẩn Azure OpenAI
@@ -75,7 +79,19 @@ class ResumeParser:
             dict: CV đã được chuyển thành JSON.
         """
         resume_text = self.extract_text(pdf_path)
+        return self.text_to_json(resume_text)
+
+    def text_to_json(self, resume_text):
+        """
+        Chuyển nội dung text của CV thành JSON bằng LLM. Dùng cho các định dạng
+        (DOCX, ODT) mà main service đã tự trích xuất text.
 
+        Args:
+            resume_text (str): Nội dung text của CV.
+
+        Returns:
+            dict: CV đã được chuyển thành JSON.
+        """
         # Khởi tạo parser JSON dựa trên schema ResumeSchema (định nghĩa cấu trúc CV)
         json_parser = JsonOutputParser(pydantic_object=ResumeSchema)
 
@@ -94,5 +110,24 @@ class ResumeParser:
 
         # Parse response thành JSON
         parsed_result = json_parser.parse(response.content)
+        parsed_result["confidence"] = self.clean_confidence(parsed_result.get("confidence"))
 
         return parsed_result
+
+    @staticmethod
+    def clean_confidence(confidence):
+        """
+        Chỉ giữ độ tin cậy của các trường đã biết, là số trong khoảng 0..1.
+        LLM có thể bỏ sót hoặc trả về giá trị không hợp lệ.
+        """
+        cleaned = {}
+        if not isinstance(confidence, dict):
+            return cleaned
+
+        for field in CONFIDENCE_FIELDS:
+            try:
+                value = float(confidence[field])
+            except (KeyError, TypeError, ValueError):
+                continue
+            cleaned[field] = min(1.0, max(0.0, value))
+        return cleaned
@@ -35,6 +35,10 @@ Thực hiện theo các bước sau để trích xuất và cấu trúc thông t
    - Xem xét dữ liệu trích xuất để đảm bảo tính nhất quán và đầy đủ.
    - Đảm bảo tất cả các trường bắt buộc được điền nếu thông tin có trong CV.
 
+7. Đánh giá độ tin cậy:
+   - Với mỗi trường (full_name, job_title, summary, birthday, gender, email, phone, address, education, courses, skills), ghi vào confidence một số từ 0 đến 1.
+   - 1 khi thông tin được ghi rõ ràng trong CV, thấp hơn khi phải suy luận hoặc văn bản bị lỗi, 0 khi không tìm thấy.
+
 </instructions>
 
 {format_instructions}"""
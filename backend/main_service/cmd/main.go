@@ -4,12 +4,18 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
+	"github.com/vdt/cv-management/internal/aiclient"
+	"github.com/vdt/cv-management/internal/authz"
 	"github.com/vdt/cv-management/internal/database"
+	"github.com/vdt/cv-management/internal/fetcher"
 	"github.com/vdt/cv-management/internal/handlers"
 	"github.com/vdt/cv-management/internal/middleware"
+	"github.com/vdt/cv-management/internal/scanner"
+	"github.com/vdt/cv-management/internal/storage"
 )
 
 func main() {
@@ -24,9 +30,36 @@ func main() {
 	}
 	defer database.CloseDB()
 
+	// Initialize file storage (local disk, S3-compatible or Digital Ocean Spaces)
+	if err := storage.Init(); err != nil {
+		log.Fatalf("Failed to initialize file storage: %v", err)
+	}
+	if err := scanner.Init(); err != nil {
+		log.Fatalf("Failed to initialize malware scanner: %v", err)
+	}
+	if err := fetcher.Init(); err != nil {
+		log.Fatalf("Failed to initialize remote file fetching: %v", err)
+	}
+	if err := aiclient.Init(); err != nil {
+		log.Fatalf("Failed to initialize AI service client: %v", err)
+	}
+
 	// Initialize SSE manager
 	handlers.InitSSEManager()
 
+	// Start the scheduled LDAP / Active Directory sync (only when AUTH_PROVIDER=ldap)
+	handlers.StartDirectorySync()
+
+	// Start the job that permanently deletes users deactivated longer than the retention period
+	handlers.StartUserPurge()
+
+	// Start the job that deletes uploaded files no CV uses anymore
+	handlers.StartUploadGC()
+	handlers.StartParseWorkers()
+
+	// Start the job that flags likely duplicate users for review
+	handlers.StartDuplicateScan()
+
 	// Set Gin mode based on environment
 	if os.Getenv("ENV") == "production" {
 		gin.SetMode(gin.ReleaseMode)
@@ -35,11 +68,26 @@ func main() {
 	// Initialize router
 	router := gin.Default()
 
+	// Only the reverse proxies listed in TRUSTED_PROXIES may set the client IP with X-Forwarded-For, which
+	// API key IP allow-lists and the audit log rely on. By default no proxy is trusted.
+	var trustedProxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			trustedProxies = append(trustedProxies, proxy)
+		}
+	}
+	if err := router.SetTrustedProxies(trustedProxies); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+
+	// Tag every request with an ID so log lines and audit entries can be correlated
+	router.Use(middleware.RequestID())
+
 	// CORS middleware
 	router.Use(func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key, X-Request-ID")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
@@ -52,11 +100,19 @@ func main() {
 	// API routes
 	api := router.Group("/api")
 	{
-		// Health check
+		// Health check; the API stays up while the AI service is down, so that only degrades it
 		api.GET("/health", func(c *gin.Context) {
+			aiService := aiclient.Default.Status()
+			status := "ok"
+			if !aiService.Healthy {
+				status = "degraded"
+			}
 			c.JSON(200, gin.H{
-				"status":  "ok",
+				"status":  status,
 				"message": "API is running",
+				"data": gin.H{
+					"ai_service": aiService,
+				},
 			})
 		})
 
@@ -75,6 +131,12 @@ func main() {
 		// Roles routes - needs to be public for registration
 		api.GET("/roles", handlers.GetRoles)
 
+		// Shared CV snapshots, authenticated by the share link token itself
+		api.GET("/shared/:token", handlers.GetSharedCVs)
+
+		// Files of the local storage backend, authenticated by the presigned URL signature
+		api.GET("/files/*key", handlers.ServeLocalFile)
+
 		// SSE connection endpoint
 		api.GET("/sse/connect", handlers.SSEConnect)
 
@@ -85,30 +147,115 @@ func main() {
 		// Profile route - accessible to any authenticated user
 		api.GET("/profile", handlers.GetUserProfile)
 
+		// Ends the impersonation session of the calling impersonation token
+		api.POST("/impersonation/end", handlers.EndImpersonation)
+
+		// Personal data export and erasure requests for the calling user
+		me := api.Group("/me", middleware.UserOnly(), middleware.NotWhileImpersonating())
+		{
+			me.GET("/export", handlers.ExportMyData)
+			me.GET("/erasure-requests", handlers.GetMyErasureRequests)
+			me.POST("/erasure-requests", handlers.CreateErasureRequest)
+		}
+
 		// User routes with role-based access
 		users := api.Group("/users")
 		{
-			users.GET("", middleware.RoleMiddleware("Admin", "PM"), handlers.GetUsers)
-			users.GET("/paginated", middleware.AdminOnly(), handlers.GetUsersPaginated)
-			users.GET("/:id", middleware.AdminOrPMOrBUL(), handlers.GetUserByID)
-			users.GET("/department/:department_id", middleware.RoleMiddleware("Admin", "BUL/Lead"), handlers.GetUsersInDepartment) // Admin always has access
-			users.GET("/project/:project_id", middleware.RoleMiddleware("Admin", "PM"), handlers.GetUsersInProject)
-			users.GET("/role/:role", middleware.AdminOnly(), handlers.GetUsersByRole)
-			users.GET("/pm", middleware.AdminOnly(), handlers.GetPMUsers)
-
-			users.POST("", middleware.AdminOnly(), handlers.CreateUser)
-			users.PUT("/:id", middleware.AdminOnly(), handlers.UpdateUser)
-			users.DELETE("/:id", middleware.AdminOnly(), handlers.DeleteUser)
+			users.GET("", middleware.RequirePermission(authz.UsersRead), handlers.GetUsers)
+			users.GET("/paginated", middleware.RequirePermission(authz.UsersReadAll), handlers.GetUsersPaginated)
+			users.GET("/:id", middleware.RequirePermission(authz.UsersView), middleware.RequireUserAccess("id"), handlers.GetUserByID)
+			users.GET("/department/:department_id", middleware.RequirePermission(authz.UsersReadDepartment), middleware.RequireDepartmentAccess("department_id"), handlers.GetUsersInDepartment)
+			users.GET("/project/:project_id", middleware.RequirePermission(authz.UsersReadProject), middleware.RequireProjectManagement("project_id"), handlers.GetUsersInProject)
+			users.GET("/role/:role", middleware.RequirePermission(authz.UsersReadAll), handlers.GetUsersByRole)
+			users.GET("/pm", middleware.RequirePermission(authz.UsersReadAll), handlers.GetPMUsers)
+
+			users.POST("", middleware.NotWhileImpersonating(), middleware.RequirePermission(authz.UsersWrite), handlers.CreateUser)
+			users.PUT("/:id", middleware.NotWhileImpersonating(), middleware.RequirePermission(authz.UsersWrite), middleware.RequireUserAccess("id"), handlers.UpdateUser)
+			users.DELETE("/:id", middleware.RequirePermission(authz.UsersWrite), middleware.RequireUserAccess("id"), handlers.DeleteUser)
+			users.POST("/:id/restore", middleware.NotWhileImpersonating(), middleware.RequirePermission(authz.UsersWrite), middleware.RequireUserAccess("id"), handlers.RestoreUser)
 
 		}
 
 		// Department management routes with role-based access
-		departments := api.Group("/admin/departments")
+		departments := api.Group("/admin/departments", middleware.NotWhileImpersonating())
+		{
+			departments.GET("", middleware.RequirePermission(authz.DepartmentsManage), handlers.GetDepartmentsWithStats)
+			departments.POST("", middleware.RequirePermission(authz.DepartmentsManage), handlers.CreateDepartment)
+			departments.PUT("/:id", middleware.RequirePermission(authz.DepartmentsManage), handlers.UpdateDepartment)
+			departments.DELETE("/:id", middleware.RequirePermission(authz.DepartmentsManage), handlers.DeleteDepartment)
+		}
+
+		// Directory (LDAP / Active Directory) routes
+		directory := api.Group("/admin/directory", middleware.NotWhileImpersonating())
+		{
+			directory.POST("/sync", middleware.RequirePermission(authz.DirectorySync), handlers.TriggerDirectorySync)
+		}
+
+		// Role and permission management routes
+		roles := api.Group("/admin/roles", middleware.NotWhileImpersonating())
 		{
-			departments.GET("", middleware.AdminOnly(), handlers.GetDepartmentsWithStats)
-			departments.POST("", middleware.AdminOnly(), handlers.CreateDepartment)
-			departments.PUT("/:id", middleware.AdminOnly(), handlers.UpdateDepartment)
-			departments.DELETE("/:id", middleware.AdminOnly(), handlers.DeleteDepartment)
+			roles.GET("", middleware.RequirePermission(authz.RolesManage), handlers.GetRolesWithPermissions)
+			roles.POST("", middleware.RequirePermission(authz.RolesManage), handlers.CreateRole)
+			roles.PUT("/:id", middleware.RequirePermission(authz.RolesManage), handlers.UpdateRole)
+			roles.DELETE("/:id", middleware.RequirePermission(authz.RolesManage), handlers.DeleteRole)
+		}
+		api.GET("/admin/permissions", middleware.RequirePermission(authz.RolesManage), handlers.GetPermissions)
+
+		// Audit log routes
+		auditLog := api.Group("/admin/audit-log")
+		{
+			auditLog.GET("", middleware.RequirePermission(authz.AuditRead), handlers.GetAuditLog)
+			auditLog.GET("/export", middleware.RequirePermission(authz.AuditRead), handlers.ExportAuditLog)
+			auditLog.GET("/verify", middleware.RequirePermission(authz.AuditRead), handlers.VerifyAuditLog)
+		}
+
+		// Orphaned upload garbage collection (GET reports only, POST deletes unless ?dry_run=true)
+		uploadGC := api.Group("/admin/uploads/gc", middleware.RequirePermission(authz.StorageManage))
+		{
+			uploadGC.GET("", handlers.GetUploadGCReport)
+			uploadGC.POST("", middleware.NotWhileImpersonating(), handlers.RunUploadGC)
+		}
+
+		// Bulk CV import from a ZIP archive and a manifest CSV
+		cvImports := api.Group("/admin/cv-imports", middleware.UserOnly(), middleware.NotWhileImpersonating())
+		{
+			cvImports.POST("", middleware.RequirePermission(authz.CVImport), handlers.ImportCVs)
+		}
+
+		// Personal data erasure review routes
+		erasure := api.Group("/admin/erasure-requests", middleware.NotWhileImpersonating())
+		{
+			erasure.GET("", middleware.RequirePermission(authz.UsersErase), handlers.GetErasureRequests)
+			erasure.POST("/:id/approve", middleware.RequirePermission(authz.UsersErase), handlers.ApproveErasureRequest)
+			erasure.POST("/:id/reject", middleware.RequirePermission(authz.UsersErase), handlers.RejectErasureRequest)
+		}
+
+		// Duplicate user review routes
+		duplicates := api.Group("/admin/duplicates", middleware.NotWhileImpersonating())
+		{
+			duplicates.GET("", middleware.RequirePermission(authz.UsersMerge), handlers.GetDuplicates)
+			duplicates.POST("/scan", middleware.RequirePermission(authz.UsersMerge), handlers.RunDuplicateScan)
+			duplicates.POST("/:id/merge", middleware.RequirePermission(authz.UsersMerge), handlers.MergeDuplicate)
+			duplicates.POST("/:id/dismiss", middleware.RequirePermission(authz.UsersMerge), handlers.DismissDuplicate)
+		}
+
+		// Impersonation ("view as user") routes
+		impersonation := api.Group("/admin/impersonation", middleware.NotWhileImpersonating())
+		{
+			impersonation.POST("/:user_id", middleware.RequirePermission(authz.UsersImpersonate), handlers.StartImpersonation)
+			impersonation.GET("/sessions", middleware.RequirePermission(authz.UsersImpersonate), handlers.GetImpersonationSessions)
+			impersonation.GET("/sessions/:id/requests", middleware.RequirePermission(authz.UsersImpersonate), handlers.GetImpersonationRequests)
+		}
+
+		// Service account and API key routes
+		serviceAccounts := api.Group("/admin/service-accounts", middleware.NotWhileImpersonating())
+		{
+			serviceAccounts.GET("", middleware.RequirePermission(authz.ServiceAccountsManage), handlers.GetServiceAccounts)
+			serviceAccounts.POST("", middleware.RequirePermission(authz.ServiceAccountsManage), handlers.CreateServiceAccount)
+			serviceAccounts.DELETE("/:id", middleware.RequirePermission(authz.ServiceAccountsManage), handlers.DisableServiceAccount)
+			serviceAccounts.POST("/:id/keys", middleware.RequirePermission(authz.ServiceAccountsManage), handlers.CreateAPIKey)
+			serviceAccounts.DELETE("/:id/keys/:key_id", middleware.RequirePermission(authz.ServiceAccountsManage), handlers.RevokeAPIKey)
+			serviceAccounts.GET("/:id/keys/:key_id/usage", middleware.RequirePermission(authz.ServiceAccountsManage), handlers.GetAPIKeyUsage)
 		}
 
 		// CV routes with role-based access
@@ -117,19 +264,37 @@ func main() {
 			// All authenticated users can view their own CV
 			cvs.GET("/me", handlers.GetUserCV)
 
-			cvs.POST("/parse-cv", handlers.ParseCVFromFile)
+			cvs.POST("/parse-cv", middleware.UserOnly(), handlers.ParseCVFromFile)
+
+			// Compare parsed CV data with the caller's CV, then apply the accepted proposals
+			cvs.POST("/merge/preview", middleware.UserOnly(), handlers.PreviewCVMerge)
+			cvs.POST("/merge/apply", middleware.UserOnly(), handlers.ApplyCVMerge)
+
+			// The owner confirms AI-extracted and admin-edited data of their CV
+			cvs.POST("/verify", middleware.UserOnly(), middleware.NotWhileImpersonating(), handlers.VerifyCV)
 
 			// All authenticated users can create or update their own CV
 			cvs.POST("", handlers.CreateOrUpdateCV)
 
 			// Admin can delete any user's CV by user ID
-			cvs.DELETE("/user/:user_id", middleware.AdminOnly(), handlers.DeleteCV)
+			cvs.DELETE("/user/:user_id", middleware.RequirePermission(authz.CVWrite), middleware.RequireUserAccess("user_id"), handlers.DeleteCV)
 
 			// Admin can update any user's CV by user ID
-			cvs.PUT("/user/:user_id", middleware.AdminOnly(), handlers.AdminUpdateCV)
+			cvs.PUT("/user/:user_id", middleware.NotWhileImpersonating(), middleware.RequirePermission(authz.CVWrite), middleware.RequireUserAccess("user_id"), handlers.AdminUpdateCV)
+
+			// BUL and PM can view any CV by user ID (and service accounts with cv:read)
+			cvs.GET("/user/:user_id", middleware.RequirePermission(authz.CVRead), middleware.RequireUserAccess("user_id"), handlers.GetCVByUserID)
 
-			// BUL and PM can view any CV by user ID
-			cvs.GET("/user/:user_id", middleware.AdminOrPMOrBUL(), handlers.GetCVByUserID)
+			// Rank the CVs the caller can view against a job description
+			cvs.POST("/match", middleware.RequirePermission(authz.CVRead), handlers.MatchCVs)
+		}
+
+		// Expiring CV share links for customers
+		shareLinks := api.Group("/share-links", middleware.UserOnly(), middleware.NotWhileImpersonating(), middleware.RequirePermission(authz.CVShare))
+		{
+			shareLinks.GET("", handlers.GetShareLinks)
+			shareLinks.POST("", handlers.CreateShareLink)
+			shareLinks.DELETE("/:id", handlers.RevokeShareLink)
 		}
 
 		// CV Request routes with role-based access
@@ -137,41 +302,41 @@ func main() {
 		{
 			// All authenticated users can view and create CV update requests
 			requests.GET("", handlers.GetCVRequests)
-			requests.GET("/sent", middleware.RoleMiddleware("BUL/Lead", "PM"), handlers.GetSentCVRequests)
-			requests.GET("/sent/pm", middleware.PMOnly(), handlers.GetSentCVRequestsPM)
-			requests.GET("/sent/bul", middleware.BULOnly(), handlers.GetSentCVRequestsBUL)
-			requests.POST("", handlers.CreateCVRequest)
-			requests.PUT("/:id/status", middleware.AdminOrPMOrBUL(), handlers.UpdateCVRequestStatus)
+			requests.GET("/sent", middleware.RequirePermission(authz.RequestsReadSent), handlers.GetSentCVRequests)
+			requests.GET("/sent/pm", middleware.RequirePermission(authz.RequestsReadSentProject), handlers.GetSentCVRequestsPM)
+			requests.GET("/sent/bul", middleware.RequirePermission(authz.RequestsReadSentDepartment), handlers.GetSentCVRequestsBUL)
+			requests.POST("", middleware.RequirePermission(authz.RequestsCreate), handlers.CreateCVRequest)
+			requests.PUT("/:id/status", middleware.RequirePermission(authz.RequestsUpdateStatus), handlers.UpdateCVRequestStatus)
 			// Mark requests as read
 			requests.PUT("/:id/read", handlers.MarkCVRequestAsRead)
 			requests.PUT("/mark-all-read", handlers.MarkAllCVRequestsAsRead)
 			// Admin-only route to get all CV requests across all users
-			requests.GET("/admin/all", middleware.AdminOnly(), handlers.GetAllCVRequestsForAdmin)
+			requests.GET("/admin/all", middleware.RequirePermission(authz.RequestsReadAll), handlers.GetAllCVRequestsForAdmin)
 		}
 
 		// Project routes with role-based access
 		projects := api.Group("/projects")
 		{
-			projects.GET("", middleware.RoleMiddleware("Admin", "PM"), handlers.GetProjects)
-			projects.GET("/:id", middleware.AdminOrPMOrBUL(), handlers.GetProjectByID)
-			projects.GET("/members", middleware.PMOnly(), handlers.GetAllMembersOfAllProjects)
+			projects.GET("", middleware.RequirePermission(authz.ProjectsRead), handlers.GetProjects)
+			projects.GET("/:id", middleware.RequirePermission(authz.ProjectsView), handlers.GetProjectByID)
+			projects.GET("/members", middleware.RequirePermission(authz.ProjectsReadMembers), handlers.GetAllMembersOfAllProjects)
 
-			projects.POST("", middleware.RoleMiddleware("Admin", "PM"), handlers.CreateProject)
-			projects.PUT("/:id", middleware.RoleMiddleware("Admin", "PM"), handlers.UpdateProject)
-			projects.DELETE("/:id", middleware.RoleMiddleware("Admin", "PM"), handlers.DeleteProject)
+			projects.POST("", middleware.RequirePermission(authz.ProjectsWrite), handlers.CreateProject)
+			projects.PUT("/:id", middleware.RequirePermission(authz.ProjectsWrite), middleware.RequireProjectManagement("id"), handlers.UpdateProject)
+			projects.DELETE("/:id", middleware.RequirePermission(authz.ProjectsWrite), middleware.RequireProjectManagement("id"), handlers.DeleteProject)
 
-			projects.POST("/:id/members", middleware.RoleMiddleware("Admin", "PM"), handlers.AddProjectMember)
-			projects.DELETE("/:id/members/:userId", middleware.RoleMiddleware("Admin", "PM"), handlers.RemoveProjectMember)
+			projects.POST("/:id/members", middleware.RequirePermission(authz.ProjectsWrite), middleware.RequireProjectManagement("id"), handlers.AddProjectMember)
+			projects.DELETE("/:id/members/:userId", middleware.RequirePermission(authz.ProjectsWrite), middleware.RequireProjectManagement("id"), handlers.RemoveProjectMember)
 
 			// Admin-specific project routes
 			adminProjects := projects.Group("/admin")
 			{
-				adminProjects.POST("", middleware.AdminOnly(), handlers.CreateProjectWithPM)
+				adminProjects.POST("", middleware.RequirePermission(authz.ProjectsAssignPM), handlers.CreateProjectWithPM)
 			}
 		}
 
 		// Upload routes - accessible to all authenticated users
-		upload := api.Group("/upload")
+		upload := api.Group("/upload", middleware.UserOnly())
 		{
 			// CV profile photo upload (optimized for CV photos, 3:4 ratio, cv-photos folder)
 			upload.POST("/cv-photo", handlers.UploadCVPhoto)
@@ -180,10 +345,12 @@ func main() {
 		}
 
 		// AI service routes - accessible to all authenticated users
-		ai := api.Group("/ai")
+		ai := api.Group("/ai", middleware.UserOnly())
 		{
 			// Parse CV from file path
 			ai.POST("/parse-cv", handlers.ParseCVFromFile)
+			// Parse job status (the owner also gets parse_job SSE events)
+			ai.GET("/parse-jobs/:id", handlers.GetParseJob)
 		}
 
 		// Employee routes - accessible to all authenticated users
@@ -200,7 +367,7 @@ func main() {
 			// Get project management general information
 			generalInfo.GET("/project-management", handlers.GetGeneralInfoOfProjectManagement)
 			// Get admin dashboard statistics (Admin only)
-			generalInfo.GET("/admin-dashboard-stats", middleware.AdminOnly(), handlers.GetAdminDashboardStats)
+			generalInfo.GET("/admin-dashboard-stats", middleware.RequirePermission(authz.DashboardRead), handlers.GetAdminDashboardStats)
 		}
 	}
 
@@ -0,0 +1,99 @@
+package aiclient
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// States of the circuit breaker
+const (
+	StateClosed   = "closed"    // calls go through
+	StateOpen     = "open"      // calls fail fast until the cooldown ends
+	StateHalfOpen = "half_open" // one trial call decides whether to close or reopen
+)
+
+// breaker opens after a number of consecutive failures, so a down service costs callers nothing
+// instead of a connection timeout each. After the cooldown it lets a single trial call through.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu        sync.Mutex
+	state     string
+	failures  int
+	openUntil time.Time
+	trial     bool // a half-open trial call is in flight
+}
+
+func newBreaker(threshold int, cooldown time.Duration) *breaker {
+	return &breaker{threshold: threshold, cooldown: cooldown, state: StateClosed}
+}
+
+// allow reports whether a call may go through, and if not, when to try again
+func (b *breaker) allow() (bool, time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case StateOpen:
+		if time.Now().Before(b.openUntil) {
+			return false, b.openUntil
+		}
+		b.state = StateHalfOpen
+		b.trial = true
+		return true, time.Time{}
+	case StateHalfOpen:
+		if b.trial {
+			return false, time.Now().Add(b.cooldown)
+		}
+		b.trial = true
+		return true, time.Time{}
+	default:
+		return true, time.Time{}
+	}
+}
+
+// success closes the breaker
+func (b *breaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state != StateClosed {
+		log.Printf("AI service circuit breaker closed")
+	}
+	b.state = StateClosed
+	b.failures = 0
+	b.trial = false
+}
+
+// failure counts a failed call, opening the breaker at the threshold or when the trial call failed
+func (b *breaker) failure(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	if b.state == StateHalfOpen || b.failures >= b.threshold {
+		if b.state != StateOpen {
+			log.Printf("AI service circuit breaker opened for %s after %d failures: %v", b.cooldown, b.failures, err)
+		}
+		b.state = StateOpen
+		b.openUntil = time.Now().Add(b.cooldown)
+	}
+	b.trial = false
+}
+
+// release ends a call that says nothing about the service's health, e.g. one cancelled by the caller
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+}
+
+func (b *breaker) snapshot() (state string, failures int, openUntil time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state, b.failures, b.openUntil
+}
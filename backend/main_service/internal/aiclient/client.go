@@ -0,0 +1,407 @@
+// Package aiclient talks to the Python AI service. One long-lived client retries the failures a
+// restarting service causes, and a circuit breaker fails calls fast while the service is down.
+package aiclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vdt/cv-management/internal/models"
+)
+
+// Defaults used when the AI_SERVICE_* variables are not set
+const (
+	defaultURL              = "http://localhost:8000"
+	defaultTimeout          = 3 * time.Minute
+	defaultConnectTimeout   = 5 * time.Second
+	defaultRetries          = 2
+	defaultRetryDelay       = 1 * time.Second
+	defaultBreakerThreshold = 5
+	defaultBreakerCooldown  = 30 * time.Second
+	defaultProbeInterval    = 30 * time.Second
+)
+
+// probeTimeout bounds one health probe
+const probeTimeout = 5 * time.Second
+
+// maxErrorBody is how much of an error response is kept as its detail
+const maxErrorBody = 4 << 10
+
+// Errors of the client. ErrCircuitOpen and ErrUnavailable mean the service can't be reached,
+// ErrTimeout that it was reached but did not answer in time.
+var (
+	ErrCircuitOpen = errors.New("AI service circuit breaker is open")
+	ErrUnavailable = errors.New("AI service unavailable")
+	ErrTimeout     = errors.New("AI service timed out")
+)
+
+// ResponseError is an error answer of the AI service
+type ResponseError struct {
+	StatusCode int
+	Detail     string
+}
+
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("AI service returned error: %s (status: %d)", e.Detail, e.StatusCode)
+}
+
+// Temporary reports whether the same call may succeed later. Other errors are about the request itself.
+func (e *ResponseError) Temporary() bool {
+	return e.StatusCode >= 500 || e.StatusCode == http.StatusTooManyRequests
+}
+
+// retriable reports whether the service never got to handle the request, so sending it again is safe
+// and cheap: it was down, restarting or shedding load
+func (e *ResponseError) retriable() bool {
+	switch e.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable:
+		return true
+	}
+	return false
+}
+
+// Unreachable reports whether the error means the service is down, restarting or not deployed at all,
+// rather than failing on the request
+func Unreachable(err error) bool {
+	var respErr *ResponseError
+	if errors.As(err, &respErr) {
+		return respErr.StatusCode == http.StatusBadGateway || respErr.StatusCode == http.StatusServiceUnavailable
+	}
+	return errors.Is(err, ErrCircuitOpen) || errors.Is(err, ErrUnavailable)
+}
+
+// Config holds the configuration of a Client
+type Config struct {
+	BaseURL          string
+	Timeout          time.Duration // bound on one attempt
+	ConnectTimeout   time.Duration
+	Retries          int           // attempts after the first, only for failures the service never handled
+	RetryDelay       time.Duration // doubles after each retry
+	BreakerThreshold int           // consecutive failures opening the circuit breaker
+	BreakerCooldown  time.Duration // how long the breaker stays open before a trial call
+	ProbeInterval    time.Duration // interval of the health probes, 0 disables them
+}
+
+// Status describes the client's view of the service, for the health endpoint
+type Status struct {
+	State               string     `json:"state"`
+	Healthy             bool       `json:"healthy"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	OpenUntil           *time.Time `json:"open_until,omitempty"`
+	LastProbeAt         *time.Time `json:"last_probe_at,omitempty"`
+}
+
+// Client calls the AI service. It is safe for concurrent use.
+type Client struct {
+	config  Config
+	http    *http.Client
+	breaker *breaker
+
+	mu          sync.Mutex
+	lastProbeAt time.Time
+}
+
+// Default is the client configured at startup by Init
+var Default = New(Config{
+	BaseURL:          defaultURL,
+	Timeout:          defaultTimeout,
+	ConnectTimeout:   defaultConnectTimeout,
+	Retries:          defaultRetries,
+	RetryDelay:       defaultRetryDelay,
+	BreakerThreshold: defaultBreakerThreshold,
+	BreakerCooldown:  defaultBreakerCooldown,
+})
+
+// Init configures Default from AI_SERVICE_URL and the other AI_SERVICE_* variables and starts its health probes
+func Init() error {
+	config := Config{BaseURL: getEnv("AI_SERVICE_URL", defaultURL)}
+
+	var err error
+	if config.Timeout, err = durationEnv("AI_SERVICE_TIMEOUT", defaultTimeout); err != nil {
+		return err
+	}
+	if config.ConnectTimeout, err = durationEnv("AI_SERVICE_CONNECT_TIMEOUT", defaultConnectTimeout); err != nil {
+		return err
+	}
+	if config.Retries, err = intEnv("AI_SERVICE_RETRIES", defaultRetries); err != nil {
+		return err
+	}
+	if config.RetryDelay, err = durationEnv("AI_SERVICE_RETRY_DELAY", defaultRetryDelay); err != nil {
+		return err
+	}
+	if config.BreakerThreshold, err = intEnv("AI_SERVICE_BREAKER_THRESHOLD", defaultBreakerThreshold); err != nil {
+		return err
+	}
+	if config.BreakerCooldown, err = durationEnv("AI_SERVICE_BREAKER_COOLDOWN", defaultBreakerCooldown); err != nil {
+		return err
+	}
+	if config.ProbeInterval, err = durationEnv("AI_SERVICE_PROBE_INTERVAL", defaultProbeInterval); err != nil {
+		return err
+	}
+	if config.Timeout == 0 || config.ConnectTimeout == 0 {
+		return fmt.Errorf("AI_SERVICE_TIMEOUT and AI_SERVICE_CONNECT_TIMEOUT must be positive")
+	}
+	if config.BreakerThreshold < 1 {
+		return fmt.Errorf("invalid AI_SERVICE_BREAKER_THRESHOLD %d (must be at least 1)", config.BreakerThreshold)
+	}
+
+	Default = New(config)
+	if config.ProbeInterval > 0 {
+		go Default.runProbes()
+	}
+
+	fmt.Printf("Using AI service at %s\n", config.BaseURL)
+	return nil
+}
+
+// New creates a client. Its connections are kept alive across calls.
+func New(config Config) *Client {
+	config.BaseURL = strings.TrimSuffix(config.BaseURL, "/")
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{Timeout: config.ConnectTimeout, KeepAlive: 30 * time.Second}).DialContext
+	transport.MaxIdleConnsPerHost = 10
+
+	return &Client{
+		config:  config,
+		http:    &http.Client{Transport: transport},
+		breaker: newBreaker(config.BreakerThreshold, config.BreakerCooldown),
+	}
+}
+
+// ParseCV asks the service to parse the CV file at the path, which it reads from the shared volume
+func (c *Client) ParseCV(ctx context.Context, filePath string) (*models.AIServiceResponse, error) {
+	payload, err := json.Marshal(models.AIServiceRequest{FilePath: filePath})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	var response models.AIServiceResponse
+	if err := c.call(ctx, http.MethodPost, "/parse-cv", payload, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// ParseText asks the service to parse a CV from its text, for documents it can't read itself
+func (c *Client) ParseText(ctx context.Context, text string) (*models.AIServiceResponse, error) {
+	payload, err := json.Marshal(models.AIServiceTextRequest{Text: text})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	var response models.AIServiceResponse
+	if err := c.call(ctx, http.MethodPost, "/parse-text", payload, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// Available reports whether calls currently go through, and if not, when the breaker allows a trial call
+func (c *Client) Available() (bool, time.Time) {
+	state, _, openUntil := c.breaker.snapshot()
+	if state == StateOpen && time.Now().Before(openUntil) {
+		return false, openUntil
+	}
+	return true, time.Time{}
+}
+
+// Status returns the breaker state and the outcome of the last health probe
+func (c *Client) Status() Status {
+	state, failures, openUntil := c.breaker.snapshot()
+	status := Status{
+		State:               state,
+		Healthy:             state == StateClosed && failures == 0,
+		ConsecutiveFailures: failures,
+	}
+	if state == StateOpen {
+		status.OpenUntil = &openUntil
+	}
+
+	c.mu.Lock()
+	if !c.lastProbeAt.IsZero() {
+		lastProbeAt := c.lastProbeAt
+		status.LastProbeAt = &lastProbeAt
+	}
+	c.mu.Unlock()
+
+	return status
+}
+
+// call sends the request through the breaker, retrying failures the service never handled
+func (c *Client) call(ctx context.Context, method, path string, payload []byte, out any) error {
+	delay := c.config.RetryDelay
+	for attempt := 0; ; attempt++ {
+		allowed, retryAt := c.breaker.allow()
+		if !allowed {
+			return fmt.Errorf("%w until %s", ErrCircuitOpen, retryAt.Format(time.RFC3339))
+		}
+
+		err := c.attempt(ctx, method, path, payload, out)
+		c.record(ctx, err)
+		if err == nil || attempt >= c.config.Retries || !retriable(err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// attempt makes one HTTP call, bounded by the configured timeout
+func (c *Client) attempt(ctx context.Context, method, path string, payload []byte, out any) error {
+	attemptCtx, cancel := context.WithTimeout(ctx, c.config.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(attemptCtx, method, c.config.BaseURL+path, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return transportError(ctx, attemptCtx, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return &ResponseError{StatusCode: resp.StatusCode, Detail: strings.TrimSpace(string(body))}
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return transportError(ctx, attemptCtx, err)
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("failed to parse AI service response: %w", err)
+	}
+	return nil
+}
+
+// transportError classifies a failed exchange: the caller giving up, the attempt timing out, or the
+// service being unreachable
+func transportError(ctx, attemptCtx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if errors.Is(attemptCtx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %v", ErrTimeout, err)
+	}
+	return fmt.Errorf("%w: %v", ErrUnavailable, err)
+}
+
+// record feeds the outcome of an attempt to the breaker. Answers about the request itself show the
+// service is up; cancellations by the caller say nothing.
+func (c *Client) record(ctx context.Context, err error) {
+	var respErr *ResponseError
+	switch {
+	case err == nil:
+		c.breaker.success()
+	case ctx.Err() != nil:
+		c.breaker.release()
+	case errors.As(err, &respErr) && !respErr.Temporary():
+		c.breaker.success()
+	case errors.Is(err, ErrTimeout), errors.Is(err, ErrUnavailable), errors.As(err, &respErr):
+		c.breaker.failure(err)
+	default:
+		// Malformed response: the service answered, so it is up
+		c.breaker.success()
+	}
+}
+
+func retriable(err error) bool {
+	var respErr *ResponseError
+	if errors.As(err, &respErr) {
+		return respErr.retriable()
+	}
+	return errors.Is(err, ErrUnavailable)
+}
+
+// runProbes checks the service's health endpoint on an interval. Probes count like calls, so an idle
+// backend notices the service going down, and a successful probe closes an open breaker early.
+func (c *Client) runProbes() {
+	ticker := time.NewTicker(c.config.ProbeInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		c.probe()
+	}
+}
+
+func (c *Client) probe() {
+	ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.config.BaseURL+"/health", nil)
+	if err == nil {
+		var resp *http.Response
+		resp, err = c.http.Do(req)
+		if err == nil {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, maxErrorBody))
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				err = fmt.Errorf("%w: health check returned HTTP %d", ErrUnavailable, resp.StatusCode)
+			}
+		} else {
+			err = fmt.Errorf("%w: %v", ErrUnavailable, err)
+		}
+	}
+
+	if err != nil {
+		c.breaker.failure(err)
+	} else {
+		c.breaker.success()
+	}
+
+	c.mu.Lock()
+	c.lastProbeAt = time.Now()
+	c.mu.Unlock()
+}
+
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func durationEnv(key string, fallback time.Duration) (time.Duration, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil || parsed < 0 {
+		return 0, fmt.Errorf("invalid %s %q", key, value)
+	}
+	return parsed, nil
+}
+
+func intEnv(key string, fallback int) (int, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed < 0 {
+		return 0, fmt.Errorf("invalid %s %q", key, value)
+	}
+	return parsed, nil
+}
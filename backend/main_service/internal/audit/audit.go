@@ -0,0 +1,254 @@
+// Package audit records administrative and CV mutations in the append-only, hash-chained audit_log table.
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/vdt/cv-management/internal/database"
+)
+
+// Actor types stored in audit_log.actor_type
+const (
+	ActorUser   = "user"
+	ActorAPIKey = "api_key"
+	ActorSystem = "system"
+)
+
+// chainLockKey serialises appends so every row is chained to the row committed before it
+const chainLockKey = 7_310_031
+
+// Querier is the subset of pgx.Tx and pgxpool.Pool used to read snapshots
+type Querier interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// Entry describes one mutation. Before and After are stored as JSON; nil means "no state"
+// (e.g. Before of a creation). json.RawMessage values are stored unchanged.
+type Entry struct {
+	Action     string
+	TargetType string
+	TargetID   string
+	Before     any
+	After      any
+}
+
+// Actor identifies who performed a mutation
+type Actor struct {
+	Type           string
+	ID             string
+	ImpersonatorID string
+	IP             string
+	RequestID      string
+}
+
+// ActorFromContext returns the actor of the request (user, impersonated user or API key)
+func ActorFromContext(c *gin.Context) Actor {
+	actor := Actor{
+		Type:           ActorUser,
+		ID:             c.GetString("userID"),
+		ImpersonatorID: c.GetString("impersonatorID"),
+		IP:             c.ClientIP(),
+		RequestID:      c.GetString("requestID"),
+	}
+	if apiKeyID := c.GetString("apiKeyID"); apiKeyID != "" {
+		actor.Type = ActorAPIKey
+		actor.ID = apiKeyID
+	}
+	return actor
+}
+
+// SystemActor is used for mutations made by background jobs
+func SystemActor(job string) Actor {
+	return Actor{Type: ActorSystem, ID: job}
+}
+
+// RecordTx appends an entry inside the caller's transaction, so it is only kept if the mutation commits
+func RecordTx(ctx context.Context, tx pgx.Tx, actor Actor, entry Entry) error {
+	before, err := marshalState(entry.Before)
+	if err != nil {
+		return fmt.Errorf("error encoding audit before state: %w", err)
+	}
+	after, err := marshalState(entry.After)
+	if err != nil {
+		return fmt.Errorf("error encoding audit after state: %w", err)
+	}
+
+	// Held until the transaction ends, so rows are chained in commit order
+	if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", chainLockKey); err != nil {
+		return fmt.Errorf("error locking audit log: %w", err)
+	}
+
+	var prevHash string
+	err = tx.QueryRow(ctx, "SELECT hash FROM audit_log ORDER BY id DESC LIMIT 1").Scan(&prevHash)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("error reading last audit hash: %w", err)
+	}
+
+	row := Row{
+		CreatedAt:      time.Now().UTC().Truncate(time.Microsecond),
+		ActorType:      actor.Type,
+		ActorID:        actor.ID,
+		ImpersonatorID: actor.ImpersonatorID,
+		Action:         entry.Action,
+		TargetType:     entry.TargetType,
+		TargetID:       entry.TargetID,
+		Before:         before,
+		After:          after,
+		BeforeDigest:   payloadDigest(before),
+		AfterDigest:    payloadDigest(after),
+		IP:             actor.IP,
+		RequestID:      actor.RequestID,
+		PrevHash:       prevHash,
+	}
+	row.Hash = row.ComputeHash()
+
+	_, err = tx.Exec(ctx,
+		`INSERT INTO audit_log (created_at, actor_type, actor_id, impersonator_id, action, target_type, target_id,
+			before_data, after_data, before_digest, after_digest, ip, request_id, prev_hash, hash)
+		VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''), $5, $6, $7, NULLIF($8, '')::json, NULLIF($9, '')::json,
+			$10, $11, NULLIF($12, ''), NULLIF($13, ''), $14, $15)`,
+		row.CreatedAt, row.ActorType, row.ActorID, row.ImpersonatorID, row.Action, row.TargetType, row.TargetID,
+		row.Before, row.After, row.BeforeDigest, row.AfterDigest, row.IP, row.RequestID, row.PrevHash, row.Hash)
+	if err != nil {
+		return fmt.Errorf("error inserting audit log entry: %w", err)
+	}
+
+	return nil
+}
+
+// RecordWithActor appends an entry for an explicit actor in its own transaction
+func RecordWithActor(ctx context.Context, actor Actor, entry Entry) error {
+	tx, err := database.DB.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("error starting audit transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := RecordTx(ctx, tx, actor, entry); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// marshalState encodes a before/after state; json.RawMessage is kept byte for byte
+func marshalState(state any) (string, error) {
+	switch value := state.(type) {
+	case nil:
+		return "", nil
+	case json.RawMessage:
+		return string(value), nil
+	default:
+		data, err := json.Marshal(value)
+		if err != nil {
+			return "", err
+		}
+		if string(data) == "null" {
+			return "", nil
+		}
+		return string(data), nil
+	}
+}
+
+// RedactSubject removes the before/after states of every entry about a user: the entries targeting the
+// user or their CV, and the other entries whose states name the user (share links, merges, uploads...).
+// Project, role and department states only reference users by ID and are kept. The digests stay, so the
+// hash chain still verifies. It returns the number of redacted entries.
+func RedactSubject(ctx context.Context, tx pgx.Tx, userID string) (int64, error) {
+	tag, err := tx.Exec(ctx,
+		`UPDATE audit_log SET before_data = NULL, after_data = NULL, redacted_at = NOW()
+		WHERE redacted_at IS NULL AND (before_data IS NOT NULL OR after_data IS NOT NULL)
+		  AND ((target_type IN ('user', 'cv') AND target_id = $1)
+		    OR (target_type NOT IN ('project', 'role', 'department')
+		      AND (strpos(before_data::text, $1) > 0 OR strpos(after_data::text, $1) > 0)))`,
+		userID)
+	if err != nil {
+		return 0, fmt.Errorf("error redacting audit log entries of user %s: %w", userID, err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// Row is a stored audit log entry. Before and After are empty once the entry is redacted.
+type Row struct {
+	ID             int64      `json:"id"`
+	CreatedAt      time.Time  `json:"created_at"`
+	ActorType      string     `json:"actor_type"`
+	ActorID        string     `json:"actor_id,omitempty"`
+	ActorName      string     `json:"actor_name,omitempty"`
+	ImpersonatorID string     `json:"impersonator_id,omitempty"`
+	Action         string     `json:"action"`
+	TargetType     string     `json:"target_type"`
+	TargetID       string     `json:"target_id"`
+	Before         string     `json:"-"`
+	After          string     `json:"-"`
+	BeforeDigest   string     `json:"before_digest,omitempty"`
+	AfterDigest    string     `json:"after_digest,omitempty"`
+	RedactedAt     *time.Time `json:"redacted_at,omitempty"`
+	IP             string     `json:"ip,omitempty"`
+	RequestID      string     `json:"request_id,omitempty"`
+	PrevHash       string     `json:"prev_hash"`
+	Hash           string     `json:"hash"`
+}
+
+// MarshalJSON embeds the before/after states as JSON instead of strings
+func (r Row) MarshalJSON() ([]byte, error) {
+	type plainRow Row
+	return json.Marshal(struct {
+		plainRow
+		Before json.RawMessage `json:"before,omitempty"`
+		After  json.RawMessage `json:"after,omitempty"`
+	}{plainRow(r), rawOrNil(r.Before), rawOrNil(r.After)})
+}
+
+func rawOrNil(s string) json.RawMessage {
+	if s == "" {
+		return nil
+	}
+	return json.RawMessage(s)
+}
+
+// payloadDigest returns the SHA-256 of a before/after state, or "" for no state
+func payloadDigest(state string) string {
+	if state == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(state))
+	return hex.EncodeToString(sum[:])
+}
+
+// PayloadsMatch checks that the before/after states still present match their digests
+func (r Row) PayloadsMatch() bool {
+	return (r.Before == "" || payloadDigest(r.Before) == r.BeforeDigest) &&
+		(r.After == "" || payloadDigest(r.After) == r.AfterDigest)
+}
+
+// ComputeHash returns the SHA-256 chain hash of the row: every field plus the hash of the previous row.
+// The states are covered through their digests, so redacting them doesn't break the chain.
+func (r Row) ComputeHash() string {
+	// Encoding the fields as a JSON array keeps the input unambiguous whatever the values contain
+	canonical, _ := json.Marshal([]string{
+		r.PrevHash,
+		r.CreatedAt.UTC().Format(time.RFC3339Nano),
+		r.ActorType,
+		r.ActorID,
+		r.ImpersonatorID,
+		r.Action,
+		r.TargetType,
+		r.TargetID,
+		r.BeforeDigest,
+		r.AfterDigest,
+		r.IP,
+		r.RequestID,
+	})
+	sum := sha256.Sum256(canonical)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,178 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/vdt/cv-management/internal/database"
+)
+
+// Filter narrows an audit log query; empty fields are ignored
+type Filter struct {
+	ActorID    string
+	Action     string
+	TargetType string
+	TargetID   string
+	RequestID  string
+	From       *time.Time
+	To         *time.Time
+}
+
+const rowColumns = `a.id, a.created_at, a.actor_type, COALESCE(a.actor_id, ''), COALESCE(u.full_name, ''),
+	COALESCE(a.impersonator_id, ''), a.action, a.target_type, a.target_id,
+	COALESCE(a.before_data::text, ''), COALESCE(a.after_data::text, ''), a.before_digest, a.after_digest, a.redacted_at,
+	COALESCE(a.ip, ''), COALESCE(a.request_id, ''), a.prev_hash, a.hash`
+
+func scanRow(rows pgx.Rows) (Row, error) {
+	var row Row
+	err := rows.Scan(&row.ID, &row.CreatedAt, &row.ActorType, &row.ActorID, &row.ActorName,
+		&row.ImpersonatorID, &row.Action, &row.TargetType, &row.TargetID,
+		&row.Before, &row.After, &row.BeforeDigest, &row.AfterDigest, &row.RedactedAt, &row.IP, &row.RequestID, &row.PrevHash, &row.Hash)
+	return row, err
+}
+
+// where builds the WHERE clause and its arguments for a filter
+func (f Filter) where() (string, []any) {
+	var conditions []string
+	var args []any
+
+	add := func(condition string, value any) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if f.ActorID != "" {
+		add("(a.actor_id = $%d OR a.impersonator_id = $%[1]d)", f.ActorID)
+	}
+	if f.Action != "" {
+		add("a.action = $%d", f.Action)
+	}
+	if f.TargetType != "" {
+		add("a.target_type = $%d", f.TargetType)
+	}
+	if f.TargetID != "" {
+		add("a.target_id = $%d", f.TargetID)
+	}
+	if f.RequestID != "" {
+		add("a.request_id = $%d", f.RequestID)
+	}
+	if f.From != nil {
+		add("a.created_at >= $%d", *f.From)
+	}
+	if f.To != nil {
+		add("a.created_at < $%d", *f.To)
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return "WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// Query returns one page of matching entries (newest first) and the total number of matches
+func Query(ctx context.Context, filter Filter, limit, offset int) ([]Row, int, error) {
+	where, args := filter.where()
+
+	var total int
+	if err := database.DB.QueryRow(ctx, "SELECT COUNT(*) FROM audit_log a "+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("error counting audit log entries: %w", err)
+	}
+
+	args = append(args, limit, offset)
+	rows, err := database.DB.Query(ctx,
+		fmt.Sprintf(`SELECT %s
+		FROM audit_log a
+		LEFT JOIN users u ON a.actor_type = 'user' AND u.id::text = a.actor_id
+		%s
+		ORDER BY a.id DESC
+		LIMIT $%d OFFSET $%d`, rowColumns, where, len(args)-1, len(args)),
+		args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error querying audit log: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []Row{}
+	for rows.Next() {
+		row, err := scanRow(rows)
+		if err != nil {
+			return nil, 0, fmt.Errorf("error scanning audit log entry: %w", err)
+		}
+		entries = append(entries, row)
+	}
+
+	return entries, total, rows.Err()
+}
+
+// Each streams every matching entry (oldest first) to fn, for exports
+func Each(ctx context.Context, filter Filter, fn func(Row) error) error {
+	where, args := filter.where()
+
+	rows, err := database.DB.Query(ctx,
+		fmt.Sprintf(`SELECT %s
+		FROM audit_log a
+		LEFT JOIN users u ON a.actor_type = 'user' AND u.id::text = a.actor_id
+		%s
+		ORDER BY a.id`, rowColumns, where),
+		args...)
+	if err != nil {
+		return fmt.Errorf("error querying audit log: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		row, err := scanRow(rows)
+		if err != nil {
+			return fmt.Errorf("error scanning audit log entry: %w", err)
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// VerifyResult reports whether the hash chain is intact
+type VerifyResult struct {
+	Valid         bool   `json:"valid"`
+	CheckedRows   int    `json:"checked_rows"`
+	FirstBrokenID int64  `json:"first_broken_id,omitempty"`
+	Reason        string `json:"reason,omitempty"`
+}
+
+// Verify recomputes the whole hash chain and reports the first row that doesn't match
+func Verify(ctx context.Context) (*VerifyResult, error) {
+	result := &VerifyResult{Valid: true}
+	prevHash := ""
+
+	err := Each(ctx, Filter{}, func(row Row) error {
+		result.CheckedRows++
+
+		switch {
+		case row.PrevHash != prevHash:
+			result.Reason = "previous hash does not match the preceding row (row deleted or reordered)"
+		case !row.PayloadsMatch() || row.ComputeHash() != row.Hash:
+			result.Reason = "row content does not match its hash (row modified)"
+		default:
+			prevHash = row.Hash
+			return nil
+		}
+
+		result.Valid = false
+		result.FirstBrokenID = row.ID
+		return errStopVerify
+	})
+	if err != nil && !errors.Is(err, errStopVerify) {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// errStopVerify stops Each at the first broken row
+var errStopVerify = errors.New("stop verify")
@@ -0,0 +1,158 @@
+package audit
+
+import (
+	"context"
+	"testing"
+
+	"github.com/vdt/cv-management/internal/database"
+	"github.com/vdt/cv-management/internal/database/dbtest"
+)
+
+const testSubject = "0b9c6a4e-6f1e-4c55-9d43-1b0f3a7e2c10"
+
+// recordChain appends three entries, the middle one naming testSubject, and returns their IDs in order
+func recordChain(t *testing.T) []int64 {
+	t.Helper()
+	ctx := context.Background()
+
+	entries := []Entry{
+		{Action: "department.create", TargetType: "department", TargetID: "d1", After: map[string]any{"name": "Engineering"}},
+		{Action: "user.update", TargetType: "user", TargetID: testSubject,
+			Before: map[string]any{"full_name": "Nguyen Van A"}, After: map[string]any{"full_name": "Nguyen Van B"}},
+		{Action: "role.delete", TargetType: "role", TargetID: "r1", Before: map[string]any{"name": "Auditor"}},
+	}
+	for _, entry := range entries {
+		if err := RecordWithActor(ctx, SystemActor("test"), entry); err != nil {
+			t.Fatalf("recording %s: %v", entry.Action, err)
+		}
+	}
+
+	var ids []int64
+	rows, err := database.DB.Query(ctx, "SELECT id FROM audit_log ORDER BY id")
+	if err != nil {
+		t.Fatalf("listing entries: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			t.Fatalf("listing entries: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) != len(entries) {
+		t.Fatalf("got %d entries, want %d", len(ids), len(entries))
+	}
+	return ids
+}
+
+// tamper runs a statement on audit_log with its append-only triggers disabled, as someone with
+// direct access to the database could
+func tamper(t *testing.T, statement string, args ...any) {
+	t.Helper()
+	ctx := context.Background()
+
+	tx, err := database.DB.Begin(ctx)
+	if err != nil {
+		t.Fatalf("starting transaction: %v", err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, "ALTER TABLE audit_log DISABLE TRIGGER USER")
+	if err == nil {
+		_, err = tx.Exec(ctx, statement, args...)
+	}
+	if err == nil {
+		_, err = tx.Exec(ctx, "ALTER TABLE audit_log ENABLE TRIGGER USER")
+	}
+	if err != nil {
+		t.Fatalf("tampering with the audit log: %v", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		t.Fatalf("tampering with the audit log: %v", err)
+	}
+}
+
+func verify(t *testing.T) *VerifyResult {
+	t.Helper()
+	result, err := Verify(context.Background())
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	return result
+}
+
+func TestVerifyCleanChain(t *testing.T) {
+	dbtest.Setup(t)
+	recordChain(t)
+
+	if result := verify(t); !result.Valid || result.CheckedRows != 3 {
+		t.Fatalf("got %+v, want a valid chain of 3 rows", result)
+	}
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		statement string
+		// broken is the index of the entry Verify must report
+		broken int
+	}{
+		{"payload changed", `UPDATE audit_log SET after_data = '{"full_name":"Someone Else"}' WHERE id = $1`, 1},
+		{"row changed", "UPDATE audit_log SET action = 'user.read' WHERE id = $1", 1},
+		{"row deleted", "DELETE FROM audit_log WHERE id = $1", 2},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			dbtest.Setup(t)
+			ids := recordChain(t)
+
+			tamper(t, test.statement, ids[1])
+
+			result := verify(t)
+			if result.Valid || result.FirstBrokenID != ids[test.broken] {
+				t.Fatalf("got %+v, want the chain broken at row %d", result, ids[test.broken])
+			}
+		})
+	}
+}
+
+func TestVerifyAfterRedaction(t *testing.T) {
+	dbtest.Setup(t)
+	ctx := context.Background()
+	ids := recordChain(t)
+
+	tx, err := database.DB.Begin(ctx)
+	if err != nil {
+		t.Fatalf("starting transaction: %v", err)
+	}
+	defer tx.Rollback(ctx)
+	redacted, err := RedactSubject(ctx, tx, testSubject)
+	if err != nil {
+		t.Fatalf("redacting: %v", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		t.Fatalf("committing redaction: %v", err)
+	}
+	if redacted != 1 {
+		t.Fatalf("redacted %d entries, want only the one about the subject", redacted)
+	}
+
+	var before, after *string
+	err = database.DB.QueryRow(ctx, "SELECT before_data::text, after_data::text FROM audit_log WHERE id = $1", ids[1]).
+		Scan(&before, &after)
+	if err != nil {
+		t.Fatalf("reading redacted entry: %v", err)
+	}
+	if before != nil || after != nil {
+		t.Fatalf("redacted entry still has states %v, %v", before, after)
+	}
+
+	if result := verify(t); !result.Valid || result.CheckedRows != 3 {
+		t.Fatalf("got %+v after redaction, want a valid chain of 3 rows", result)
+	}
+
+	// The redact-only trigger still refuses anything else
+	if _, err := database.DB.Exec(ctx, "UPDATE audit_log SET action = 'user.read' WHERE id = $1", ids[1]); err == nil {
+		t.Fatalf("audit_log accepted an update that is not a redaction")
+	}
+}
@@ -0,0 +1,80 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Snapshot runs a query returning a single JSON value and returns it unchanged.
+// A missing row returns nil, which is stored as "no state".
+func Snapshot(ctx context.Context, q Querier, query string, args ...any) (json.RawMessage, error) {
+	var data *string
+	err := q.QueryRow(ctx, query, args...).Scan(&data)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && data == nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error taking audit snapshot: %w", err)
+	}
+	return json.RawMessage(*data), nil
+}
+
+// UserSnapshot returns a user with their role names (never the password hash)
+func UserSnapshot(ctx context.Context, q Querier, userID string) (json.RawMessage, error) {
+	return Snapshot(ctx, q,
+		`SELECT jsonb_build_object(
+			'user', to_jsonb(u) - 'password',
+			'roles', COALESCE((
+				SELECT jsonb_agg(r.name ORDER BY r.name)
+				FROM user_roles ur JOIN roles r ON r.id = ur.role_id
+				WHERE ur.user_id = u.id), '[]'::jsonb)
+		)::text
+		FROM users u WHERE u.id = $1`,
+		userID)
+}
+
+// CVSnapshot returns the complete CV of a user: status, details, education, courses and skills
+func CVSnapshot(ctx context.Context, q Querier, userID string) (json.RawMessage, error) {
+	return Snapshot(ctx, q,
+		`SELECT jsonb_build_object(
+			'cv', to_jsonb(cv),
+			'details', to_jsonb(d),
+			'education', COALESCE((SELECT jsonb_agg(to_jsonb(e) ORDER BY e.id) FROM cv_education e WHERE e.cv_id = d.id), '[]'::jsonb),
+			'courses', COALESCE((SELECT jsonb_agg(to_jsonb(co) ORDER BY co.id) FROM cv_courses co WHERE co.cv_id = d.id), '[]'::jsonb),
+			'skills', COALESCE((SELECT jsonb_agg(to_jsonb(s) ORDER BY s.id) FROM cv_skills s WHERE s.cv_id = d.id), '[]'::jsonb)
+		)::text
+		FROM cv
+		LEFT JOIN cv_details d ON d.cv_id = cv.id
+		WHERE cv.user_id = $1`,
+		userID)
+}
+
+// RoleSnapshot returns a role with its permissions
+func RoleSnapshot(ctx context.Context, q Querier, roleID string) (json.RawMessage, error) {
+	return Snapshot(ctx, q,
+		`SELECT jsonb_build_object(
+			'role', to_jsonb(r),
+			'permissions', COALESCE((
+				SELECT jsonb_agg(rp.permission ORDER BY rp.permission)
+				FROM role_permissions rp WHERE rp.role_id = r.id), '[]'::jsonb)
+		)::text
+		FROM roles r WHERE r.id = $1`,
+		roleID)
+}
+
+// ProjectSnapshot returns a project with its members (current and past)
+func ProjectSnapshot(ctx context.Context, q Querier, projectID string) (json.RawMessage, error) {
+	return Snapshot(ctx, q,
+		`SELECT jsonb_build_object(
+			'project', to_jsonb(p),
+			'members', COALESCE((
+				SELECT jsonb_agg(to_jsonb(pm) ORDER BY pm.joined_at, pm.user_id)
+				FROM project_members pm WHERE pm.project_id = p.id), '[]'::jsonb)
+		)::text
+		FROM projects p WHERE p.id = $1`,
+		projectID)
+}
@@ -0,0 +1,212 @@
+package authz
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/vdt/cv-management/internal/database"
+)
+
+// Permissions that decide which users and projects a caller can reach
+const (
+	UsersAccessAll        = "users:access_all"
+	UsersAccessDepartment = "users:access_department"
+	UsersAccessProject    = "users:access_project"
+	ProjectsManageAll     = "projects:manage_all"
+)
+
+// Resource types recorded in access_denials
+const (
+	ResourceUser       = "user"
+	ResourceDepartment = "department"
+	ResourceProject    = "project"
+)
+
+// callerUserID returns the user ID of the caller, or "" for API key requests
+func callerUserID(c *gin.Context) string {
+	return c.GetString("userID")
+}
+
+// CanAccessUser checks if the caller can read or change the data of the target user:
+//   - everybody can reach themselves
+//   - users:access_all reaches every user
+//   - users:access_department reaches users of the departments the caller is the manager of
+//   - users:access_project reaches current and past members of projects where the caller is the current PM
+//
+// API keys have no user of their own, so they reach users only when scoped with users:access_all:
+// a key scoped cv:read alone is denied every CV.
+func CanAccessUser(c *gin.Context, targetUserID string) (bool, error) {
+	callerID := callerUserID(c)
+	if callerID != "" && callerID == targetUserID {
+		return true, nil
+	}
+
+	if allowed, err := HasPermission(c, UsersAccessAll); err != nil || allowed {
+		return allowed, err
+	}
+
+	if callerID == "" || uuid.Validate(targetUserID) != nil {
+		return false, nil
+	}
+
+	if allowed, err := HasPermission(c, UsersAccessDepartment); err != nil {
+		return false, err
+	} else if allowed {
+		managed, err := isManagedDepartmentMember(c, callerID, targetUserID)
+		if err != nil || managed {
+			return managed, err
+		}
+	}
+
+	if allowed, err := HasPermission(c, UsersAccessProject); err != nil {
+		return false, err
+	} else if allowed {
+		return isManagedProjectMember(c, callerID, targetUserID)
+	}
+
+	return false, nil
+}
+
+// UserAccessFilter returns an SQL condition on the user ID column that selects the users the caller can
+// reach, following the same rules as CanAccessUser, with its arguments numbered from firstArg.
+// API keys without users:access_all get a condition matching nobody.
+func UserAccessFilter(c *gin.Context, column string, firstArg int) (string, []any, error) {
+	if allowed, err := HasPermission(c, UsersAccessAll); err != nil {
+		return "", nil, err
+	} else if allowed {
+		return "TRUE", nil, nil
+	}
+
+	callerID := callerUserID(c)
+	if callerID == "" {
+		return "FALSE", nil, nil
+	}
+
+	caller := fmt.Sprintf("$%d", firstArg)
+	conditions := []string{column + " = " + caller}
+	if allowed, err := HasPermission(c, UsersAccessDepartment); err != nil {
+		return "", nil, err
+	} else if allowed {
+		conditions = append(conditions, column+` IN (
+			SELECT target.id FROM users target
+			JOIN departments d ON d.id = target.department_id
+			WHERE d.manager_id = `+caller+`)`)
+	}
+	if allowed, err := HasPermission(c, UsersAccessProject); err != nil {
+		return "", nil, err
+	} else if allowed {
+		conditions = append(conditions, column+` IN (
+			SELECT member.user_id FROM project_members pm
+			JOIN project_members member ON member.project_id = pm.project_id
+			WHERE pm.user_id = `+caller+` AND pm.role_in_project = 'PM'
+			  AND (pm.left_at IS NULL OR pm.left_at > CURRENT_DATE))`)
+	}
+	return "(" + strings.Join(conditions, " OR ") + ")", []any{callerID}, nil
+}
+
+// CanAccessDepartment checks if the caller can list the users of a department:
+// users:access_all lists every department, users:access_department the ones the caller is the manager of
+func CanAccessDepartment(c *gin.Context, departmentID string) (bool, error) {
+	if allowed, err := HasPermission(c, UsersAccessAll); err != nil || allowed {
+		return allowed, err
+	}
+
+	callerID := callerUserID(c)
+	if callerID == "" || uuid.Validate(departmentID) != nil {
+		return false, nil
+	}
+
+	if allowed, err := HasPermission(c, UsersAccessDepartment); err != nil || !allowed {
+		return false, err
+	}
+
+	var manages bool
+	err := database.DB.QueryRow(c,
+		"SELECT EXISTS (SELECT 1 FROM departments WHERE id = $1 AND manager_id = $2)",
+		departmentID, callerID).Scan(&manages)
+	if err != nil {
+		return false, fmt.Errorf("error checking manager of department %s: %w", departmentID, err)
+	}
+
+	return manages, nil
+}
+
+// CanManageProject checks if the caller can change a project and its members:
+// projects:manage_all manages every project, otherwise the caller must be its current PM
+func CanManageProject(c *gin.Context, projectID string) (bool, error) {
+	if allowed, err := HasPermission(c, ProjectsManageAll); err != nil || allowed {
+		return allowed, err
+	}
+
+	callerID := callerUserID(c)
+	if callerID == "" || uuid.Validate(projectID) != nil {
+		return false, nil
+	}
+
+	var isPM bool
+	err := database.DB.QueryRow(c,
+		`SELECT EXISTS (
+			SELECT 1 FROM project_members
+			WHERE project_id = $1 AND user_id = $2 AND role_in_project = 'PM'
+			  AND (left_at IS NULL OR left_at > CURRENT_DATE)
+		)`,
+		projectID, callerID).Scan(&isPM)
+	if err != nil {
+		return false, fmt.Errorf("error checking PM of project %s: %w", projectID, err)
+	}
+
+	return isPM, nil
+}
+
+func isManagedDepartmentMember(ctx context.Context, callerID, targetUserID string) (bool, error) {
+	var member bool
+	err := database.DB.QueryRow(ctx,
+		`SELECT EXISTS (
+			SELECT 1 FROM users target
+			JOIN departments d ON d.id = target.department_id
+			WHERE d.manager_id = $1 AND target.id = $2
+		)`,
+		callerID, targetUserID).Scan(&member)
+	if err != nil {
+		return false, fmt.Errorf("error checking department of user %s: %w", targetUserID, err)
+	}
+	return member, nil
+}
+
+func isManagedProjectMember(ctx context.Context, callerID, targetUserID string) (bool, error) {
+	var member bool
+	err := database.DB.QueryRow(ctx,
+		`SELECT EXISTS (
+			SELECT 1 FROM project_members pm
+			JOIN project_members member ON member.project_id = pm.project_id
+			WHERE pm.user_id = $1 AND pm.role_in_project = 'PM' AND member.user_id = $2
+			  AND (pm.left_at IS NULL OR pm.left_at > CURRENT_DATE)
+		)`,
+		callerID, targetUserID).Scan(&member)
+	if err != nil {
+		return false, fmt.Errorf("error checking project membership of user %s: %w", targetUserID, err)
+	}
+	return member, nil
+}
+
+// RecordDenial stores a denied access attempt. Failures are only logged so they never change the response.
+func RecordDenial(c *gin.Context, resourceType, resourceID string) {
+	var userID, apiKeyID *string
+	if id := c.GetString("userID"); id != "" {
+		userID = &id
+	}
+	if id := c.GetString("apiKeyID"); id != "" {
+		apiKeyID = &id
+	}
+
+	_, err := database.DB.Exec(c,
+		`INSERT INTO access_denials (user_id, api_key_id, resource_type, resource_id, method, path, ip)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		userID, apiKeyID, resourceType, resourceID, c.Request.Method, c.Request.URL.Path, c.ClientIP())
+	if err != nil {
+		fmt.Printf("RecordDenial: Error recording denied access to %s %s: %v\n", resourceType, resourceID, err)
+	}
+}
@@ -0,0 +1,163 @@
+// Package authz resolves what a caller is allowed to do. Roles map to permissions
+// stored in the role_permissions table; API keys carry permissions directly as scopes.
+package authz
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vdt/cv-management/internal/database"
+)
+
+// Permissions checked by routes and handlers. The full list (with descriptions) lives in the permissions table.
+const (
+	UsersRead           = "users:read"
+	UsersReadAll        = "users:read_all"
+	UsersView           = "users:view"
+	UsersReadDepartment = "users:read_department"
+	UsersReadProject    = "users:read_project"
+	UsersWrite          = "users:write"
+
+	CVRead   = "cv:read"
+	CVWrite  = "cv:write"
+	CVShare  = "cv:share"
+	CVImport = "cv:import"
+
+	RequestsCreate             = "requests:create"
+	RequestsReadSent           = "requests:read_sent"
+	RequestsReadSentProject    = "requests:read_sent_project"
+	RequestsReadSentDepartment = "requests:read_sent_department"
+	RequestsUpdateStatus       = "requests:update_status"
+	RequestsReadAll            = "requests:read_all"
+
+	ProjectsRead        = "projects:read"
+	ProjectsReadAll     = "projects:read_all"
+	ProjectsView        = "projects:view"
+	ProjectsReadMembers = "projects:read_members"
+	ProjectsWrite       = "projects:write"
+	ProjectsAssignPM    = "projects:assign_pm"
+
+	DepartmentsManage     = "departments:manage"
+	DirectorySync         = "directory:sync"
+	ServiceAccountsManage = "service_accounts:manage"
+	RolesManage           = "roles:manage"
+	UsersImpersonate      = "users:impersonate"
+	AuditRead             = "audit:read"
+	UsersErase            = "users:erase"
+	UsersMerge            = "users:merge"
+	StorageManage         = "storage:manage"
+	DashboardRead         = "dashboard:read"
+)
+
+// cacheTTL bounds how long a permission change made on another instance takes to apply here
+const cacheTTL = time.Minute
+
+var cache struct {
+	sync.RWMutex
+	rolePermissions map[string][]string
+	loadedAt        time.Time
+}
+
+// Invalidate drops the cached role permissions so the next check reloads them
+func Invalidate() {
+	cache.Lock()
+	cache.rolePermissions = nil
+	cache.Unlock()
+}
+
+// rolePermissions returns the role name -> permissions map, reloading it when stale
+func rolePermissions(ctx context.Context) (map[string][]string, error) {
+	cache.RLock()
+	if cache.rolePermissions != nil && time.Since(cache.loadedAt) < cacheTTL {
+		defer cache.RUnlock()
+		return cache.rolePermissions, nil
+	}
+	cache.RUnlock()
+
+	rows, err := database.DB.Query(ctx,
+		`SELECT r.name, rp.permission
+		FROM role_permissions rp
+		JOIN roles r ON r.id = rp.role_id`)
+	if err != nil {
+		return nil, fmt.Errorf("error loading role permissions: %w", err)
+	}
+	defer rows.Close()
+
+	loaded := map[string][]string{}
+	for rows.Next() {
+		var role, permission string
+		if err := rows.Scan(&role, &permission); err != nil {
+			return nil, fmt.Errorf("error scanning role permission: %w", err)
+		}
+		loaded[role] = append(loaded[role], permission)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading role permissions: %w", err)
+	}
+
+	cache.Lock()
+	cache.rolePermissions = loaded
+	cache.loadedAt = time.Now()
+	cache.Unlock()
+
+	return loaded, nil
+}
+
+// PermissionsForRoles returns the union of the permissions granted to the roles
+func PermissionsForRoles(ctx context.Context, roles []string) ([]string, error) {
+	byRole, err := rolePermissions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var permissions []string
+	for _, role := range roles {
+		for _, permission := range byRole[role] {
+			if !slices.Contains(permissions, permission) {
+				permissions = append(permissions, permission)
+			}
+		}
+	}
+	slices.Sort(permissions)
+	return permissions, nil
+}
+
+// RolesHavePermission checks if any of the roles grants the permission
+func RolesHavePermission(ctx context.Context, roles []string, permission string) (bool, error) {
+	byRole, err := rolePermissions(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	for _, role := range roles {
+		if slices.Contains(byRole[role], permission) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// HasPermission checks the permission for the caller of the request:
+// the scopes of an API key (set by AuthMiddleware) or the permissions of the user's roles
+func HasPermission(c *gin.Context, permission string) (bool, error) {
+	if scopes, isAPIKey := c.Get("scopes"); isAPIKey {
+		scopeSlice, ok := scopes.([]string)
+		return ok && slices.Contains(scopeSlice, permission), nil
+	}
+
+	return RolesHavePermission(c, c.GetStringSlice("roles"), permission)
+}
+
+// IsValidPermission checks that the permission exists in the permissions table
+func IsValidPermission(ctx context.Context, permission string) (bool, error) {
+	var exists bool
+	err := database.DB.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM permissions WHERE name = $1)", permission).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("error checking permission %s: %w", permission, err)
+	}
+	return exists, nil
+}
@@ -0,0 +1,105 @@
+package authz
+
+import (
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Relationship is how a viewer relates to the owner of the CV they read
+type Relationship string
+
+const (
+	RelationshipSelf       Relationship = "self"
+	RelationshipAdmin      Relationship = "admin"
+	RelationshipDepartment Relationship = "department" // manager of the owner's department
+	RelationshipProject    Relationship = "project"    // PM of a project the owner is or was a member of
+	RelationshipExternal   Relationship = "external"   // anyone outside the company, e.g. through a share link
+)
+
+// Sensitive CV fields. Every other field is visible to anyone who can reach the CV.
+const (
+	CVFieldBirthday = "birthday"
+	CVFieldGender   = "gender"
+	CVFieldEmail    = "email"
+	CVFieldPhone    = "phone"
+	CVFieldAddress  = "address"
+	CVFieldPortrait = "portrait_path"
+	CVFieldFile     = "cv_path" // the uploaded original contains every field above
+)
+
+// cvFieldVisibility lists who can see each sensitive CV field. Staffing (PM) only needs
+// skills and experience; the BUL also manages the person and may need to contact them.
+var cvFieldVisibility = map[string][]Relationship{
+	CVFieldBirthday: {RelationshipSelf, RelationshipAdmin},
+	CVFieldGender:   {RelationshipSelf, RelationshipAdmin},
+	CVFieldAddress:  {RelationshipSelf, RelationshipAdmin},
+	CVFieldFile:     {RelationshipSelf, RelationshipAdmin},
+	CVFieldEmail:    {RelationshipSelf, RelationshipAdmin, RelationshipDepartment},
+	CVFieldPhone:    {RelationshipSelf, RelationshipAdmin, RelationshipDepartment},
+	CVFieldPortrait: {RelationshipSelf, RelationshipAdmin, RelationshipDepartment, RelationshipProject},
+}
+
+// CVFieldVisible checks if a viewer with the relationship can see the CV field
+func CVFieldVisible(field string, relationship Relationship) bool {
+	allowed, sensitive := cvFieldVisibility[field]
+	return !sensitive || slices.Contains(allowed, relationship)
+}
+
+// HiddenCVFields returns the sensitive CV fields the relationship can't see, sorted
+func HiddenCVFields(relationship Relationship) []string {
+	var hidden []string
+	for field := range cvFieldVisibility {
+		if !CVFieldVisible(field, relationship) {
+			hidden = append(hidden, field)
+		}
+	}
+	slices.Sort(hidden)
+	return hidden
+}
+
+// ViewerRelationship returns the closest relationship between the caller and the target user,
+// following the same rules as CanAccessUser. A caller matching none of them is treated as external.
+func ViewerRelationship(c *gin.Context, targetUserID string) (Relationship, error) {
+	callerID := callerUserID(c)
+	if callerID != "" && callerID == targetUserID {
+		return RelationshipSelf, nil
+	}
+
+	if allowed, err := HasPermission(c, UsersAccessAll); err != nil {
+		return "", err
+	} else if allowed {
+		return RelationshipAdmin, nil
+	}
+
+	if callerID == "" || uuid.Validate(targetUserID) != nil {
+		return RelationshipExternal, nil
+	}
+
+	if allowed, err := HasPermission(c, UsersAccessDepartment); err != nil {
+		return "", err
+	} else if allowed {
+		managed, err := isManagedDepartmentMember(c, callerID, targetUserID)
+		if err != nil {
+			return "", err
+		}
+		if managed {
+			return RelationshipDepartment, nil
+		}
+	}
+
+	if allowed, err := HasPermission(c, UsersAccessProject); err != nil {
+		return "", err
+	} else if allowed {
+		member, err := isManagedProjectMember(c, callerID, targetUserID)
+		if err != nil {
+			return "", err
+		}
+		if member {
+			return RelationshipProject, nil
+		}
+	}
+
+	return RelationshipExternal, nil
+}
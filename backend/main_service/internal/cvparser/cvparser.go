@@ -0,0 +1,65 @@
+// Package cvparser is a best-effort CV parser for PDFs with a text layer and for DOCX and ODT documents,
+// used when the AI service can't be reached. It reads the text and applies heuristics (section headings in
+// Vietnamese and English, labelled fields, email, phone and date patterns) to fill the AI service's
+// ResumeSchema. It also extracts the text of the documents the AI service can't read itself.
+package cvparser
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/vdt/cv-management/internal/models"
+)
+
+// ParserName identifies results of this parser
+const ParserName = "fallback"
+
+// minTextLength is the least text, spaces excluded, a document must have to be parsed. Scanned PDFs have none.
+const minTextLength = 50
+
+// Errors of ParseFile
+var (
+	ErrUnreadable = errors.New("unreadable document")
+	ErrNoText     = errors.New("document has no text")
+)
+
+// Result is a parsed CV in the ResumeSchema shape, with the confidence of each field from 0 (not found)
+// to 1, keyed by its JSON name
+type Result struct {
+	models.ParsedCV
+	Parser string `json:"parser"`
+}
+
+// ParseFile parses the PDF, DOCX or ODT file at the path
+func ParseFile(path, contentType string) (*Result, error) {
+	lines, err := ExtractFile(path, contentType)
+	if err != nil {
+		return nil, err
+	}
+	if len(strings.Join(strings.Fields(strings.Join(lines, "")), "")) < minTextLength {
+		return nil, ErrNoText
+	}
+	return Parse(lines), nil
+}
+
+// sizedFile is an open file with its size, as the PDF reader needs
+type sizedFile struct {
+	*os.File
+	size int64
+}
+
+func openSized(path string) (*sizedFile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	return &sizedFile{File: file, size: info.Size()}, nil
+}
@@ -0,0 +1,242 @@
+package cvparser
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/vdt/cv-management/internal/utils"
+)
+
+// maxDocumentXML bounds the uncompressed size of a document's main XML part, against ZIP bombs
+const maxDocumentXML = 32 << 20
+
+// Markers of the structure kept in the text of word processor documents, read by Parse and the AI service
+const (
+	headingMarker  = "## "
+	listItemMarker = "- "
+	cellSeparator  = " | "
+)
+
+// ErrUnsupported is returned for documents of other formats
+var ErrUnsupported = errors.New("unsupported document format")
+
+// ExtractFile returns the text of a PDF, DOCX or ODT file as lines. Word processor documents keep their
+// structure: headings start with "## ", list items with "- ", and the cells of a table row are joined by " | ".
+func ExtractFile(path, contentType string) ([]string, error) {
+	switch contentType {
+	case "application/pdf":
+		file, err := openSized(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		return ExtractText(file, file.size)
+	case utils.ContentTypeDOCX:
+		return extractArchive(path, "word/document.xml", docxLines)
+	case utils.ContentTypeODT:
+		return extractArchive(path, "content.xml", odtLines)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupported, contentType)
+	}
+}
+
+// extractArchive reads the lines of the XML part of a ZIP-based document
+func extractArchive(path, part string, lines func(*xml.Decoder) ([]string, error)) ([]string, error) {
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnreadable, err)
+	}
+	defer archive.Close()
+
+	for _, entry := range archive.File {
+		if entry.Name != part {
+			continue
+		}
+		content, err := entry.Open()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrUnreadable, err)
+		}
+		defer content.Close()
+
+		limited := &io.LimitedReader{R: content, N: maxDocumentXML}
+		result, err := lines(xml.NewDecoder(limited))
+		if limited.N <= 0 {
+			return nil, fmt.Errorf("%w: %s is larger than %d bytes", ErrUnreadable, part, maxDocumentXML)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrUnreadable, err)
+		}
+		return result, nil
+	}
+	return nil, fmt.Errorf("%w: missing %s", ErrUnreadable, part)
+}
+
+// documentWriter collects paragraphs into lines, joining the paragraphs of a table row into one line
+type documentWriter struct {
+	lines     []string
+	paragraph strings.Builder
+	heading   bool
+	listItem  bool
+	tableRow  []string // cells of the current row, nil outside tables
+	cell      []string // paragraphs of the current cell
+	tableRows int      // depth of nested rows
+}
+
+func (w *documentWriter) endParagraph() {
+	text := strings.Join(strings.Fields(w.paragraph.String()), " ")
+	w.paragraph.Reset()
+	heading, listItem := w.heading, w.listItem
+	w.heading, w.listItem = false, false
+	if text == "" {
+		return
+	}
+
+	if w.tableRows > 0 {
+		w.cell = append(w.cell, text)
+		return
+	}
+	switch {
+	case heading:
+		text = headingMarker + text
+	case listItem:
+		text = listItemMarker + text
+	}
+	w.lines = append(w.lines, text)
+}
+
+func (w *documentWriter) startRow() {
+	w.tableRows++
+	if w.tableRows == 1 {
+		w.tableRow = []string{}
+	}
+}
+
+func (w *documentWriter) endCell() {
+	if len(w.cell) > 0 {
+		w.tableRow = append(w.tableRow, strings.Join(w.cell, " "))
+	}
+	w.cell = nil
+}
+
+func (w *documentWriter) endRow() {
+	w.tableRows--
+	if w.tableRows == 0 && len(w.tableRow) > 0 {
+		w.lines = append(w.lines, strings.Join(w.tableRow, cellSeparator))
+		w.tableRow = nil
+	}
+}
+
+// docxLines reads the body of a WordprocessingML document. Headings are paragraphs with a heading style
+// or an outline level, list items are numbered paragraphs.
+func docxLines(decoder *xml.Decoder) ([]string, error) {
+	var w documentWriter
+	inText := false
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return w.lines, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch element := token.(type) {
+		case xml.StartElement:
+			switch element.Name.Local {
+			case "t":
+				inText = true
+			case "tab":
+				w.paragraph.WriteByte(' ')
+			case "br", "cr":
+				w.paragraph.WriteByte(' ')
+			case "pStyle":
+				style := strings.ToLower(attr(element, "val"))
+				w.heading = w.heading || strings.HasPrefix(style, "heading")
+			case "outlineLvl":
+				w.heading = true
+			case "numPr":
+				w.listItem = true
+			case "tr":
+				w.startRow()
+			}
+		case xml.EndElement:
+			switch element.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				w.endParagraph()
+			case "tc":
+				w.endCell()
+			case "tr":
+				w.endRow()
+			}
+		case xml.CharData:
+			if inText {
+				w.paragraph.Write(element)
+			}
+		}
+	}
+}
+
+// odtLines reads the body of an OpenDocument text. Headings are text:h elements and list items the
+// paragraphs of text:list-item elements.
+func odtLines(decoder *xml.Decoder) ([]string, error) {
+	var w documentWriter
+	inBody, listDepth := false, 0
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return w.lines, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch element := token.(type) {
+		case xml.StartElement:
+			switch element.Name.Local {
+			case "body":
+				inBody = true
+			case "h":
+				w.heading = true
+			case "p":
+				w.listItem = listDepth > 0
+			case "list-item":
+				listDepth++
+			case "tab", "line-break", "s":
+				w.paragraph.WriteByte(' ')
+			case "table-row":
+				w.startRow()
+			}
+		case xml.EndElement:
+			switch element.Name.Local {
+			case "h", "p":
+				w.endParagraph()
+			case "list-item":
+				listDepth--
+			case "table-cell":
+				w.endCell()
+			case "table-row":
+				w.endRow()
+			}
+		case xml.CharData:
+			// Text outside the body belongs to styles and declarations
+			if inBody {
+				w.paragraph.Write(element)
+			}
+		}
+	}
+}
+
+func attr(element xml.StartElement, name string) string {
+	for _, attribute := range element.Attr {
+		if attribute.Name.Local == name {
+			return attribute.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,616 @@
+package cvparser
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/vdt/cv-management/internal/models"
+	"github.com/vdt/cv-management/internal/utils"
+)
+
+// Sections of a CV
+const (
+	sectionHeader     = "header" // before the first heading: name, title, contact details
+	sectionSummary    = "summary"
+	sectionEducation  = "education"
+	sectionCourses    = "courses"
+	sectionSkills     = "skills"
+	sectionExperience = "experience"
+	sectionPersonal   = "personal"
+	sectionOther      = "other"
+)
+
+// Limits on list items, so a misdetected section can't flood the CV
+const (
+	maxEducation = 10
+	maxCourses   = 30
+	maxSkills    = 50
+	maxSummary   = 1000
+)
+
+// Confidence of values by how they were found
+const (
+	confidenceLabelled = 0.9  // after a label such as "Email:" or "Ngày sinh:"
+	confidencePattern  = 0.8  // matched a pattern anywhere in the text
+	confidenceSection  = 0.6  // taken from the section under a recognized heading
+	confidenceGuess    = 0.45 // guessed from position, e.g. the name as the first line
+)
+
+// sectionHeadings maps normalized headings (see utils.NormalizeText) to their section
+var sectionHeadings = map[string]string{
+	"gioi thieu":              sectionSummary,
+	"gioi thieu ban than":     sectionSummary,
+	"tom tat":                 sectionSummary,
+	"muc tieu":                sectionSummary,
+	"muc tieu nghe nghiep":    sectionSummary,
+	"summary":                 sectionSummary,
+	"professional summary":    sectionSummary,
+	"profile":                 sectionSummary,
+	"objective":               sectionSummary,
+	"career objective":        sectionSummary,
+	"about me":                sectionSummary,
+	"hoc van":                 sectionEducation,
+	"trinh do hoc van":        sectionEducation,
+	"qua trinh hoc tap":       sectionEducation,
+	"education":               sectionEducation,
+	"academic background":     sectionEducation,
+	"chung chi":               sectionCourses,
+	"khoa hoc":                sectionCourses,
+	"chung chi khoa hoc":      sectionCourses,
+	"dao tao":                 sectionCourses,
+	"certifications":          sectionCourses,
+	"certificates":            sectionCourses,
+	"certification":           sectionCourses,
+	"courses":                 sectionCourses,
+	"training":                sectionCourses,
+	"licenses certifications": sectionCourses,
+	"ky nang":                 sectionSkills,
+	"ky nang chuyen mon":      sectionSkills,
+	"skills":                  sectionSkills,
+	"technical skills":        sectionSkills,
+	"technologies":            sectionSkills,
+	"kinh nghiem":             sectionExperience,
+	"kinh nghiem lam viec":    sectionExperience,
+	"qua trinh cong tac":      sectionExperience,
+	"experience":              sectionExperience,
+	"work experience":         sectionExperience,
+	"professional experience": sectionExperience,
+	"employment history":      sectionExperience,
+	"du an":                   sectionExperience,
+	"projects":                sectionExperience,
+	"thong tin ca nhan":       sectionPersonal,
+	"thong tin lien he":       sectionPersonal,
+	"lien he":                 sectionPersonal,
+	"personal information":    sectionPersonal,
+	"personal details":        sectionPersonal,
+	"contact":                 sectionPersonal,
+	"contact information":     sectionPersonal,
+	"so thich":                sectionOther,
+	"hobbies":                 sectionOther,
+	"interests":               sectionOther,
+	"hoat dong":               sectionOther,
+	"activities":              sectionOther,
+	"giai thuong":             sectionOther,
+	"awards":                  sectionOther,
+	"nguoi tham chieu":        sectionOther,
+	"references":              sectionOther,
+	"ngoai ngu":               sectionOther,
+	"languages":               sectionOther,
+}
+
+// Labels of single fields, normalized
+var (
+	fullNameLabels = []string{"ho ten", "ho va ten", "ten", "full name", "name"}
+	jobTitleLabels = []string{"vi tri", "vi tri ung tuyen", "vi tri mong muon", "chuc danh", "chuc vu", "position",
+		"job title", "title", "desired position"}
+	birthdayLabels = []string{"ngay sinh", "sinh ngay", "date of birth", "dob", "birthday", "birth date"}
+	genderLabels   = []string{"gioi tinh", "gender", "sex"}
+	emailLabels    = []string{"email", "e mail", "thu dien tu"}
+	phoneLabels    = []string{"dien thoai", "so dien thoai", "sdt", "dt", "phone", "phone number", "mobile", "tel"}
+	addressLabels  = []string{"dia chi", "noi o", "cho o hien tai", "address", "location"}
+	majorLabels    = []string{"chuyen nganh", "nganh", "nganh hoc", "major"}
+)
+
+// documentTitles are header lines naming the document rather than the candidate
+var documentTitles = []string{"curriculum vitae", "cv", "resume", "so yeu ly lich", "ho so ca nhan", "ho so xin viec"}
+
+// schoolWords mark the line naming a school, which starts an education entry
+var schoolWords = []string{"dai hoc", "truong", "hoc vien", "cao dang", "university", "college", "institute",
+	"academy", "school"}
+
+// degrees maps normalized degree words to the degree reported
+var degrees = []struct {
+	words  string
+	degree string
+}{
+	{"cu nhan", "Cử nhân"},
+	{"ky su", "Kỹ sư"},
+	{"thac si", "Thạc sĩ"},
+	{"tien si", "Tiến sĩ"},
+	{"bachelor", "Bachelor"},
+	{"master", "Master"},
+	{"phd", "PhD"},
+	{"doctor", "PhD"},
+	{"engineer", "Engineer"},
+}
+
+// monthNames are the English month abbreviations; periodStart is the day and month before a year
+const (
+	monthNames  = `jan|feb|mar|apr|may|jun|jul|aug|sep|oct|nov|dec`
+	periodStart = `(?:(?:` + monthNames + `)[a-z]*\.?,?\s+|(?:\d{1,2}[/.\-]){1,2})?`
+)
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+	// Vietnamese mobile and landline numbers, with or without the country code
+	phonePattern = regexp.MustCompile(`(?:\+84|\b84|\b0)(?:[\s.\-]?\d){8,10}\b`)
+	// Any phone number after a label
+	labelledPhonePattern = regexp.MustCompile(`\+?\d[\d\s.\-()]{7,}\d`)
+	datePattern          = regexp.MustCompile(`\b(\d{1,2})[/.\-](\d{1,2})[/.\-](\d{4})\b|\b(\d{4})-(\d{1,2})-(\d{1,2})\b`)
+	monthYearPattern     = regexp.MustCompile(`\b(\d{1,2})[/.\-](\d{4})\b`)
+	yearPattern          = regexp.MustCompile(`\b(19[5-9]\d|20\d\d)\b`)
+	monthNamePattern     = regexp.MustCompile(`(?i)\b(` + monthNames + `)[a-z]*\.?,?\s+((?:19|20)\d\d)\b`)
+	// Year ranges and dates, stripped from names of schools and courses
+	periodPattern = regexp.MustCompile(`(?i)[\s(,|–\-]*` + periodStart + `\b(?:19|20)\d\d\b` +
+		`(?:\s*[–\-]\s*(?:` + periodStart + `(?:19|20)\d\d\b|nay|hiện tại|hiện nay|present|now))?[\s)]*`)
+	// End of the major after a degree, as in "Bachelor of Science at UET, 2020"
+	majorEnd = regexp.MustCompile(`(?i)\s+(?:at|tại|[-–])\s+|,`)
+	// Separators of the parts of a course line
+	coursePartSeparator = regexp.MustCompile(`\s+[-–|]\s+|\s*\|\s*`)
+	// Numbering of headings, e.g. "2." or "II."
+	headingNumber = regexp.MustCompile(`^(?:[ivx]+|\d+)\s+`)
+	bulletPattern = regexp.MustCompile(`^[\s•●○◦▪■□►▶➢✓✔\-*·–]+`)
+)
+
+// Parse fills a Result from the lines of a CV's text
+func Parse(lines []string) *Result {
+	result := &Result{
+		ParsedCV: models.ParsedCV{
+			Education:  []models.CVEducationRequest{},
+			Courses:    []models.CVCourseRequest{},
+			Skills:     []models.CVSkillRequest{},
+			Confidence: map[string]float64{},
+		},
+		Parser: ParserName,
+	}
+
+	sections := splitSections(lines)
+	parseContact(result, lines)
+	parseHeader(result, sections[sectionHeader])
+
+	if summary := sections[sectionSummary]; len(summary) > 0 {
+		text := strings.Join(summary, " ")
+		if runes := []rune(text); len(runes) > maxSummary {
+			text = string(runes[:maxSummary])
+		}
+		result.Summary = text
+		result.Confidence["summary"] = confidenceSection
+	}
+
+	result.Education = parseEducation(sections[sectionEducation])
+	result.Courses = parseCourses(sections[sectionCourses])
+	result.Skills = parseSkills(sections[sectionSkills])
+	if len(result.Education) > 0 {
+		result.Confidence["education"] = confidenceSection
+	}
+	if len(result.Courses) > 0 {
+		result.Confidence["courses"] = confidenceSection
+	}
+	if len(result.Skills) > 0 {
+		result.Confidence["skills"] = confidenceSection
+	}
+
+	for _, field := range []string{"full_name", "job_title", "summary", "birthday", "gender", "email", "phone",
+		"address", "education", "courses", "skills"} {
+		if _, found := result.Confidence[field]; !found {
+			result.Confidence[field] = 0
+		}
+	}
+	return result
+}
+
+// splitSections groups the lines by the section heading above them. Text after a heading's colon, as in
+// "Kỹ năng: Go, SQL", belongs to the section.
+func splitSections(lines []string) map[string][]string {
+	sections := map[string][]string{}
+	current := sectionHeader
+	for _, line := range lines {
+		line = strings.Join(strings.Fields(line), " ")
+		if line == "" {
+			continue
+		}
+
+		// Headings of word processor documents are marked, so they need not be in capitals
+		marked := strings.HasPrefix(line, headingMarker)
+		line = strings.TrimPrefix(line, headingMarker)
+		if section, rest, ok := sectionHeading(line, marked); ok {
+			current = section
+			if rest == "" {
+				continue
+			}
+			line = rest
+		}
+		sections[current] = append(sections[current], line)
+	}
+	return sections
+}
+
+// sectionHeading recognizes a heading line. A heading with more words (e.g. "KỸ NĂNG LẬP TRÌNH") must be
+// in capitals, end with a colon or be marked as a heading, so that body text starting with the same words
+// is not taken for one.
+func sectionHeading(line string, marked bool) (section, rest string, ok bool) {
+	head, rest, hasColon := strings.Cut(line, ":")
+	rest = strings.TrimSpace(rest)
+	normalized := headingNumber.ReplaceAllString(utils.NormalizeText(head), "")
+	if normalized == "" || len(strings.Fields(normalized)) > 5 {
+		return "", "", false
+	}
+
+	if section, found := sectionHeadings[normalized]; found {
+		return section, rest, true
+	}
+	if !hasColon && !marked && strings.ToUpper(head) != head {
+		return "", "", false
+	}
+	for heading, section := range sectionHeadings {
+		if strings.HasPrefix(normalized, heading+" ") {
+			return section, rest, true
+		}
+	}
+	return "", "", false
+}
+
+// labelValue returns the value after a "label:" prefix when the label is one of the given ones
+func labelValue(line string, labels []string) (string, bool) {
+	label, value, found := strings.Cut(line, ":")
+	if !found {
+		return "", false
+	}
+	value = strings.TrimSpace(value)
+	return value, value != "" && slices.Contains(labels, utils.NormalizeText(label))
+}
+
+// parseContact looks for labelled fields and email and phone patterns across the whole text
+func parseContact(result *Result, lines []string) {
+	// Contact details are often laid out in a table, one per cell
+	var cells []string
+	for _, line := range lines {
+		cells = append(cells, strings.Split(line, cellSeparator)...)
+	}
+	lines = cells
+
+	for _, line := range lines {
+		line = strings.TrimSpace(bulletPattern.ReplaceAllString(line, ""))
+
+		if value, ok := labelValue(line, fullNameLabels); ok && result.FullName == "" {
+			setField(result, "full_name", &result.FullName, value, confidenceLabelled)
+		}
+		if value, ok := labelValue(line, jobTitleLabels); ok && result.JobTitle == "" {
+			setField(result, "job_title", &result.JobTitle, value, confidenceLabelled)
+		}
+		if value, ok := labelValue(line, birthdayLabels); ok && result.Birthday == "" {
+			if date := parseDate(value); date != "" {
+				setField(result, "birthday", &result.Birthday, date, confidenceLabelled)
+			}
+		}
+		if value, ok := labelValue(line, genderLabels); ok && result.Gender == "" {
+			if gender := parseGender(value); gender != "" {
+				setField(result, "gender", &result.Gender, gender, confidenceLabelled)
+			}
+		}
+		if value, ok := labelValue(line, addressLabels); ok && result.Address == "" {
+			setField(result, "address", &result.Address, value, confidenceLabelled)
+		}
+		if value, ok := labelValue(line, emailLabels); ok && result.Email == "" {
+			if email := emailPattern.FindString(value); email != "" {
+				setField(result, "email", &result.Email, email, confidenceLabelled)
+			}
+		}
+		if value, ok := labelValue(line, phoneLabels); ok && result.Phone == "" {
+			if phone := labelledPhonePattern.FindString(value); phone != "" {
+				setField(result, "phone", &result.Phone, normalizePhone(phone), confidenceLabelled)
+			}
+		}
+	}
+
+	// Unlabelled contact details, common in headers like "a@b.com | 0912 345 678"
+	for _, line := range lines {
+		if result.Email == "" {
+			if email := emailPattern.FindString(line); email != "" {
+				setField(result, "email", &result.Email, email, confidencePattern)
+			}
+		}
+		if result.Phone == "" {
+			if phone := phonePattern.FindString(line); phone != "" {
+				setField(result, "phone", &result.Phone, normalizePhone(phone), confidencePattern)
+			}
+		}
+	}
+}
+
+// parseHeader guesses the name and job title from the lines above the first section: the name is the
+// first line that looks like one, and the title the line right after it
+func parseHeader(result *Result, header []string) {
+	for i, line := range header {
+		if i >= 6 {
+			break
+		}
+		if !looksLikeName(line) {
+			continue
+		}
+
+		if result.FullName == "" {
+			setField(result, "full_name", &result.FullName, titleCase(line), confidenceGuess)
+		}
+		if result.JobTitle == "" && i+1 < len(header) && looksLikeTitle(header[i+1]) {
+			setField(result, "job_title", &result.JobTitle, header[i+1], confidenceGuess)
+		}
+		return
+	}
+}
+
+func looksLikeName(line string) bool {
+	if strings.ContainsAny(line, ":@|/0123456789") || slices.Contains(documentTitles, utils.NormalizeText(line)) {
+		return false
+	}
+	words := strings.Fields(line)
+	if len(words) < 2 || len(words) > 6 {
+		return false
+	}
+	for _, word := range words {
+		first := []rune(word)[0]
+		if !unicode.IsLetter(first) || !unicode.IsUpper(first) {
+			return false
+		}
+	}
+	return true
+}
+
+func looksLikeTitle(line string) bool {
+	return !strings.ContainsAny(line, ":@0123456789") && len(strings.Fields(line)) <= 8
+}
+
+// parseEducation reads education entries. A line naming a school starts an entry; the lines until the
+// next one give its degree, major and graduation year.
+func parseEducation(lines []string) []models.CVEducationRequest {
+	entries := []models.CVEducationRequest{}
+	var entryLines [][]string
+	// Lines above a school belong to its entry when they give the degree, as in "Bachelor of Science" over
+	// "Hanoi University", or come before the first school
+	var pending []string
+	for i, line := range lines {
+		line = strings.TrimSpace(bulletPattern.ReplaceAllString(line, ""))
+		if line == "" {
+			continue
+		}
+		if degree, _ := parseDegree(line); degree != "" && !isSchool(line) && i+1 < len(lines) && isSchool(lines[i+1]) {
+			pending = append(pending, line)
+			continue
+		}
+		if isSchool(line) && len(entries) < maxEducation {
+			entries = append(entries, models.CVEducationRequest{Organization: stripPeriod(line)})
+			entryLines = append(entryLines, append(pending, line))
+			pending = nil
+			continue
+		}
+		if len(entryLines) > 0 {
+			entryLines[len(entryLines)-1] = append(entryLines[len(entryLines)-1], line)
+		} else {
+			pending = append(pending, line)
+		}
+	}
+
+	for i := range entries {
+		entry := &entries[i]
+		var degreeMajor string
+		for _, line := range entryLines[i] {
+			if value, ok := labelValue(line, majorLabels); ok && entry.Major == nil {
+				major := stripPeriod(value)
+				entry.Major = &major
+			}
+			if entry.Degree == nil {
+				if degree, major := parseDegree(line); degree != "" {
+					entry.Degree = &degree
+					degreeMajor = major
+				}
+			}
+			for _, match := range yearPattern.FindAllString(line, -1) {
+				year, _ := strconv.Atoi(match)
+				if entry.GraduationYear == nil || year > *entry.GraduationYear {
+					entry.GraduationYear = &year
+				}
+			}
+		}
+		// A labelled major beats the words after the degree
+		if entry.Major == nil && degreeMajor != "" {
+			entry.Major = &degreeMajor
+		}
+	}
+	return entries
+}
+
+func isSchool(line string) bool {
+	normalized := " " + utils.NormalizeText(line) + " "
+	for _, word := range schoolWords {
+		if strings.Contains(normalized, " "+word+" ") {
+			return true
+		}
+	}
+	return false
+}
+
+// parseDegree finds a degree at the start of the line and returns it with the words after it as the
+// major, as in "Cử nhân Công nghệ thông tin" or "Bachelor of Computer Science"
+func parseDegree(line string) (degree, major string) {
+	words := strings.Fields(stripPeriod(line))
+	normalized := make([]string, len(words))
+	for i, word := range words {
+		// "Bachelor’s" normalizes to "bachelor s"
+		normalized[i], _, _ = strings.Cut(utils.NormalizeText(word), " ")
+	}
+
+	for _, candidate := range degrees {
+		degreeWords := strings.Fields(candidate.words)
+		if len(normalized) < len(degreeWords) || strings.Join(normalized[:len(degreeWords)], " ") != candidate.words {
+			continue
+		}
+
+		rest := words[len(degreeWords):]
+		for len(rest) > 0 && slices.Contains([]string{"of", "in", "nganh", "chuyen", "s", "degree", "-"},
+			utils.NormalizeText(rest[0])) {
+			rest = rest[1:]
+		}
+		major := majorEnd.Split(strings.Join(rest, " "), 2)[0]
+		return candidate.degree, strings.Trim(major, " ,-:")
+	}
+	return "", ""
+}
+
+// parseCourses reads one course or certificate per line, as "name - organization - date" in any order
+// after the name
+func parseCourses(lines []string) []models.CVCourseRequest {
+	courses := []models.CVCourseRequest{}
+	for _, line := range lines {
+		line = strings.TrimSpace(bulletPattern.ReplaceAllString(line, ""))
+		if line == "" || len(courses) >= maxCourses {
+			continue
+		}
+
+		course := models.CVCourseRequest{FinishDate: parseDate(line)}
+		if course.FinishDate == "" {
+			if match := monthYearPattern.FindStringSubmatch(line); match != nil {
+				month, _ := strconv.Atoi(match[1])
+				if month >= 1 && month <= 12 {
+					course.FinishDate = fmt.Sprintf("%s-%02d-01", match[2], month)
+				}
+			} else if match := monthNamePattern.FindStringSubmatch(line); match != nil {
+				month := strings.Index(monthNames, strings.ToLower(match[1][:3]))/4 + 1
+				course.FinishDate = fmt.Sprintf("%s-%02d-01", match[2], month)
+			}
+		}
+
+		var parts []string
+		for _, part := range coursePartSeparator.Split(line, -1) {
+			if part = strings.Trim(stripPeriod(part), " ,()"); part != "" {
+				parts = append(parts, part)
+			}
+		}
+		if len(parts) == 0 {
+			continue
+		}
+		course.CourseName = parts[0]
+		if len(parts) > 1 {
+			course.Organization = parts[1]
+		}
+		courses = append(courses, course)
+	}
+	return courses
+}
+
+// parseSkills reads skills listed across lines and separated by commas, semicolons or bullets. A
+// "category: a, b" line gives the category as the description of its skills. Sentences are skipped.
+func parseSkills(lines []string) []models.CVSkillRequest {
+	skills := []models.CVSkillRequest{}
+	seen := map[string]bool{}
+	for _, line := range lines {
+		line = strings.TrimSpace(bulletPattern.ReplaceAllString(line, ""))
+
+		description := ""
+		if category, rest, found := strings.Cut(line, ":"); found && len(strings.Fields(category)) <= 4 {
+			description, line = strings.TrimSpace(category), rest
+		}
+
+		for _, item := range strings.FieldsFunc(line, func(r rune) bool {
+			return r == ',' || r == ';' || r == '•' || r == '|' || r == '·'
+		}) {
+			item = strings.Trim(item, " .")
+			if strings.Count(item, "(") != strings.Count(item, ")") {
+				item = strings.Trim(item, "()")
+			}
+			key := utils.NormalizeText(item)
+			if key == "" || len(strings.Fields(item)) > 5 || seen[key] || len(skills) >= maxSkills {
+				continue
+			}
+			seen[key] = true
+			skills = append(skills, models.CVSkillRequest{SkillName: item, Description: description})
+		}
+	}
+	return skills
+}
+
+func setField(result *Result, name string, field *string, value string, confidence float64) {
+	*field = strings.TrimSpace(value)
+	result.Confidence[name] = confidence
+}
+
+// parseDate returns the first full date of the text as YYYY-MM-DD, reading D/M/Y (the Vietnamese order)
+// and Y-M-D
+func parseDate(text string) string {
+	match := datePattern.FindStringSubmatch(text)
+	if match == nil {
+		return ""
+	}
+
+	var year, month, day int
+	if match[3] != "" {
+		day, _ = strconv.Atoi(match[1])
+		month, _ = strconv.Atoi(match[2])
+		year, _ = strconv.Atoi(match[3])
+	} else {
+		year, _ = strconv.Atoi(match[4])
+		month, _ = strconv.Atoi(match[5])
+		day, _ = strconv.Atoi(match[6])
+	}
+
+	date := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	if date.Day() != day || int(date.Month()) != month {
+		return ""
+	}
+	return date.Format("2006-01-02")
+}
+
+// parseGender maps the value to the genders of the CV form
+func parseGender(value string) string {
+	switch utils.NormalizeText(value) {
+	case "nam", "male", "m":
+		return "Nam"
+	case "nu", "female", "f":
+		return "Nữ"
+	}
+	return ""
+}
+
+// normalizePhone keeps the digits and a leading +
+func normalizePhone(phone string) string {
+	var digits strings.Builder
+	for i, r := range phone {
+		if unicode.IsDigit(r) || (r == '+' && i == 0) {
+			digits.WriteRune(r)
+		}
+	}
+	return digits.String()
+}
+
+// stripPeriod removes dates and year ranges, e.g. "Đại học Bách Khoa (2016 - 2020)"
+func stripPeriod(text string) string {
+	return strings.Trim(periodPattern.ReplaceAllString(text, " "), " ,-–|:")
+}
+
+// titleCase turns an all-capitals name like "NGUYỄN VĂN A" into "Nguyễn Văn A", leaving mixed case as is
+func titleCase(name string) string {
+	if strings.ToUpper(name) != name {
+		return name
+	}
+	words := strings.Fields(strings.ToLower(name))
+	for i, word := range words {
+		runes := []rune(word)
+		runes[0] = unicode.ToUpper(runes[0])
+		words[i] = string(runes)
+	}
+	return strings.Join(words, " ")
+}
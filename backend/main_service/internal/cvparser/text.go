@@ -0,0 +1,81 @@
+package cvparser
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/ledongthuc/pdf"
+	"golang.org/x/text/unicode/norm"
+)
+
+// maxPages bounds the pages read from one PDF; CVs longer than this are rare and their tail matters little
+const maxPages = 20
+
+// ExtractText returns the text layer of a PDF as lines, in reading order within each page.
+// Glyphs are grouped into lines by their baseline, and a space is inserted where glyphs are far apart.
+func ExtractText(r io.ReaderAt, size int64) (lines []string, err error) {
+	// The PDF library panics on some malformed files
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			lines, err = nil, fmt.Errorf("%w: %v", ErrUnreadable, recovered)
+		}
+	}()
+
+	reader, err := pdf.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnreadable, err)
+	}
+
+	for i := 1; i <= reader.NumPage() && i <= maxPages; i++ {
+		page := reader.Page(i)
+		if page.V.IsNull() {
+			continue
+		}
+		lines = append(lines, pageLines(page.Content().Text)...)
+	}
+	return lines, nil
+}
+
+// pageLines rebuilds the lines of a page from its glyphs
+func pageLines(glyphs []pdf.Text) []string {
+	sort.SliceStable(glyphs, func(i, j int) bool {
+		return glyphs[i].Y > glyphs[j].Y
+	})
+
+	// Glyphs close to the first baseline of a line belong to it
+	var rows [][]pdf.Text
+	for _, glyph := range glyphs {
+		if n := len(rows); n > 0 && math.Abs(rows[n-1][0].Y-glyph.Y) <= baselineTolerance(rows[n-1][0], glyph) {
+			rows[n-1] = append(rows[n-1], glyph)
+			continue
+		}
+		rows = append(rows, []pdf.Text{glyph})
+	}
+
+	lines := make([]string, 0, len(rows))
+	for _, row := range rows {
+		sort.SliceStable(row, func(i, j int) bool {
+			return row[i].X < row[j].X
+		})
+
+		var line strings.Builder
+		for i, glyph := range row {
+			if i > 0 && glyph.X-(row[i-1].X+row[i-1].W) > glyph.FontSize*0.2 {
+				line.WriteByte(' ')
+			}
+			line.WriteString(glyph.S)
+		}
+		// NFKC turns ligatures like "ﬁ" back into letters
+		lines = append(lines, norm.NFKC.String(line.String()))
+	}
+	return lines
+}
+
+// baselineTolerance is how far apart two glyphs' baselines may be on the same line,
+// allowing for superscripts and mixed font sizes
+func baselineTolerance(a, b pdf.Text) float64 {
+	return math.Max(math.Max(a.FontSize, b.FontSize)*0.4, 1)
+}
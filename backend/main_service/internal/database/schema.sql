@@ -16,10 +16,21 @@ CREATE TABLE users (
     employee_code VARCHAR(50) NOT NULL,
     full_name VARCHAR(255) NOT NULL,
     email VARCHAR(255) UNIQUE NOT NULL,
+    -- Hash bcrypt; rỗng với tài khoản LDAP
+    password VARCHAR(255),
     department_id UUID REFERENCES departments(id),
+    auth_source VARCHAR(20) NOT NULL DEFAULT 'local' CHECK (auth_source IN ('local', 'ldap')),
+    deactivated_at TIMESTAMP,
+    -- TRUE khi đồng bộ LDAP vô hiệu hoá tài khoản; đồng bộ chỉ kích hoạt lại những tài khoản này
+    deactivated_by_sync BOOLEAN NOT NULL DEFAULT FALSE,
+    -- Thời điểm dữ liệu cá nhân bị xoá theo yêu cầu; tài khoản này không thể khôi phục
+    erased_at TIMESTAMPTZ,
     created_at TIMESTAMP DEFAULT NOW()
 );
 
+-- Trưởng phòng; users:access_department cho phép truy cập người dùng của phòng mình quản lý
+ALTER TABLE departments ADD COLUMN manager_id UUID REFERENCES users(id) ON DELETE SET NULL;
+
 -- Bảng cv
 CREATE TABLE cv (
     id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
@@ -41,6 +52,9 @@ CREATE TABLE cv_details (
     email TEXT,
     phone TEXT,
     address TEXT,
+    -- Nguồn gốc của từng trường theo tên cột: {"email": {"source": "ai", "verified": false, "confidence": 0.8}}
+    -- Trường không có trong đây được nhập trước khi có tính năng này, hoặc đang trống
+    provenance JSONB NOT NULL DEFAULT '{}',
     created_at TIMESTAMP DEFAULT NOW()
 );
 
@@ -51,7 +65,13 @@ CREATE TABLE cv_education (
     organization TEXT NOT NULL,
     degree TEXT,
     major TEXT,
-    graduation_year INT
+    graduation_year INT,
+    -- manual: chủ CV tự nhập, ai: trích xuất từ file CV, admin: Admin chỉnh sửa
+    source VARCHAR(10) NOT NULL DEFAULT 'manual' CHECK (source IN ('manual', 'ai', 'admin')),
+    -- Chủ CV đã xác nhận dữ liệu chưa
+    verified BOOLEAN NOT NULL DEFAULT TRUE,
+    -- Độ tin cậy (0..1) của dữ liệu do AI trích xuất
+    confidence DOUBLE PRECISION
 );
 
 -- Bảng cv_courses
@@ -60,7 +80,11 @@ CREATE TABLE cv_courses (
     cv_id UUID REFERENCES cv(id) ON DELETE CASCADE,
     course_name TEXT NOT NULL,
     organization TEXT,
-    finish_date DATE
+    finish_date DATE,
+    -- Nguồn gốc và xác nhận, như cv_education
+    source VARCHAR(10) NOT NULL DEFAULT 'manual' CHECK (source IN ('manual', 'ai', 'admin')),
+    verified BOOLEAN NOT NULL DEFAULT TRUE,
+    confidence DOUBLE PRECISION
 );
 
 -- Bảng cv_skills
@@ -68,7 +92,11 @@ CREATE TABLE cv_skills (
     id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
     cv_id UUID REFERENCES cv(id) ON DELETE CASCADE,
     skill_name TEXT NOT NULL,
-    description TEXT
+    description TEXT,
+    -- Nguồn gốc và xác nhận, như cv_education
+    source VARCHAR(10) NOT NULL DEFAULT 'manual' CHECK (source IN ('manual', 'ai', 'admin')),
+    verified BOOLEAN NOT NULL DEFAULT TRUE,
+    confidence DOUBLE PRECISION
 );
 
 -- Bảng cv_update_requests
@@ -86,9 +114,18 @@ CREATE TABLE cv_update_requests (
 -- Bảng roles
 CREATE TABLE roles (
     id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
-    name VARCHAR(50) NOT NULL UNIQUE
+    name VARCHAR(50) NOT NULL UNIQUE,
+    is_system BOOLEAN NOT NULL DEFAULT FALSE
 );
 
+-- Các role hệ thống được tham chiếu theo tên trong code nên không được đổi tên / xoá
+INSERT INTO roles (name, is_system) VALUES
+    ('Admin', TRUE),
+    ('PM', TRUE),
+    ('BUL/Lead', TRUE),
+    ('Employee', TRUE)
+ON CONFLICT (name) DO UPDATE SET is_system = TRUE;
+
 -- Bảng user_roles
 CREATE TABLE user_roles (
     user_id UUID REFERENCES users(id),
@@ -96,6 +133,90 @@ CREATE TABLE user_roles (
     PRIMARY KEY (user_id, role_id)
 );
 
+-- Bảng permissions
+CREATE TABLE permissions (
+    name VARCHAR(100) PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT ''
+);
+
+INSERT INTO permissions (name, description) VALUES
+    ('users:read', 'List all users'),
+    ('users:read_all', 'List every user by page, role or PM status, deactivated accounts included'),
+    ('users:view', 'View a single user'),
+    ('users:read_department', 'List the users of a department'),
+    ('users:read_project', 'List the members of a project'),
+    ('users:write', 'Create, update and delete users'),
+    ('cv:read', 'View the CV of any user'),
+    ('cv:write', 'Update and delete the CV of any user'),
+    ('requests:create', 'Create CV update requests'),
+    ('requests:read_sent', 'View sent CV update requests'),
+    ('requests:read_sent_project', 'View CV update requests sent within managed projects'),
+    ('requests:read_sent_department', 'View CV update requests sent within the department'),
+    ('requests:update_status', 'Update the status of CV update requests'),
+    ('requests:read_all', 'View all CV update requests'),
+    ('projects:read', 'List projects'),
+    ('projects:read_all', 'List every project, not only the ones the user manages or belongs to'),
+    ('projects:view', 'View a single project'),
+    ('projects:read_members', 'List the members of all managed projects'),
+    ('projects:write', 'Create, update and delete projects and their members'),
+    ('projects:assign_pm', 'Create projects on behalf of a PM'),
+    ('departments:manage', 'Create, update and delete departments'),
+    ('directory:sync', 'Run the LDAP / Active Directory sync'),
+    ('service_accounts:manage', 'Manage service accounts and API keys'),
+    ('roles:manage', 'Manage roles and their permissions'),
+    ('dashboard:read', 'View the admin dashboard statistics'),
+    ('users:access_all', 'Reach the data and CV of every user; the only way for API keys to reach users'),
+    ('users:access_department', 'Reach the data and CV of users in the departments the user is the manager of'),
+    ('users:access_project', 'Reach the data and CV of current and past members of projects the user manages'),
+    ('projects:manage_all', 'Change every project, not only the ones the user is PM of'),
+    ('users:impersonate', 'Act as another user to reproduce support issues'),
+    ('audit:read', 'Query, export and verify the audit log'),
+    ('users:erase', 'Review personal data erasure requests'),
+    ('cv:share', 'Create expiring share links to CVs the user can reach'),
+    ('storage:manage', 'Report and clean up orphaned uploaded files'),
+    ('cv:import', 'Bulk import CV files from a ZIP archive into the CVs of users'),
+    ('users:merge', 'Review likely duplicate users and merge or dismiss them')
+ON CONFLICT (name) DO NOTHING;
+
+-- Bảng role_permissions
+CREATE TABLE role_permissions (
+    role_id UUID REFERENCES roles(id) ON DELETE CASCADE,
+    permission VARCHAR(100) REFERENCES permissions(name) ON DELETE CASCADE,
+    PRIMARY KEY (role_id, permission)
+);
+
+-- Quyền mặc định, tương ứng với phân quyền theo role trước đây
+INSERT INTO role_permissions (role_id, permission)
+SELECT r.id, p.permission
+FROM roles r
+JOIN (VALUES
+    ('Admin', 'users:read'), ('Admin', 'users:read_all'), ('Admin', 'users:view'),
+    ('Admin', 'users:read_department'), ('Admin', 'users:read_project'), ('Admin', 'users:write'),
+    ('Admin', 'cv:read'), ('Admin', 'cv:write'),
+    ('Admin', 'requests:create'), ('Admin', 'requests:update_status'), ('Admin', 'requests:read_all'),
+    ('Admin', 'projects:read'), ('Admin', 'projects:read_all'), ('Admin', 'projects:view'),
+    ('Admin', 'projects:write'), ('Admin', 'projects:assign_pm'),
+    ('Admin', 'departments:manage'), ('Admin', 'directory:sync'), ('Admin', 'service_accounts:manage'),
+    ('Admin', 'roles:manage'), ('Admin', 'dashboard:read'),
+    ('Admin', 'users:access_all'), ('Admin', 'projects:manage_all'), ('Admin', 'users:impersonate'),
+    ('Admin', 'audit:read'), ('Admin', 'users:erase'), ('Admin', 'cv:share'),
+    ('Admin', 'storage:manage'), ('Admin', 'cv:import'), ('Admin', 'users:merge'),
+    ('PM', 'users:access_project'),
+    ('BUL/Lead', 'users:access_department'),
+    ('PM', 'users:read'), ('PM', 'users:view'), ('PM', 'users:read_project'),
+    ('PM', 'cv:read'), ('PM', 'cv:share'),
+    ('PM', 'requests:create'), ('PM', 'requests:read_sent'), ('PM', 'requests:read_sent_project'),
+    ('PM', 'requests:update_status'),
+    ('PM', 'projects:read'), ('PM', 'projects:view'), ('PM', 'projects:read_members'), ('PM', 'projects:write'),
+    ('BUL/Lead', 'users:view'), ('BUL/Lead', 'users:read_department'),
+    ('BUL/Lead', 'cv:read'), ('BUL/Lead', 'cv:share'),
+    ('BUL/Lead', 'requests:create'), ('BUL/Lead', 'requests:read_sent'), ('BUL/Lead', 'requests:read_sent_department'),
+    ('BUL/Lead', 'requests:update_status'),
+    ('BUL/Lead', 'projects:view'),
+    ('Employee', 'requests:create')
+) AS p(role_name, permission) ON p.role_name = r.name
+ON CONFLICT DO NOTHING;
+
 -- Bảng projects
 CREATE TABLE projects (
     id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
@@ -113,3 +234,261 @@ CREATE TABLE project_members (
     left_at DATE,
     PRIMARY KEY (project_id, user_id)
 );
+
+-- Bảng service_accounts (tài khoản cho tích hợp máy, không phải người dùng)
+CREATE TABLE service_accounts (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    name VARCHAR(255) NOT NULL UNIQUE,
+    description TEXT,
+    owner_id UUID NOT NULL REFERENCES users(id),
+    created_at TIMESTAMP DEFAULT NOW(),
+    disabled_at TIMESTAMP
+);
+
+-- Bảng api_keys (chỉ lưu prefix và SHA-256 hash của key)
+CREATE TABLE api_keys (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    service_account_id UUID NOT NULL REFERENCES service_accounts(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    key_prefix VARCHAR(32) NOT NULL UNIQUE,
+    key_hash CHAR(64) NOT NULL,
+    scopes TEXT[] NOT NULL,
+    allowed_ips TEXT[],
+    expires_at TIMESTAMP,
+    last_used_at TIMESTAMP,
+    last_used_ip VARCHAR(64),
+    revoked_at TIMESTAMP,
+    created_by UUID NOT NULL REFERENCES users(id),
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+-- Bảng api_key_usage
+CREATE TABLE api_key_usage (
+    id BIGSERIAL PRIMARY KEY,
+    api_key_id UUID NOT NULL REFERENCES api_keys(id) ON DELETE CASCADE,
+    used_at TIMESTAMP DEFAULT NOW(),
+    ip VARCHAR(64),
+    method VARCHAR(10),
+    path TEXT,
+    status_code INT
+);
+
+CREATE INDEX idx_api_key_usage_key_used_at ON api_key_usage (api_key_id, used_at DESC);
+
+-- Bảng access_denials (các lần truy cập bị từ chối vào dữ liệu của user / phòng ban / dự án)
+CREATE TABLE access_denials (
+    id BIGSERIAL PRIMARY KEY,
+    user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    api_key_id UUID REFERENCES api_keys(id) ON DELETE SET NULL,
+    resource_type VARCHAR(20) NOT NULL,
+    resource_id TEXT NOT NULL,
+    method VARCHAR(10),
+    path TEXT,
+    ip VARCHAR(64),
+    denied_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX idx_access_denials_denied_at ON access_denials (denied_at DESC);
+
+-- Bảng impersonation_sessions (Admin "xem như user" để hỗ trợ)
+CREATE TABLE impersonation_sessions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    impersonator_id UUID NOT NULL REFERENCES users(id),
+    user_id UUID NOT NULL REFERENCES users(id),
+    reason TEXT NOT NULL,
+    started_at TIMESTAMP DEFAULT NOW(),
+    expires_at TIMESTAMP NOT NULL,
+    ended_at TIMESTAMP
+);
+
+-- Bảng impersonation_requests (mọi request thực hiện bằng impersonation token)
+CREATE TABLE impersonation_requests (
+    id BIGSERIAL PRIMARY KEY,
+    session_id UUID NOT NULL REFERENCES impersonation_sessions(id),
+    impersonator_id UUID NOT NULL REFERENCES users(id),
+    user_id UUID NOT NULL REFERENCES users(id),
+    method VARCHAR(10) NOT NULL,
+    path TEXT NOT NULL,
+    status_code INT,
+    ip VARCHAR(64),
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX idx_impersonation_requests_session ON impersonation_requests (session_id, created_at);
+
+-- Bảng audit_log (chỉ được thêm, các dòng được nối với nhau bằng hash để phát hiện chỉnh sửa)
+CREATE TABLE audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL,
+    actor_type VARCHAR(20) NOT NULL CHECK (actor_type IN ('user', 'api_key', 'system')),
+    actor_id TEXT,
+    impersonator_id TEXT,
+    action VARCHAR(100) NOT NULL,
+    target_type VARCHAR(50) NOT NULL,
+    target_id TEXT NOT NULL,
+    -- JSON (không phải JSONB) để giữ nguyên nội dung đã dùng khi tính digest
+    before_data JSON,
+    after_data JSON,
+    -- SHA-256 của before_data / after_data (rỗng khi không có); hash tính trên digest nên
+    -- nội dung có thể bị xoá (khi xoá dữ liệu cá nhân) mà chuỗi hash vẫn kiểm tra được
+    before_digest VARCHAR(64) NOT NULL DEFAULT '',
+    after_digest VARCHAR(64) NOT NULL DEFAULT '',
+    redacted_at TIMESTAMPTZ,
+    ip VARCHAR(64),
+    request_id VARCHAR(64),
+    prev_hash VARCHAR(64) NOT NULL DEFAULT '',
+    hash CHAR(64) NOT NULL
+);
+
+CREATE INDEX idx_audit_log_created_at ON audit_log (created_at);
+CREATE INDEX idx_audit_log_actor ON audit_log (actor_id);
+CREATE INDEX idx_audit_log_target ON audit_log (target_type, target_id);
+
+CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+-- Chỉ cho phép xoá before_data / after_data (đặt redacted_at), mọi cột khác giữ nguyên
+CREATE OR REPLACE FUNCTION audit_log_redact_only() RETURNS trigger AS $$
+BEGIN
+    IF (NEW.id, NEW.created_at, NEW.actor_type, NEW.actor_id, NEW.impersonator_id, NEW.action, NEW.target_type,
+            NEW.target_id, NEW.before_digest, NEW.after_digest, NEW.ip, NEW.request_id, NEW.prev_hash, NEW.hash)
+        IS NOT DISTINCT FROM
+        (OLD.id, OLD.created_at, OLD.actor_type, OLD.actor_id, OLD.impersonator_id, OLD.action, OLD.target_type,
+            OLD.target_id, OLD.before_digest, OLD.after_digest, OLD.ip, OLD.request_id, OLD.prev_hash, OLD.hash)
+        AND (NEW.before_data IS NULL OR NEW.before_data::text IS NOT DISTINCT FROM OLD.before_data::text)
+        AND (NEW.after_data IS NULL OR NEW.after_data::text IS NOT DISTINCT FROM OLD.after_data::text)
+        AND NEW.redacted_at IS NOT NULL THEN
+        RETURN NEW;
+    END IF;
+    RAISE EXCEPTION 'audit_log is append-only, only its payloads can be redacted';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_log_redact_only
+    BEFORE UPDATE ON audit_log
+    FOR EACH ROW EXECUTE FUNCTION audit_log_redact_only();
+
+CREATE TRIGGER audit_log_no_delete
+    BEFORE DELETE ON audit_log
+    FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
+
+CREATE TRIGGER audit_log_no_truncate
+    BEFORE TRUNCATE ON audit_log
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_log_append_only();
+
+-- Bảng erasure_requests (yêu cầu xoá dữ liệu cá nhân, cần Admin duyệt)
+CREATE TABLE erasure_requests (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    reason TEXT,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'rejected', 'approved', 'completed', 'failed')),
+    reviewed_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    reviewed_at TIMESTAMPTZ,
+    review_note TEXT,
+    -- Các file trên Spaces chưa xoá được, sẽ thử lại khi duyệt lại
+    pending_objects TEXT[] NOT NULL DEFAULT '{}',
+    error TEXT,
+    completed_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Mỗi người dùng chỉ có một yêu cầu đang chờ duyệt
+CREATE UNIQUE INDEX idx_erasure_requests_pending ON erasure_requests (user_id) WHERE status = 'pending';
+
+-- Bảng share_links (link chia sẻ CV cho khách hàng, có hạn dùng và có thể thu hồi)
+CREATE TABLE share_links (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    -- Chỉ lưu SHA-256 của token, token chỉ trả về một lần khi tạo
+    token_hash CHAR(64) NOT NULL UNIQUE,
+    profile VARCHAR(20) NOT NULL CHECK (profile IN ('anonymised', 'full')),
+    expires_at TIMESTAMPTZ NOT NULL,
+    revoked_at TIMESTAMPTZ,
+    view_count INTEGER NOT NULL DEFAULT 0,
+    last_viewed_at TIMESTAMPTZ,
+    created_by UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_share_links_created_by ON share_links (created_by);
+
+-- Bảng share_link_cvs (bản chụp CV tại thời điểm tạo link, đã lọc theo profile)
+CREATE TABLE share_link_cvs (
+    share_link_id UUID NOT NULL REFERENCES share_links(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    snapshot JSONB NOT NULL,
+    PRIMARY KEY (share_link_id, user_id)
+);
+
+CREATE INDEX idx_share_link_cvs_user ON share_link_cvs (user_id);
+
+-- Bảng uploads (file đã tải lên storage, để dọn các file không còn CV nào dùng)
+CREATE TABLE uploads (
+    key TEXT PRIMARY KEY,
+    -- key mà CV lưu; các rendition của cùng một ảnh dùng chung asset_key
+    asset_key TEXT NOT NULL,
+    owner_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    content_type VARCHAR(100) NOT NULL,
+    size BIGINT NOT NULL,
+    -- pending: chưa gắn vào CV, attached: CV đang dùng, superseded: CV đã thay/xoá file, deleted: đã xoá khỏi storage
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'attached', 'superseded', 'deleted')),
+    attached_user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    attached_at TIMESTAMPTZ,
+    released_at TIMESTAMPTZ,
+    deleted_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_uploads_status ON uploads (status);
+CREATE INDEX idx_uploads_attached_user ON uploads (attached_user_id);
+CREATE INDEX idx_uploads_asset_key ON uploads (asset_key);
+CREATE INDEX idx_uploads_owner ON uploads (owner_id) WHERE status <> 'deleted';
+
+-- Bảng parse_jobs (yêu cầu phân tích CV bằng AI, chạy nền và thử lại khi lỗi)
+CREATE TABLE parse_jobs (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    owner_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    file_ref TEXT NOT NULL,
+    -- Người dùng có CV được điền tự động từ kết quả (nhập CV hàng loạt); NULL: kết quả chỉ trả cho owner
+    cv_user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    status VARCHAR(20) NOT NULL DEFAULT 'queued' CHECK (status IN ('queued', 'running', 'succeeded', 'failed')),
+    attempts INT NOT NULL DEFAULT 0,
+    max_attempts INT NOT NULL,
+    -- Lần chạy tiếp theo (backoff sau mỗi lần lỗi)
+    run_after TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    -- Thời điểm worker nhận job; job 'running' quá lâu sẽ được worker khác nhận lại
+    locked_at TIMESTAMPTZ,
+    result JSONB,
+    error TEXT,
+    finished_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_parse_jobs_queue ON parse_jobs (run_after) WHERE status IN ('queued', 'running');
+CREATE INDEX idx_parse_jobs_owner ON parse_jobs (owner_id, created_at DESC);
+CREATE INDEX idx_parse_jobs_cv_user ON parse_jobs (cv_user_id) WHERE cv_user_id IS NOT NULL;
+
+-- Bảng duplicate_candidates (cặp người dùng có thể trùng nhau, chờ Admin gộp hoặc bỏ qua)
+CREATE TABLE duplicate_candidates (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    -- Mỗi cặp chỉ lưu một lần, user_a_id < user_b_id
+    user_a_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    user_b_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    score DOUBLE PRECISION NOT NULL,
+    -- Các dấu hiệu trùng: employee_code, phone, name, birthday, cv_content
+    reasons JSONB NOT NULL DEFAULT '[]',
+    -- 'dismissed' và 'merged' không bị lần quét sau mở lại
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'merged', 'dismissed')),
+    detected_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    resolved_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    resolved_at TIMESTAMPTZ,
+    UNIQUE (user_a_id, user_b_id),
+    CHECK (user_a_id < user_b_id)
+);
+
+CREATE INDEX idx_duplicate_candidates_status ON duplicate_candidates (status, score DESC);
+CREATE INDEX idx_duplicate_candidates_user_b ON duplicate_candidates (user_b_id);
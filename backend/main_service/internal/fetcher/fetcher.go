@@ -0,0 +1,233 @@
+// Package fetcher downloads files from user-supplied URLs without letting users reach internal services:
+// only allow-listed hosts are fetched, and connections to private, loopback or link-local addresses are
+// refused after DNS resolution, so a hostname can't be pointed at the internal network.
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// defaultTimeout bounds one download, redirects included, when FETCH_TIMEOUT is not set
+const defaultTimeout = 30 * time.Second
+
+// maxRedirects is how many redirects a download follows, each checked like the original URL
+const maxRedirects = 3
+
+// Errors of Fetch. They are the caller's fault, so retrying won't help.
+var (
+	ErrURLNotAllowed  = errors.New("URL not allowed")
+	ErrBlockedAddress = errors.New("address not allowed")
+	ErrTooLarge       = errors.New("remote file too large")
+)
+
+// StatusError is returned when the remote server answers with anything but 200 OK
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("remote server returned HTTP %d", e.StatusCode)
+}
+
+// blockedPrefixes are the non-public ranges netip.Addr has no predicate for
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),      // "this" network
+	netip.MustParsePrefix("100.64.0.0/10"),  // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),   // IETF protocol assignments
+	netip.MustParsePrefix("198.18.0.0/15"),  // benchmarking
+	netip.MustParsePrefix("240.0.0.0/4"),    // reserved, broadcast
+	netip.MustParsePrefix("64:ff9b::/96"),   // NAT64, may map to private IPv4 addresses
+	netip.MustParsePrefix("64:ff9b:1::/48"), // local-use NAT64
+	netip.MustParsePrefix("2002::/16"),      // 6to4, embeds an IPv4 address
+}
+
+// Config holds the configuration of a Fetcher
+type Config struct {
+	// AllowedHosts are host names that may be fetched. An entry starting with a dot (or "*.") allows
+	// the subdomains of the name. An empty list refuses every URL.
+	AllowedHosts []string
+	Timeout      time.Duration
+}
+
+// Fetcher downloads files over HTTP(S) from allowed hosts
+type Fetcher struct {
+	allowedHosts []string
+	client       *http.Client
+}
+
+// Default is the fetcher configured at startup by Init. Until then it refuses every URL.
+var Default = New(Config{Timeout: defaultTimeout})
+
+// Init configures Default from FETCH_ALLOWED_HOSTS (comma-separated) and FETCH_TIMEOUT (default 30s)
+func Init() error {
+	timeout := defaultTimeout
+	if value := os.Getenv("FETCH_TIMEOUT"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			return fmt.Errorf("invalid FETCH_TIMEOUT %q", value)
+		}
+		timeout = parsed
+	}
+
+	var hosts []string
+	for _, host := range strings.Split(os.Getenv("FETCH_ALLOWED_HOSTS"), ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			hosts = append(hosts, host)
+		}
+	}
+
+	Default = New(Config{AllowedHosts: hosts, Timeout: timeout})
+	if len(hosts) == 0 {
+		fmt.Println("Remote file fetching disabled (FETCH_ALLOWED_HOSTS is empty)")
+	} else {
+		fmt.Printf("Remote file fetching allowed from %s\n", strings.Join(hosts, ", "))
+	}
+	return nil
+}
+
+// New creates a fetcher. Its client ignores proxy settings, since a proxy would make the connection
+// checks apply to the proxy instead of the actual destination.
+func New(config Config) *Fetcher {
+	f := &Fetcher{}
+	for _, host := range config.AllowedHosts {
+		host = strings.ToLower(strings.TrimPrefix(host, "*"))
+		f.allowedHosts = append(f.allowedHosts, host)
+	}
+
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: checkConnection,
+	}
+	f.client = &http.Client{
+		Timeout: config.Timeout,
+		Transport: &http.Transport{
+			Proxy:                 nil,
+			DialContext:           dialer.DialContext,
+			ForceAttemptHTTP2:     true,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ResponseHeaderTimeout: config.Timeout,
+			MaxIdleConns:          10,
+			IdleConnTimeout:       90 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			return f.checkURL(req.URL)
+		},
+	}
+	return f
+}
+
+// CheckURL checks that the URL may be fetched: HTTP(S) on the default port of an allowed host.
+// The address the host resolves to is only checked when connecting.
+func (f *Fetcher) CheckURL(rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrURLNotAllowed, err)
+	}
+	return f.checkURL(parsed)
+}
+
+func (f *Fetcher) checkURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%w: scheme %q is not supported", ErrURLNotAllowed, u.Scheme)
+	}
+	if u.User != nil {
+		return fmt.Errorf("%w: credentials in URLs are not supported", ErrURLNotAllowed)
+	}
+	if port := u.Port(); port != "" && port != "80" && port != "443" {
+		return fmt.Errorf("%w: port %s is not allowed", ErrURLNotAllowed, port)
+	}
+
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if !f.allowedHost(host) {
+		return fmt.Errorf("%w: host %q is not allowed", ErrURLNotAllowed, host)
+	}
+	return nil
+}
+
+func (f *Fetcher) allowedHost(host string) bool {
+	if host == "" {
+		return false
+	}
+	for _, allowed := range f.allowedHosts {
+		if host == allowed || (strings.HasPrefix(allowed, ".") && strings.HasSuffix(host, allowed)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Fetch downloads the URL into w, refusing bodies over maxSize bytes, and returns the number of bytes written
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string, w io.Writer, maxSize int64) (int64, error) {
+	if err := f.CheckURL(rawURL); err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrURLNotAllowed, err)
+	}
+
+	// Refused redirects and connections keep their error in the chain, for errors.Is
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to download file: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, &StatusError{StatusCode: resp.StatusCode}
+	}
+	if resp.ContentLength > maxSize {
+		return 0, ErrTooLarge
+	}
+
+	written, err := io.Copy(w, io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return written, fmt.Errorf("failed to read remote file: %w", err)
+	}
+	if written > maxSize {
+		return written, ErrTooLarge
+	}
+	return written, nil
+}
+
+// checkConnection runs right before connecting, once the host is resolved, so a name that resolves
+// (or is rebound) to an internal address is refused whatever the allow-list says
+func checkConnection(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrBlockedAddress, address)
+	}
+	if !publicAddr(addrPort.Addr()) {
+		return fmt.Errorf("%w: %s", ErrBlockedAddress, addrPort.Addr())
+	}
+	return nil
+}
+
+// publicAddr reports whether the address is routable on the internet
+func publicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() || addr.IsLoopback() || addr.IsLinkLocalUnicast() {
+		return false
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
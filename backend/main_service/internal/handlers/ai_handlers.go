@@ -1,20 +1,30 @@
 package handlers
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/vdt/cv-management/internal/aiclient"
+	"github.com/vdt/cv-management/internal/cvparser"
+	"github.com/vdt/cv-management/internal/database"
+	"github.com/vdt/cv-management/internal/fetcher"
 	"github.com/vdt/cv-management/internal/models"
+	"github.com/vdt/cv-management/internal/storage"
+	"github.com/vdt/cv-management/internal/utils"
 )
 
-// ParseCVFromFile handles CV parsing requests by calling the AI service
+// ParseCVFromFile queues a CV parsing job. The AI service can take minutes on long PDFs, so the
+// request returns right away; the job's progress comes as parse_job SSE events and from GetParseJob.
 func ParseCVFromFile(c *gin.Context) {
 	var request models.ParseCVRequest
 
@@ -37,128 +47,203 @@ func ParseCVFromFile(c *gin.Context) {
 		return
 	}
 
-	// Validate file is a PDF
-	if !strings.HasSuffix(strings.ToLower(request.FilePath), ".pdf") {
+	// Uploaded CVs are private objects, referenced by key (or by a presigned/legacy URL of the same object)
+	filePath := request.FilePath
+	if storageKey := storage.KeyFromRef(request.FilePath); storage.IsCVFileKey(storageKey) {
+		filePath = storageKey
+	}
+
+	// Validate file is a PDF, DOCX or ODT document
+	if !utils.IsValidDocumentType(filePath) {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"status":  "error",
-			"message": "File must be a PDF",
+			"message": "File must be a PDF, DOCX or ODT document",
 		})
 		return
 	}
 
-	var localFilePath string
-	var tempFile bool
-
-	// Check if it's a remote URL or local file
-	if isRemoteURL(request.FilePath) {
-		// Download remote file to temporary location
-		tempPath, err := downloadFileToTemp(request.FilePath)
+	// The parse result is a copy of the CV, so only the caller's own uploads may be parsed;
+	// anything else must be a URL on an allowed host
+	sourceErr := checkParseSource(filePath)
+	if sourceErr == nil && storage.IsCVFileKey(filePath) {
+		owned, err := ownsUpload(c, c.GetString("userID"), filePath)
 		if err != nil {
+			fmt.Printf("ParseCVFromFile: %v\n", err)
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"status":  "error",
-				"message": fmt.Sprintf("Failed to download file: %v", err),
+				"message": "Error checking upload",
 			})
 			return
 		}
-		localFilePath = tempPath
-		tempFile = true
-
-		// Clean up temp file after processing
-		defer func() {
-			if tempFile {
-				os.Remove(localFilePath)
-			}
-		}()
-	} else {
-		// Local file path
-		localFilePath = request.FilePath
-
-		// Check if local file exists
-		if _, err := os.Stat(localFilePath); os.IsNotExist(err) {
-			c.JSON(http.StatusNotFound, gin.H{
-				"status":  "error",
-				"message": fmt.Sprintf("File not found: %s", localFilePath),
-			})
-			return
+		if !owned {
+			sourceErr = errors.New("not one of your uploads")
 		}
 	}
+	if sourceErr != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "File path is not allowed",
+			"details": sourceErr.Error(),
+		})
+		return
+	}
 
-	// Call AI service with local file path
-	aiResponse, err := callAIService(localFilePath)
+	// Without the fallback parser, queued jobs would only wait, so tell the caller now while the AI
+	// service is known to be down
+	if available, retryAt := aiclient.Default.Available(); !available && !parseFallbackEnabled() {
+		respondAIServiceError(c, aiclient.ErrCircuitOpen, retryAt)
+		return
+	}
+
+	job, err := enqueueParseJob(c, c.GetString("userID"), filePath, "")
 	if err != nil {
+		fmt.Printf("ParseCVFromFile: %v\n", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"status":  "error",
-			"message": "Failed to parse CV",
-			"details": err.Error(),
+			"message": "Failed to queue CV parsing",
 		})
 		return
 	}
 
-	// Return successful response
-	c.JSON(http.StatusOK, gin.H{
-		"status": "success",
-		"data":   aiResponse,
+	c.JSON(http.StatusAccepted, gin.H{
+		"status":  "success",
+		"message": "CV parsing queued",
+		"data":    job,
 	})
 }
 
-// callAIService makes an HTTP request to the AI service
-func callAIService(filePath string) (*models.AIServiceResponse, error) {
-	// Get AI service URL from environment or use default
-	aiServiceURL := os.Getenv("AI_SERVICE_URL")
-	if aiServiceURL == "" {
-		aiServiceURL = "http://localhost:8000"
-	}
+// parseCVFile sends a stored upload or a remote URL to the AI service. The service reads PDFs itself;
+// DOCX and ODT documents are sent as the text extracted here.
+func parseCVFile(ctx context.Context, filePath string) (*models.AIServiceResponse, error) {
+	var localFilePath string
 
-	// Prepare request payload
-	requestPayload := models.AIServiceRequest{
-		FilePath: filePath,
+	// Check if it's a stored upload or a remote URL
+	if storage.IsCVFileKey(filePath) {
+		tempPath, err := downloadObjectToTemp(ctx, filePath)
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, permanentError{fmt.Errorf("file not found: %s", filePath)}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to download file: %w", err)
+		}
+		localFilePath = tempPath
+		defer os.Remove(localFilePath)
+	} else if isRemoteURL(filePath) {
+		// Download remote file to temporary location
+		tempPath, err := downloadFileToTemp(ctx, filePath)
+		if err != nil {
+			return nil, err
+		}
+		localFilePath = tempPath
+		defer os.Remove(localFilePath)
+	} else {
+		return nil, permanentError{fmt.Errorf("not a stored upload or a URL: %s", filePath)}
 	}
 
-	// Marshal request to JSON
-	jsonData, err := json.Marshal(requestPayload)
+	// The extension decides how the file is parsed, so the content must match it
+	contentType, err := utils.SniffFile(localFilePath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %w", err)
+		return nil, fmt.Errorf("failed to read file: %w", err)
 	}
-
-	// Create HTTP request
-	req, err := http.NewRequest("POST", aiServiceURL+"/parse-cv", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+	if contentType != storage.ContentType(localFilePath) {
+		return nil, permanentError{fmt.Errorf("file content is not a PDF, DOCX or ODT document: %s", filePath)}
 	}
 
-	// Set headers
-	req.Header.Set("Content-Type", "application/json")
-
-	// Create HTTP client with timeout
-	client := &http.Client{
-		Timeout: 30 * time.Second,
+	var response *models.AIServiceResponse
+	if contentType == "application/pdf" {
+		response, err = callAIService(ctx, localFilePath)
+	} else {
+		response, err = parseDocumentText(ctx, filePath, localFilePath, contentType)
 	}
+	if err != nil && parseFallbackEnabled() && aiclient.Unreachable(err) {
+		return parseWithFallback(filePath, localFilePath, contentType, err)
+	}
+	return response, err
+}
 
-	// Make the request
-	resp, err := client.Do(req)
+// parseDocumentText extracts the text of a word processor document and sends it to the AI service.
+// Documents the extractor can't read, or without text, won't parse on retry either.
+func parseDocumentText(ctx context.Context, filePath, localFilePath, contentType string) (*models.AIServiceResponse, error) {
+	lines, err := cvparser.ExtractFile(localFilePath, contentType)
 	if err != nil {
-		return nil, fmt.Errorf("failed to make request to AI service: %w", err)
+		return nil, permanentError{err}
+	}
+	text := strings.Join(lines, "\n")
+	if strings.TrimSpace(text) == "" {
+		return nil, permanentError{cvparser.ErrNoText}
 	}
-	defer resp.Body.Close()
 
-	// Read response body
-	body, err := io.ReadAll(resp.Body)
+	response, err := aiServiceError(aiclient.Default.ParseText(ctx, text))
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
+		return nil, err
 	}
+	response.FilePath = filePath
+	return response, nil
+}
 
-	// Check if request was successful
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("AI service returned error: %s (status: %d)", string(body), resp.StatusCode)
+// parseWithFallback parses the file with the built-in parser while the AI service is unreachable.
+// Scanned PDFs have no text to read, so they keep the AI service error and wait for it.
+func parseWithFallback(filePath, localFilePath, contentType string, aiErr error) (*models.AIServiceResponse, error) {
+	result, err := cvparser.ParseFile(localFilePath, contentType)
+	if err != nil {
+		log.Printf("Fallback CV parser failed on %s: %v", filePath, err)
+		return nil, aiErr
 	}
 
-	// Parse response
-	var aiResponse models.AIServiceResponse
-	if err := json.Unmarshal(body, &aiResponse); err != nil {
-		return nil, fmt.Errorf("failed to parse AI service response: %w", err)
+	log.Printf("Parsed %s with the fallback CV parser: %v", filePath, aiErr)
+	return &models.AIServiceResponse{
+		Status:     "success",
+		FilePath:   filePath,
+		Data:       result,
+		Confidence: result.Confidence,
+	}, nil
+}
+
+// parseFallbackEnabled reports whether PARSE_FALLBACK (default true) lets the built-in parser stand in
+// for the AI service
+func parseFallbackEnabled() bool {
+	enabled, err := strconv.ParseBool(os.Getenv("PARSE_FALLBACK"))
+	return err != nil || enabled
+}
+
+// callAIService sends the file to the AI service
+func callAIService(ctx context.Context, filePath string) (*models.AIServiceResponse, error) {
+	return aiServiceError(aiclient.Default.ParseCV(ctx, filePath))
+}
+
+// aiServiceError marks the AI service rejecting a request as permanent, as that won't change on retry
+func aiServiceError(response *models.AIServiceResponse, err error) (*models.AIServiceResponse, error) {
+	var respErr *aiclient.ResponseError
+	if errors.As(err, &respErr) && !respErr.Temporary() {
+		return nil, permanentError{err}
 	}
+	return response, err
+}
 
-	return &aiResponse, nil
+// respondAIServiceError answers a request the AI service couldn't serve: 503 while it is unreachable,
+// with a Retry-After when the circuit breaker says when to try again, and 504 when it did not answer in time
+func respondAIServiceError(c *gin.Context, err error, retryAt time.Time) {
+	switch {
+	case errors.Is(err, aiclient.ErrTimeout):
+		c.JSON(http.StatusGatewayTimeout, gin.H{
+			"status":  "error",
+			"message": "AI service did not respond in time",
+		})
+	case errors.Is(err, aiclient.ErrCircuitOpen), errors.Is(err, aiclient.ErrUnavailable):
+		if !retryAt.IsZero() {
+			c.Header("Retry-After", strconv.Itoa(int(time.Until(retryAt).Seconds())+1))
+		}
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"status":  "error",
+			"message": "AI service is unavailable, please try again later",
+		})
+	default:
+		fmt.Printf("AI service error: %v\n", err)
+		c.JSON(http.StatusBadGateway, gin.H{
+			"status":  "error",
+			"message": "AI service error",
+		})
+	}
 }
 
 // isRemoteURL checks if the given path is a remote URL
@@ -166,34 +251,84 @@ func isRemoteURL(path string) bool {
 	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
 }
 
-// downloadFileToTemp downloads a remote file to a temporary local path
-func downloadFileToTemp(url string) (string, error) {
-	// Create a temporary file
-	tempFile, err := os.CreateTemp("", "cv_*.pdf")
+// checkParseSource checks that a file path is a storage key or a URL on an allowed host
+func checkParseSource(filePath string) error {
+	if storage.IsCVFileKey(filePath) {
+		return nil
+	}
+	if isRemoteURL(filePath) {
+		return fetcher.Default.CheckURL(filePath)
+	}
+	return errors.New("not an uploaded CV or a URL")
+}
+
+// ownsUpload checks that a stored upload was made by the user or is attached to their CV
+func ownsUpload(ctx context.Context, userID, key string) (bool, error) {
+	if userID == "" {
+		return false, nil
+	}
+	var owned bool
+	err := database.DB.QueryRow(ctx,
+		`SELECT EXISTS (
+			SELECT 1 FROM uploads
+			WHERE key = $1 AND status <> 'deleted' AND (owner_id = $2 OR attached_user_id = $2)
+		)`,
+		key, userID).Scan(&owned)
+	if err != nil {
+		return false, fmt.Errorf("error checking owner of upload %s: %w", key, err)
+	}
+	return owned, nil
+}
+
+// downloadFileToTemp downloads a remote file from an allowed host to a temporary local path.
+// Refused URLs, oversized files and client errors are permanent; the rest may be retried.
+func downloadFileToTemp(ctx context.Context, url string) (string, error) {
+	// Create a temporary file, with the extension of the URL's path
+	tempFile, err := os.CreateTemp("", "cv_*"+documentExtension(url))
 	if err != nil {
 		return "", fmt.Errorf("failed to create temp file: %w", err)
 	}
 	defer tempFile.Close()
 
-	// Download the file
-	resp, err := http.Get(url)
-	if err != nil {
+	// Download the file, within the upload size limit
+	if _, err := fetcher.Default.Fetch(ctx, url, tempFile, utils.MaxPDFSize); err != nil {
 		os.Remove(tempFile.Name())
+		var statusErr *fetcher.StatusError
+		if errors.Is(err, fetcher.ErrURLNotAllowed) || errors.Is(err, fetcher.ErrBlockedAddress) ||
+			errors.Is(err, fetcher.ErrTooLarge) ||
+			(errors.As(err, &statusErr) && statusErr.StatusCode < 500 && statusErr.StatusCode != http.StatusTooManyRequests) {
+			return "", permanentError{fmt.Errorf("failed to download file: %w", err)}
+		}
 		return "", fmt.Errorf("failed to download file: %w", err)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		os.Remove(tempFile.Name())
-		return "", fmt.Errorf("failed to download file: HTTP %d", resp.StatusCode)
+	return tempFile.Name(), nil
+}
+
+// downloadObjectToTemp downloads a stored upload to a temporary local path
+func downloadObjectToTemp(ctx context.Context, key string) (string, error) {
+	body, err := storage.Store.Get(ctx, key)
+	if err != nil {
+		return "", err
 	}
+	defer body.Close()
 
-	// Copy the content to temp file
-	_, err = io.Copy(tempFile, resp.Body)
+	tempFile, err := os.CreateTemp("", "cv_*"+documentExtension(key))
 	if err != nil {
+		return "", fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer tempFile.Close()
+
+	if _, err := io.Copy(tempFile, body); err != nil {
 		os.Remove(tempFile.Name())
 		return "", fmt.Errorf("failed to write temp file: %w", err)
 	}
 
 	return tempFile.Name(), nil
 }
+
+// documentExtension returns the lowercased extension of a file path, storage key or URL, which
+// ParseCVFromFile has checked to be one of a CV document format
+func documentExtension(filePath string) string {
+	return strings.ToLower(filepath.Ext(filePath))
+}
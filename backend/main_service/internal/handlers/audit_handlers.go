@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/vdt/cv-management/internal/audit"
+)
+
+// Audit log actions
+const (
+	auditUserUpdate          = "user.update"
+	auditUserDeactivate      = "user.deactivate"
+	auditUserRestore         = "user.restore"
+	auditUserPurge           = "user.purge"
+	auditUserDataExport      = "user.data_export"
+	auditUserErase           = "user.erase"
+	auditUserMerge           = "user.merge"
+	auditDuplicateDismiss    = "duplicate.dismiss"
+	auditErasureRequest      = "erasure_request.create"
+	auditErasureReject       = "erasure_request.reject"
+	auditCVUpdate            = "cv.update"
+	auditCVAdminUpdate       = "cv.admin_update"
+	auditCVDelete            = "cv.delete"
+	auditCVMerge             = "cv.merge"
+	auditCVImport            = "cv.import"
+	auditCVVerify            = "cv.verify"
+	auditCVRequestStatus     = "cv_request.update_status"
+	auditShareLinkCreate     = "share_link.create"
+	auditShareLinkRevoke     = "share_link.revoke"
+	auditDepartmentCreate    = "department.create"
+	auditDepartmentUpdate    = "department.update"
+	auditDepartmentDelete    = "department.delete"
+	auditRoleCreate          = "role.create"
+	auditRoleUpdate          = "role.update"
+	auditRoleDelete          = "role.delete"
+	auditProjectCreate       = "project.create"
+	auditProjectUpdate       = "project.update"
+	auditProjectDelete       = "project.delete"
+	auditProjectMemberAdd    = "project.member_add"
+	auditProjectMemberRemove = "project.member_remove"
+	auditServiceAccountAdd   = "service_account.create"
+	auditServiceAccountOff   = "service_account.disable"
+	auditAPIKeyCreate        = "api_key.create"
+	auditAPIKeyRevoke        = "api_key.revoke"
+	auditImpersonationStart  = "impersonation.start"
+	auditDirectorySync       = "directory.sync"
+	auditUploadGC            = "upload.gc"
+	auditUploadRejected      = "upload.rejected"
+)
+
+// recordAudit appends an audit entry inside the handler's transaction.
+// On failure it writes a 500 response and returns false, so the caller just returns (rolling back).
+func recordAudit(c *gin.Context, tx pgx.Tx, entry audit.Entry) bool {
+	if err := audit.RecordTx(c, tx, audit.ActorFromContext(c), entry); err != nil {
+		fmt.Printf("recordAudit: Error recording %s on %s %s: %v\n", entry.Action, entry.TargetType, entry.TargetID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error recording audit log",
+		})
+		return false
+	}
+	return true
+}
+
+// recordAuditEvent appends an audit entry in its own transaction, for actions that change nothing in the
+// database (an export, a refused upload). On failure it writes a 500 response and returns false.
+func recordAuditEvent(c *gin.Context, entry audit.Entry) bool {
+	if err := audit.RecordWithActor(c, audit.ActorFromContext(c), entry); err != nil {
+		fmt.Printf("recordAuditEvent: Error recording %s on %s %s: %v\n", entry.Action, entry.TargetType, entry.TargetID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error recording audit log",
+		})
+		return false
+	}
+	return true
+}
+
+// auditSnapshot takes a before/after snapshot; on failure it writes a 500 response and returns false
+func auditSnapshot(c *gin.Context, snapshot func() (json.RawMessage, error)) (json.RawMessage, bool) {
+	data, err := snapshot()
+	if err != nil {
+		fmt.Printf("auditSnapshot: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error recording audit log",
+		})
+		return nil, false
+	}
+	return data, true
+}
+
+// parseAuditFilter reads the audit log filters from the query string.
+// from and to accept RFC3339 timestamps or YYYY-MM-DD dates (to is exclusive).
+func parseAuditFilter(c *gin.Context) (audit.Filter, error) {
+	filter := audit.Filter{
+		ActorID:    c.Query("actor_id"),
+		Action:     c.Query("action"),
+		TargetType: c.Query("target_type"),
+		TargetID:   c.Query("target_id"),
+		RequestID:  c.Query("request_id"),
+	}
+
+	for _, bound := range []struct {
+		name   string
+		target **time.Time
+	}{{"from", &filter.From}, {"to", &filter.To}} {
+		value := c.Query(bound.name)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			parsed, err = time.Parse("2006-01-02", value)
+		}
+		if err != nil {
+			return filter, fmt.Errorf("invalid %s, expected RFC3339 or YYYY-MM-DD", bound.name)
+		}
+		*bound.target = &parsed
+	}
+
+	return filter, nil
+}
+
+// GetAuditLog returns a filtered, paginated page of the audit log (newest first)
+func GetAuditLog(c *gin.Context) {
+	filter, err := parseAuditFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	perPage, err := strconv.Atoi(c.DefaultQuery("per_page", "50"))
+	if err != nil || perPage < 1 || perPage > 200 {
+		perPage = 50
+	}
+
+	entries, total, err := audit.Query(c, filter, perPage, (page-1)*perPage)
+	if err != nil {
+		fmt.Printf("GetAuditLog error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error fetching audit log",
+		})
+		return
+	}
+
+	totalPages := (total + perPage - 1) / perPage
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data": gin.H{
+			"entries":       entries,
+			"current_page":  page,
+			"total_pages":   totalPages,
+			"total_entries": total,
+			"per_page":      perPage,
+			"has_next":      page < totalPages,
+			"has_prev":      page > 1,
+		},
+	})
+}
+
+// ExportAuditLog streams the filtered audit log as CSV (oldest first)
+func ExportAuditLog(c *gin.Context) {
+	filter, err := parseAuditFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	filename := fmt.Sprintf("audit-log-%s.csv", time.Now().Format("20060102-150405"))
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	writer := csv.NewWriter(c.Writer)
+	writer.Write([]string{
+		"id", "created_at", "actor_type", "actor_id", "actor_name", "impersonator_id", "action",
+		"target_type", "target_id", "before", "after", "before_digest", "after_digest", "redacted_at",
+		"ip", "request_id", "prev_hash", "hash",
+	})
+
+	err = audit.Each(c, filter, func(row audit.Row) error {
+		redactedAt := ""
+		if row.RedactedAt != nil {
+			redactedAt = row.RedactedAt.UTC().Format(time.RFC3339Nano)
+		}
+		return writer.Write([]string{
+			strconv.FormatInt(row.ID, 10), row.CreatedAt.UTC().Format(time.RFC3339Nano), row.ActorType,
+			row.ActorID, row.ActorName, row.ImpersonatorID, row.Action, row.TargetType, row.TargetID,
+			row.Before, row.After, row.BeforeDigest, row.AfterDigest, redactedAt,
+			row.IP, row.RequestID, row.PrevHash, row.Hash,
+		})
+	})
+	writer.Flush()
+
+	// Headers are already sent, so an error can only be logged
+	if err != nil {
+		fmt.Printf("ExportAuditLog error: %v\n", err)
+	}
+}
+
+// VerifyAuditLog recomputes the hash chain and reports the first tampered row, if any
+func VerifyAuditLog(c *gin.Context) {
+	result, err := audit.Verify(c)
+	if err != nil {
+		fmt.Printf("VerifyAuditLog error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error verifying audit log",
+		})
+		return
+	}
+
+	if !result.Valid {
+		fmt.Printf("VerifyAuditLog: Hash chain broken at row %d: %s\n", result.FirstBrokenID, result.Reason)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   result,
+	})
+}
@@ -2,10 +2,13 @@ package handlers
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
 	"net/http"
 	"slices"
 
 	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
 	"github.com/vdt/cv-management/internal/database"
 	"github.com/vdt/cv-management/internal/models"
 	"github.com/vdt/cv-management/internal/utils"
@@ -158,6 +161,9 @@ func Register(c *gin.Context) {
 			})
 			return
 		}
+
+		// Bulk registrations are where duplicate people come from
+		requestDuplicateScan()
 	}
 
 	// Prepare response
@@ -202,24 +208,27 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	// Mock user retrieval - in real implementation, query the database
 	var user models.User
-	var hashedPassword string
+	var hashedPassword sql.NullString
+	var authSource string
+	var deactivatedAt sql.NullTime
 
 	// Get user by email
-	row := database.DB.QueryRow(c,
-		`SELECT u.id, u.employee_code, u.full_name, u.email, u.password, u.department_id, d.name
+	userQuery := `SELECT u.id, u.employee_code, u.full_name, u.email, u.password, u.department_id, d.name,
+		u.auth_source, u.deactivated_at
 		FROM users u
 		LEFT JOIN departments d ON u.department_id = d.id
-		WHERE u.email = $1`,
-		loginData.Email)
+		WHERE lower(u.email) = lower($1)`
+	row := database.DB.QueryRow(c, userQuery, loginData.Email)
 
 	// Scan into user object
 	var deptID, deptName sql.NullString
 	err := row.Scan(&user.ID, &user.EmployeeCode, &user.FullName, &user.Email,
-		&hashedPassword, &deptID, &deptName)
+		&hashedPassword, &deptID, &deptName, &authSource, &deactivatedAt)
+	userFound := err == nil
 
-	if err != nil {
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		fmt.Printf("Login: Error fetching user: %v\n", err)
 		c.JSON(http.StatusUnauthorized, gin.H{
 			"status":  "error",
 			"message": "Đăng nhập thất bại",
@@ -227,11 +236,54 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	// Check password
-	if !utils.CheckPasswordHash(loginData.Password, hashedPassword) {
-		c.JSON(http.StatusUnauthorized, gin.H{
+	// With the LDAP provider, directory users (and unknown users, who are provisioned on first login)
+	// authenticate against the directory. Local accounts such as the bootstrap admin keep their password.
+	if utils.AuthProvider() == "ldap" && (!userFound || authSource == "ldap") {
+		directoryEmail, err := loginWithDirectory(c, loginData.Email, loginData.Password)
+		if err != nil {
+			fmt.Printf("Login: Directory authentication failed for %s: %v\n", loginData.Email, err)
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"status":  "error",
+				"message": "Đăng nhập thất bại",
+			})
+			return
+		}
+
+		// Reload the user as the directory may have created or updated it
+		err = database.DB.QueryRow(c, userQuery, directoryEmail).Scan(&user.ID, &user.EmployeeCode, &user.FullName,
+			&user.Email, &hashedPassword, &deptID, &deptName, &authSource, &deactivatedAt)
+		if err != nil {
+			fmt.Printf("Login: Error reloading directory user %s: %v\n", loginData.Email, err)
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"status":  "error",
+				"message": "Đăng nhập thất bại",
+			})
+			return
+		}
+	} else {
+		if !userFound {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"status":  "error",
+				"message": "Đăng nhập thất bại",
+			})
+			return
+		}
+
+		// Check password
+		if !utils.CheckPasswordHash(loginData.Password, hashedPassword.String) {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"status":  "error",
+				"message": "Mật khẩu không chính xác",
+			})
+			return
+		}
+	}
+
+	// Deactivated users cannot log in
+	if deactivatedAt.Valid {
+		c.JSON(http.StatusForbidden, gin.H{
 			"status":  "error",
-			"message": "Mật khẩu không chính xác",
+			"message": "Tài khoản đã bị vô hiệu hoá",
 		})
 		return
 	}
@@ -321,6 +373,40 @@ func Login(c *gin.Context) {
 	})
 }
 
+// loginWithDirectory verifies the credentials against the directory, provisions or updates
+// the local user and returns the email stored for that user
+func loginWithDirectory(c *gin.Context, email, password string) (string, error) {
+	client, err := utils.NewLDAPClient()
+	if err != nil {
+		return "", err
+	}
+
+	entry, err := client.Authenticate(email, password)
+	if err != nil {
+		return "", err
+	}
+
+	if entry.Email == "" || entry.EmployeeCode == "" || entry.FullName == "" {
+		return "", fmt.Errorf("directory entry %s is missing email, employee code or full name", entry.DN)
+	}
+
+	tx, err := database.DB.Begin(c)
+	if err != nil {
+		return "", fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(c)
+
+	if _, _, err := upsertDirectoryUser(c, tx, *entry); err != nil {
+		return "", err
+	}
+
+	if err := tx.Commit(c); err != nil {
+		return "", fmt.Errorf("error committing directory user: %w", err)
+	}
+
+	return entry.Email, nil
+}
+
 // RefreshToken refreshes an access token using a valid refresh token
 func RefreshToken(c *gin.Context) {
 	var request struct {
@@ -345,6 +431,16 @@ func RefreshToken(c *gin.Context) {
 		return
 	}
 
+	// Deactivated users cannot get new tokens
+	var deactivatedAt sql.NullTime
+	if err := database.DB.QueryRow(c, "SELECT deactivated_at FROM users WHERE id = $1", userID).Scan(&deactivatedAt); err != nil || deactivatedAt.Valid {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"status":  "error",
+			"message": "Invalid refresh token",
+		})
+		return
+	}
+
 	// Get user roles
 	rows, err := database.DB.Query(c,
 		`SELECT r.name
@@ -488,8 +584,18 @@ func GetUserProfile(c *gin.Context) {
 	}
 	user.Roles = roles
 
-	c.JSON(http.StatusOK, gin.H{
+	response := gin.H{
 		"status": "success",
 		"data":   user,
-	})
+	}
+
+	// Let the frontend show a clear banner while an Admin is viewing as this user
+	if impersonatorID := c.GetString("impersonatorID"); impersonatorID != "" {
+		response["impersonation"] = gin.H{
+			"impersonator_id":  impersonatorID,
+			"impersonation_id": c.GetString("impersonationID"),
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
 }
@@ -1,14 +1,19 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/vdt/cv-management/internal/audit"
+	"github.com/vdt/cv-management/internal/authz"
 	"github.com/vdt/cv-management/internal/database"
 	"github.com/vdt/cv-management/internal/models"
+	"github.com/vdt/cv-management/internal/storage"
 )
 
 // Helper function to convert string to *string for nullable fields
@@ -19,15 +24,103 @@ func nullStringPtr(s string) *string {
 	return &s
 }
 
+// maskCVDetail clears the sensitive fields the viewer's relationship can't see and returns their names
+func maskCVDetail(details *models.CVDetail, relationship authz.Relationship) []string {
+	hidden := authz.HiddenCVFields(relationship)
+	for _, field := range hidden {
+		delete(details.Provenance, field)
+		switch field {
+		case authz.CVFieldBirthday:
+			details.Birthday = nil
+		case authz.CVFieldGender:
+			details.Gender = nil
+		case authz.CVFieldEmail:
+			details.Email = nil
+		case authz.CVFieldPhone:
+			details.Phone = nil
+		case authz.CVFieldAddress:
+			details.Address = nil
+		case authz.CVFieldPortrait:
+			details.PortraitPath = nil
+		case authz.CVFieldFile:
+			details.CVPath = nil
+		}
+	}
+	return hidden
+}
+
+// normalizeCVFileRefs converts the file references sent by the client (object key, presigned or legacy URL)
+// to the object keys stored in the CV of ownerID. It returns false if a reference is not a CV file the caller
+// may put there: one uploaded by the caller or the owner, one attached to the owner's CV, or one the CV
+// already references (files uploaded before uploads were tracked).
+func normalizeCVFileRefs(ctx context.Context, callerID, ownerID string, refs ...*string) (bool, error) {
+	for _, ref := range refs {
+		if *ref == "" {
+			continue
+		}
+		key := storage.KeyFromRef(*ref)
+		if !storage.IsCVFileKey(key) {
+			return false, nil
+		}
+
+		var allowed bool
+		err := database.DB.QueryRow(ctx,
+			`SELECT EXISTS (
+				SELECT 1 FROM uploads
+				WHERE asset_key = $1 AND status <> 'deleted'
+				  AND (owner_id = $2 OR owner_id = $3 OR attached_user_id = $3)
+			) OR EXISTS (
+				SELECT 1 FROM cv JOIN cv_details d ON d.cv_id = cv.id
+				WHERE cv.user_id = $3 AND $1 IN (d.cvpath, d.portraitpath)
+			)`,
+			key, callerID, ownerID).Scan(&allowed)
+		if err != nil {
+			return false, fmt.Errorf("error checking upload %s: %w", key, err)
+		}
+		if !allowed {
+			return false, nil
+		}
+		*ref = key
+	}
+	return true, nil
+}
+
+// presignCVFiles fills in short-lived download URLs for the files still visible in the CV
+func presignCVFiles(ctx context.Context, details *models.CVDetail) {
+	urls := presignFiles(ctx, details.CVPath, details.PortraitPath)
+	details.CVURL, details.PortraitURL = urls[0], urls[1]
+}
+
+// presignFiles returns a short-lived download URL for each stored file reference (nil for empty ones).
+// Storage errors are only logged so the data referencing the files can still be shown.
+func presignFiles(ctx context.Context, fileRefs ...*string) []*string {
+	urls := make([]*string, len(fileRefs))
+
+	ttl := storage.PresignTTL()
+	for i, fileRef := range fileRefs {
+		if fileRef == nil || *fileRef == "" {
+			continue
+		}
+
+		presignedURL, err := storage.Store.PresignGet(ctx, storage.KeyFromRef(*fileRef), ttl)
+		if err != nil {
+			fmt.Printf("presignFiles: Error presigning %s: %v\n", *fileRef, err)
+			continue
+		}
+		urls[i] = &presignedURL
+	}
+	return urls
+}
+
 // Helper function to load related CV data (education, courses, skills)
-func loadCVRelatedData(c *gin.Context, cvDetailID string) ([]models.CVEducation, []models.CVCourse, []models.CVSkill, error) {
+func loadCVRelatedData(ctx context.Context, cvDetailID string) ([]models.CVEducation, []models.CVCourse, []models.CVSkill, error) {
 	var education []models.CVEducation
 	var courses []models.CVCourse
 	var skills []models.CVSkill
 
 	// Load education data
-	eduRows, err := database.DB.Query(c,
-		`SELECT id, cv_id, organization, degree, major, graduation_year
+	eduRows, err := database.DB.Query(ctx,
+		`SELECT id, cv_id, organization, degree, major, graduation_year, source, verified, confidence
 		FROM cv_education WHERE cv_id = $1 ORDER BY id`, cvDetailID)
 	if err != nil {
 		return nil, nil, nil, fmt.Errorf("failed to load education data: %w", err)
@@ -36,7 +129,8 @@ func loadCVRelatedData(c *gin.Context, cvDetailID string) ([]models.CVEducation,
 
 	for eduRows.Next() {
 		var edu models.CVEducation
-		err := eduRows.Scan(&edu.ID, &edu.CVID, &edu.Organization, &edu.Degree, &edu.Major, &edu.GraduationYear)
+		err := eduRows.Scan(&edu.ID, &edu.CVID, &edu.Organization, &edu.Degree, &edu.Major, &edu.GraduationYear,
+			&edu.Source, &edu.Verified, &edu.Confidence)
 		if err != nil {
 			return nil, nil, nil, fmt.Errorf("failed to scan education row: %w", err)
 		}
@@ -44,8 +138,8 @@ func loadCVRelatedData(c *gin.Context, cvDetailID string) ([]models.CVEducation,
 	}
 
 	// Load courses data
-	courseRows, err := database.DB.Query(c,
-		`SELECT id, cv_id, course_name, organization, finish_date
+	courseRows, err := database.DB.Query(ctx,
+		`SELECT id, cv_id, course_name, organization, finish_date, source, verified, confidence
 		FROM cv_courses WHERE cv_id = $1 ORDER BY id`, cvDetailID)
 	if err != nil {
 		return nil, nil, nil, fmt.Errorf("failed to load courses data: %w", err)
@@ -54,7 +148,8 @@ func loadCVRelatedData(c *gin.Context, cvDetailID string) ([]models.CVEducation,
 
 	for courseRows.Next() {
 		var course models.CVCourse
-		err := courseRows.Scan(&course.ID, &course.CVID, &course.CourseName, &course.Organization, &course.FinishDate)
+		err := courseRows.Scan(&course.ID, &course.CVID, &course.CourseName, &course.Organization, &course.FinishDate,
+			&course.Source, &course.Verified, &course.Confidence)
 		if err != nil {
 			return nil, nil, nil, fmt.Errorf("failed to scan course row: %w", err)
 		}
@@ -62,8 +157,8 @@ func loadCVRelatedData(c *gin.Context, cvDetailID string) ([]models.CVEducation,
 	}
 
 	// Load skills data
-	skillRows, err := database.DB.Query(c,
-		`SELECT id, cv_id, skill_name, description
+	skillRows, err := database.DB.Query(ctx,
+		`SELECT id, cv_id, skill_name, description, source, verified, confidence
 		FROM cv_skills WHERE cv_id = $1 ORDER BY id`, cvDetailID)
 	if err != nil {
 		return nil, nil, nil, fmt.Errorf("failed to load skills data: %w", err)
@@ -72,7 +167,8 @@ func loadCVRelatedData(c *gin.Context, cvDetailID string) ([]models.CVEducation,
 
 	for skillRows.Next() {
 		var skill models.CVSkill
-		err := skillRows.Scan(&skill.ID, &skill.CVID, &skill.SkillName, &skill.Description)
+		err := skillRows.Scan(&skill.ID, &skill.CVID, &skill.SkillName, &skill.Description,
+			&skill.Source, &skill.Verified, &skill.Confidence)
 		if err != nil {
 			return nil, nil, nil, fmt.Errorf("failed to scan skill row: %w", err)
 		}
@@ -104,7 +200,7 @@ func GetUserCV(c *gin.Context) {
 		`SELECT cv.id, cv.user_id, cv.last_updated_by, cv.last_updated_at, cv.status,
 		cv_details.id, cv_details.cv_id, cv_details.full_name, cv_details.job_title, cv_details.summary,
 		cv_details.birthday, cv_details.gender, cv_details.email, cv_details.phone, cv_details.address,
-		cv_details.cvpath, cv_details.portraitpath, cv_details.created_at,
+		cv_details.cvpath, cv_details.portraitpath, cv_details.created_at, cv_details.provenance,
 		updater.full_name, updater.employee_code
 		FROM cv
 		LEFT JOIN cv_details ON cv.id = cv_details.cv_id
@@ -113,7 +209,7 @@ func GetUserCV(c *gin.Context) {
 		&cv.ID, &cv.UserID, &cv.LastUpdatedBy, &cv.LastUpdatedAt, &cv.Status,
 		&details.ID, &details.CVID, &details.FullName, &details.JobTitle, &details.Summary,
 		&details.Birthday, &details.Gender, &details.Email, &details.Phone, &details.Address,
-		&details.CVPath, &details.PortraitPath, &details.CreatedAt,
+		&details.CVPath, &details.PortraitPath, &details.CreatedAt, &details.Provenance,
 		&updaterName, &updaterEmployeeCode)
 
 	if err != nil {
@@ -143,6 +239,8 @@ func GetUserCV(c *gin.Context) {
 		details.Skills = skills
 	}
 
+	presignCVFiles(c, &details)
+
 	// Create response with proper null handling
 	response := map[string]interface{}{
 		"id":      cv.ID,
@@ -150,6 +248,9 @@ func GetUserCV(c *gin.Context) {
 		"status":  cv.Status,
 		"details": details,
 	}
+	if details.ID != "" {
+		response["unverified"] = unverifiedCVData(details)
+	}
 
 	// Handle nullable fields
 	if cv.LastUpdatedBy.Valid {
@@ -193,7 +294,7 @@ func GetCVByUserID(c *gin.Context) {
 		`SELECT cv.id, cv.user_id, cv.last_updated_by, cv.last_updated_at, cv.status,
 		cv_details.id, cv_details.cv_id, cv_details.full_name, cv_details.job_title, cv_details.summary,
 		cv_details.birthday, cv_details.gender, cv_details.email, cv_details.phone, cv_details.address,
-		cv_details.cvpath, cv_details.portraitpath, cv_details.created_at,
+		cv_details.cvpath, cv_details.portraitpath, cv_details.created_at, cv_details.provenance,
 		updater.full_name, updater.employee_code
 		FROM cv
 		LEFT JOIN cv_details ON cv.id = cv_details.cv_id
@@ -202,7 +303,7 @@ func GetCVByUserID(c *gin.Context) {
 		&cv.ID, &cv.UserID, &cv.LastUpdatedBy, &cv.LastUpdatedAt, &cv.Status,
 		&details.ID, &details.CVID, &details.FullName, &details.JobTitle, &details.Summary,
 		&details.Birthday, &details.Gender, &details.Email, &details.Phone, &details.Address,
-		&details.CVPath, &details.PortraitPath, &details.CreatedAt,
+		&details.CVPath, &details.PortraitPath, &details.CreatedAt, &details.Provenance,
 		&updaterName, &updaterEmployeeCode)
 
 	if err != nil {
@@ -232,6 +333,19 @@ func GetCVByUserID(c *gin.Context) {
 		details.Skills = skills
 	}
 
+	// Hide the sensitive fields the caller's relationship to the owner doesn't allow
+	relationship, err := authz.ViewerRelationship(c, userID)
+	if err != nil {
+		fmt.Printf("GetCVByUserID: Error resolving relationship to user %s: %v\n", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error checking access",
+		})
+		return
+	}
+	hiddenFields := maskCVDetail(&details, relationship)
+	presignCVFiles(c, &details)
+
 	// Create response with proper null handling
 	response := map[string]interface{}{
 		"id":      cv.ID,
@@ -239,6 +353,12 @@ func GetCVByUserID(c *gin.Context) {
 		"status":  cv.Status,
 		"details": details,
 	}
+	if len(hiddenFields) > 0 {
+		response["hidden_fields"] = hiddenFields
+	}
+	if details.ID != "" {
+		response["unverified"] = unverifiedCVData(details)
+	}
 
 	// Handle nullable fields
 	if cv.LastUpdatedBy.Valid {
@@ -298,6 +418,23 @@ func CreateOrUpdateCV(c *gin.Context) {
 		return
 	}
 
+	validFiles, err := normalizeCVFileRefs(c, userID.(string), userID.(string), &request.CVPath, &request.PortraitPath)
+	if err != nil {
+		fmt.Printf("CreateOrUpdateCV: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error checking CV files",
+		})
+		return
+	}
+	if !validFiles {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid cv_path or portrait_path, use the key returned by the upload endpoints",
+		})
+		return
+	}
+
 	fmt.Printf("CreateOrUpdateCV: Processing CV for user %v\n", userID)
 
 	// Check if user already has a CV (since user_id is unique in cv table)
@@ -306,7 +443,7 @@ func CreateOrUpdateCV(c *gin.Context) {
 	var currentStatus string
 	isUpdate := false
 
-	err := database.DB.QueryRow(c,
+	err = database.DB.QueryRow(c,
 		`SELECT cv.id, cv_details.id, cv.status
 		FROM cv
 		LEFT JOIN cv_details ON cv.id = cv_details.cv_id
@@ -384,6 +521,26 @@ func CreateOrUpdateCV(c *gin.Context) {
 	}
 	defer tx.Rollback(c)
 
+	before, ok := auditSnapshot(c, func() (json.RawMessage, error) { return audit.CVSnapshot(c, tx, userID.(string)) })
+	if !ok {
+		return
+	}
+
+	// Values the update keeps also keep their provenance
+	var previousDetailID string
+	if existingCVDetailID != nil {
+		previousDetailID = *existingCVDetailID
+	}
+	previous, err := loadCVProvenance(c, tx, previousDetailID)
+	if err != nil {
+		fmt.Printf("CreateOrUpdateCV: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error saving CV data",
+		})
+		return
+	}
+
 	var cvID string
 	var cvDetailID string
 
@@ -608,6 +765,32 @@ func CreateOrUpdateCV(c *gin.Context) {
 		}
 	}
 
+	if err := recordCVProvenance(c, tx, cvDetailID, previous, models.SourceManual); err != nil {
+		fmt.Printf("CreateOrUpdateCV: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error saving CV data",
+		})
+		return
+	}
+
+	if err := syncUploadReferences(c, tx, userID.(string)); err != nil {
+		fmt.Printf("CreateOrUpdateCV: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error saving CV data",
+		})
+		return
+	}
+
+	after, ok := auditSnapshot(c, func() (json.RawMessage, error) { return audit.CVSnapshot(c, tx, userID.(string)) })
+	if !ok {
+		return
+	}
+	if !recordAudit(c, tx, audit.Entry{Action: auditCVUpdate, TargetType: "cv", TargetID: userID.(string), Before: before, After: after}) {
+		return
+	}
+
 	// Commit the transaction
 	if err = tx.Commit(c); err != nil {
 		fmt.Printf("CreateOrUpdateCV: Error committing transaction: %v\n", err)
@@ -757,6 +940,23 @@ func AdminUpdateCV(c *gin.Context) {
 		return
 	}
 
+	validFiles, err := normalizeCVFileRefs(c, adminUserID.(string), targetUserID, &request.CVPath, &request.PortraitPath)
+	if err != nil {
+		fmt.Printf("AdminUpdateCV: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error checking CV files",
+		})
+		return
+	}
+	if !validFiles {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid cv_path or portrait_path, use the key returned by the upload endpoints",
+		})
+		return
+	}
+
 	fmt.Printf("AdminUpdateCV: Admin %s updating CV for user %s\n", adminUserID, targetUserID)
 
 	// Start transaction
@@ -771,6 +971,11 @@ func AdminUpdateCV(c *gin.Context) {
 	}
 	defer tx.Rollback(c)
 
+	before, ok := auditSnapshot(c, func() (json.RawMessage, error) { return audit.CVSnapshot(c, tx, targetUserID) })
+	if !ok {
+		return
+	}
+
 	// Check if CV exists for the target user
 	var existingCVID *string
 	var existingCVDetailID *string
@@ -806,6 +1011,26 @@ func AdminUpdateCV(c *gin.Context) {
 		}
 	}
 
+	// Values the update keeps also keep their provenance; the others are recorded as admin-edited,
+	// unless the admin edits their own CV
+	var previousDetailID string
+	if existingCVDetailID != nil {
+		previousDetailID = *existingCVDetailID
+	}
+	previous, err := loadCVProvenance(c, tx, previousDetailID)
+	if err != nil {
+		fmt.Printf("AdminUpdateCV: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error getting CV details",
+		})
+		return
+	}
+	source := models.SourceAdmin
+	if adminUserID == targetUserID {
+		source = models.SourceManual
+	}
+
 	// Parse birthday if provided
 	var birthday *time.Time
 	if request.Birthday != "" {
@@ -1021,6 +1246,32 @@ func AdminUpdateCV(c *gin.Context) {
 		}
 	}
 
+	if err := recordCVProvenance(c, tx, cvDetailID, previous, source); err != nil {
+		fmt.Printf("AdminUpdateCV: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error saving CV data",
+		})
+		return
+	}
+
+	if err := syncUploadReferences(c, tx, targetUserID); err != nil {
+		fmt.Printf("AdminUpdateCV: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error saving CV data",
+		})
+		return
+	}
+
+	after, ok := auditSnapshot(c, func() (json.RawMessage, error) { return audit.CVSnapshot(c, tx, targetUserID) })
+	if !ok {
+		return
+	}
+	if !recordAudit(c, tx, audit.Entry{Action: auditCVAdminUpdate, TargetType: "cv", TargetID: targetUserID, Before: before, After: after}) {
+		return
+	}
+
 	// Commit transaction
 	err = tx.Commit(c)
 	if err != nil {
@@ -1176,6 +1427,11 @@ func DeleteCV(c *gin.Context) {
 	}
 	defer tx.Rollback(c)
 
+	before, ok := auditSnapshot(c, func() (json.RawMessage, error) { return audit.CVSnapshot(c, tx, targetUserID) })
+	if !ok {
+		return
+	}
+
 	// Update CV status to "Chưa cập nhật" (use current user as the one who performed the deletion)
 	err = tx.QueryRow(c,
 		`UPDATE cv SET last_updated_by = $1, last_updated_at = NOW(), status = 'Chưa cập nhật'
@@ -1200,7 +1456,7 @@ func DeleteCV(c *gin.Context) {
 			`UPDATE cv_details SET
 			full_name = '', job_title = '', summary = '',
 			birthday = NULL, gender = NULL, email = NULL,
-			phone = NULL, address = NULL, cvpath = NULL, portraitpath = NULL
+			phone = NULL, address = NULL, cvpath = NULL, portraitpath = NULL, provenance = '{}'
 			WHERE id = $1 RETURNING id`,
 			*existingCVDetailID).Scan(existingCVDetailID)
 
@@ -1247,6 +1503,23 @@ func DeleteCV(c *gin.Context) {
 		}
 	}
 
+	if err := syncUploadReferences(c, tx, targetUserID); err != nil {
+		fmt.Printf("DeleteCV: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error clearing CV details",
+		})
+		return
+	}
+
+	after, ok := auditSnapshot(c, func() (json.RawMessage, error) { return audit.CVSnapshot(c, tx, targetUserID) })
+	if !ok {
+		return
+	}
+	if !recordAudit(c, tx, audit.Entry{Action: auditCVDelete, TargetType: "cv", TargetID: targetUserID, Before: before, After: after}) {
+		return
+	}
+
 	// Commit transaction
 	err = tx.Commit(c)
 	if err != nil {
@@ -0,0 +1,558 @@
+package handlers
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/vdt/cv-management/internal/audit"
+	"github.com/vdt/cv-management/internal/authz"
+	"github.com/vdt/cv-management/internal/database"
+	"github.com/vdt/cv-management/internal/models"
+	"github.com/vdt/cv-management/internal/scanner"
+	"github.com/vdt/cv-management/internal/storage"
+	"github.com/vdt/cv-management/internal/utils"
+)
+
+// Limits of a bulk CV import
+const (
+	maxCVImportArchiveSize  = 500 << 20
+	maxCVImportManifestSize = 1 << 20
+	maxCVImportRows         = 500
+)
+
+// cvImportRow is a manifest line: a file of the archive and the employee whose CV it is,
+// by employee code, email or both
+type cvImportRow struct {
+	FileName     string
+	EmployeeCode string
+	Email        string
+}
+
+// cvImportUser is the employee a manifest row resolves to
+type cvImportUser struct {
+	ID           string
+	EmployeeCode string
+	FullName     string
+	Email        string
+}
+
+// ImportCVs imports a ZIP archive of CV files (PDF, DOCX or ODT) into the CVs of the employees a manifest
+// CSV maps them to. The manifest has a filename column and an employee_code and/or email column.
+// Each file is stored and attached to the employee's CV like their own upload, creating the CV if needed,
+// then parsed by a job owned by the caller; the parsed data fills the CV's empty fields when the job succeeds.
+func ImportCVs(c *gin.Context) {
+	files, err := utils.ReceiveUploads(c.Writer, c.Request, map[string]int64{
+		"archive":  maxCVImportArchiveSize,
+		"manifest": maxCVImportManifestSize,
+	})
+	switch {
+	case errors.Is(err, utils.ErrFileTooLarge):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"status":  "error",
+			"message": fmt.Sprintf("The archive may be at most %dMB and the manifest %dMB", maxCVImportArchiveSize>>20, maxCVImportManifestSize>>20),
+		})
+		return
+	case errors.Is(err, utils.ErrNoFile):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Both the 'archive' (ZIP) and 'manifest' (CSV) files are required",
+		})
+		return
+	case err != nil:
+		fmt.Printf("ImportCVs: %v\n", err)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Failed to parse multipart form",
+		})
+		return
+	}
+	archiveFile, manifestFile := files["archive"], files["manifest"]
+	defer archiveFile.Close()
+	defer manifestFile.Close()
+
+	manifestReader, err := manifestFile.Reader()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to read uploaded file",
+		})
+		return
+	}
+	rows, err := readImportManifest(manifestReader)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": fmt.Sprintf("Invalid manifest: %v", err),
+		})
+		return
+	}
+
+	if archiveFile.ContentType != "application/zip" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "The archive must be a ZIP file",
+		})
+		return
+	}
+	archive, err := zip.NewReader(archiveFile, archiveFile.Size)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": fmt.Sprintf("Invalid ZIP archive: %v", err),
+		})
+		return
+	}
+	entries := archiveEntries(archive)
+
+	results := make([]models.CVImportResult, 0, len(rows))
+	successCount := 0
+	imported := map[string]string{} // user ID -> file name, so one CV doesn't get two files
+	for _, row := range rows {
+		result := importCVFile(c, entries, row, imported)
+		if result.Success {
+			successCount++
+		}
+		results = append(results, result)
+	}
+
+	bulkResult := models.BulkCVImportResult{
+		TotalFiles:      len(rows),
+		SuccessfulFiles: successCount,
+		FailedFiles:     len(rows) - successCount,
+		Results:         results,
+	}
+
+	// Determine response status based on results
+	if successCount == len(rows) {
+		c.JSON(http.StatusCreated, gin.H{
+			"status":  "success",
+			"message": "CV files imported, parsing queued",
+			"data":    bulkResult,
+		})
+	} else if successCount > 0 {
+		c.JSON(http.StatusPartialContent, gin.H{
+			"status":  "partial_success",
+			"message": "Some CV files could not be imported",
+			"data":    bulkResult,
+		})
+	} else {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "No CV file could be imported",
+			"data":    bulkResult,
+		})
+	}
+}
+
+// readImportManifest reads the rows of the manifest CSV. Column names are matched case-insensitively.
+func readImportManifest(r io.Reader) ([]cvImportRow, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("the manifest is empty")
+	}
+	if err != nil {
+		return nil, err
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		// Spreadsheet programs start UTF-8 CSVs with a byte order mark
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if _, exists := columns[name]; !exists {
+			columns[name] = i
+		}
+	}
+	if _, ok := columns["filename"]; !ok {
+		return nil, errors.New("missing the filename column")
+	}
+	_, hasCode := columns["employee_code"]
+	_, hasEmail := columns["email"]
+	if !hasCode && !hasEmail {
+		return nil, errors.New("missing an employee_code or email column")
+	}
+
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var rows []cvImportRow
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		row := cvImportRow{
+			FileName:     field(record, "filename"),
+			EmployeeCode: field(record, "employee_code"),
+			Email:        field(record, "email"),
+		}
+		if row == (cvImportRow{}) {
+			continue
+		}
+		rows = append(rows, row)
+		if len(rows) > maxCVImportRows {
+			return nil, fmt.Errorf("more than %d files", maxCVImportRows)
+		}
+	}
+	if len(rows) == 0 {
+		return nil, errors.New("the manifest lists no file")
+	}
+	return rows, nil
+}
+
+// archiveEntries indexes the files of the archive by path, leaving out directories and
+// the metadata macOS adds to archives it creates
+func archiveEntries(archive *zip.Reader) map[string]*zip.File {
+	entries := map[string]*zip.File{}
+	for _, entry := range archive.File {
+		name := path.Clean(strings.ReplaceAll(entry.Name, "\\", "/"))
+		if entry.FileInfo().IsDir() || strings.HasPrefix(name, "__MACOSX/") || strings.HasPrefix(path.Base(name), "._") {
+			continue
+		}
+		entries[strings.TrimPrefix(name, "/")] = entry
+	}
+	return entries
+}
+
+// findArchiveEntry returns the entry with the manifest's file name: its path in the archive,
+// or its base name when a single file has it
+func findArchiveEntry(entries map[string]*zip.File, fileName string) (*zip.File, error) {
+	name := strings.TrimPrefix(path.Clean(strings.ReplaceAll(fileName, "\\", "/")), "/")
+	if entry, ok := entries[name]; ok {
+		return entry, nil
+	}
+
+	var found *zip.File
+	for entryName, entry := range entries {
+		if path.Base(entryName) != name {
+			continue
+		}
+		if found != nil {
+			return nil, errors.New("Several files of the archive have this name, use its path")
+		}
+		found = entry
+	}
+	if found == nil {
+		return nil, errors.New("File not found in the archive")
+	}
+	return found, nil
+}
+
+// importCVFile imports the file of a manifest row: it checks and stores the file, attaches it to the
+// employee's CV and queues its parsing. Failures are reported in the result.
+func importCVFile(c *gin.Context, entries map[string]*zip.File, row cvImportRow, imported map[string]string) models.CVImportResult {
+	result := models.CVImportResult{
+		FileName:     row.FileName,
+		EmployeeCode: row.EmployeeCode,
+		Email:        row.Email,
+	}
+
+	if row.FileName == "" {
+		result.Error = "File name is required"
+		return result
+	}
+	user, err := findImportUser(c, row)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.EmployeeCode, result.Email, result.FullName = user.EmployeeCode, user.Email, user.FullName
+
+	if allowed, err := authz.CanAccessUser(c, user.ID); err != nil {
+		fmt.Printf("ImportCVs: Error checking access to user %s: %v\n", user.ID, err)
+		result.Error = "Error checking access to the employee"
+		return result
+	} else if !allowed {
+		result.Error = "Not allowed to change the CV of this employee"
+		return result
+	}
+	if other, ok := imported[user.ID]; ok {
+		result.Error = fmt.Sprintf("The employee already gets %s from this import", other)
+		return result
+	}
+
+	entry, err := findArchiveEntry(entries, row.FileName)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if entry.UncompressedSize64 > utils.MaxPDFSize {
+		result.Error = fmt.Sprintf("File exceeds the maximum size of %dMB", utils.MaxPDFSize>>20)
+		return result
+	}
+	file, err := spoolArchiveEntry(entry)
+	if errors.Is(err, utils.ErrFileTooLarge) {
+		result.Error = fmt.Sprintf("File exceeds the maximum size of %dMB", utils.MaxPDFSize>>20)
+		return result
+	}
+	if err != nil {
+		fmt.Printf("ImportCVs: Error extracting %s: %v\n", entry.Name, err)
+		result.Error = "Failed to extract the file from the archive"
+		return result
+	}
+	defer file.Close()
+
+	if err := utils.ValidateCVDocument(file); err != nil {
+		result.Error = fmt.Sprintf("Invalid CV file: %v", err)
+		return result
+	}
+	if message := scanImportedFile(c, file); message != "" {
+		result.Error = message
+		return result
+	}
+
+	// Stored like an upload of the employee, so it counts against their quota and the GC tracks it
+	key := storage.NewKey(storage.FolderCVDocuments, file.ContentType)
+	err = recordUpload(c, user.ID, key, uploadObject{Key: key, ContentType: file.ContentType, Size: file.Size})
+	if errors.Is(err, errUploadQuotaExceeded) {
+		result.Error = fmt.Sprintf("Upload quota of %dMB of the employee exceeded", uploadQuota()>>20)
+		return result
+	}
+	if err != nil {
+		fmt.Printf("ImportCVs: %v\n", err)
+		result.Error = "Failed to upload file"
+		return result
+	}
+	reader, err := file.Reader()
+	if err == nil {
+		err = storage.Store.Put(c, key, reader, file.Size, file.ContentType)
+	}
+	if err != nil {
+		fmt.Printf("ImportCVs: Error storing %s: %v\n", key, err)
+		result.Error = "Failed to upload file"
+		return result
+	}
+
+	if err := attachImportedCV(c, user.ID, key); err != nil {
+		fmt.Printf("ImportCVs: %v\n", err)
+		result.Error = "Error attaching the file to the CV"
+		return result
+	}
+	result.FileKey = key
+	imported[user.ID] = row.FileName
+
+	job, err := enqueueParseJob(c, c.GetString("userID"), key, user.ID)
+	if err != nil {
+		fmt.Printf("ImportCVs: %v\n", err)
+		result.Error = "The file is attached to the CV, but its parsing could not be queued"
+		return result
+	}
+	result.ParseJobID = job.ID
+	result.Success = true
+	return result
+}
+
+// findImportUser returns the active user a manifest row names. With both an employee code and an email,
+// they must belong to the same user.
+func findImportUser(ctx context.Context, row cvImportRow) (cvImportUser, error) {
+	var user cvImportUser
+	if row.EmployeeCode == "" && row.Email == "" {
+		return user, errors.New("Employee code or email is required")
+	}
+
+	err := database.DB.QueryRow(ctx,
+		`SELECT id, employee_code, full_name, email FROM users
+		WHERE ($1 = '' OR employee_code = $1) AND ($2 = '' OR lower(email) = lower($2)) AND deactivated_at IS NULL`,
+		row.EmployeeCode, row.Email).Scan(&user.ID, &user.EmployeeCode, &user.FullName, &user.Email)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return user, errors.New("Employee not found")
+	}
+	if err != nil {
+		fmt.Printf("ImportCVs: Error finding employee %q/%q: %v\n", row.EmployeeCode, row.Email, err)
+		return user, errors.New("Error finding the employee")
+	}
+	return user, nil
+}
+
+// spoolArchiveEntry extracts an archive entry to a temporary file. The size declared by the
+// archive can lie, so the extraction itself stops at the limit.
+func spoolArchiveEntry(entry *zip.File) (*utils.ReceivedFile, error) {
+	content, err := entry.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+	return utils.SpoolFile(content, entry.Name, utils.MaxPDFSize)
+}
+
+// scanImportedFile runs the malware scanner on an imported file like scanUpload does for uploads.
+// It returns the reason the file is refused, or "" if it is clean.
+func scanImportedFile(c *gin.Context, file *utils.ReceivedFile) string {
+	reader, err := file.Reader()
+	if err != nil {
+		return "Failed to read the file"
+	}
+
+	result, err := scanner.Default.Scan(c, reader)
+	if err != nil {
+		fmt.Printf("ImportCVs: Error scanning %s: %v\n", file.Filename, err)
+		return "File could not be checked for malware, please try again later"
+	}
+	if result.Infected {
+		err := audit.RecordWithActor(c, audit.ActorFromContext(c), audit.Entry{
+			Action:     auditUploadRejected,
+			TargetType: "upload",
+			After: gin.H{
+				"filename":     file.Filename,
+				"size":         file.Size,
+				"content_type": file.ContentType,
+				"signature":    result.Signature,
+				"scanner":      scanner.Default.Name(),
+			},
+		})
+		if err != nil {
+			fmt.Printf("ImportCVs: Error recording the rejection of %s: %v\n", file.Filename, err)
+			return "File rejected: malware detected, and the rejection could not be recorded"
+		}
+		return "File rejected: malware detected"
+	}
+	return ""
+}
+
+// attachImportedCV makes the stored file the CV file of the user, creating their CV if needed
+func attachImportedCV(c *gin.Context, userID, key string) error {
+	tx, err := database.DB.Begin(c)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(c)
+
+	before, err := audit.CVSnapshot(c, tx, userID)
+	if err != nil {
+		return err
+	}
+
+	var cvID string
+	err = tx.QueryRow(c, "SELECT id FROM cv WHERE user_id = $1 FOR UPDATE", userID).Scan(&cvID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		err = tx.QueryRow(c,
+			`INSERT INTO cv (user_id, last_updated_by, last_updated_at, status) VALUES ($1, $2, NOW(), 'Chưa cập nhật')
+			RETURNING id`, userID, c.GetString("userID")).Scan(&cvID)
+	}
+	if err != nil {
+		return fmt.Errorf("error loading CV of user %s: %w", userID, err)
+	}
+
+	tag, err := tx.Exec(c, "UPDATE cv_details SET cvpath = $1 WHERE cv_id = $2", key, cvID)
+	if err == nil && tag.RowsAffected() == 0 {
+		_, err = tx.Exec(c,
+			`INSERT INTO cv_details (cv_id, full_name, job_title, summary, cvpath, created_at)
+			VALUES ($1, '', '', '', $2, NOW())`, cvID, key)
+	}
+	if err != nil {
+		return fmt.Errorf("error saving CV file of user %s: %w", userID, err)
+	}
+	_, err = tx.Exec(c, "UPDATE cv SET last_updated_by = $1, last_updated_at = NOW() WHERE id = $2",
+		c.GetString("userID"), cvID)
+	if err != nil {
+		return fmt.Errorf("error updating CV record of user %s: %w", userID, err)
+	}
+	if err := syncUploadReferences(c, tx, userID); err != nil {
+		return err
+	}
+
+	after, err := audit.CVSnapshot(c, tx, userID)
+	if err != nil {
+		return err
+	}
+	err = audit.RecordTx(c, tx, audit.ActorFromContext(c), audit.Entry{
+		Action: auditCVImport, TargetType: "cv", TargetID: userID, Before: before, After: after,
+	})
+	if err != nil {
+		return err
+	}
+	return tx.Commit(c)
+}
+
+// applyImportedCV fills the CV of an imported file's user with the parsed data. Only empty fields and
+// list items the CV doesn't have yet are added, so nothing entered by hand is overwritten. The change is
+// recorded as a merge by the user who imported the file.
+func applyImportedCV(ctx context.Context, job models.ParseJob, result *models.AIServiceResponse) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return permanentError{fmt.Errorf("error encoding parse result: %w", err)}
+	}
+	parsed, err := parsedCVFromResult(data)
+	if err != nil {
+		return permanentError{err}
+	}
+	userID := *job.CVUserID
+
+	tx, err := database.DB.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	base, err := loadMergeBase(ctx, tx, userID, true)
+	if err != nil {
+		return err
+	}
+	preview := buildMergePreview(base, parsed)
+	var accept models.CVMergeSelection
+	for _, proposal := range preview.Fields {
+		if proposal.Status == models.MergeNew {
+			accept.Fields = append(accept.Fields, proposal.Field)
+		}
+	}
+	for _, proposal := range preview.Education {
+		if proposal.Status == models.MergeNew {
+			accept.Education = append(accept.Education, proposal.ID)
+		}
+	}
+	for _, proposal := range preview.Courses {
+		if proposal.Status == models.MergeNew {
+			accept.Courses = append(accept.Courses, proposal.ID)
+		}
+	}
+	for _, proposal := range preview.Skills {
+		if proposal.Status == models.MergeNew {
+			accept.Skills = append(accept.Skills, proposal.ID)
+		}
+	}
+
+	before, err := audit.CVSnapshot(ctx, tx, userID)
+	if err != nil {
+		return err
+	}
+	if _, err := applyMergeProposals(ctx, tx, userID, job.OwnerID, base, preview, accept); err != nil {
+		return err
+	}
+	after, err := audit.CVSnapshot(ctx, tx, userID)
+	if err != nil {
+		return err
+	}
+	err = audit.RecordTx(ctx, tx, audit.Actor{Type: audit.ActorUser, ID: job.OwnerID}, audit.Entry{
+		Action: auditCVMerge, TargetType: "cv", TargetID: userID, Before: before, After: after,
+	})
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("error committing CV of user %s: %w", userID, err)
+	}
+
+	// The same CV may have been imported into another account
+	requestDuplicateScan()
+	return nil
+}
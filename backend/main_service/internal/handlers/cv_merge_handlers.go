@@ -0,0 +1,673 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/vdt/cv-management/internal/audit"
+	"github.com/vdt/cv-management/internal/database"
+	"github.com/vdt/cv-management/internal/models"
+	"github.com/vdt/cv-management/internal/utils"
+)
+
+// Minimum similarity for a parsed list item to be paired with a stored one
+const (
+	educationMatchThreshold = 0.75
+	courseMatchThreshold    = 0.8
+	skillMatchThreshold     = 0.85
+)
+
+// mergeBase is the stored CV a merge is computed against. CVID is empty when the user has no CV yet.
+type mergeBase struct {
+	CVID      string
+	UpdatedAt *time.Time
+	Details   models.CVDetail
+}
+
+// mergeFields are the CV fields a merge proposes values for, named like their cv_details column
+var mergeFields = []string{"full_name", "job_title", "summary", "birthday", "gender", "email", "phone", "address"}
+
+// PreviewCVMerge compares parsed CV data with the caller's CV and returns a proposal per field and per
+// list item, without changing anything
+func PreviewCVMerge(c *gin.Context) {
+	var request models.CVMergePreviewRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid request data: " + err.Error(),
+		})
+		return
+	}
+
+	parsed, ok := resolveParsedCV(c, request)
+	if !ok {
+		return
+	}
+
+	base, err := loadMergeBase(c, database.DB, c.GetString("userID"), false)
+	if err != nil {
+		fmt.Printf("PreviewCVMerge: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error loading CV",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   buildMergePreview(base, parsed),
+	})
+}
+
+// ApplyCVMerge applies the accepted proposals of a preview to the caller's CV in one transaction.
+// Stored list items that were not matched are kept; the merge never deletes anything.
+func ApplyCVMerge(c *gin.Context) {
+	userID := c.GetString("userID")
+
+	var request models.CVMergeApplyRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid request data: " + err.Error(),
+		})
+		return
+	}
+
+	parsed, ok := resolveParsedCV(c, request.CVMergePreviewRequest)
+	if !ok {
+		return
+	}
+
+	tx, err := database.DB.Begin(c)
+	if err != nil {
+		fmt.Printf("ApplyCVMerge: Error starting transaction: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error starting database transaction",
+		})
+		return
+	}
+	defer tx.Rollback(c)
+
+	// Locks the CV, so it can't change between the check below and the commit
+	base, err := loadMergeBase(c, tx, userID, true)
+	if err != nil {
+		fmt.Printf("ApplyCVMerge: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error loading CV",
+		})
+		return
+	}
+	if !sameInstant(base.UpdatedAt, request.BaseUpdatedAt) {
+		c.JSON(http.StatusConflict, gin.H{
+			"status":  "error",
+			"message": "The CV changed since the preview, preview the merge again",
+		})
+		return
+	}
+
+	preview := buildMergePreview(base, parsed)
+	if unknown := unknownProposals(preview, request.Accept); len(unknown) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Unknown proposals: " + strings.Join(unknown, ", "),
+		})
+		return
+	}
+
+	before, ok := auditSnapshot(c, func() (json.RawMessage, error) { return audit.CVSnapshot(c, tx, userID) })
+	if !ok {
+		return
+	}
+
+	applied, err := applyMergeProposals(c, tx, userID, userID, base, preview, request.Accept)
+	if err != nil {
+		fmt.Printf("ApplyCVMerge: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error saving CV data",
+		})
+		return
+	}
+
+	after, ok := auditSnapshot(c, func() (json.RawMessage, error) { return audit.CVSnapshot(c, tx, userID) })
+	if !ok {
+		return
+	}
+	if !recordAudit(c, tx, audit.Entry{Action: auditCVMerge, TargetType: "cv", TargetID: userID, Before: before, After: after}) {
+		return
+	}
+
+	if err := tx.Commit(c); err != nil {
+		fmt.Printf("ApplyCVMerge: Error committing transaction: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error saving CV data",
+		})
+		return
+	}
+
+	// Like a regular update, the merge answers pending update requests
+	_, err = database.DB.Exec(c,
+		`UPDATE cv_update_requests SET status = 'Đã xử lý'
+		WHERE cv_id = (SELECT id FROM cv WHERE user_id = $1) AND status = 'Đang yêu cầu'`,
+		userID)
+	if err != nil {
+		fmt.Printf("ApplyCVMerge: Error updating CV request status: %v\n", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "CV merged successfully",
+		"data":    applied,
+	})
+}
+
+// resolveParsedCV returns the parsed data of the request, loading it from the caller's parse job when
+// referenced. On failure it writes the error response.
+func resolveParsedCV(c *gin.Context, request models.CVMergePreviewRequest) (models.ParsedCV, bool) {
+	if request.Parsed != nil {
+		return *request.Parsed, true
+	}
+	if request.ParseJobID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Either parsed or parse_job_id is required",
+		})
+		return models.ParsedCV{}, false
+	}
+
+	var result json.RawMessage
+	err := database.DB.QueryRow(c,
+		"SELECT result FROM parse_jobs WHERE id = $1 AND owner_id = $2 AND status = 'succeeded'",
+		request.ParseJobID, c.GetString("userID")).Scan(&result)
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "Parse job not found or not succeeded",
+		})
+		return models.ParsedCV{}, false
+	}
+	if err != nil {
+		fmt.Printf("resolveParsedCV: Error fetching parse job %s: %v\n", request.ParseJobID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error fetching parse job",
+		})
+		return models.ParsedCV{}, false
+	}
+
+	parsed, err := parsedCVFromResult(result)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"status":  "error",
+			"message": "Parse job result is not a CV",
+		})
+		return models.ParsedCV{}, false
+	}
+	return parsed, true
+}
+
+// parsedCVFromResult returns the CV of a parse job result. The job stores the whole AI service
+// response; the CV is its data, with the confidence of the response.
+func parsedCVFromResult(result json.RawMessage) (models.ParsedCV, error) {
+	var response struct {
+		Data       models.ParsedCV    `json:"data"`
+		Confidence map[string]float64 `json:"confidence"`
+	}
+	if err := json.Unmarshal(result, &response); err != nil {
+		return models.ParsedCV{}, fmt.Errorf("error decoding parse result: %w", err)
+	}
+	if len(response.Confidence) > 0 {
+		response.Data.Confidence = response.Confidence
+	}
+	return response.Data, nil
+}
+
+// loadMergeBase loads the user's CV with its lists, optionally locking the cv row
+func loadMergeBase(ctx context.Context, q audit.Querier, userID string, forUpdate bool) (mergeBase, error) {
+	query := `SELECT cv.id, cv.last_updated_at, d.id, COALESCE(d.full_name, ''), COALESCE(d.job_title, ''),
+		COALESCE(d.summary, ''), d.birthday, d.gender, d.email, d.phone, d.address
+		FROM cv
+		LEFT JOIN cv_details d ON d.cv_id = cv.id
+		WHERE cv.user_id = $1`
+	if forUpdate {
+		query += " FOR UPDATE OF cv"
+	}
+
+	var base mergeBase
+	var detailID *string
+	details := &base.Details
+	err := q.QueryRow(ctx, query, userID).Scan(&base.CVID, &base.UpdatedAt, &detailID,
+		&details.FullName, &details.JobTitle, &details.Summary, &details.Birthday,
+		&details.Gender, &details.Email, &details.Phone, &details.Address)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return mergeBase{}, nil
+	}
+	if err != nil {
+		return base, fmt.Errorf("error loading CV of user %s: %w", userID, err)
+	}
+	if detailID == nil {
+		return base, nil
+	}
+
+	details.ID = *detailID
+	details.Education, details.Courses, details.Skills, err = loadCVRelatedData(ctx, details.ID)
+	if err != nil {
+		return base, fmt.Errorf("error loading CV of user %s: %w", userID, err)
+	}
+	return base, nil
+}
+
+// buildMergePreview proposes every non-empty parsed value. List items are paired with the most similar
+// stored item above a threshold, each stored item being used at most once.
+func buildMergePreview(base mergeBase, parsed models.ParsedCV) models.CVMergePreview {
+	details := base.Details
+	preview := models.CVMergePreview{
+		BaseUpdatedAt: base.UpdatedAt,
+		Fields:        []models.FieldProposal{},
+		Education:     []models.EducationProposal{},
+		Courses:       []models.CourseProposal{},
+		Skills:        []models.SkillProposal{},
+	}
+
+	var birthday *string
+	if details.Birthday != nil {
+		formatted := details.Birthday.Format("2006-01-02")
+		birthday = &formatted
+	}
+	current := map[string]*string{
+		"full_name": &details.FullName, "job_title": &details.JobTitle, "summary": &details.Summary,
+		"birthday": birthday, "gender": details.Gender, "email": details.Email,
+		"phone": details.Phone, "address": details.Address,
+	}
+	proposed := map[string]string{
+		"full_name": parsed.FullName, "job_title": parsed.JobTitle, "summary": parsed.Summary,
+		"birthday": normalizeDate(parsed.Birthday), "gender": parsed.Gender, "email": parsed.Email,
+		"phone": parsed.Phone, "address": parsed.Address,
+	}
+	for _, field := range mergeFields {
+		proposal := fieldProposal(field, current[field], proposed[field])
+		if proposal.Proposed != nil {
+			proposal.Confidence = parsedConfidence(parsed, field)
+		}
+		preview.Fields = append(preview.Fields, proposal)
+	}
+
+	education := slices.DeleteFunc(slices.Clone(parsed.Education), func(e models.CVEducationRequest) bool {
+		return strings.TrimSpace(e.Organization) == ""
+	})
+	matches, scores := pairByScore(len(education), len(details.Education), func(p, s int) float64 {
+		stored := details.Education[s]
+		score := utils.Similarity(education[p].Organization, stored.Organization)
+		if education[p].Major != nil && stored.Major != nil && *education[p].Major != "" && *stored.Major != "" {
+			score = 0.7*score + 0.3*utils.Similarity(*education[p].Major, *stored.Major)
+		}
+		return score
+	}, educationMatchThreshold)
+	for i, item := range education {
+		proposal := models.EducationProposal{ID: fmt.Sprintf("education:%d", i), Status: models.MergeNew, Proposed: item,
+			Confidence: parsedConfidence(parsed, "education")}
+		if s := matches[i]; s >= 0 {
+			stored := details.Education[s]
+			proposal.Current = &stored
+			proposal.MatchScore = scores[i]
+			proposal.Status = models.MergeUnchanged
+			if !sameValue(item.Organization, stored.Organization) || differs(item.Degree, stored.Degree) ||
+				differs(item.Major, stored.Major) ||
+				(item.GraduationYear != nil && (stored.GraduationYear == nil || *item.GraduationYear != *stored.GraduationYear)) {
+				proposal.Status = models.MergeChanged
+			}
+		}
+		preview.Education = append(preview.Education, proposal)
+	}
+
+	courses := slices.DeleteFunc(slices.Clone(parsed.Courses), func(c models.CVCourseRequest) bool {
+		return strings.TrimSpace(c.CourseName) == ""
+	})
+	matches, scores = pairByScore(len(courses), len(details.Courses), func(p, s int) float64 {
+		stored := details.Courses[s]
+		score := utils.Similarity(courses[p].CourseName, stored.CourseName)
+		if courses[p].Organization != "" && stored.Organization != nil && *stored.Organization != "" {
+			score = 0.8*score + 0.2*utils.Similarity(courses[p].Organization, *stored.Organization)
+		}
+		return score
+	}, courseMatchThreshold)
+	for i, item := range courses {
+		item.FinishDate = normalizeDate(item.FinishDate)
+		proposal := models.CourseProposal{ID: fmt.Sprintf("courses:%d", i), Status: models.MergeNew, Proposed: item,
+			Confidence: parsedConfidence(parsed, "courses")}
+		if s := matches[i]; s >= 0 {
+			stored := details.Courses[s]
+			proposal.Current = &stored
+			proposal.MatchScore = scores[i]
+			proposal.Status = models.MergeUnchanged
+			var storedDate *string
+			if stored.FinishDate != nil {
+				formatted := stored.FinishDate.Format("2006-01-02")
+				storedDate = &formatted
+			}
+			if !sameValue(item.CourseName, stored.CourseName) || differs(&item.Organization, stored.Organization) ||
+				differs(&item.FinishDate, storedDate) {
+				proposal.Status = models.MergeChanged
+			}
+		}
+		preview.Courses = append(preview.Courses, proposal)
+	}
+
+	skills := slices.DeleteFunc(slices.Clone(parsed.Skills), func(s models.CVSkillRequest) bool {
+		return strings.TrimSpace(s.SkillName) == ""
+	})
+	matches, scores = pairByScore(len(skills), len(details.Skills), func(p, s int) float64 {
+		return utils.Similarity(skills[p].SkillName, details.Skills[s].SkillName)
+	}, skillMatchThreshold)
+	for i, item := range skills {
+		proposal := models.SkillProposal{ID: fmt.Sprintf("skills:%d", i), Status: models.MergeNew, Proposed: item,
+			Confidence: parsedConfidence(parsed, "skills")}
+		if s := matches[i]; s >= 0 {
+			stored := details.Skills[s]
+			proposal.Current = &stored
+			proposal.MatchScore = scores[i]
+			proposal.Status = models.MergeUnchanged
+			if !sameValue(item.SkillName, stored.SkillName) || differs(&item.Description, stored.Description) {
+				proposal.Status = models.MergeChanged
+			}
+		}
+		preview.Skills = append(preview.Skills, proposal)
+	}
+
+	return preview
+}
+
+// parsedConfidence returns the parser's confidence in a field, or in a whole list, clamped to [0, 1].
+// It is nil when the parser gave none.
+func parsedConfidence(parsed models.ParsedCV, field string) *float64 {
+	confidence, found := parsed.Confidence[field]
+	if !found {
+		return nil
+	}
+	confidence = math.Max(0, math.Min(1, confidence))
+	return &confidence
+}
+
+func fieldProposal(field string, current *string, proposed string) models.FieldProposal {
+	proposal := models.FieldProposal{Field: field, Status: models.MergeUnchanged}
+	if current != nil && *current != "" {
+		proposal.Current = current
+	}
+	if proposed = strings.TrimSpace(proposed); proposed == "" {
+		return proposal
+	}
+
+	proposal.Proposed = &proposed
+	switch {
+	case proposal.Current == nil:
+		proposal.Status = models.MergeNew
+	case !sameValue(*proposal.Current, proposed):
+		proposal.Status = models.MergeChanged
+	}
+	return proposal
+}
+
+// pairByScore pairs parsed items with stored items, best scores first, each stored item at most once.
+// It returns for every parsed item the index of its stored item (-1 if none) and the score.
+func pairByScore(parsedCount, storedCount int, score func(parsed, stored int) float64, threshold float64) ([]int, []float64) {
+	type candidate struct {
+		parsed, stored int
+		score          float64
+	}
+	var candidates []candidate
+	for p := 0; p < parsedCount; p++ {
+		for s := 0; s < storedCount; s++ {
+			if value := score(p, s); value >= threshold {
+				candidates = append(candidates, candidate{p, s, value})
+			}
+		}
+	}
+	slices.SortStableFunc(candidates, func(a, b candidate) int {
+		switch {
+		case a.score > b.score:
+			return -1
+		case a.score < b.score:
+			return 1
+		default:
+			return 0
+		}
+	})
+
+	matches := make([]int, parsedCount)
+	scores := make([]float64, parsedCount)
+	for i := range matches {
+		matches[i] = -1
+	}
+	storedUsed := make([]bool, storedCount)
+	for _, candidate := range candidates {
+		if matches[candidate.parsed] >= 0 || storedUsed[candidate.stored] {
+			continue
+		}
+		matches[candidate.parsed] = candidate.stored
+		scores[candidate.parsed] = candidate.score
+		storedUsed[candidate.stored] = true
+	}
+	return matches, scores
+}
+
+// sameValue compares values ignoring case and spacing
+func sameValue(a, b string) bool {
+	return strings.EqualFold(strings.Join(strings.Fields(a), " "), strings.Join(strings.Fields(b), " "))
+}
+
+// differs reports whether a parsed optional value would change the stored one. Empty parsed values never do.
+func differs(proposed, stored *string) bool {
+	if proposed == nil || strings.TrimSpace(*proposed) == "" {
+		return false
+	}
+	return stored == nil || !sameValue(*proposed, *stored)
+}
+
+// normalizeDate returns the date as YYYY-MM-DD, or "" when it is not one
+func normalizeDate(value string) string {
+	parsed, err := time.Parse("2006-01-02", strings.TrimSpace(value))
+	if err != nil {
+		return ""
+	}
+	return parsed.Format("2006-01-02")
+}
+
+func sameInstant(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.Equal(*b)
+}
+
+// unknownProposals returns the accepted IDs and field names that the preview does not contain
+func unknownProposals(preview models.CVMergePreview, accept models.CVMergeSelection) []string {
+	known := map[string]bool{}
+	for _, proposal := range preview.Fields {
+		known[proposal.Field] = true
+	}
+	for _, proposal := range preview.Education {
+		known[proposal.ID] = true
+	}
+	for _, proposal := range preview.Courses {
+		known[proposal.ID] = true
+	}
+	for _, proposal := range preview.Skills {
+		known[proposal.ID] = true
+	}
+
+	var unknown []string
+	for _, id := range slices.Concat(accept.Fields, accept.Education, accept.Courses, accept.Skills) {
+		if !known[id] {
+			unknown = append(unknown, id)
+		}
+	}
+	return unknown
+}
+
+// applyMergeProposals writes the accepted new and changed proposals, creating the CV if needed,
+// then recomputes the CV status. The values written are recorded as AI-extracted and unverified.
+// It returns how many proposals of each kind were applied.
+func applyMergeProposals(ctx context.Context, tx pgx.Tx, userID, updatedBy string, base mergeBase, preview models.CVMergePreview, accept models.CVMergeSelection) (gin.H, error) {
+	cvID, detailID := base.CVID, base.Details.ID
+	if cvID == "" {
+		err := tx.QueryRow(ctx,
+			`INSERT INTO cv (user_id, last_updated_by, last_updated_at, status) VALUES ($1, $2, NOW(), 'Chưa cập nhật')
+			RETURNING id`, userID, updatedBy).Scan(&cvID)
+		if err != nil {
+			return nil, fmt.Errorf("error creating CV: %w", err)
+		}
+	}
+	if detailID == "" {
+		err := tx.QueryRow(ctx,
+			`INSERT INTO cv_details (cv_id, full_name, job_title, summary, created_at) VALUES ($1, '', '', '', NOW())
+			RETURNING id`, cvID).Scan(&detailID)
+		if err != nil {
+			return nil, fmt.Errorf("error creating CV details: %w", err)
+		}
+	}
+
+	applied := map[string]int{"fields": 0, "education": 0, "courses": 0, "skills": 0}
+
+	for _, proposal := range preview.Fields {
+		if proposal.Status == models.MergeUnchanged || !slices.Contains(accept.Fields, proposal.Field) {
+			continue
+		}
+		var value any = *proposal.Proposed
+		if proposal.Field == "birthday" {
+			value, _ = time.Parse("2006-01-02", *proposal.Proposed)
+		}
+		provenance, err := json.Marshal(models.Provenance{Source: models.SourceAI, Confidence: proposal.Confidence})
+		if err != nil {
+			return nil, fmt.Errorf("error encoding provenance of %s: %w", proposal.Field, err)
+		}
+		// The column comes from mergeFields, never from the request
+		_, err = tx.Exec(ctx,
+			"UPDATE cv_details SET "+proposal.Field+" = $1, provenance = provenance || jsonb_build_object($3::text, $4::jsonb) WHERE id = $2",
+			value, detailID, proposal.Field, string(provenance))
+		if err != nil {
+			return nil, fmt.Errorf("error updating %s: %w", proposal.Field, err)
+		}
+		applied["fields"]++
+	}
+
+	for _, proposal := range preview.Education {
+		if proposal.Status == models.MergeUnchanged || !slices.Contains(accept.Education, proposal.ID) {
+			continue
+		}
+		item := proposal.Proposed
+		var err error
+		if proposal.Current == nil {
+			_, err = tx.Exec(ctx,
+				`INSERT INTO cv_education (id, cv_id, organization, degree, major, graduation_year, source, verified, confidence)
+				VALUES (uuid_generate_v4(), $1, $2, $3, $4, $5, 'ai', FALSE, $6)`,
+				detailID, item.Organization, item.Degree, item.Major, item.GraduationYear, proposal.Confidence)
+		} else {
+			_, err = tx.Exec(ctx,
+				`UPDATE cv_education SET organization = $2, degree = COALESCE(NULLIF($3, ''), degree),
+					major = COALESCE(NULLIF($4, ''), major), graduation_year = COALESCE($5, graduation_year),
+					source = 'ai', verified = FALSE, confidence = $6
+				WHERE id = $1`,
+				proposal.Current.ID, item.Organization, item.Degree, item.Major, item.GraduationYear, proposal.Confidence)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error saving education %s: %w", proposal.ID, err)
+		}
+		applied["education"]++
+	}
+
+	for _, proposal := range preview.Courses {
+		if proposal.Status == models.MergeUnchanged || !slices.Contains(accept.Courses, proposal.ID) {
+			continue
+		}
+		item := proposal.Proposed
+		var finishDate *time.Time
+		if parsedDate, err := time.Parse("2006-01-02", item.FinishDate); err == nil {
+			finishDate = &parsedDate
+		}
+		var err error
+		if proposal.Current == nil {
+			_, err = tx.Exec(ctx,
+				`INSERT INTO cv_courses (id, cv_id, course_name, organization, finish_date, source, verified, confidence)
+				VALUES (uuid_generate_v4(), $1, $2, $3, $4, 'ai', FALSE, $5)`,
+				detailID, item.CourseName, item.Organization, finishDate, proposal.Confidence)
+		} else {
+			_, err = tx.Exec(ctx,
+				`UPDATE cv_courses SET course_name = $2, organization = COALESCE(NULLIF($3, ''), organization),
+					finish_date = COALESCE($4, finish_date), source = 'ai', verified = FALSE, confidence = $5
+				WHERE id = $1`,
+				proposal.Current.ID, item.CourseName, item.Organization, finishDate, proposal.Confidence)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error saving course %s: %w", proposal.ID, err)
+		}
+		applied["courses"]++
+	}
+
+	for _, proposal := range preview.Skills {
+		if proposal.Status == models.MergeUnchanged || !slices.Contains(accept.Skills, proposal.ID) {
+			continue
+		}
+		item := proposal.Proposed
+		var err error
+		if proposal.Current == nil {
+			_, err = tx.Exec(ctx,
+				`INSERT INTO cv_skills (id, cv_id, skill_name, description, source, verified, confidence)
+				VALUES (uuid_generate_v4(), $1, $2, $3, 'ai', FALSE, $4)`,
+				detailID, item.SkillName, item.Description, proposal.Confidence)
+		} else {
+			_, err = tx.Exec(ctx,
+				`UPDATE cv_skills SET skill_name = $2, description = COALESCE(NULLIF($3, ''), description),
+					source = 'ai', verified = FALSE, confidence = $4
+				WHERE id = $1`,
+				proposal.Current.ID, item.SkillName, item.Description, proposal.Confidence)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error saving skill %s: %w", proposal.ID, err)
+		}
+		applied["skills"]++
+	}
+
+	status, err := updateCVStatus(ctx, tx, cvID, detailID, updatedBy)
+	if err != nil {
+		return nil, err
+	}
+
+	return gin.H{"applied": applied, "cv_status": status}, nil
+}
+
+// updateCVStatus recomputes the status of a CV after a change to its details and records who made it
+func updateCVStatus(ctx context.Context, tx pgx.Tx, cvID, detailID, updatedBy string) (string, error) {
+	// Same completeness rule as CreateOrUpdateCV
+	var status string
+	err := tx.QueryRow(ctx,
+		`SELECT CASE WHEN d.full_name <> '' AND d.job_title <> '' AND d.summary <> '' AND d.birthday IS NOT NULL
+				AND COALESCE(d.gender, '') <> '' AND COALESCE(d.email, '') <> ''
+				AND COALESCE(d.phone, '') <> '' AND COALESCE(d.address, '') <> ''
+				AND EXISTS (SELECT 1 FROM cv_education e WHERE e.cv_id = d.id)
+				AND EXISTS (SELECT 1 FROM cv_skills s WHERE s.cv_id = d.id)
+			THEN 'Đã cập nhật' ELSE 'Chưa cập nhật' END
+		FROM cv_details d WHERE d.id = $1`, detailID).Scan(&status)
+	if err != nil {
+		return "", fmt.Errorf("error computing CV status: %w", err)
+	}
+	_, err = tx.Exec(ctx,
+		"UPDATE cv SET last_updated_by = $1, last_updated_at = NOW(), status = $2 WHERE id = $3",
+		updatedBy, status, cvID)
+	if err != nil {
+		return "", fmt.Errorf("error updating CV record: %w", err)
+	}
+	return status, nil
+}
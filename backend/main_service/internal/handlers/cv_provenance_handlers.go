@@ -0,0 +1,316 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/vdt/cv-management/internal/audit"
+	"github.com/vdt/cv-management/internal/database"
+	"github.com/vdt/cv-management/internal/models"
+)
+
+// provenanceLists are the CV list tables, with the content that identifies an item across the
+// delete-and-insert of a full CV update
+var provenanceLists = []struct{ name, table, key string }{
+	{"education", "cv_education",
+		"organization || '|' || COALESCE(degree, '') || '|' || COALESCE(major, '') || '|' || COALESCE(graduation_year::text, '')"},
+	{"courses", "cv_courses",
+		"course_name || '|' || COALESCE(organization, '') || '|' || COALESCE(finish_date::text, '')"},
+	{"skills", "cv_skills", "skill_name || '|' || COALESCE(description, '')"},
+}
+
+// cvProvenance is the provenance of a CV before a full update, so the values the update keeps keep it
+type cvProvenance struct {
+	values map[string]string                       // field values as text, by column name
+	fields map[string]models.Provenance            // by column name
+	items  map[string]map[string]models.Provenance // by list table, then by item content
+}
+
+// loadCVProvenance loads the provenance of the CV details, empty when there are none yet
+func loadCVProvenance(ctx context.Context, tx pgx.Tx, detailID string) (cvProvenance, error) {
+	previous := cvProvenance{values: map[string]string{}, fields: map[string]models.Provenance{},
+		items: map[string]map[string]models.Provenance{}}
+	for _, list := range provenanceLists {
+		previous.items[list.table] = map[string]models.Provenance{}
+	}
+	if detailID == "" {
+		return previous, nil
+	}
+
+	var err error
+	if previous.values, previous.fields, err = loadFieldProvenance(ctx, tx, detailID); err != nil {
+		return previous, err
+	}
+	for _, list := range provenanceLists {
+		// The table and key come from provenanceLists, never from the request
+		rows, err := tx.Query(ctx,
+			"SELECT "+list.key+", source, verified, confidence FROM "+list.table+" WHERE cv_id = $1", detailID)
+		if err != nil {
+			return previous, fmt.Errorf("error loading provenance of %s: %w", list.name, err)
+		}
+		for rows.Next() {
+			var key string
+			var provenance models.Provenance
+			if err := rows.Scan(&key, &provenance.Source, &provenance.Verified, &provenance.Confidence); err != nil {
+				rows.Close()
+				return previous, fmt.Errorf("error scanning provenance of %s: %w", list.name, err)
+			}
+			previous.items[list.table][key] = provenance
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return previous, fmt.Errorf("error loading provenance of %s: %w", list.name, err)
+		}
+	}
+	return previous, nil
+}
+
+// loadFieldProvenance loads the values of the CV fields as text, with their provenance
+func loadFieldProvenance(ctx context.Context, tx pgx.Tx, detailID string) (map[string]string, map[string]models.Provenance, error) {
+	columns := make([]string, len(mergeFields))
+	texts := make([]string, len(mergeFields))
+	dest := make([]any, 0, len(mergeFields)+1)
+	for i, field := range mergeFields {
+		columns[i] = "COALESCE(" + field + "::text, '')"
+		dest = append(dest, &texts[i])
+	}
+	var provenance map[string]models.Provenance
+	dest = append(dest, &provenance)
+
+	err := tx.QueryRow(ctx,
+		"SELECT "+strings.Join(columns, ", ")+", provenance FROM cv_details WHERE id = $1", detailID).Scan(dest...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error loading provenance of CV details %s: %w", detailID, err)
+	}
+
+	values := map[string]string{}
+	for i, field := range mergeFields {
+		values[field] = texts[i]
+	}
+	if provenance == nil {
+		provenance = map[string]models.Provenance{}
+	}
+	return values, provenance, nil
+}
+
+// recordCVProvenance records the provenance of the CV after a full update. Values and items the update
+// kept keep their provenance; the others get the source, verified only when the owner entered them.
+func recordCVProvenance(ctx context.Context, tx pgx.Tx, detailID string, previous cvProvenance, source string) error {
+	changed := models.Provenance{Source: source, Verified: source == models.SourceManual}
+
+	values, _, err := loadFieldProvenance(ctx, tx, detailID)
+	if err != nil {
+		return err
+	}
+	fields := map[string]models.Provenance{}
+	for _, field := range mergeFields {
+		value, before := values[field], previous.values[field]
+		if value == "" {
+			continue
+		}
+		if value != before {
+			fields[field] = changed
+		} else if provenance, found := previous.fields[field]; found {
+			fields[field] = provenance
+		}
+	}
+	if _, err := tx.Exec(ctx, "UPDATE cv_details SET provenance = $2 WHERE id = $1", detailID, fields); err != nil {
+		return fmt.Errorf("error saving provenance of CV details %s: %w", detailID, err)
+	}
+
+	for _, list := range provenanceLists {
+		rows, err := tx.Query(ctx, "SELECT id::text, "+list.key+" FROM "+list.table+" WHERE cv_id = $1", detailID)
+		if err != nil {
+			return fmt.Errorf("error loading %s: %w", list.name, err)
+		}
+		var ids, sources []string
+		var verified []bool
+		var confidences []*float64
+		for rows.Next() {
+			var id, key string
+			if err := rows.Scan(&id, &key); err != nil {
+				rows.Close()
+				return fmt.Errorf("error scanning %s: %w", list.name, err)
+			}
+			provenance, found := previous.items[list.table][key]
+			if !found {
+				provenance = changed
+			}
+			ids = append(ids, id)
+			sources = append(sources, provenance.Source)
+			verified = append(verified, provenance.Verified)
+			confidences = append(confidences, provenance.Confidence)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("error loading %s: %w", list.name, err)
+		}
+		if len(ids) == 0 {
+			continue
+		}
+
+		_, err = tx.Exec(ctx,
+			`UPDATE `+list.table+` t SET source = v.source, verified = v.verified, confidence = v.confidence
+			FROM unnest($1::text[], $2::text[], $3::boolean[], $4::float8[]) AS v(id, source, verified, confidence)
+			WHERE t.id = v.id::uuid`,
+			ids, sources, verified, confidences)
+		if err != nil {
+			return fmt.Errorf("error saving provenance of %s: %w", list.name, err)
+		}
+	}
+	return nil
+}
+
+// unverifiedCVData lists the fields and list items of the CV its owner hasn't verified
+func unverifiedCVData(details models.CVDetail) models.CVVerification {
+	unverified := models.CVVerification{Fields: []string{}, Education: []string{}, Courses: []string{}, Skills: []string{}}
+	for _, field := range mergeFields {
+		if provenance, found := details.Provenance[field]; found && !provenance.Verified {
+			unverified.Fields = append(unverified.Fields, field)
+		}
+	}
+	for _, item := range details.Education {
+		if !item.Verified {
+			unverified.Education = append(unverified.Education, item.ID)
+		}
+	}
+	for _, item := range details.Courses {
+		if !item.Verified {
+			unverified.Courses = append(unverified.Courses, item.ID)
+		}
+	}
+	for _, item := range details.Skills {
+		if !item.Verified {
+			unverified.Skills = append(unverified.Skills, item.ID)
+		}
+	}
+	return unverified
+}
+
+// VerifyCV lets the owner confirm the AI-extracted and admin-edited data of their CV: the listed fields
+// and list items, or all of it
+func VerifyCV(c *gin.Context) {
+	userID := c.GetString("userID")
+
+	var request models.CVVerifyRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid request data: " + err.Error(),
+		})
+		return
+	}
+	var unknown []string
+	for _, field := range request.Fields {
+		if !slices.Contains(mergeFields, field) {
+			unknown = append(unknown, field)
+		}
+	}
+	if len(unknown) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Unknown fields: " + strings.Join(unknown, ", "),
+		})
+		return
+	}
+
+	tx, err := database.DB.Begin(c)
+	if err != nil {
+		fmt.Printf("VerifyCV: Error starting transaction: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error starting database transaction",
+		})
+		return
+	}
+	defer tx.Rollback(c)
+
+	var detailID string
+	var provenance map[string]models.Provenance
+	err = tx.QueryRow(c,
+		`SELECT d.id, d.provenance FROM cv JOIN cv_details d ON d.cv_id = cv.id
+		WHERE cv.user_id = $1 FOR UPDATE OF d`, userID).Scan(&detailID, &provenance)
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "CV not found for this user",
+		})
+		return
+	}
+	if err != nil {
+		fmt.Printf("VerifyCV: Error loading CV of user %s: %v\n", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error loading CV",
+		})
+		return
+	}
+
+	before, ok := auditSnapshot(c, func() (json.RawMessage, error) { return audit.CVSnapshot(c, tx, userID) })
+	if !ok {
+		return
+	}
+
+	verified := map[string]int64{"fields": 0, "education": 0, "courses": 0, "skills": 0}
+	for field, value := range provenance {
+		if !value.Verified && (request.All || slices.Contains(request.Fields, field)) {
+			value.Verified = true
+			provenance[field] = value
+			verified["fields"]++
+		}
+	}
+	if _, err := tx.Exec(c, "UPDATE cv_details SET provenance = $2 WHERE id = $1", detailID, provenance); err != nil {
+		fmt.Printf("VerifyCV: Error saving provenance of CV details %s: %v\n", detailID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error saving CV data",
+		})
+		return
+	}
+
+	items := map[string][]string{"education": request.Education, "courses": request.Courses, "skills": request.Skills}
+	for _, list := range provenanceLists {
+		tag, err := tx.Exec(c,
+			"UPDATE "+list.table+" SET verified = TRUE WHERE cv_id = $1 AND NOT verified AND ($2 OR id::text = ANY($3))",
+			detailID, request.All, items[list.name])
+		if err != nil {
+			fmt.Printf("VerifyCV: Error verifying %s of CV details %s: %v\n", list.name, detailID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  "error",
+				"message": "Error saving CV data",
+			})
+			return
+		}
+		verified[list.name] = tag.RowsAffected()
+	}
+
+	after, ok := auditSnapshot(c, func() (json.RawMessage, error) { return audit.CVSnapshot(c, tx, userID) })
+	if !ok {
+		return
+	}
+	if !recordAudit(c, tx, audit.Entry{Action: auditCVVerify, TargetType: "cv", TargetID: userID, Before: before, After: after}) {
+		return
+	}
+
+	if err := tx.Commit(c); err != nil {
+		fmt.Printf("VerifyCV: Error committing transaction: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error saving CV data",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "CV data verified",
+		"data":    gin.H{"verified": verified},
+	})
+}
@@ -1,10 +1,14 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/vdt/cv-management/internal/audit"
 	"github.com/vdt/cv-management/internal/database"
 	"github.com/vdt/cv-management/internal/models"
 )
@@ -14,7 +18,7 @@ func GetDepartments(c *gin.Context) {
 	fmt.Println("GetDepartments: Fetching all departments")
 
 	// Query database for departments
-	rows, err := database.DB.Query(c, "SELECT id, name FROM departments ORDER BY name")
+	rows, err := database.DB.Query(c, "SELECT id, name, manager_id FROM departments ORDER BY name")
 	if err != nil {
 		fmt.Printf("GetDepartments error: %v\n", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -29,7 +33,7 @@ func GetDepartments(c *gin.Context) {
 	var departments []models.Department
 	for rows.Next() {
 		var dept models.Department
-		if err := rows.Scan(&dept.ID, &dept.Name); err != nil {
+		if err := rows.Scan(&dept.ID, &dept.Name, &dept.ManagerID); err != nil {
 			fmt.Printf("GetDepartments scan error: %v\n", err)
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"status":  "error",
@@ -66,12 +70,15 @@ func GetDepartmentsWithStats(c *gin.Context) {
 		SELECT
 			d.id,
 			d.name,
-			COALESCE(member_count.count, 0) as member_count
+			COALESCE(member_count.count, 0) as member_count,
+			COALESCE(manager.id::text, '') as manager_id,
+			COALESCE(manager.full_name, 'Chưa có') as manager_name
 		FROM departments d
+		LEFT JOIN users manager ON manager.id = d.manager_id
 		LEFT JOIN (
 			SELECT department_id, COUNT(*) as count
 			FROM users
-			WHERE department_id IS NOT NULL
+			WHERE department_id IS NOT NULL AND deactivated_at IS NULL
 			GROUP BY department_id
 		) member_count ON d.id = member_count.department_id
 		ORDER BY d.name`)
@@ -98,8 +105,7 @@ func GetDepartmentsWithStats(c *gin.Context) {
 	var departments []DepartmentWithStats
 	for rows.Next() {
 		var dept DepartmentWithStats
-		// Scan the basic fields
-		if err := rows.Scan(&dept.ID, &dept.Name, &dept.MemberCount); err != nil {
+		if err := rows.Scan(&dept.ID, &dept.Name, &dept.MemberCount, &dept.ManagerID, &dept.ManagerName); err != nil {
 			fmt.Printf("GetDepartmentsWithStats scan error: %v\n", err)
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"status":  "error",
@@ -108,29 +114,6 @@ func GetDepartmentsWithStats(c *gin.Context) {
 			return
 		}
 
-		// Query for BUL/Lead manager in this department
-		var managerID, managerName string
-		managerQuery := `
-			SELECT u.id, u.full_name
-			FROM users u
-			JOIN user_roles ur ON u.id = ur.user_id
-			JOIN roles r ON ur.role_id = r.id
-			WHERE u.department_id = $1 AND r.name = 'BUL/Lead'
-			LIMIT 1`
-
-		err := database.DB.QueryRow(c, managerQuery, dept.ID).Scan(&managerID, &managerName)
-		if err != nil {
-			// No BUL/Lead found in this department, set default values
-			fmt.Printf("No BUL/Lead manager found for department %s (%s): %v\n", dept.Name, dept.ID, err)
-			dept.ManagerName = "Chưa có"
-			dept.ManagerID = ""
-		} else {
-			// BUL/Lead manager found
-			dept.ManagerName = managerName
-			dept.ManagerID = managerID
-			fmt.Printf("Found BUL/Lead manager for department %s: %s (%s)\n", dept.Name, managerName, managerID)
-		}
-
 		departments = append(departments, dept)
 	}
 
@@ -156,7 +139,8 @@ func CreateDepartment(c *gin.Context) {
 	fmt.Println("CreateDepartment: Creating new department")
 
 	var req struct {
-		Name string `json:"name" binding:"required"`
+		Name      string `json:"name" binding:"required"`
+		ManagerID string `json:"manager_id" binding:"omitempty,uuid"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -190,9 +174,29 @@ func CreateDepartment(c *gin.Context) {
 		return
 	}
 
+	tx, err := database.DB.Begin(c)
+	if err != nil {
+		fmt.Printf("CreateDepartment transaction begin error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error creating department",
+		})
+		return
+	}
+	defer tx.Rollback(c)
+
 	// Insert new department
+	managerID := nullStringPtr(req.ManagerID)
 	var departmentID string
-	err = database.DB.QueryRow(c, "INSERT INTO departments (name) VALUES ($1) RETURNING id", req.Name).Scan(&departmentID)
+	err = tx.QueryRow(c, "INSERT INTO departments (name, manager_id) VALUES ($1, $2) RETURNING id",
+		req.Name, managerID).Scan(&departmentID)
+	if isForeignKeyViolation(err) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Manager not found",
+		})
+		return
+	}
 	if err != nil {
 		fmt.Printf("CreateDepartment insert error: %v\n", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -203,8 +207,22 @@ func CreateDepartment(c *gin.Context) {
 	}
 
 	department := models.Department{
-		ID:   departmentID,
-		Name: req.Name,
+		ID:        departmentID,
+		Name:      req.Name,
+		ManagerID: managerID,
+	}
+
+	if !recordAudit(c, tx, audit.Entry{Action: auditDepartmentCreate, TargetType: "department", TargetID: departmentID, After: department}) {
+		return
+	}
+
+	if err := tx.Commit(c); err != nil {
+		fmt.Printf("CreateDepartment transaction commit error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error creating department",
+		})
+		return
 	}
 
 	fmt.Printf("CreateDepartment: Successfully created department %s with ID %s\n", req.Name, departmentID)
@@ -215,16 +233,22 @@ func CreateDepartment(c *gin.Context) {
 	})
 }
 
-// UpdateDepartment updates an existing department (Admin only)
+// UpdateDepartment updates an existing department (Admin only). Without manager_id the manager is
+// kept; an empty manager_id removes it.
 func UpdateDepartment(c *gin.Context) {
 	id := c.Param("id")
 	fmt.Printf("UpdateDepartment: Updating department %s\n", id)
 
 	var req struct {
-		Name string `json:"name" binding:"required"`
+		Name      string  `json:"name" binding:"required"`
+		ManagerID *string `json:"manager_id"`
 	}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
+	err := c.ShouldBindJSON(&req)
+	if err == nil && req.ManagerID != nil && *req.ManagerID != "" {
+		err = uuid.Validate(*req.ManagerID)
+	}
+	if err != nil {
 		fmt.Printf("UpdateDepartment bind error: %v\n", err)
 		c.JSON(http.StatusBadRequest, gin.H{
 			"status":  "error",
@@ -235,22 +259,22 @@ func UpdateDepartment(c *gin.Context) {
 
 	fmt.Printf("UpdateDepartment: Updating department %s with name: %s\n", id, req.Name)
 
-	// Check if department exists
-	var exists bool
-	err := database.DB.QueryRow(c, "SELECT EXISTS(SELECT 1 FROM departments WHERE id = $1)", id).Scan(&exists)
-	if err != nil {
-		fmt.Printf("UpdateDepartment existence check error: %v\n", err)
-		c.JSON(http.StatusInternalServerError, gin.H{
+	// Check if department exists and get its current name and manager for the audit log
+	var previous models.Department
+	err = database.DB.QueryRow(c, "SELECT id, name, manager_id FROM departments WHERE id = $1", id).
+		Scan(&previous.ID, &previous.Name, &previous.ManagerID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{
 			"status":  "error",
-			"message": "Error checking department existence",
+			"message": "Department not found",
 		})
 		return
 	}
-
-	if !exists {
-		c.JSON(http.StatusNotFound, gin.H{
+	if err != nil {
+		fmt.Printf("UpdateDepartment existence check error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
 			"status":  "error",
-			"message": "Department not found",
+			"message": "Error checking department existence",
 		})
 		return
 	}
@@ -275,8 +299,32 @@ func UpdateDepartment(c *gin.Context) {
 		return
 	}
 
+	managerID := previous.ManagerID
+	if req.ManagerID != nil {
+		managerID = nullStringPtr(*req.ManagerID)
+	}
+
+	tx, err := database.DB.Begin(c)
+	if err != nil {
+		fmt.Printf("UpdateDepartment transaction begin error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error updating department",
+		})
+		return
+	}
+	defer tx.Rollback(c)
+
 	// Update department
-	result, err := database.DB.Exec(c, "UPDATE departments SET name = $1 WHERE id = $2", req.Name, id)
+	result, err := tx.Exec(c, "UPDATE departments SET name = $1, manager_id = $2 WHERE id = $3",
+		req.Name, managerID, id)
+	if isForeignKeyViolation(err) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Manager not found",
+		})
+		return
+	}
 	if err != nil {
 		fmt.Printf("UpdateDepartment update error: %v\n", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -298,8 +346,27 @@ func UpdateDepartment(c *gin.Context) {
 	}
 
 	department := models.Department{
-		ID:   id,
-		Name: req.Name,
+		ID:        id,
+		Name:      req.Name,
+		ManagerID: managerID,
+	}
+
+	if !recordAudit(c, tx, audit.Entry{
+		Action:     auditDepartmentUpdate,
+		TargetType: "department",
+		TargetID:   id,
+		Before:     previous,
+		After:      department,
+	}) {
+		return
+	}
+	if err := tx.Commit(c); err != nil {
+		fmt.Printf("UpdateDepartment transaction commit error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error updating department",
+		})
+		return
 	}
 
 	fmt.Printf("UpdateDepartment: Successfully updated department %s\n", id)
@@ -347,8 +414,19 @@ func DeleteDepartment(c *gin.Context) {
 		return
 	}
 
+	tx, err := database.DB.Begin(c)
+	if err != nil {
+		fmt.Printf("DeleteDepartment transaction begin error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error deleting department",
+		})
+		return
+	}
+	defer tx.Rollback(c)
+
 	// Delete department
-	result, err := database.DB.Exec(c, "DELETE FROM departments WHERE id = $1", id)
+	result, err := tx.Exec(c, "DELETE FROM departments WHERE id = $1", id)
 	if err != nil {
 		fmt.Printf("DeleteDepartment delete error: %v\n", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -369,6 +447,23 @@ func DeleteDepartment(c *gin.Context) {
 		return
 	}
 
+	if !recordAudit(c, tx, audit.Entry{
+		Action:     auditDepartmentDelete,
+		TargetType: "department",
+		TargetID:   id,
+		Before:     models.Department{ID: id, Name: departmentName},
+	}) {
+		return
+	}
+	if err := tx.Commit(c); err != nil {
+		fmt.Printf("DeleteDepartment transaction commit error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error deleting department",
+		})
+		return
+	}
+
 	fmt.Printf("DeleteDepartment: Successfully deleted department %s (%s)\n", id, departmentName)
 
 	c.JSON(http.StatusOK, gin.H{
@@ -0,0 +1,335 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/vdt/cv-management/internal/audit"
+	"github.com/vdt/cv-management/internal/database"
+	"github.com/vdt/cv-management/internal/models"
+	"github.com/vdt/cv-management/internal/utils"
+)
+
+// errDirectoryEmailTaken means a directory entry has the email of a local account, which the sync never takes over
+var errDirectoryEmailTaken = errors.New("email belongs to a local account")
+
+// directorySyncMutex prevents the scheduled and the manual sync from running at the same time
+var directorySyncMutex sync.Mutex
+
+// StartDirectorySync starts the scheduled directory sync when the LDAP provider is enabled
+func StartDirectorySync() {
+	if utils.AuthProvider() != "ldap" {
+		return
+	}
+
+	interval := time.Hour
+	if value := os.Getenv("LDAP_SYNC_INTERVAL"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			log.Printf("Invalid LDAP_SYNC_INTERVAL %q, using %s: %v", value, interval, err)
+		} else {
+			interval = parsed
+		}
+	}
+
+	// A zero or negative interval disables the scheduled sync (manual sync is still available)
+	if interval <= 0 {
+		log.Printf("Scheduled directory sync disabled")
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			client, err := utils.NewLDAPClient()
+			if err != nil {
+				log.Printf("Directory sync: failed to create LDAP client: %v", err)
+			} else if result, err := SyncDirectory(context.Background(), client, audit.SystemActor("directory_sync")); err != nil {
+				log.Printf("Directory sync failed: %v", err)
+			} else {
+				log.Printf("Directory sync finished: %d entries, %d created, %d updated, %d deactivated, %d skipped",
+					result.TotalEntries, result.Created, result.Updated, result.Deactivated, result.Skipped)
+			}
+
+			<-ticker.C
+		}
+	}()
+
+	log.Printf("Scheduled directory sync every %s", interval)
+}
+
+// TriggerDirectorySync runs a directory sync on demand (Admin only)
+func TriggerDirectorySync(c *gin.Context) {
+	if utils.AuthProvider() != "ldap" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Directory sync is only available when AUTH_PROVIDER=ldap",
+		})
+		return
+	}
+
+	client, err := utils.NewLDAPClient()
+	if err != nil {
+		fmt.Printf("TriggerDirectorySync: Error creating LDAP client: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to initialize directory client",
+		})
+		return
+	}
+
+	result, err := SyncDirectory(c, client, audit.ActorFromContext(c))
+	if err != nil {
+		fmt.Printf("TriggerDirectorySync: Sync failed: %v\n", err)
+		c.JSON(http.StatusBadGateway, gin.H{
+			"status":  "error",
+			"message": "Directory sync failed",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   result,
+	})
+}
+
+// SyncDirectory creates and updates users from the directory and deactivates directory users who have left.
+// The run is recorded in the audit log as one entry for the actor, listing the deactivated users.
+func SyncDirectory(ctx context.Context, client utils.DirectoryClient, actor audit.Actor) (*models.DirectorySyncResult, error) {
+	directorySyncMutex.Lock()
+	defer directorySyncMutex.Unlock()
+
+	result := &models.DirectorySyncResult{StartedAt: time.Now()}
+
+	entries, err := client.SearchUsers()
+	if err != nil {
+		return nil, err
+	}
+	result.TotalEntries = len(entries)
+
+	// An empty result almost always means a broken filter or base DN, never that everybody left
+	if len(entries) == 0 {
+		return nil, errors.New("directory returned no entries, refusing to deactivate every directory user")
+	}
+
+	tx, err := database.DB.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Not nil: = ANY of a NULL array is NULL, which would deactivate nobody
+	seenUserIDs := []string{}
+	for _, entry := range entries {
+		if entry.Email == "" || entry.EmployeeCode == "" || entry.FullName == "" {
+			result.Skipped++
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: missing email, employee code or full name", entry.DN))
+
+			// A bad attribute doesn't mean the person left, so the user it still matches stays active
+			userID, err := findDirectoryUser(ctx, tx, entry)
+			if err != nil {
+				return nil, fmt.Errorf("error syncing %s: %w", entry.DN, err)
+			}
+			if userID != "" && !entry.Disabled {
+				seenUserIDs = append(seenUserIDs, userID)
+			}
+			continue
+		}
+
+		userID, created, err := upsertDirectoryUser(ctx, tx, entry)
+		if errors.Is(err, errDirectoryEmailTaken) {
+			result.Skipped++
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: %s is the email of a local account", entry.DN, entry.Email))
+			continue
+		}
+		if err != nil {
+			// Abort the whole run so a half-applied sync never deactivates the wrong people
+			return nil, fmt.Errorf("error syncing %s: %w", entry.DN, err)
+		}
+
+		if created {
+			result.Created++
+		} else {
+			result.Updated++
+		}
+
+		if !entry.Disabled {
+			seenUserIDs = append(seenUserIDs, userID)
+		}
+	}
+
+	// Deactivate directory-managed users that were not returned (or are disabled) in the directory
+	rows, err := tx.Query(ctx,
+		`UPDATE users SET deactivated_at = NOW(), deactivated_by_sync = TRUE
+		WHERE auth_source = 'ldap' AND deactivated_at IS NULL AND NOT (id = ANY($1::uuid[]))
+		RETURNING id`,
+		seenUserIDs)
+	if err != nil {
+		return nil, fmt.Errorf("error deactivating users who left the directory: %w", err)
+	}
+	deactivatedIDs, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("error deactivating users who left the directory: %w", err)
+	}
+	result.Deactivated = len(deactivatedIDs)
+
+	err = audit.RecordTx(ctx, tx, actor, audit.Entry{
+		Action:     auditDirectorySync,
+		TargetType: "directory",
+		TargetID:   utils.AuthProvider(),
+		After: map[string]any{
+			"total_entries":        result.TotalEntries,
+			"created":              result.Created,
+			"updated":              result.Updated,
+			"skipped":              result.Skipped,
+			"deactivated_user_ids": deactivatedIDs,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("error committing directory sync: %w", err)
+	}
+
+	result.FinishedAt = time.Now()
+	return result, nil
+}
+
+// findDirectoryUser returns the directory-managed user matching a directory entry, by email first and
+// then by employee code, or "" when there is none
+func findDirectoryUser(ctx context.Context, tx pgx.Tx, entry utils.DirectoryEntry) (string, error) {
+	if entry.Email == "" && entry.EmployeeCode == "" {
+		return "", nil
+	}
+
+	var userID string
+	err := tx.QueryRow(ctx,
+		`SELECT id FROM users
+		WHERE auth_source = 'ldap' AND ((lower(email) = $1 AND $1 <> '') OR (employee_code = $2 AND $2 <> ''))
+		ORDER BY (lower(email) = $1) DESC
+		LIMIT 1`,
+		entry.Email, entry.EmployeeCode).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("error looking up user: %w", err)
+	}
+	return userID, nil
+}
+
+// upsertDirectoryUser creates or updates the local user matching a directory entry. Local accounts are
+// never matched; an entry with the email of one fails with errDirectoryEmailTaken.
+func upsertDirectoryUser(ctx context.Context, tx pgx.Tx, entry utils.DirectoryEntry) (string, bool, error) {
+	departmentID, err := findOrCreateDepartment(ctx, tx, entry.Department)
+	if err != nil {
+		return "", false, err
+	}
+
+	userID, err := findDirectoryUser(ctx, tx, entry)
+	if err != nil {
+		return "", false, err
+	}
+
+	var taken bool
+	err = tx.QueryRow(ctx,
+		"SELECT EXISTS (SELECT 1 FROM users WHERE lower(email) = $1 AND auth_source <> 'ldap')",
+		entry.Email).Scan(&taken)
+	if err != nil {
+		return "", false, fmt.Errorf("error looking up user: %w", err)
+	}
+	if taken {
+		return "", false, errDirectoryEmailTaken
+	}
+
+	if userID != "" {
+		// The directory is authoritative for the profile and the active state of the users it manages, but
+		// only lifts the deactivations it made itself: an Admin's deactivation or a merge stays
+		_, err = tx.Exec(ctx,
+			`UPDATE users
+			SET employee_code = $1, full_name = $2, email = $3, department_id = $4,
+				deactivated_at = CASE WHEN $5 THEN COALESCE(deactivated_at, NOW())
+					WHEN deactivated_by_sync THEN NULL ELSE deactivated_at END,
+				deactivated_by_sync = CASE WHEN $5 THEN deactivated_by_sync OR deactivated_at IS NULL ELSE FALSE END
+			WHERE id = $6`,
+			entry.EmployeeCode, entry.FullName, entry.Email, departmentID, entry.Disabled, userID)
+		if err != nil {
+			return "", false, fmt.Errorf("error updating user: %w", err)
+		}
+		return userID, false, nil
+	}
+
+	// Directory users never get a local password
+	err = tx.QueryRow(ctx,
+		`INSERT INTO users (id, employee_code, full_name, email, password, department_id, auth_source,
+			deactivated_at, deactivated_by_sync, created_at)
+		VALUES (uuid_generate_v4(), $1, $2, $3, '', $4, 'ldap', CASE WHEN $5 THEN NOW() END, $5, NOW())
+		RETURNING id`,
+		entry.EmployeeCode, entry.FullName, entry.Email, departmentID, entry.Disabled).Scan(&userID)
+	if err != nil {
+		return "", false, fmt.Errorf("error creating user: %w", err)
+	}
+
+	// New users get the Employee role and an empty CV, the same as a registration
+	_, err = tx.Exec(ctx,
+		`INSERT INTO user_roles (user_id, role_id) SELECT $1, id FROM roles WHERE name = 'Employee'`,
+		userID)
+	if err != nil {
+		return "", false, fmt.Errorf("error assigning Employee role: %w", err)
+	}
+
+	var cvID string
+	err = tx.QueryRow(ctx,
+		"INSERT INTO cv (id, user_id, status) VALUES (uuid_generate_v4(), $1, 'Chưa cập nhật') RETURNING id",
+		userID).Scan(&cvID)
+	if err != nil {
+		return "", false, fmt.Errorf("error creating user CV: %w", err)
+	}
+
+	_, err = tx.Exec(ctx,
+		`INSERT INTO cv_details (id, cv_id, full_name, job_title, summary, created_at)
+		VALUES (uuid_generate_v4(), $1, '', '', '', NOW())`,
+		cvID)
+	if err != nil {
+		return "", false, fmt.Errorf("error creating user CV details: %w", err)
+	}
+
+	return userID, true, nil
+}
+
+// findOrCreateDepartment returns the ID of the department with the given name, creating it if needed
+func findOrCreateDepartment(ctx context.Context, tx pgx.Tx, name string) (*string, error) {
+	if name == "" {
+		return nil, nil
+	}
+
+	var departmentID string
+	err := tx.QueryRow(ctx, "SELECT id FROM departments WHERE name = $1", name).Scan(&departmentID)
+	if err == nil {
+		return &departmentID, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("error looking up department %s: %w", name, err)
+	}
+
+	err = tx.QueryRow(ctx, "INSERT INTO departments (name) VALUES ($1) RETURNING id", name).Scan(&departmentID)
+	if err != nil {
+		return nil, fmt.Errorf("error creating department %s: %w", name, err)
+	}
+
+	return &departmentID, nil
+}
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jimlambrt/gldap"
+	"github.com/vdt/cv-management/internal/audit"
+	"github.com/vdt/cv-management/internal/database"
+	"github.com/vdt/cv-management/internal/database/dbtest"
+	"github.com/vdt/cv-management/internal/models"
+	"github.com/vdt/cv-management/internal/utils"
+)
+
+// The directory sync is tested against an in-process LDAP server and the database of dbtest.
+// Without TEST_DATABASE_URL the test is skipped.
+
+const directoryTestBaseDN = "ou=people,dc=vdt,dc=local"
+
+// directoryStandIn is an LDAP server returning the entries it is given to every search
+type directoryStandIn struct {
+	mu      sync.Mutex
+	entries []*gldap.Entry
+}
+
+// startDirectoryStandIn starts the LDAP server and points the LDAP configuration at it
+func startDirectoryStandIn(t *testing.T) *directoryStandIn {
+	t.Helper()
+	directory := &directoryStandIn{}
+
+	server, err := gldap.NewServer()
+	if err != nil {
+		t.Fatalf("creating LDAP server: %v", err)
+	}
+	mux, err := gldap.NewMux()
+	if err != nil {
+		t.Fatalf("creating LDAP mux: %v", err)
+	}
+	if err := mux.Search(directory.search); err != nil {
+		t.Fatalf("routing LDAP searches: %v", err)
+	}
+	if err := server.Router(mux); err != nil {
+		t.Fatalf("routing LDAP requests: %v", err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("finding a free port: %v", err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	go server.Run(address)
+	t.Cleanup(func() { server.Stop() })
+	for deadline := time.Now().Add(5 * time.Second); !server.Ready(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("LDAP server did not start")
+		}
+	}
+
+	t.Setenv("LDAP_URL", "ldap://"+address)
+	t.Setenv("LDAP_BASE_DN", directoryTestBaseDN)
+	t.Setenv("LDAP_BIND_DN", "")
+	return directory
+}
+
+func (d *directoryStandIn) set(entries ...*gldap.Entry) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.entries = entries
+}
+
+func (d *directoryStandIn) search(w *gldap.ResponseWriter, r *gldap.Request) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, entry := range d.entries {
+		response := r.NewSearchResponseEntry(entry.DN)
+		for _, attribute := range entry.Attributes {
+			response.AddAttribute(attribute.Name, attribute.Values)
+		}
+		w.Write(response)
+	}
+	w.Write(r.NewSearchDoneResponse(gldap.WithResponseCode(gldap.ResultSuccess)))
+}
+
+// directoryPerson is an Active Directory user entry; empty attributes are left out
+func directoryPerson(uid, employeeCode, fullName, email string, disabled bool) *gldap.Entry {
+	attributes := map[string][]string{"userAccountControl": {"512"}}
+	if disabled {
+		// NORMAL_ACCOUNT with ACCOUNTDISABLE
+		attributes["userAccountControl"] = []string{"514"}
+	}
+	for name, value := range map[string]string{"employeeID": employeeCode, "displayName": fullName, "mail": email} {
+		if value != "" {
+			attributes[name] = []string{value}
+		}
+	}
+	return gldap.NewEntry("uid="+uid+","+directoryTestBaseDN, attributes)
+}
+
+func runDirectorySync(t *testing.T) *models.DirectorySyncResult {
+	t.Helper()
+	client, err := utils.NewLDAPClient()
+	if err != nil {
+		t.Fatalf("creating LDAP client: %v", err)
+	}
+	result, err := SyncDirectory(context.Background(), client, audit.SystemActor("directory_sync"))
+	if err != nil {
+		t.Fatalf("directory sync: %v", err)
+	}
+	return result
+}
+
+type directoryTestUser struct {
+	fullName, authSource string
+	deactivated          bool
+}
+
+func directoryUser(t *testing.T, email string) directoryTestUser {
+	t.Helper()
+	var user directoryTestUser
+	err := database.DB.QueryRow(context.Background(),
+		"SELECT full_name, auth_source, deactivated_at IS NOT NULL FROM users WHERE email = $1",
+		email).Scan(&user.fullName, &user.authSource, &user.deactivated)
+	if err != nil {
+		t.Fatalf("loading user %s: %v", email, err)
+	}
+	return user
+}
+
+func checkSyncCounts(t *testing.T, step string, result *models.DirectorySyncResult, created, updated, deactivated, skipped int) {
+	t.Helper()
+	if result.Created != created || result.Updated != updated || result.Deactivated != deactivated || result.Skipped != skipped {
+		t.Fatalf("%s: got %d created, %d updated, %d deactivated, %d skipped, want %d, %d, %d, %d (errors: %v)",
+			step, result.Created, result.Updated, result.Deactivated, result.Skipped,
+			created, updated, deactivated, skipped, result.Errors)
+	}
+}
+
+func TestSyncDirectory(t *testing.T) {
+	dbtest.Setup(t)
+	directory := startDirectoryStandIn(t)
+	ctx := context.Background()
+
+	// A local account, like the bootstrap Admin, whose email the directory also has
+	_, err := database.DB.Exec(ctx,
+		"INSERT INTO users (employee_code, full_name, email, password) VALUES ('ADMIN', 'Admin', 'admin@vdt.local', 'hash')")
+	if err != nil {
+		t.Fatalf("creating local account: %v", err)
+	}
+
+	an := directoryPerson("an.nguyen", "LDAP001", "Nguyễn Văn An", "an.nguyen@vdt.local", false)
+	binh := directoryPerson("binh.tran", "LDAP002", "Trần Thị Bình", "binh.tran@vdt.local", false)
+
+	directory.set(an, binh, directoryPerson("admin", "LDAP000", "Admin", "admin@vdt.local", false))
+	checkSyncCounts(t, "create", runDirectorySync(t), 2, 0, 0, 1)
+	if user := directoryUser(t, "admin@vdt.local"); user.authSource != "local" || user.deactivated {
+		t.Fatalf("local account taken over by the directory: %+v", user)
+	}
+
+	// An is renamed and Bình leaves
+	directory.set(directoryPerson("an.nguyen", "LDAP001", "Nguyễn Văn An (KTCN)", "an.nguyen@vdt.local", false))
+	checkSyncCounts(t, "update", runDirectorySync(t), 0, 1, 1, 0)
+	if user := directoryUser(t, "an.nguyen@vdt.local"); user.fullName != "Nguyễn Văn An (KTCN)" || user.deactivated {
+		t.Fatalf("An not updated: %+v", user)
+	}
+	if user := directoryUser(t, "binh.tran@vdt.local"); !user.deactivated {
+		t.Fatalf("Bình not deactivated: %+v", user)
+	}
+
+	// Bình comes back, but An was deactivated by an Admin in the meantime
+	_, err = database.DB.Exec(ctx, "UPDATE users SET deactivated_at = NOW() WHERE email = 'an.nguyen@vdt.local'")
+	if err != nil {
+		t.Fatalf("deactivating An: %v", err)
+	}
+	directory.set(an, binh)
+	checkSyncCounts(t, "reactivate", runDirectorySync(t), 0, 2, 0, 0)
+	if user := directoryUser(t, "binh.tran@vdt.local"); user.deactivated {
+		t.Fatalf("Bình not reactivated: %+v", user)
+	}
+	if user := directoryUser(t, "an.nguyen@vdt.local"); !user.deactivated {
+		t.Fatalf("Admin deactivation of An undone: %+v", user)
+	}
+
+	// Bình's entry loses its display name, which doesn't mean Bình left
+	directory.set(an, directoryPerson("binh.tran", "LDAP002", "", "binh.tran@vdt.local", false))
+	checkSyncCounts(t, "missing attribute", runDirectorySync(t), 0, 1, 0, 1)
+	if user := directoryUser(t, "binh.tran@vdt.local"); user.deactivated {
+		t.Fatalf("Bình deactivated for a missing attribute: %+v", user)
+	}
+
+	// Bình's account is disabled in the directory
+	directory.set(an, directoryPerson("binh.tran", "LDAP002", "Trần Thị Bình", "binh.tran@vdt.local", true))
+	checkSyncCounts(t, "disable", runDirectorySync(t), 0, 2, 0, 0)
+	if user := directoryUser(t, "binh.tran@vdt.local"); !user.deactivated {
+		t.Fatalf("disabled Bình still active: %+v", user)
+	}
+}
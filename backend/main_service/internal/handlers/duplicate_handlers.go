@@ -0,0 +1,909 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/vdt/cv-management/internal/audit"
+	"github.com/vdt/cv-management/internal/database"
+	"github.com/vdt/cv-management/internal/models"
+	"github.com/vdt/cv-management/internal/utils"
+)
+
+const (
+	defaultDuplicateScanInterval = 24 * time.Hour
+	// duplicateScanDelay lets the rest of a bulk registration or import land before a requested scan
+	duplicateScanDelay = time.Minute
+	// duplicateThreshold is the score from which a pair is flagged
+	duplicateThreshold = 0.5
+	// Below these, names and CV contents are too far apart to count as a signal
+	duplicateNameThreshold    = 0.85
+	duplicateContentThreshold = 0.5
+	// duplicateMinContentTokens keeps near-empty CVs from looking alike
+	duplicateMinContentTokens = 20
+	// duplicateMaxBlockSize skips keys shared by too many users to mean anything, e.g. a placeholder phone
+	duplicateMaxBlockSize = 50
+	// A content token held by at most duplicateRareTokenUsers users pairs them; a pair needs
+	// duplicateMinRareTokens of those to be compared
+	duplicateRareTokenUsers = 5
+	duplicateMinRareTokens  = 3
+)
+
+// duplicateWeights is how much each signal adds to the score of a pair, which is capped at 1
+var duplicateWeights = map[string]float64{
+	"employee_code": 0.5,
+	"phone":         0.4,
+	"name":          0.3,
+	"birthday":      0.2,
+	"cv_content":    0.6,
+}
+
+var (
+	// duplicateScanMu serialises scans, so a manual scan and the scheduled one don't race on the pairs
+	duplicateScanMu sync.Mutex
+	// duplicateScanRequests wakes the scheduled scan up early; requests made while one waits are merged
+	duplicateScanRequests = make(chan struct{}, 1)
+)
+
+// duplicateProfile is what a user is compared on, normalised
+type duplicateProfile struct {
+	id           string
+	employeeCode string
+	name         string // normalised, words sorted
+	phone        string // last 9 digits
+	birthday     string
+	content      map[string]bool
+}
+
+// StartDuplicateScan starts the job that flags likely duplicate users every DUPLICATE_SCAN_INTERVAL
+// (default 24h), and shortly after a bulk registration or CV import. A zero or negative interval disables it.
+func StartDuplicateScan() {
+	interval := parseDurationEnv("DUPLICATE_SCAN_INTERVAL", defaultDuplicateScanInterval)
+	if interval <= 0 {
+		log.Printf("Duplicate scan disabled")
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			result, err := ScanDuplicates(context.Background())
+			if err != nil {
+				log.Printf("Duplicate scan failed: %v", err)
+			} else if result.New > 0 {
+				log.Printf("Duplicate scan finished: %d new pairs flagged, %d pending", result.New, result.Flagged)
+			}
+
+			select {
+			case <-ticker.C:
+			case <-duplicateScanRequests:
+				time.Sleep(duplicateScanDelay)
+			}
+		}
+	}()
+
+	log.Printf("Scheduled duplicate scan every %s", interval)
+}
+
+// requestDuplicateScan asks the scheduled scan to run soon, without waiting for it
+func requestDuplicateScan() {
+	select {
+	case duplicateScanRequests <- struct{}{}:
+	default:
+	}
+}
+
+// ScanDuplicates compares the active users and flags the likely duplicate pairs. Pending pairs are
+// rescored, or dropped when they no longer score; dismissed and merged pairs are never flagged again.
+func ScanDuplicates(ctx context.Context) (models.DuplicateScanResult, error) {
+	duplicateScanMu.Lock()
+	defer duplicateScanMu.Unlock()
+
+	profiles, err := loadDuplicateProfiles(ctx)
+	if err != nil {
+		return models.DuplicateScanResult{}, err
+	}
+	result := models.DuplicateScanResult{Users: len(profiles)}
+
+	type pair struct{ a, b int }
+	flagged := map[pair][]models.DuplicateReason{}
+	scores := map[pair]float64{}
+	for _, candidate := range duplicatePairs(profiles) {
+		reasons, score := scoreDuplicate(profiles[candidate[0]], profiles[candidate[1]])
+		if score >= duplicateThreshold {
+			key := pair{candidate[0], candidate[1]}
+			flagged[key], scores[key] = reasons, score
+		}
+	}
+
+	tx, err := database.DB.Begin(ctx)
+	if err != nil {
+		return result, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, "SELECT id::text, user_a_id::text, user_b_id::text, status FROM duplicate_candidates")
+	if err != nil {
+		return result, fmt.Errorf("error loading duplicate pairs: %w", err)
+	}
+	type existing struct{ id, status string }
+	known := map[[2]string]existing{}
+	for rows.Next() {
+		var row existing
+		var userA, userB string
+		if err := rows.Scan(&row.id, &userA, &userB, &row.status); err != nil {
+			rows.Close()
+			return result, fmt.Errorf("error scanning duplicate pair: %w", err)
+		}
+		known[[2]string{userA, userB}] = row
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return result, fmt.Errorf("error loading duplicate pairs: %w", err)
+	}
+
+	kept := map[string]bool{}
+	for key, reasons := range flagged {
+		userA, userB := profiles[key.a].id, profiles[key.b].id
+		if userA > userB {
+			userA, userB = userB, userA
+		}
+		row, found := known[[2]string{userA, userB}]
+		switch {
+		case !found:
+			_, err = tx.Exec(ctx,
+				"INSERT INTO duplicate_candidates (user_a_id, user_b_id, score, reasons) VALUES ($1, $2, $3, $4)",
+				userA, userB, scores[key], reasons)
+			result.New++
+		case row.status == "pending":
+			kept[row.id] = true
+			_, err = tx.Exec(ctx,
+				"UPDATE duplicate_candidates SET score = $2, reasons = $3 WHERE id = $1",
+				row.id, scores[key], reasons)
+		default:
+			continue
+		}
+		if err != nil {
+			return result, fmt.Errorf("error saving duplicate pair %s / %s: %w", userA, userB, err)
+		}
+		result.Flagged++
+	}
+
+	var stale []string
+	for _, row := range known {
+		if row.status == "pending" && !kept[row.id] {
+			stale = append(stale, row.id)
+		}
+	}
+	if len(stale) > 0 {
+		if _, err := tx.Exec(ctx, "DELETE FROM duplicate_candidates WHERE id = ANY($1::uuid[])", stale); err != nil {
+			return result, fmt.Errorf("error dropping stale duplicate pairs: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return result, fmt.Errorf("error committing duplicate pairs: %w", err)
+	}
+	return result, nil
+}
+
+// loadDuplicateProfiles loads the active users with what their CV says about them
+func loadDuplicateProfiles(ctx context.Context) ([]duplicateProfile, error) {
+	rows, err := database.DB.Query(ctx,
+		`SELECT u.id, u.employee_code, u.full_name, COALESCE(d.phone, ''), COALESCE(d.birthday::text, ''),
+			COALESCE(d.summary, '') || ' ' || COALESCE(d.job_title, '') || ' ' ||
+			COALESCE((SELECT string_agg(e.organization || ' ' || COALESCE(e.degree, '') || ' ' || COALESCE(e.major, ''), ' ')
+				FROM cv_education e WHERE e.cv_id = d.id), '') || ' ' ||
+			COALESCE((SELECT string_agg(co.course_name || ' ' || COALESCE(co.organization, ''), ' ')
+				FROM cv_courses co WHERE co.cv_id = d.id), '') || ' ' ||
+			COALESCE((SELECT string_agg(s.skill_name || ' ' || COALESCE(s.description, ''), ' ')
+				FROM cv_skills s WHERE s.cv_id = d.id), '')
+		FROM users u
+		LEFT JOIN cv ON cv.user_id = u.id
+		LEFT JOIN cv_details d ON d.cv_id = cv.id
+		WHERE u.deactivated_at IS NULL AND u.erased_at IS NULL
+		ORDER BY u.id`)
+	if err != nil {
+		return nil, fmt.Errorf("error loading users: %w", err)
+	}
+	defer rows.Close()
+
+	var profiles []duplicateProfile
+	for rows.Next() {
+		var profile duplicateProfile
+		var employeeCode, fullName, phone, content string
+		if err := rows.Scan(&profile.id, &employeeCode, &fullName, &phone, &profile.birthday, &content); err != nil {
+			return nil, fmt.Errorf("error scanning user: %w", err)
+		}
+		profile.employeeCode = normalizeEmployeeCode(employeeCode)
+		profile.name = normalizePersonName(fullName)
+		profile.phone = normalizePhone(phone)
+		profile.content = map[string]bool{}
+		for _, token := range strings.Fields(utils.NormalizeText(content)) {
+			if len([]rune(token)) >= 3 {
+				profile.content[token] = true
+			}
+		}
+		profiles = append(profiles, profile)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error loading users: %w", err)
+	}
+	return profiles, nil
+}
+
+// normalizeEmployeeCode keeps the letters and digits of an employee code, uppercased
+func normalizeEmployeeCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToUpper(r)
+		}
+		return -1
+	}, code)
+}
+
+// normalizePersonName drops case, diacritics and word order, so "Nguyễn Văn An" matches "AN Nguyen Van"
+func normalizePersonName(name string) string {
+	words := strings.Fields(utils.NormalizeText(name))
+	slices.Sort(words)
+	return strings.Join(words, " ")
+}
+
+// normalizePhone keeps the last 9 digits of a phone number, so "+84 912 345 678" matches "0912345678".
+// Shorter numbers are too incomplete to compare.
+func normalizePhone(phone string) string {
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, phone)
+	if len(digits) < 9 {
+		return ""
+	}
+	return digits[len(digits)-9:]
+}
+
+// duplicatePairs returns the pairs of profiles worth scoring: those sharing an employee code, a phone,
+// a name or a birthday, and those whose CVs share several rare words. Comparing every pair would not scale.
+func duplicatePairs(profiles []duplicateProfile) [][2]int {
+	blocks := map[string][]int{}
+	for i, profile := range profiles {
+		for _, key := range []string{
+			"employee_code:" + profile.employeeCode, "phone:" + profile.phone,
+			"name:" + profile.name, "birthday:" + profile.birthday,
+		} {
+			if !strings.HasSuffix(key, ":") {
+				blocks[key] = append(blocks[key], i)
+			}
+		}
+	}
+
+	tokenUsers := map[string][]int{}
+	for i, profile := range profiles {
+		if len(profile.content) < duplicateMinContentTokens {
+			continue
+		}
+		for token := range profile.content {
+			tokenUsers[token] = append(tokenUsers[token], i)
+		}
+	}
+	rareShared := map[[2]int]int{}
+	for _, users := range tokenUsers {
+		if len(users) > duplicateRareTokenUsers {
+			continue
+		}
+		for i := 0; i < len(users); i++ {
+			for j := i + 1; j < len(users); j++ {
+				rareShared[[2]int{users[i], users[j]}]++
+			}
+		}
+	}
+
+	seen := map[[2]int]bool{}
+	var pairs [][2]int
+	add := func(a, b int) {
+		if a > b {
+			a, b = b, a
+		}
+		if key := [2]int{a, b}; !seen[key] {
+			seen[key] = true
+			pairs = append(pairs, key)
+		}
+	}
+	for _, users := range blocks {
+		if len(users) > duplicateMaxBlockSize {
+			continue
+		}
+		for i := 0; i < len(users); i++ {
+			for j := i + 1; j < len(users); j++ {
+				add(users[i], users[j])
+			}
+		}
+	}
+	for key, shared := range rareShared {
+		if shared >= duplicateMinRareTokens {
+			add(key[0], key[1])
+		}
+	}
+	return pairs
+}
+
+// scoreDuplicate returns the signals two profiles share and the resulting score, from 0 to 1
+func scoreDuplicate(a, b duplicateProfile) ([]models.DuplicateReason, float64) {
+	reasons := []models.DuplicateReason{}
+	addReason := func(signal string, similarity float64) {
+		reasons = append(reasons, models.DuplicateReason{
+			Signal: signal, Similarity: roundScore(similarity), Weight: duplicateWeights[signal],
+		})
+	}
+
+	if a.employeeCode != "" && a.employeeCode == b.employeeCode {
+		addReason("employee_code", 1)
+	}
+	if a.phone != "" && a.phone == b.phone {
+		addReason("phone", 1)
+	}
+	if a.name != "" && b.name != "" {
+		if similarity := utils.Similarity(a.name, b.name); similarity >= duplicateNameThreshold {
+			addReason("name", similarity)
+		}
+	}
+	if a.birthday != "" && a.birthday == b.birthday {
+		addReason("birthday", 1)
+	}
+	if len(a.content) >= duplicateMinContentTokens && len(b.content) >= duplicateMinContentTokens {
+		shared := 0
+		for token := range a.content {
+			if b.content[token] {
+				shared++
+			}
+		}
+		if similarity := float64(shared) / float64(len(a.content)+len(b.content)-shared); similarity >= duplicateContentThreshold {
+			addReason("cv_content", similarity)
+		}
+	}
+
+	score := 0.0
+	for _, reason := range reasons {
+		score += reason.Weight
+	}
+	return reasons, roundScore(math.Min(1, score))
+}
+
+// GetDuplicates returns the duplicate pairs with the given status (default pending), most likely first (Admin only)
+func GetDuplicates(c *gin.Context) {
+	status := c.DefaultQuery("status", "pending")
+	if !slices.Contains([]string{"pending", "merged", "dismissed"}, status) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "status must be pending, merged or dismissed",
+		})
+		return
+	}
+
+	rows, err := database.DB.Query(c,
+		`SELECT dc.id, dc.score, dc.reasons, dc.status, dc.detected_at, dc.resolved_by, dc.resolved_at,
+			a.id, a.employee_code, a.full_name, a.email, a.deactivated_at IS NOT NULL, a.created_at,
+			b.id, b.employee_code, b.full_name, b.email, b.deactivated_at IS NOT NULL, b.created_at
+		FROM duplicate_candidates dc
+		JOIN users a ON a.id = dc.user_a_id
+		JOIN users b ON b.id = dc.user_b_id
+		WHERE dc.status = $1
+		ORDER BY dc.score DESC, dc.detected_at DESC`,
+		status)
+	if err != nil {
+		fmt.Printf("GetDuplicates error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error fetching duplicate users",
+		})
+		return
+	}
+	defer rows.Close()
+
+	candidates := []models.DuplicateCandidate{}
+	for rows.Next() {
+		var candidate models.DuplicateCandidate
+		a, b := &candidate.UserA, &candidate.UserB
+		err := rows.Scan(&candidate.ID, &candidate.Score, &candidate.Reasons, &candidate.Status,
+			&candidate.DetectedAt, &candidate.ResolvedBy, &candidate.ResolvedAt,
+			&a.ID, &a.EmployeeCode, &a.FullName, &a.Email, &a.Deactivated, &a.CreatedAt,
+			&b.ID, &b.EmployeeCode, &b.FullName, &b.Email, &b.Deactivated, &b.CreatedAt)
+		if err != nil {
+			fmt.Printf("GetDuplicates scan error: %v\n", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  "error",
+				"message": "Error parsing duplicate user data",
+			})
+			return
+		}
+		candidates = append(candidates, candidate)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   candidates,
+	})
+}
+
+// RunDuplicateScan scans for duplicate users now instead of waiting for the scheduled scan (Admin only)
+func RunDuplicateScan(c *gin.Context) {
+	result, err := ScanDuplicates(c)
+	if err != nil {
+		fmt.Printf("RunDuplicateScan error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error scanning for duplicate users",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   result,
+	})
+}
+
+// DismissDuplicate marks a pending pair as not being the same person, so scans don't flag it again (Admin only)
+func DismissDuplicate(c *gin.Context) {
+	tx, err := database.DB.Begin(c)
+	if err != nil {
+		fmt.Printf("DismissDuplicate transaction begin error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error dismissing duplicate users",
+		})
+		return
+	}
+	defer tx.Rollback(c)
+
+	tag, err := tx.Exec(c,
+		`UPDATE duplicate_candidates SET status = 'dismissed', resolved_by = $2, resolved_at = NOW()
+		WHERE id = $1 AND status = 'pending'`,
+		c.Param("id"), c.GetString("userID"))
+	if err != nil {
+		fmt.Printf("DismissDuplicate error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error dismissing duplicate users",
+		})
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "No pending duplicate pair found",
+		})
+		return
+	}
+
+	if !recordAudit(c, tx, audit.Entry{
+		Action:     auditDuplicateDismiss,
+		TargetType: "duplicate_candidate",
+		TargetID:   c.Param("id"),
+	}) {
+		return
+	}
+
+	if err := tx.Commit(c); err != nil {
+		fmt.Printf("DismissDuplicate transaction commit error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error dismissing duplicate users",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Duplicate pair dismissed",
+	})
+}
+
+// MergeDuplicate merges a pending pair into the user named by keep_user_id. The other user's CV is
+// folded into the survivor's, their CV requests, project memberships (PM roles included) and managed
+// departments move to the survivor, and they are deactivated, so the purge job deletes them later (Admin only).
+func MergeDuplicate(c *gin.Context) {
+	candidateID := c.Param("id")
+	var request models.DuplicateMergeRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid request data",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	tx, err := database.DB.Begin(c)
+	if err != nil {
+		fmt.Printf("MergeDuplicate transaction begin error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error starting transaction",
+		})
+		return
+	}
+	defer tx.Rollback(c)
+
+	var userA, userB string
+	err = tx.QueryRow(c,
+		"SELECT user_a_id, user_b_id FROM duplicate_candidates WHERE id = $1 AND status = 'pending' FOR UPDATE",
+		candidateID).Scan(&userA, &userB)
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "No pending duplicate pair found",
+		})
+		return
+	}
+	if err != nil {
+		fmt.Printf("MergeDuplicate error fetching pair: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error fetching duplicate pair",
+		})
+		return
+	}
+
+	keepID, mergedID := userA, userB
+	switch request.KeepUserID {
+	case userA:
+	case userB:
+		keepID, mergedID = userB, userA
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "keep_user_id must be one of the pair",
+		})
+		return
+	}
+	if mergedID == c.GetString("userID") {
+		c.JSON(http.StatusForbidden, gin.H{
+			"status":  "error",
+			"message": "You cannot merge your own account into another",
+		})
+		return
+	}
+
+	var active int
+	err = tx.QueryRow(c,
+		`SELECT COUNT(*) FROM (SELECT id FROM users WHERE id IN ($1, $2) AND deactivated_at IS NULL FOR UPDATE) u`,
+		keepID, mergedID).Scan(&active)
+	if err != nil {
+		fmt.Printf("MergeDuplicate error locking users: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error fetching users",
+		})
+		return
+	}
+	if active < 2 {
+		c.JSON(http.StatusConflict, gin.H{
+			"status":  "error",
+			"message": "Both users must be active to be merged",
+		})
+		return
+	}
+
+	before, ok := auditSnapshot(c, func() (json.RawMessage, error) { return mergeSnapshot(c, tx, keepID, mergedID) })
+	if !ok {
+		return
+	}
+
+	moved, err := mergeUsers(c, tx, keepID, mergedID, c.GetString("userID"))
+	if err != nil {
+		fmt.Printf("MergeDuplicate error merging user %s into %s: %v\n", mergedID, keepID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error merging users",
+		})
+		return
+	}
+
+	_, err = tx.Exec(c,
+		"UPDATE duplicate_candidates SET status = 'merged', resolved_by = $2, resolved_at = NOW() WHERE id = $1",
+		candidateID, c.GetString("userID"))
+	if err == nil {
+		// The merged user is gone from every other pending pair
+		_, err = tx.Exec(c,
+			"DELETE FROM duplicate_candidates WHERE status = 'pending' AND $1 IN (user_a_id, user_b_id)",
+			mergedID)
+	}
+	if err != nil {
+		fmt.Printf("MergeDuplicate error updating pairs: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error updating duplicate pair",
+		})
+		return
+	}
+
+	after, ok := auditSnapshot(c, func() (json.RawMessage, error) { return mergeSnapshot(c, tx, keepID, mergedID) })
+	if !ok {
+		return
+	}
+	if !recordAudit(c, tx, audit.Entry{
+		Action:     auditUserMerge,
+		TargetType: "user",
+		TargetID:   keepID,
+		Before:     before,
+		After:      after,
+	}) {
+		return
+	}
+
+	if err := tx.Commit(c); err != nil {
+		fmt.Printf("MergeDuplicate transaction commit error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error committing transaction",
+		})
+		return
+	}
+
+	fmt.Printf("MergeDuplicate: User %s merged into %s\n", mergedID, keepID)
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Users merged",
+		"data": gin.H{
+			"kept_user_id":   keepID,
+			"merged_user_id": mergedID,
+			"moved":          moved,
+		},
+	})
+}
+
+// mergeSnapshot records both users of a merge with their CVs
+func mergeSnapshot(ctx context.Context, tx pgx.Tx, keepID, mergedID string) (json.RawMessage, error) {
+	snapshot := map[string]json.RawMessage{}
+	for name, get := range map[string]func() (json.RawMessage, error){
+		"kept_user":   func() (json.RawMessage, error) { return audit.UserSnapshot(ctx, tx, keepID) },
+		"kept_cv":     func() (json.RawMessage, error) { return audit.CVSnapshot(ctx, tx, keepID) },
+		"merged_user": func() (json.RawMessage, error) { return audit.UserSnapshot(ctx, tx, mergedID) },
+		"merged_cv":   func() (json.RawMessage, error) { return audit.CVSnapshot(ctx, tx, mergedID) },
+	} {
+		data, err := get()
+		if err != nil {
+			return nil, err
+		}
+		snapshot[name] = data
+	}
+	return json.Marshal(snapshot)
+}
+
+// mergeUsers folds the merged user into the kept one and deactivates them. It returns how many
+// records of each kind moved.
+func mergeUsers(ctx context.Context, tx pgx.Tx, keepID, mergedID, updatedBy string) (map[string]int64, error) {
+	moved := map[string]int64{}
+
+	keepCV, keepDetail, err := userCVIDs(ctx, tx, keepID)
+	if err != nil {
+		return nil, err
+	}
+	mergedCV, mergedDetail, err := userCVIDs(ctx, tx, mergedID)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case mergedCV == "":
+	case keepCV == "":
+		// The survivor has no CV, so it takes the whole CV with its requests
+		if _, err := tx.Exec(ctx, "UPDATE cv SET user_id = $1 WHERE id = $2", keepID, mergedCV); err != nil {
+			return nil, fmt.Errorf("error moving CV: %w", err)
+		}
+		moved["cv"] = 1
+	default:
+		if mergedDetail != "" {
+			if keepDetail == "" {
+				if _, err := tx.Exec(ctx, "UPDATE cv_details SET cv_id = $1 WHERE id = $2", keepCV, mergedDetail); err != nil {
+					return nil, fmt.Errorf("error moving CV details: %w", err)
+				}
+				keepDetail = mergedDetail
+				moved["cv"] = 1
+			} else if err := foldCVDetails(ctx, tx, keepDetail, mergedDetail, moved); err != nil {
+				return nil, err
+			}
+			if _, err := updateCVStatus(ctx, tx, keepCV, keepDetail, updatedBy); err != nil {
+				return nil, err
+			}
+		}
+
+		tag, err := tx.Exec(ctx, "UPDATE cv_update_requests SET cv_id = $1 WHERE cv_id = $2", keepCV, mergedCV)
+		if err != nil {
+			return nil, fmt.Errorf("error moving CV requests: %w", err)
+		}
+		moved["requests_received"] = tag.RowsAffected()
+		// CASCADE deletes what was not folded into the kept CV
+		if _, err := tx.Exec(ctx, "DELETE FROM cv WHERE id = $1", mergedCV); err != nil {
+			return nil, fmt.Errorf("error deleting merged CV: %w", err)
+		}
+	}
+
+	tag, err := tx.Exec(ctx, "UPDATE cv_update_requests SET requested_by = $1 WHERE requested_by = $2", keepID, mergedID)
+	if err != nil {
+		return nil, fmt.Errorf("error moving sent CV requests: %w", err)
+	}
+	moved["requests_sent"] = tag.RowsAffected()
+
+	// Where both were members, the kept user's membership stays as it is
+	tag, err = tx.Exec(ctx,
+		`UPDATE project_members SET user_id = $1
+		WHERE user_id = $2 AND project_id NOT IN (SELECT project_id FROM project_members WHERE user_id = $1)`,
+		keepID, mergedID)
+	if err != nil {
+		return nil, fmt.Errorf("error moving project memberships: %w", err)
+	}
+	moved["project_memberships"] = tag.RowsAffected()
+	// ...unless the merged user was the PM, then the kept user takes over so the project keeps its PM
+	tag, err = tx.Exec(ctx,
+		`UPDATE project_members keep SET role_in_project = 'PM', left_at = NULL
+		FROM project_members merged
+		WHERE keep.user_id = $1 AND merged.user_id = $2 AND merged.project_id = keep.project_id
+		  AND merged.role_in_project = 'PM' AND (merged.left_at IS NULL OR merged.left_at > CURRENT_DATE)`,
+		keepID, mergedID)
+	if err != nil {
+		return nil, fmt.Errorf("error moving project PM roles: %w", err)
+	}
+	moved["project_pm_roles"] = tag.RowsAffected()
+	if _, err := tx.Exec(ctx, "DELETE FROM project_members WHERE user_id = $1", mergedID); err != nil {
+		return nil, fmt.Errorf("error deleting project memberships: %w", err)
+	}
+
+	tag, err = tx.Exec(ctx, "UPDATE departments SET manager_id = $1 WHERE manager_id = $2", keepID, mergedID)
+	if err != nil {
+		return nil, fmt.Errorf("error moving managed departments: %w", err)
+	}
+	moved["managed_departments"] = tag.RowsAffected()
+
+	// Imported CVs still being parsed land in the kept CV
+	_, err = tx.Exec(ctx,
+		"UPDATE parse_jobs SET cv_user_id = $1 WHERE cv_user_id = $2 AND status IN ('queued', 'running')",
+		keepID, mergedID)
+	if err != nil {
+		return nil, fmt.Errorf("error moving parse jobs: %w", err)
+	}
+
+	for _, userID := range []string{keepID, mergedID} {
+		if err := syncUploadReferences(ctx, tx, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = tx.Exec(ctx, "UPDATE users SET deactivated_at = NOW() WHERE id = $1", mergedID)
+	if err != nil {
+		return nil, fmt.Errorf("error deactivating merged user: %w", err)
+	}
+	// Nobody can keep acting as a deactivated user
+	_, err = tx.Exec(ctx, "UPDATE impersonation_sessions SET ended_at = NOW() WHERE user_id = $1 AND ended_at IS NULL", mergedID)
+	if err != nil {
+		return nil, fmt.Errorf("error ending impersonation sessions: %w", err)
+	}
+
+	return moved, nil
+}
+
+// userCVIDs returns the ids of the user's CV and CV details, empty when missing
+func userCVIDs(ctx context.Context, tx pgx.Tx, userID string) (string, string, error) {
+	var cvID, detailID string
+	err := tx.QueryRow(ctx,
+		`SELECT cv.id::text, COALESCE(d.id::text, '') FROM cv LEFT JOIN cv_details d ON d.cv_id = cv.id
+		WHERE cv.user_id = $1 FOR UPDATE OF cv`,
+		userID).Scan(&cvID, &detailID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", "", nil
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("error loading CV of user %s: %w", userID, err)
+	}
+	return cvID, detailID, nil
+}
+
+// foldCVDetails fills the empty fields and files of the kept CV from the merged one, with their provenance,
+// and moves over the list items the kept CV has no similar item for
+func foldCVDetails(ctx context.Context, tx pgx.Tx, keepDetail, mergedDetail string, moved map[string]int64) error {
+	keepValues, keepProvenance, err := loadFieldProvenance(ctx, tx, keepDetail)
+	if err != nil {
+		return err
+	}
+	mergedValues, mergedProvenance, err := loadFieldProvenance(ctx, tx, mergedDetail)
+	if err != nil {
+		return err
+	}
+	for _, field := range mergeFields {
+		if keepValues[field] != "" || mergedValues[field] == "" {
+			continue
+		}
+		// The column comes from mergeFields, never from the request
+		_, err := tx.Exec(ctx,
+			"UPDATE cv_details k SET "+field+" = m."+field+" FROM cv_details m WHERE k.id = $1 AND m.id = $2",
+			keepDetail, mergedDetail)
+		if err != nil {
+			return fmt.Errorf("error folding %s: %w", field, err)
+		}
+		if provenance, found := mergedProvenance[field]; found {
+			keepProvenance[field] = provenance
+		}
+		moved["fields"]++
+	}
+	_, err = tx.Exec(ctx,
+		`UPDATE cv_details k SET provenance = $3,
+			cvpath = COALESCE(NULLIF(k.cvpath, ''), m.cvpath), portraitpath = COALESCE(NULLIF(k.portraitpath, ''), m.portraitpath)
+		FROM cv_details m WHERE k.id = $1 AND m.id = $2`,
+		keepDetail, mergedDetail, keepProvenance)
+	if err != nil {
+		return fmt.Errorf("error folding CV details: %w", err)
+	}
+
+	keepEducation, keepCourses, keepSkills, err := loadCVRelatedData(ctx, keepDetail)
+	if err != nil {
+		return err
+	}
+	mergedEducation, mergedCourses, mergedSkills, err := loadCVRelatedData(ctx, mergedDetail)
+	if err != nil {
+		return err
+	}
+
+	matches, _ := pairByScore(len(mergedEducation), len(keepEducation), func(m, k int) float64 {
+		return utils.Similarity(mergedEducation[m].Organization, keepEducation[k].Organization)
+	}, educationMatchThreshold)
+	var education []string
+	for i, item := range mergedEducation {
+		if matches[i] < 0 {
+			education = append(education, item.ID)
+		}
+	}
+	matches, _ = pairByScore(len(mergedCourses), len(keepCourses), func(m, k int) float64 {
+		return utils.Similarity(mergedCourses[m].CourseName, keepCourses[k].CourseName)
+	}, courseMatchThreshold)
+	var courses []string
+	for i, item := range mergedCourses {
+		if matches[i] < 0 {
+			courses = append(courses, item.ID)
+		}
+	}
+	matches, _ = pairByScore(len(mergedSkills), len(keepSkills), func(m, k int) float64 {
+		return utils.Similarity(mergedSkills[m].SkillName, keepSkills[k].SkillName)
+	}, skillMatchThreshold)
+	var skills []string
+	for i, item := range mergedSkills {
+		if matches[i] < 0 {
+			skills = append(skills, item.ID)
+		}
+	}
+
+	for _, list := range []struct {
+		name, table string
+		ids         []string
+	}{
+		{"education", "cv_education", education},
+		{"courses", "cv_courses", courses},
+		{"skills", "cv_skills", skills},
+	} {
+		if len(list.ids) == 0 {
+			continue
+		}
+		tag, err := tx.Exec(ctx, "UPDATE "+list.table+" SET cv_id = $1 WHERE id = ANY($2::uuid[])", keepDetail, list.ids)
+		if err != nil {
+			return fmt.Errorf("error moving %s: %w", list.name, err)
+		}
+		moved[list.name] = tag.RowsAffected()
+	}
+	return nil
+}
@@ -95,7 +95,7 @@ func GetGeneralInfoOfDepartment(c *gin.Context) {
 
 	err = database.DB.QueryRow(c, `
 		SELECT d.id, d.name,
-			(SELECT COUNT(*) FROM users u WHERE u.department_id = d.id) as member_count
+			(SELECT COUNT(*) FROM users u WHERE u.department_id = d.id AND u.deactivated_at IS NULL) as member_count
 		FROM departments d
 		WHERE d.id = $1`, userDepartmentID).Scan(&department.ID, &department.Name, &memberCount)
 
@@ -242,7 +242,7 @@ func GetAdminDashboardStats(c *gin.Context) {
 	var stats AdminDashboardStats
 
 	// Get total number of users
-	err := database.DB.QueryRow(c, "SELECT COUNT(*) FROM users").Scan(&stats.TotalUsers)
+	err := database.DB.QueryRow(c, "SELECT COUNT(*) FROM users WHERE deactivated_at IS NULL").Scan(&stats.TotalUsers)
 	if err != nil {
 		fmt.Printf("GetAdminDashboardStats: Error getting total users: %v\n", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -0,0 +1,302 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/vdt/cv-management/internal/audit"
+	"github.com/vdt/cv-management/internal/authz"
+	"github.com/vdt/cv-management/internal/database"
+	"github.com/vdt/cv-management/internal/models"
+	"github.com/vdt/cv-management/internal/utils"
+)
+
+// StartImpersonation issues a short-lived token that lets the calling Admin act as another user.
+// The token carries both identities, is never refreshed and every request made with it is recorded.
+func StartImpersonation(c *gin.Context) {
+	impersonatorID := c.GetString("userID")
+	targetUserID := c.Param("user_id")
+	if uuid.Validate(targetUserID) != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "User not found",
+		})
+		return
+	}
+
+	var request models.StartImpersonationRequest
+	if err := c.ShouldBindJSON(&request); err != nil || strings.TrimSpace(request.Reason) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "A reason is required to impersonate a user",
+		})
+		return
+	}
+
+	if targetUserID == impersonatorID {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "You cannot impersonate yourself",
+		})
+		return
+	}
+
+	var user models.User
+	var deactivatedAt *time.Time
+	err := database.DB.QueryRow(c,
+		"SELECT id, full_name, email, deactivated_at FROM users WHERE id = $1",
+		targetUserID).Scan(&user.ID, &user.FullName, &user.Email, &deactivatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"status":  "error",
+				"message": "User not found",
+			})
+			return
+		}
+		fmt.Printf("StartImpersonation: Error fetching user %s: %v\n", targetUserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error fetching user",
+		})
+		return
+	}
+	if deactivatedAt != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Deactivated users cannot be impersonated",
+		})
+		return
+	}
+
+	userRoles, err := getUserRoles(c, user.ID)
+	if err != nil {
+		fmt.Printf("StartImpersonation: Error fetching roles of user %s: %v\n", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error fetching roles",
+		})
+		return
+	}
+	roleNames := make([]string, 0, len(userRoles))
+	for _, role := range userRoles {
+		roleNames = append(roleNames, role.Name)
+	}
+
+	// Admins can't impersonate each other, that would only hide who really did something
+	canImpersonate, err := authz.RolesHavePermission(c, roleNames, authz.UsersImpersonate)
+	if err != nil {
+		fmt.Printf("StartImpersonation: Error checking permissions of user %s: %v\n", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Server error - could not check permissions",
+		})
+		return
+	}
+	if canImpersonate {
+		c.JSON(http.StatusForbidden, gin.H{
+			"status":  "error",
+			"message": "Users who can impersonate others cannot be impersonated",
+		})
+		return
+	}
+
+	expiresAt := time.Now().Add(utils.ImpersonationTokenExpiration)
+
+	tx, err := database.DB.Begin(c)
+	if err != nil {
+		fmt.Printf("StartImpersonation: Error starting transaction: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error starting impersonation",
+		})
+		return
+	}
+	defer tx.Rollback(c)
+
+	var impersonationID string
+	err = tx.QueryRow(c,
+		`INSERT INTO impersonation_sessions (impersonator_id, user_id, reason, expires_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id`,
+		impersonatorID, user.ID, strings.TrimSpace(request.Reason), expiresAt).Scan(&impersonationID)
+	if err != nil {
+		fmt.Printf("StartImpersonation: Error creating session: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error starting impersonation",
+		})
+		return
+	}
+
+	token, err := utils.GenerateImpersonationToken(impersonatorID, user.ID, roleNames, impersonationID, expiresAt)
+	if err != nil {
+		fmt.Printf("StartImpersonation: Error generating token: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error generating token",
+		})
+		return
+	}
+
+	if !recordAudit(c, tx, audit.Entry{
+		Action:     auditImpersonationStart,
+		TargetType: "user",
+		TargetID:   user.ID,
+		After: gin.H{
+			"impersonation_id": impersonationID,
+			"reason":           strings.TrimSpace(request.Reason),
+			"expires_at":       expiresAt,
+		},
+	}) {
+		return
+	}
+
+	if err := tx.Commit(c); err != nil {
+		fmt.Printf("StartImpersonation: Error committing transaction: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error starting impersonation",
+		})
+		return
+	}
+
+	user.Roles = userRoles
+	fmt.Printf("StartImpersonation: Admin %s is impersonating user %s (session %s)\n", impersonatorID, user.ID, impersonationID)
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Impersonation started",
+		"data": gin.H{
+			"token":            token,
+			"impersonation_id": impersonationID,
+			"impersonator_id":  impersonatorID,
+			"expires_at":       expiresAt,
+			"user":             user,
+		},
+	})
+}
+
+// EndImpersonation ends the impersonation session of the token used for the request
+func EndImpersonation(c *gin.Context) {
+	impersonationID := c.GetString("impersonationID")
+	if impersonationID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "This token is not an impersonation token",
+		})
+		return
+	}
+
+	_, err := database.DB.Exec(c,
+		"UPDATE impersonation_sessions SET ended_at = COALESCE(ended_at, NOW()) WHERE id = $1",
+		impersonationID)
+	if err != nil {
+		fmt.Printf("EndImpersonation: Error ending session %s: %v\n", impersonationID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error ending impersonation",
+		})
+		return
+	}
+
+	fmt.Printf("EndImpersonation: Ended impersonation session %s\n", impersonationID)
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Impersonation ended",
+	})
+}
+
+// GetImpersonationSessions returns the most recent impersonation sessions with their request counts
+func GetImpersonationSessions(c *gin.Context) {
+	rows, err := database.DB.Query(c, `
+		SELECT s.id, s.impersonator_id, a.full_name, s.user_id, u.full_name, s.reason,
+		       s.started_at, s.expires_at, s.ended_at,
+		       (SELECT COUNT(*) FROM impersonation_requests r WHERE r.session_id = s.id)
+		FROM impersonation_sessions s
+		JOIN users a ON a.id = s.impersonator_id
+		JOIN users u ON u.id = s.user_id
+		ORDER BY s.started_at DESC
+		LIMIT 200`)
+	if err != nil {
+		fmt.Printf("GetImpersonationSessions error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error fetching impersonation sessions",
+		})
+		return
+	}
+	defer rows.Close()
+
+	sessions := []models.ImpersonationSession{}
+	for rows.Next() {
+		var session models.ImpersonationSession
+		if err := rows.Scan(&session.ID, &session.ImpersonatorID, &session.Impersonator, &session.UserID,
+			&session.UserName, &session.Reason, &session.StartedAt, &session.ExpiresAt, &session.EndedAt,
+			&session.RequestCount); err != nil {
+			fmt.Printf("GetImpersonationSessions scan error: %v\n", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  "error",
+				"message": "Error parsing impersonation session data",
+			})
+			return
+		}
+		sessions = append(sessions, session)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   sessions,
+	})
+}
+
+// GetImpersonationRequests returns every request made during an impersonation session
+func GetImpersonationRequests(c *gin.Context) {
+	sessionID := c.Param("id")
+	if uuid.Validate(sessionID) != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "Impersonation session not found",
+		})
+		return
+	}
+
+	rows, err := database.DB.Query(c, `
+		SELECT method, path, status_code, COALESCE(ip, ''), created_at
+		FROM impersonation_requests
+		WHERE session_id = $1
+		ORDER BY created_at`, sessionID)
+	if err != nil {
+		fmt.Printf("GetImpersonationRequests error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error fetching impersonation requests",
+		})
+		return
+	}
+	defer rows.Close()
+
+	requests := []models.ImpersonationRequest{}
+	for rows.Next() {
+		var request models.ImpersonationRequest
+		if err := rows.Scan(&request.Method, &request.Path, &request.StatusCode, &request.IP, &request.CreatedAt); err != nil {
+			fmt.Printf("GetImpersonationRequests scan error: %v\n", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  "error",
+				"message": "Error parsing impersonation request data",
+			})
+			return
+		}
+		requests = append(requests, request)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   requests,
+	})
+}
@@ -0,0 +1,564 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vdt/cv-management/internal/authz"
+	"github.com/vdt/cv-management/internal/database"
+	"github.com/vdt/cv-management/internal/models"
+	"github.com/vdt/cv-management/internal/utils"
+)
+
+// defaultJobMatchLimit is how many matches are returned when the request doesn't say
+const defaultJobMatchLimit = 50
+
+// jobSkillMatchThreshold is the minimum similarity for a CV skill to cover a required skill
+const jobSkillMatchThreshold = 0.85
+
+// jobMatchWeights weigh the criteria of a job match. Criteria the profile doesn't ask for are left out
+// and the others share their weight.
+var jobMatchWeights = map[string]float64{
+	"must_have":    50,
+	"nice_to_have": 15,
+	"degree":       10,
+	"experience":   10,
+	"availability": 10,
+	"freshness":    5,
+}
+
+// A CV updated within freshCVAge is fully fresh; its freshness then drops to nothing at staleCVAge
+const (
+	freshCVAge = 180 * 24 * time.Hour
+	staleCVAge = 730 * 24 * time.Hour
+)
+
+// availableSoon is how close the end of an employee's current projects must be to count them as half available
+const availableSoon = 30 * 24 * time.Hour
+
+// degreeLevels ranks normalized degree words. Words that also name a job, like "engineer", are not
+// read from job descriptions.
+var degreeLevels = []struct {
+	words     string
+	level     int
+	name      string
+	inJobText bool
+}{
+	{"cao dang", 1, "College", true},
+	{"college", 1, "College", true},
+	{"associate", 1, "College", true},
+	{"cu nhan", 2, "Bachelor", true},
+	{"bachelor", 2, "Bachelor", true},
+	{"dai hoc", 2, "Bachelor", true},
+	{"university", 2, "Bachelor", true},
+	{"ky su", 2, "Bachelor", false},
+	{"engineer", 2, "Bachelor", false},
+	{"thac si", 3, "Master", true},
+	{"master", 3, "Master", true},
+	{"mba", 3, "Master", true},
+	{"tien si", 4, "PhD", true},
+	{"phd", 4, "PhD", true},
+	{"doctor", 4, "PhD", true},
+}
+
+var (
+	// Sentences of a job description. A dot only ends one before a space, so "Node.js" stays whole.
+	sentenceSeparator = regexp.MustCompile(`[\n;]+|\.\s+`)
+	// Years of experience in a normalized description, as in "3+ years" or "3 năm kinh nghiệm"
+	yearsPattern = regexp.MustCompile(`\b(\d{1,2})\s*\+?\s*(?:years?|yrs?|nam)\b`)
+	// Separators of the skills listed in a CV skill's description, as in "Go, PostgreSQL, Docker"
+	skillListSeparator = regexp.MustCompile(`[,;/|]+`)
+)
+
+// niceToHaveMarkers are the normalized words that make the skills of a sentence optional
+var niceToHaveMarkers = []string{"nice to have", "plus", "preferred", "prefer", "bonus", "advantage", "optional",
+	"uu tien", "loi the", "diem cong"}
+
+// jobCandidate is a CV the caller can see, with what a match is computed from
+type jobCandidate struct {
+	match      models.JobMatch
+	detailID   string
+	skills     []string // skill names and the skills listed in their descriptions
+	degree     int
+	graduation int // earliest graduation year, 0 if unknown
+}
+
+// MatchCVs ranks the CVs the caller can see against a job description and explains every score:
+// the skills matched and missing, the degree, the years since graduating, how recently the CV was
+// updated and whether the employee is free from projects now
+func MatchCVs(c *gin.Context) {
+	var request models.JobMatchRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid request data: " + err.Error(),
+		})
+		return
+	}
+
+	candidates, err := loadJobCandidates(c)
+	if err != nil {
+		fmt.Printf("MatchCVs: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error loading CVs",
+		})
+		return
+	}
+
+	profile := buildJobProfile(request, candidates)
+	if len(profile.MustHave) == 0 && len(profile.NiceToHave) == 0 && profile.Degree == "" && profile.MinYears == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "No requirement to match: give skills, a degree, years of experience or a description mentioning them",
+		})
+		return
+	}
+
+	now := time.Now()
+	matches := make([]models.JobMatch, 0, len(candidates))
+	for _, candidate := range candidates {
+		matches = append(matches, scoreJobCandidate(candidate, profile, now))
+	}
+	slices.SortStableFunc(matches, func(a, b models.JobMatch) int {
+		if a.Score != b.Score {
+			if a.Score > b.Score {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a.FullName, b.FullName)
+	})
+
+	limit := request.Limit
+	if limit == 0 {
+		limit = defaultJobMatchLimit
+	}
+	result := models.JobMatchResult{Profile: profile, Total: len(matches), Matches: matches}
+	if len(result.Matches) > limit {
+		result.Matches = result.Matches[:limit]
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   result,
+	})
+}
+
+// loadJobCandidates loads the CVs of the active users the caller can reach, with their skills,
+// education and current projects
+func loadJobCandidates(c *gin.Context) ([]*jobCandidate, error) {
+	filter, args, err := authz.UserAccessFilter(c, "u.id", 1)
+	if err != nil {
+		return nil, fmt.Errorf("error checking access: %w", err)
+	}
+
+	rows, err := database.DB.Query(c,
+		`SELECT u.id, u.employee_code, u.full_name, COALESCE(dep.name, ''), d.id, COALESCE(d.job_title, ''),
+			cv.last_updated_at
+		FROM users u
+		JOIN cv ON cv.user_id = u.id
+		JOIN cv_details d ON d.cv_id = cv.id
+		LEFT JOIN departments dep ON dep.id = u.department_id
+		WHERE u.deactivated_at IS NULL AND `+filter,
+		args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying CVs: %w", err)
+	}
+	defer rows.Close()
+
+	var candidates []*jobCandidate
+	byDetail := map[string]*jobCandidate{}
+	byUser := map[string]*jobCandidate{}
+	for rows.Next() {
+		candidate := &jobCandidate{}
+		match := &candidate.match
+		if err := rows.Scan(&match.UserID, &match.EmployeeCode, &match.FullName, &match.Department,
+			&candidate.detailID, &match.JobTitle, &match.LastUpdatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning CV: %w", err)
+		}
+		match.Availability.CurrentProjects = []string{}
+		candidates = append(candidates, candidate)
+		byDetail[candidate.detailID] = candidate
+		byUser[match.UserID] = candidate
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error querying CVs: %w", err)
+	}
+	if len(candidates) == 0 {
+		return candidates, nil
+	}
+	detailIDs := make([]string, 0, len(candidates))
+	userIDs := make([]string, 0, len(candidates))
+	for _, candidate := range candidates {
+		detailIDs = append(detailIDs, candidate.detailID)
+		userIDs = append(userIDs, candidate.match.UserID)
+	}
+
+	if err := loadCandidateSkills(c, detailIDs, byDetail); err != nil {
+		return nil, err
+	}
+	if err := loadCandidateEducation(c, detailIDs, byDetail); err != nil {
+		return nil, err
+	}
+	if err := loadCandidateProjects(c, userIDs, byUser); err != nil {
+		return nil, err
+	}
+	return candidates, nil
+}
+
+func loadCandidateSkills(ctx context.Context, detailIDs []string, byDetail map[string]*jobCandidate) error {
+	rows, err := database.DB.Query(ctx,
+		"SELECT cv_id, skill_name, COALESCE(description, '') FROM cv_skills WHERE cv_id = ANY($1)", detailIDs)
+	if err != nil {
+		return fmt.Errorf("error querying skills: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var detailID, name, description string
+		if err := rows.Scan(&detailID, &name, &description); err != nil {
+			return fmt.Errorf("error scanning skill: %w", err)
+		}
+		candidate := byDetail[detailID]
+		candidate.skills = append(candidate.skills, strings.TrimSpace(name))
+		// Skills are often grouped, as in "Databases: PostgreSQL, Redis"
+		for _, item := range skillListSeparator.Split(description, -1) {
+			if item = strings.TrimSpace(item); item != "" {
+				candidate.skills = append(candidate.skills, item)
+			}
+		}
+	}
+	return rows.Err()
+}
+
+func loadCandidateEducation(ctx context.Context, detailIDs []string, byDetail map[string]*jobCandidate) error {
+	rows, err := database.DB.Query(ctx,
+		"SELECT cv_id, organization, COALESCE(degree, ''), graduation_year FROM cv_education WHERE cv_id = ANY($1)",
+		detailIDs)
+	if err != nil {
+		return fmt.Errorf("error querying education: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var detailID, organization, degree string
+		var graduationYear *int
+		if err := rows.Scan(&detailID, &organization, &degree, &graduationYear); err != nil {
+			return fmt.Errorf("error scanning education: %w", err)
+		}
+		candidate := byDetail[detailID]
+
+		// Without a degree, the school still tells a university from a college
+		level, name := degreeLevel(degree, false)
+		if level == 0 {
+			level, name = degreeLevel(organization, false)
+		}
+		if level > candidate.degree {
+			candidate.degree = level
+			candidate.match.Degree = name
+		}
+		if graduationYear != nil && (candidate.graduation == 0 || *graduationYear < candidate.graduation) {
+			candidate.graduation = *graduationYear
+		}
+	}
+	return rows.Err()
+}
+
+// loadCandidateProjects loads the projects each user is currently a member of, with the day they
+// become free when every membership has an end, from the member's left_at or the project's end_date
+func loadCandidateProjects(ctx context.Context, userIDs []string, byUser map[string]*jobCandidate) error {
+	rows, err := database.DB.Query(ctx,
+		`SELECT pm.user_id, p.name, LEAST(pm.left_at, p.end_date)
+		FROM project_members pm
+		JOIN projects p ON p.id = pm.project_id
+		WHERE pm.user_id = ANY($1)
+		  AND (pm.joined_at IS NULL OR pm.joined_at <= CURRENT_DATE)
+		  AND (pm.left_at IS NULL OR pm.left_at > CURRENT_DATE)
+		  AND (p.end_date IS NULL OR p.end_date >= CURRENT_DATE)
+		ORDER BY p.name`,
+		userIDs)
+	if err != nil {
+		return fmt.Errorf("error querying project memberships: %w", err)
+	}
+	defer rows.Close()
+
+	openEnded := map[string]bool{}
+	for rows.Next() {
+		var userID, project string
+		var endsAt *time.Time
+		if err := rows.Scan(&userID, &project, &endsAt); err != nil {
+			return fmt.Errorf("error scanning project membership: %w", err)
+		}
+		availability := &byUser[userID].match.Availability
+		availability.CurrentProjects = append(availability.CurrentProjects, project)
+		if endsAt == nil {
+			openEnded[userID] = true
+			availability.AvailableFrom = nil
+		} else if !openEnded[userID] && (availability.AvailableFrom == nil || endsAt.After(*availability.AvailableFrom)) {
+			availability.AvailableFrom = endsAt
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, candidate := range byUser {
+		candidate.match.Availability.Available = len(candidate.match.Availability.CurrentProjects) == 0
+	}
+	return nil
+}
+
+// buildJobProfile takes the structured requirements of the request and completes the ones it leaves out
+// from the description. Skills are only recognized in a description when some CV has them.
+func buildJobProfile(request models.JobMatchRequest, candidates []*jobCandidate) models.JobProfile {
+	profile := models.JobProfile{
+		MustHave:   uniqueSkills(request.MustHave),
+		NiceToHave: uniqueSkills(request.NiceToHave),
+		Degree:     strings.TrimSpace(request.Degree),
+		MinYears:   request.MinYears,
+	}
+	if strings.TrimSpace(request.Description) == "" {
+		return profile
+	}
+
+	var vocabulary []string
+	for _, candidate := range candidates {
+		vocabulary = append(vocabulary, candidate.skills...)
+	}
+	reduced := reduceJobDescription(request.Description, vocabulary)
+	if len(profile.MustHave) == 0 && len(profile.NiceToHave) == 0 {
+		profile.MustHave, profile.NiceToHave = reduced.MustHave, reduced.NiceToHave
+	}
+	if profile.Degree == "" {
+		profile.Degree = reduced.Degree
+	}
+	if profile.MinYears == 0 {
+		profile.MinYears = reduced.MinYears
+	}
+	return profile
+}
+
+// reduceJobDescription reduces a free-text job description to a requirement profile: the known skills it
+// mentions, optional when their sentence says so, the lowest degree it names and the years of experience
+func reduceJobDescription(description string, vocabulary []string) models.JobProfile {
+	profile := models.JobProfile{MustHave: []string{}, NiceToHave: []string{}}
+
+	// Longer skills first, so "React Native" isn't also read as "React"
+	type term struct{ display, normalized string }
+	terms := []term{}
+	seen := map[string]bool{}
+	for _, skill := range vocabulary {
+		normalized := utils.NormalizeText(skill)
+		words := len(strings.Fields(normalized))
+		if len(normalized) < 2 || words > 4 || seen[normalized] {
+			continue
+		}
+		seen[normalized] = true
+		terms = append(terms, term{skill, normalized})
+	}
+	slices.SortStableFunc(terms, func(a, b term) int {
+		return len(b.normalized) - len(a.normalized)
+	})
+
+	found := map[string]bool{}
+	degree := 0
+	for _, sentence := range sentenceSeparator.Split(description, -1) {
+		text := " " + utils.NormalizeText(sentence) + " "
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+
+		optional := false
+		for _, marker := range niceToHaveMarkers {
+			optional = optional || strings.Contains(text, " "+marker+" ")
+		}
+		if level, _ := degreeLevel(text, true); level > 0 && (degree == 0 || level < degree) {
+			degree = level
+		}
+		for _, match := range yearsPattern.FindAllStringSubmatch(text, -1) {
+			if years, err := strconv.Atoi(match[1]); err == nil && years > profile.MinYears && years <= 50 {
+				profile.MinYears = years
+			}
+		}
+
+		for _, skill := range terms {
+			phrase := " " + skill.normalized + " "
+			if !strings.Contains(text, phrase) {
+				continue
+			}
+			text = strings.ReplaceAll(text, phrase, " | ")
+			if found[skill.normalized] {
+				continue
+			}
+			found[skill.normalized] = true
+			if optional {
+				profile.NiceToHave = append(profile.NiceToHave, skill.display)
+			} else {
+				profile.MustHave = append(profile.MustHave, skill.display)
+			}
+		}
+	}
+
+	for _, candidate := range degreeLevels {
+		if candidate.level == degree {
+			profile.Degree = candidate.name
+			break
+		}
+	}
+	return profile
+}
+
+// scoreJobCandidate scores a CV against the profile and explains the score
+func scoreJobCandidate(candidate *jobCandidate, profile models.JobProfile, now time.Time) models.JobMatch {
+	match := candidate.match
+	match.Breakdown = map[string]float64{}
+	match.MatchedSkills = []models.SkillMatch{}
+	match.MissingSkills = []string{}
+	match.MissingNiceToHave = []string{}
+
+	for _, group := range []struct {
+		name     string
+		skills   []string
+		mustHave bool
+		missing  *[]string
+	}{
+		{"must_have", profile.MustHave, true, &match.MissingSkills},
+		{"nice_to_have", profile.NiceToHave, false, &match.MissingNiceToHave},
+	} {
+		if len(group.skills) == 0 {
+			continue
+		}
+		matched := 0
+		for _, required := range group.skills {
+			skill, similarity := bestSkillMatch(required, candidate.skills)
+			if similarity < jobSkillMatchThreshold {
+				*group.missing = append(*group.missing, required)
+				continue
+			}
+			matched++
+			match.MatchedSkills = append(match.MatchedSkills, models.SkillMatch{
+				Required: required, Skill: skill, MustHave: group.mustHave, Similarity: roundScore(similarity),
+			})
+		}
+		match.Breakdown[group.name] = float64(matched) / float64(len(group.skills))
+	}
+
+	if profile.Degree != "" {
+		required, _ := degreeLevel(profile.Degree, false)
+		switch {
+		case required == 0 || candidate.degree >= required:
+			match.Breakdown["degree"] = 1
+		case candidate.degree == required-1:
+			match.Breakdown["degree"] = 0.5
+		default:
+			match.Breakdown["degree"] = 0
+		}
+	}
+
+	// Years since the first graduation stand for experience, the CV having no work history
+	if candidate.graduation > 0 && candidate.graduation <= now.Year() {
+		years := now.Year() - candidate.graduation
+		match.ExperienceYears = &years
+	}
+	if profile.MinYears > 0 {
+		experience := 0.0
+		if match.ExperienceYears != nil {
+			experience = math.Min(1, float64(*match.ExperienceYears)/float64(profile.MinYears))
+		}
+		match.Breakdown["experience"] = experience
+	}
+
+	freshness := 0.0
+	if match.LastUpdatedAt != nil {
+		age := now.Sub(*match.LastUpdatedAt)
+		days := int(age.Hours() / 24)
+		match.FreshnessDays = &days
+		switch {
+		case age <= freshCVAge:
+			freshness = 1
+		case age < staleCVAge:
+			freshness = 1 - float64(age-freshCVAge)/float64(staleCVAge-freshCVAge)
+		}
+	}
+	match.Breakdown["freshness"] = freshness
+
+	availability := 0.0
+	switch {
+	case match.Availability.Available:
+		availability = 1
+	case match.Availability.AvailableFrom != nil && match.Availability.AvailableFrom.Sub(now) <= availableSoon:
+		availability = 0.5
+	}
+	match.Breakdown["availability"] = availability
+
+	var score, weights float64
+	for criterion, value := range match.Breakdown {
+		match.Breakdown[criterion] = roundScore(value)
+		score += jobMatchWeights[criterion] * value
+		weights += jobMatchWeights[criterion]
+	}
+	match.Score = math.Round(1000*score/weights) / 10
+	return match
+}
+
+// bestSkillMatch returns the CV skill most similar to the required one. A skill containing the
+// required words, as in "PostgreSQL 14" for "PostgreSQL", covers it.
+func bestSkillMatch(required string, skills []string) (string, float64) {
+	phrase := " " + utils.NormalizeText(required) + " "
+	best, bestSimilarity := "", 0.0
+	for _, skill := range skills {
+		similarity := utils.Similarity(required, skill)
+		if strings.Contains(" "+utils.NormalizeText(skill)+" ", phrase) {
+			similarity = math.Max(similarity, 0.9)
+		}
+		if similarity > bestSimilarity {
+			best, bestSimilarity = skill, similarity
+		}
+	}
+	return best, bestSimilarity
+}
+
+// degreeLevel returns the level and name of the highest degree named in the text, 0 if none.
+// With jobText, words that also name a job are ignored.
+func degreeLevel(text string, jobText bool) (int, string) {
+	normalized := " " + utils.NormalizeText(text) + " "
+	level, name := 0, ""
+	for _, candidate := range degreeLevels {
+		if jobText && !candidate.inJobText {
+			continue
+		}
+		if candidate.level > level && strings.Contains(normalized, " "+candidate.words+" ") {
+			level, name = candidate.level, candidate.name
+		}
+	}
+	return level, name
+}
+
+// uniqueSkills trims the skills and drops empty ones and repeats
+func uniqueSkills(skills []string) []string {
+	unique := []string{}
+	seen := map[string]bool{}
+	for _, skill := range skills {
+		skill = strings.TrimSpace(skill)
+		normalized := utils.NormalizeText(skill)
+		if normalized == "" || seen[normalized] {
+			continue
+		}
+		seen[normalized] = true
+		unique = append(unique, skill)
+	}
+	return unique
+}
+
+func roundScore(value float64) float64 {
+	return math.Round(value*1000) / 1000
+}
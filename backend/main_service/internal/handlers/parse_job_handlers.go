@@ -0,0 +1,310 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/vdt/cv-management/internal/aiclient"
+	"github.com/vdt/cv-management/internal/database"
+	"github.com/vdt/cv-management/internal/models"
+)
+
+// Defaults of the CV parse job queue
+const (
+	defaultParseWorkers      = 2
+	defaultParseMaxAttempts  = 3
+	defaultParsePollInterval = 2 * time.Second
+)
+
+// parseJobLease is how long a job may run before another worker takes it over, assuming its worker died.
+// It must exceed the AI service timeout, retries included.
+const parseJobLease = 10 * time.Minute
+
+// Retry delays double from the base after each failed attempt, up to the max
+const (
+	parseRetryBaseDelay = 15 * time.Second
+	parseRetryMaxDelay  = 10 * time.Minute
+)
+
+// parseJobEvent is the SSE event sent to the owner whenever a job changes state
+const parseJobEvent = "parse_job"
+
+// parseJobWake wakes an idle worker of this instance as soon as a job is queued
+var parseJobWake = make(chan struct{}, 1)
+
+// permanentError marks a parse failure retrying can't fix, e.g. a missing file
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string { return e.err.Error() }
+
+func (e permanentError) Unwrap() error { return e.err }
+
+const parseJobColumns = `id, owner_id, file_ref, cv_user_id, status, attempts, max_attempts, run_after, result, error,
+	finished_at, created_at, updated_at`
+
+func scanParseJob(row pgx.Row, job *models.ParseJob) error {
+	return row.Scan(&job.ID, &job.OwnerID, &job.FilePath, &job.CVUserID, &job.Status, &job.Attempts, &job.MaxAttempts,
+		&job.RunAfter, &job.Result, &job.Error, &job.FinishedAt, &job.CreatedAt, &job.UpdatedAt)
+}
+
+// enqueueParseJob persists a parse job for the owner and wakes a worker. When cvUserID is set, the result
+// also fills that user's CV.
+func enqueueParseJob(ctx context.Context, ownerID, filePath, cvUserID string) (models.ParseJob, error) {
+	var job models.ParseJob
+	err := scanParseJob(database.DB.QueryRow(ctx,
+		`INSERT INTO parse_jobs (owner_id, file_ref, cv_user_id, max_attempts) VALUES ($1, $2, NULLIF($3, '')::uuid, $4)
+		RETURNING `+parseJobColumns,
+		ownerID, filePath, cvUserID, parseMaxAttempts()), &job)
+	if err != nil {
+		return job, fmt.Errorf("error queueing parse job: %w", err)
+	}
+
+	select {
+	case parseJobWake <- struct{}{}:
+	default:
+	}
+	return job, nil
+}
+
+// GetParseJob returns the state of one of the caller's parse jobs, with the parsed CV once it succeeded
+func GetParseJob(c *gin.Context) {
+	jobID := c.Param("id")
+	if uuid.Validate(jobID) != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "Parse job not found",
+		})
+		return
+	}
+
+	var job models.ParseJob
+	err := scanParseJob(database.DB.QueryRow(c,
+		"SELECT "+parseJobColumns+" FROM parse_jobs WHERE id = $1 AND owner_id = $2",
+		jobID, c.GetString("userID")), &job)
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "Parse job not found",
+		})
+		return
+	}
+	if err != nil {
+		fmt.Printf("GetParseJob: Error fetching job %s: %v\n", jobID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error fetching parse job",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   job,
+	})
+}
+
+// StartParseWorkers starts PARSE_WORKERS (default 2) workers processing the parse job queue.
+// Workers of every instance share the queue; 0 disables them on this instance.
+func StartParseWorkers() {
+	workers := defaultParseWorkers
+	if value := os.Getenv("PARSE_WORKERS"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			log.Printf("Invalid PARSE_WORKERS %q, using %d", value, defaultParseWorkers)
+		} else {
+			workers = parsed
+		}
+	}
+	if workers == 0 {
+		log.Printf("CV parse workers disabled")
+		return
+	}
+
+	pollInterval := parseDurationEnv("PARSE_POLL_INTERVAL", defaultParsePollInterval)
+	for i := 0; i < workers; i++ {
+		go runParseWorker(pollInterval)
+	}
+
+	log.Printf("Started %d CV parse workers polling every %s", workers, pollInterval)
+}
+
+func parseMaxAttempts() int {
+	if value := os.Getenv("PARSE_MAX_ATTEMPTS"); value != "" {
+		if attempts, err := strconv.Atoi(value); err == nil && attempts > 0 {
+			return attempts
+		}
+	}
+	return defaultParseMaxAttempts
+}
+
+func runParseWorker(pollInterval time.Duration) {
+	for {
+		ran, err := runNextParseJob(context.Background())
+		if err != nil {
+			log.Printf("CV parse worker: %v", err)
+		}
+		if ran {
+			continue
+		}
+
+		select {
+		case <-parseJobWake:
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// runNextParseJob claims the next due job and runs it. It reports whether there was one.
+func runNextParseJob(ctx context.Context) (bool, error) {
+	// Leave jobs queued while the AI service is down rather than failing their attempts,
+	// unless the fallback parser can handle them
+	if available, _ := aiclient.Default.Available(); !available && !parseFallbackEnabled() {
+		return false, nil
+	}
+
+	job, err := claimParseJob(ctx)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	notifyParseJob(job)
+
+	var result *models.AIServiceResponse
+	if job.Attempts > job.MaxAttempts {
+		// Taken over after its last attempt's worker stopped
+		err = permanentError{errors.New("parsing did not finish")}
+	} else {
+		result, err = parseCVFile(ctx, job.FilePath)
+		if err == nil && job.CVUserID != nil {
+			err = applyImportedCV(ctx, job, result)
+		}
+	}
+
+	if err := finishParseJob(ctx, &job, result, err); err != nil {
+		return true, err
+	}
+	notifyParseJob(job)
+	return true, nil
+}
+
+// claimParseJob marks the next due job as running and returns it. Queued jobs past their backoff and
+// running jobs past their lease are due. SKIP LOCKED lets workers claim different jobs concurrently.
+func claimParseJob(ctx context.Context) (models.ParseJob, error) {
+	var job models.ParseJob
+	err := scanParseJob(database.DB.QueryRow(ctx,
+		`UPDATE parse_jobs SET status = 'running', attempts = attempts + 1, locked_at = NOW(), updated_at = NOW()
+		WHERE id = (
+			SELECT id FROM parse_jobs
+			WHERE (status = 'queued' AND run_after <= NOW()) OR (status = 'running' AND locked_at < $1)
+			ORDER BY run_after
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+parseJobColumns,
+		time.Now().Add(-parseJobLease)), &job)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return job, fmt.Errorf("error claiming parse job: %w", err)
+	}
+	return job, err
+}
+
+// finishParseJob stores the outcome of an attempt: the result, a retry after a backoff, or the failure.
+// The attempt number fences the update, so a worker whose job was taken over can't overwrite it.
+func finishParseJob(ctx context.Context, job *models.ParseJob, result *models.AIServiceResponse, parseErr error) error {
+	var row pgx.Row
+	switch {
+	case parseErr == nil:
+		data, err := json.Marshal(result)
+		if err != nil {
+			return fmt.Errorf("error encoding result of parse job %s: %w", job.ID, err)
+		}
+		row = database.DB.QueryRow(ctx,
+			`UPDATE parse_jobs SET status = 'succeeded', result = $3, error = NULL, locked_at = NULL,
+				finished_at = NOW(), updated_at = NOW()
+			WHERE id = $1 AND attempts = $2 AND status = 'running'
+			RETURNING `+parseJobColumns,
+			job.ID, job.Attempts, data)
+
+	case errors.Is(parseErr, aiclient.ErrCircuitOpen):
+		// The breaker opened meanwhile, so the file was never tried: the attempt is given back
+		_, retryAt := aiclient.Default.Available()
+		if retryAt.IsZero() {
+			retryAt = time.Now().Add(parseRetryBaseDelay)
+		}
+		row = database.DB.QueryRow(ctx,
+			`UPDATE parse_jobs SET status = 'queued', attempts = attempts - 1, run_after = $3, error = $4,
+				locked_at = NULL, updated_at = NOW()
+			WHERE id = $1 AND attempts = $2 AND status = 'running'
+			RETURNING `+parseJobColumns,
+			job.ID, job.Attempts, retryAt, parseErr.Error())
+
+	case !errors.As(parseErr, &permanentError{}) && job.Attempts < job.MaxAttempts:
+		log.Printf("CV parse job %s attempt %d failed, retrying: %v", job.ID, job.Attempts, parseErr)
+		row = database.DB.QueryRow(ctx,
+			`UPDATE parse_jobs SET status = 'queued', run_after = $3, error = $4, locked_at = NULL, updated_at = NOW()
+			WHERE id = $1 AND attempts = $2 AND status = 'running'
+			RETURNING `+parseJobColumns,
+			job.ID, job.Attempts, time.Now().Add(parseRetryDelay(job.Attempts)), parseErr.Error())
+
+	default:
+		log.Printf("CV parse job %s failed after %d attempts: %v", job.ID, job.Attempts, parseErr)
+		row = database.DB.QueryRow(ctx,
+			`UPDATE parse_jobs SET status = 'failed', error = $3, locked_at = NULL, finished_at = NOW(), updated_at = NOW()
+			WHERE id = $1 AND attempts = $2 AND status = 'running'
+			RETURNING `+parseJobColumns,
+			job.ID, job.Attempts, parseErr.Error())
+	}
+
+	err := scanParseJob(row, job)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("parse job %s was taken over by another worker", job.ID)
+	}
+	if err != nil {
+		return fmt.Errorf("error saving parse job %s: %w", job.ID, err)
+	}
+	return nil
+}
+
+// parseRetryDelay returns the backoff before the attempt following the given one
+func parseRetryDelay(attempt int) time.Duration {
+	delay := parseRetryBaseDelay
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if delay >= parseRetryMaxDelay {
+			return parseRetryMaxDelay
+		}
+	}
+	return delay
+}
+
+// notifyParseJob sends the job's state to its owner. Clients fetch the result through GetParseJob.
+func notifyParseJob(job models.ParseJob) {
+	data := map[string]any{
+		"job_id":       job.ID,
+		"status":       job.Status,
+		"attempts":     job.Attempts,
+		"max_attempts": job.MaxAttempts,
+		"file_path":    job.FilePath,
+	}
+	if job.Error != nil {
+		data["error"] = *job.Error
+	}
+	if job.Status == models.ParseJobQueued {
+		data["retry_at"] = job.RunAfter
+	}
+	SendSSENotificationToUser(job.OwnerID, parseJobEvent, data)
+}
@@ -0,0 +1,601 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/vdt/cv-management/internal/audit"
+	"github.com/vdt/cv-management/internal/database"
+	"github.com/vdt/cv-management/internal/models"
+	"github.com/vdt/cv-management/internal/storage"
+)
+
+// erasedUserName replaces the name of an erased user, so history still reads sensibly
+const erasedUserName = "Người dùng đã xoá"
+
+const erasureRequestColumns = `e.id, e.user_id, u.full_name, e.reason, e.status, e.reviewed_by, e.reviewed_at,
+	e.review_note, e.pending_objects, e.error, e.completed_at, e.created_at`
+
+func scanErasureRequest(row pgx.Row, request *models.ErasureRequest) error {
+	return row.Scan(&request.ID, &request.UserID, &request.UserName, &request.Reason, &request.Status,
+		&request.ReviewedBy, &request.ReviewedAt, &request.ReviewNote, &request.PendingObjects,
+		&request.Error, &request.CompletedAt, &request.CreatedAt)
+}
+
+// ExportMyData returns a ZIP archive with everything stored about the caller:
+// profile, CV, CV history (from the audit log), CV update requests, project memberships and uploaded files.
+// The caller is the owner, so the CV field visibility policy (authz.RelationshipSelf) hides nothing.
+func ExportMyData(c *gin.Context) {
+	userID := c.GetString("userID")
+
+	sections := []struct {
+		name  string
+		fetch func() (json.RawMessage, error)
+	}{
+		{"profile.json", func() (json.RawMessage, error) { return audit.UserSnapshot(c, database.DB, userID) }},
+		{"cv.json", func() (json.RawMessage, error) { return audit.CVSnapshot(c, database.DB, userID) }},
+		{"cv_history.json", func() (json.RawMessage, error) { return exportCVHistory(c, userID) }},
+		{"cv_requests.json", func() (json.RawMessage, error) {
+			return audit.Snapshot(c, database.DB,
+				`SELECT COALESCE(jsonb_agg(to_jsonb(r) ORDER BY r.requested_at), '[]'::jsonb)::text
+				FROM cv_update_requests r
+				WHERE r.cv_id IN (SELECT id FROM cv WHERE user_id = $1) OR r.requested_by = $1`,
+				userID)
+		}},
+		{"projects.json", func() (json.RawMessage, error) {
+			return audit.Snapshot(c, database.DB,
+				`SELECT COALESCE(jsonb_agg(jsonb_build_object(
+					'project_id', p.id, 'project_name', p.name, 'role_in_project', pm.role_in_project,
+					'joined_at', pm.joined_at, 'left_at', pm.left_at) ORDER BY pm.joined_at), '[]'::jsonb)::text
+				FROM project_members pm
+				JOIN projects p ON p.id = pm.project_id
+				WHERE pm.user_id = $1`,
+				userID)
+		}},
+	}
+
+	manifest := models.DataExportManifest{UserID: userID, GeneratedAt: time.Now().UTC()}
+	files := map[string][]byte{}
+
+	for _, section := range sections {
+		data, err := section.fetch()
+		if err != nil {
+			fmt.Printf("ExportMyData: Error exporting %s for user %s: %v\n", section.name, userID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  "error",
+				"message": "Error exporting personal data",
+			})
+			return
+		}
+		files[section.name] = indentJSON(data)
+		manifest.Files = append(manifest.Files, section.name)
+	}
+
+	// Uploaded files are downloaded from storage; a missing file is reported instead of failing the export
+	var cvPath, portraitPath *string
+	err := database.DB.QueryRow(c,
+		`SELECT d.cvpath, d.portraitpath FROM cv_details d JOIN cv ON cv.id = d.cv_id WHERE cv.user_id = $1`,
+		userID).Scan(&cvPath, &portraitPath)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		fmt.Printf("ExportMyData: Error fetching file paths for user %s: %v\n", userID, err)
+	}
+	uploads := map[string]*string{"files/cv": cvPath, "files/portrait": portraitPath}
+	for name, fileURL := range uploads {
+		if fileURL == nil || *fileURL == "" {
+			continue
+		}
+		data, err := downloadUserFile(c, *fileURL)
+		if err != nil {
+			fmt.Printf("ExportMyData: Error downloading %s for user %s: %v\n", *fileURL, userID, err)
+			manifest.Errors = append(manifest.Errors, fmt.Sprintf("%s: could not be downloaded (%s)", name, *fileURL))
+			continue
+		}
+		name += path.Ext(*fileURL)
+		files[name] = data
+		manifest.Files = append(manifest.Files, name)
+	}
+
+	// Nothing is sent unless the export is on record
+	if !recordAuditEvent(c, audit.Entry{Action: auditUserDataExport, TargetType: "user", TargetID: userID, After: manifest}) {
+		return
+	}
+
+	manifestData, _ := json.MarshalIndent(manifest, "", "  ")
+
+	filename := fmt.Sprintf("personal-data-%s.zip", time.Now().Format("20060102-150405"))
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	archive := zip.NewWriter(c.Writer)
+	writeZipEntry(archive, "manifest.json", manifestData)
+	for _, name := range manifest.Files {
+		writeZipEntry(archive, name, files[name])
+	}
+	// Headers are already sent, so an error can only be logged
+	if err := archive.Close(); err != nil {
+		fmt.Printf("ExportMyData: Error writing archive for user %s: %v\n", userID, err)
+	}
+}
+
+// exportCVHistory returns every recorded change of the user's CV, oldest first
+func exportCVHistory(ctx context.Context, userID string) (json.RawMessage, error) {
+	rows := []audit.Row{}
+	err := audit.Each(ctx, audit.Filter{TargetType: "cv", TargetID: userID}, func(row audit.Row) error {
+		rows = append(rows, row)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(rows)
+}
+
+func indentJSON(data json.RawMessage) []byte {
+	if data == nil {
+		return []byte("null")
+	}
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, data, "", "  "); err != nil {
+		return data
+	}
+	return indented.Bytes()
+}
+
+func writeZipEntry(archive *zip.Writer, name string, data []byte) {
+	writer, err := archive.Create(name)
+	if err == nil {
+		_, err = writer.Write(data)
+	}
+	if err != nil {
+		fmt.Printf("writeZipEntry: Error writing %s: %v\n", name, err)
+	}
+}
+
+func downloadUserFile(ctx context.Context, fileRef string) ([]byte, error) {
+	key := storage.KeyFromRef(fileRef)
+	if key == "" {
+		return nil, fmt.Errorf("invalid file reference %s", fileRef)
+	}
+	return storage.ReadAll(ctx, key)
+}
+
+// CreateErasureRequest asks for the caller's personal data to be erased; an Admin has to approve it
+func CreateErasureRequest(c *gin.Context) {
+	userID := c.GetString("userID")
+
+	var request models.ErasureRequestCreate
+	if err := c.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid request data",
+		})
+		return
+	}
+
+	var reason *string
+	if trimmed := strings.TrimSpace(request.Reason); trimmed != "" {
+		reason = &trimmed
+	}
+
+	tx, err := database.DB.Begin(c)
+	if err != nil {
+		fmt.Printf("CreateErasureRequest transaction begin error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error creating erasure request",
+		})
+		return
+	}
+	defer tx.Rollback(c)
+
+	var requestID string
+	err = tx.QueryRow(c,
+		"INSERT INTO erasure_requests (user_id, reason) VALUES ($1, $2) RETURNING id",
+		userID, reason).Scan(&requestID)
+	if err != nil {
+		if isUniqueViolation(err) {
+			c.JSON(http.StatusConflict, gin.H{
+				"status":  "error",
+				"message": "You already have a pending erasure request",
+			})
+			return
+		}
+		fmt.Printf("CreateErasureRequest error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error creating erasure request",
+		})
+		return
+	}
+
+	if !recordAudit(c, tx, audit.Entry{Action: auditErasureRequest, TargetType: "erasure_request", TargetID: requestID}) {
+		return
+	}
+
+	if err := tx.Commit(c); err != nil {
+		fmt.Printf("CreateErasureRequest transaction commit error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error creating erasure request",
+		})
+		return
+	}
+
+	fmt.Printf("CreateErasureRequest: User %s requested erasure (%s)\n", userID, requestID)
+	c.JSON(http.StatusCreated, gin.H{
+		"status":  "success",
+		"message": "Your erasure request has been sent to an administrator",
+		"data": gin.H{
+			"id":     requestID,
+			"status": "pending",
+		},
+	})
+}
+
+// GetMyErasureRequests returns the caller's erasure requests
+func GetMyErasureRequests(c *gin.Context) {
+	listErasureRequests(c, "WHERE e.user_id = $1", c.GetString("userID"))
+}
+
+// GetErasureRequests returns all erasure requests, optionally filtered by status (Admin only)
+func GetErasureRequests(c *gin.Context) {
+	if status := c.Query("status"); status != "" {
+		listErasureRequests(c, "WHERE e.status = $1", status)
+		return
+	}
+	listErasureRequests(c, "")
+}
+
+func listErasureRequests(c *gin.Context, where string, args ...any) {
+	rows, err := database.DB.Query(c,
+		`SELECT `+erasureRequestColumns+`
+		FROM erasure_requests e
+		JOIN users u ON u.id = e.user_id
+		`+where+`
+		ORDER BY e.created_at DESC`,
+		args...)
+	if err != nil {
+		fmt.Printf("listErasureRequests error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error fetching erasure requests",
+		})
+		return
+	}
+	defer rows.Close()
+
+	requests := []models.ErasureRequest{}
+	for rows.Next() {
+		var request models.ErasureRequest
+		if err := scanErasureRequest(rows, &request); err != nil {
+			fmt.Printf("listErasureRequests scan error: %v\n", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  "error",
+				"message": "Error parsing erasure request data",
+			})
+			return
+		}
+		requests = append(requests, request)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   requests,
+	})
+}
+
+// RejectErasureRequest rejects a pending erasure request (Admin only)
+func RejectErasureRequest(c *gin.Context) {
+	var review models.ErasureReview
+	if err := c.ShouldBindJSON(&review); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid request data",
+		})
+		return
+	}
+
+	tx, err := database.DB.Begin(c)
+	if err != nil {
+		fmt.Printf("RejectErasureRequest transaction begin error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error rejecting erasure request",
+		})
+		return
+	}
+	defer tx.Rollback(c)
+
+	tag, err := tx.Exec(c,
+		`UPDATE erasure_requests
+		SET status = 'rejected', reviewed_by = $2, reviewed_at = NOW(), review_note = NULLIF($3, '')
+		WHERE id = $1 AND status = 'pending'`,
+		c.Param("id"), c.GetString("userID"), strings.TrimSpace(review.Note))
+	if err != nil {
+		fmt.Printf("RejectErasureRequest error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error rejecting erasure request",
+		})
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "No pending erasure request found",
+		})
+		return
+	}
+
+	if !recordAudit(c, tx, audit.Entry{
+		Action:     auditErasureReject,
+		TargetType: "erasure_request",
+		TargetID:   c.Param("id"),
+		After:      gin.H{"note": strings.TrimSpace(review.Note)},
+	}) {
+		return
+	}
+
+	if err := tx.Commit(c); err != nil {
+		fmt.Printf("RejectErasureRequest transaction commit error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error rejecting erasure request",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Erasure request rejected",
+	})
+}
+
+// ApproveErasureRequest anonymises the user of a pending erasure request and deletes their files from storage.
+// Approving a failed request retries the files that could not be deleted (Admin only).
+//
+// The audit log is kept as the record of processing: earlier entries stay, but their states naming the user
+// are redacted, and the erasure entry itself stores no personal data.
+func ApproveErasureRequest(c *gin.Context) {
+	requestID := c.Param("id")
+	reviewerID := c.GetString("userID")
+
+	var review models.ErasureReview
+	if err := c.ShouldBindJSON(&review); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid request data",
+		})
+		return
+	}
+
+	tx, err := database.DB.Begin(c)
+	if err != nil {
+		fmt.Printf("ApproveErasureRequest transaction begin error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error starting transaction",
+		})
+		return
+	}
+	defer tx.Rollback(c)
+
+	var userID, status string
+	var objects []string
+	err = tx.QueryRow(c,
+		"SELECT user_id, status, pending_objects FROM erasure_requests WHERE id = $1 FOR UPDATE",
+		requestID).Scan(&userID, &status, &objects)
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "Erasure request not found",
+		})
+		return
+	}
+	if err != nil {
+		fmt.Printf("ApproveErasureRequest error fetching request: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error fetching erasure request",
+		})
+		return
+	}
+
+	if userID == reviewerID {
+		c.JSON(http.StatusForbidden, gin.H{
+			"status":  "error",
+			"message": "You cannot approve your own erasure request",
+		})
+		return
+	}
+
+	switch status {
+	case "pending":
+		objects, err = anonymiseUser(c, tx, userID)
+		if err != nil {
+			fmt.Printf("ApproveErasureRequest error anonymising user %s: %v\n", userID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  "error",
+				"message": "Error erasing user data",
+			})
+			return
+		}
+
+		_, err = tx.Exec(c,
+			`UPDATE erasure_requests
+			SET status = 'approved', reviewed_by = $2, reviewed_at = NOW(), review_note = NULLIF($3, ''), pending_objects = $4
+			WHERE id = $1`,
+			requestID, reviewerID, strings.TrimSpace(review.Note), objects)
+		if err != nil {
+			fmt.Printf("ApproveErasureRequest error updating request: %v\n", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  "error",
+				"message": "Error updating erasure request",
+			})
+			return
+		}
+
+		if !recordAudit(c, tx, audit.Entry{
+			Action:     auditUserErase,
+			TargetType: "user",
+			TargetID:   userID,
+			After:      gin.H{"erasure_request_id": requestID, "files_to_delete": len(objects)},
+		}) {
+			return
+		}
+	case "failed":
+		// Only the file deletion is retried
+	default:
+		c.JSON(http.StatusConflict, gin.H{
+			"status":  "error",
+			"message": fmt.Sprintf("Erasure request is already %s", status),
+		})
+		return
+	}
+
+	if err := tx.Commit(c); err != nil {
+		fmt.Printf("ApproveErasureRequest transaction commit error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error committing transaction",
+		})
+		return
+	}
+
+	// Storage isn't transactional, so files are deleted after the commit and failures are kept for a retry
+	remaining, deleteErr := deleteUserFiles(c, objects)
+	var errorMessage *string
+	finalStatus := "completed"
+	if deleteErr != nil {
+		message := deleteErr.Error()
+		errorMessage = &message
+		finalStatus = "failed"
+		fmt.Printf("ApproveErasureRequest: Could not delete files of user %s: %v\n", userID, deleteErr)
+	}
+
+	var result models.ErasureRequest
+	err = scanErasureRequest(database.DB.QueryRow(c,
+		`WITH updated AS (
+			UPDATE erasure_requests
+			SET status = $2, pending_objects = $3, error = $4,
+				completed_at = CASE WHEN $2 = 'completed' THEN NOW() END
+			WHERE id = $1
+			RETURNING *
+		)
+		SELECT `+erasureRequestColumns+`
+		FROM updated e
+		JOIN users u ON u.id = e.user_id`,
+		requestID, finalStatus, remaining, errorMessage), &result)
+	if err != nil {
+		fmt.Printf("ApproveErasureRequest error updating request status: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "User data erased but error updating erasure request",
+		})
+		return
+	}
+
+	fmt.Printf("ApproveErasureRequest: Erasure request %s for user %s is %s\n", requestID, userID, finalStatus)
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   result,
+	})
+}
+
+// anonymiseUser replaces the user's identity, clears their CV and deactivates them.
+// It returns the storage URLs of the user's files, which the caller deletes after committing.
+func anonymiseUser(ctx context.Context, tx pgx.Tx, userID string) ([]string, error) {
+	var cvPath, portraitPath *string
+	err := tx.QueryRow(ctx,
+		`SELECT d.cvpath, d.portraitpath FROM cv_details d JOIN cv ON cv.id = d.cv_id WHERE cv.user_id = $1`,
+		userID).Scan(&cvPath, &portraitPath)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("error fetching file paths: %w", err)
+	}
+
+	objects := []string{}
+	for _, fileURL := range []*string{cvPath, portraitPath} {
+		if fileURL != nil && *fileURL != "" {
+			objects = append(objects, *fileURL)
+		}
+	}
+	objects, err = withRenditions(ctx, tx, objects)
+	if err != nil {
+		return nil, err
+	}
+
+	// cv_education, cv_courses and cv_skills reference cv_details through their cv_id column
+	cvDetailIDs := "SELECT d.id FROM cv_details d JOIN cv ON cv.id = d.cv_id WHERE cv.user_id = $1"
+	statements := []string{
+		`UPDATE users SET full_name = '` + erasedUserName + `', email = 'erased-' || id || '@erased.invalid',
+			employee_code = 'ERASED', password = '', deactivated_at = COALESCE(deactivated_at, NOW()),
+			deactivated_by_sync = FALSE, erased_at = NOW()
+		WHERE id = $1`,
+		"DELETE FROM user_roles WHERE user_id = $1",
+		"DELETE FROM cv_education WHERE cv_id IN (" + cvDetailIDs + ")",
+		"DELETE FROM cv_courses WHERE cv_id IN (" + cvDetailIDs + ")",
+		"DELETE FROM cv_skills WHERE cv_id IN (" + cvDetailIDs + ")",
+		`UPDATE cv_details SET
+			full_name = '', job_title = '', summary = '',
+			birthday = NULL, gender = NULL, email = NULL,
+			phone = NULL, address = NULL, cvpath = NULL, portraitpath = NULL, provenance = '{}'
+		WHERE cv_id IN (SELECT id FROM cv WHERE user_id = $1)`,
+		"UPDATE cv SET status = 'Chưa cập nhật', last_updated_at = NOW() WHERE user_id = $1",
+		"UPDATE cv_update_requests SET content = NULL WHERE cv_id IN (SELECT id FROM cv WHERE user_id = $1)",
+		"UPDATE impersonation_sessions SET ended_at = NOW() WHERE user_id = $1 AND ended_at IS NULL",
+		// Shared snapshots are copies of the CV, so they go too
+		"DELETE FROM share_link_cvs WHERE user_id = $1",
+		// Parse results are copies of the uploaded CV, including the ones an admin imported
+		"DELETE FROM parse_jobs WHERE owner_id = $1 OR cv_user_id = $1",
+		// An erased user is no longer anyone's duplicate
+		"DELETE FROM duplicate_candidates WHERE status = 'pending' AND $1 IN (user_a_id, user_b_id)",
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(ctx, statement, userID); err != nil {
+			return nil, fmt.Errorf("error running %q: %w", statement, err)
+		}
+	}
+
+	// CV and profile snapshots in the audit log are copies of the personal data too
+	if _, err := audit.RedactSubject(ctx, tx, userID); err != nil {
+		return nil, err
+	}
+
+	// The files are deleted right after committing; the garbage collector retries any left behind
+	if err := syncUploadReferences(ctx, tx, userID); err != nil {
+		return nil, err
+	}
+
+	return objects, nil
+}
+
+// deleteUserFiles deletes the files from storage and returns the ones that could not be deleted
+func deleteUserFiles(ctx context.Context, objects []string) ([]string, error) {
+	remaining := []string{}
+
+	var errs []error
+	for _, fileURL := range objects {
+		key := storage.KeyFromRef(fileURL)
+		if key == "" {
+			remaining = append(remaining, fileURL)
+			errs = append(errs, fmt.Errorf("%s: invalid file reference", fileURL))
+			continue
+		}
+		if err := storage.Store.Delete(ctx, key); err != nil {
+			remaining = append(remaining, fileURL)
+			errs = append(errs, fmt.Errorf("%s: %w", fileURL, err))
+		}
+	}
+	return remaining, errors.Join(errs...)
+}
@@ -1,13 +1,15 @@
 package handlers
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
-	"slices"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/vdt/cv-management/internal/audit"
+	"github.com/vdt/cv-management/internal/authz"
 	"github.com/vdt/cv-management/internal/database"
 	"github.com/vdt/cv-management/internal/models"
 )
@@ -24,46 +26,44 @@ func GetProjects(c *gin.Context) {
 		return
 	}
 
-	// Get user roles from context
-	roles, exists := c.Get("roles")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{
+	userIDStr, ok := userID.(string)
+	if !ok {
+		fmt.Printf("GetProjects: Invalid userID format: %T = %v\n", userID, userID)
+		c.JSON(http.StatusInternalServerError, gin.H{
 			"status":  "error",
-			"message": "Unauthorized - user roles not found",
+			"message": "Server error - invalid user ID format",
 		})
 		return
 	}
 
-	// Convert roles to string slice
-	roleSlice, ok := roles.([]string)
-	if !ok {
-		fmt.Printf("GetProjects: Invalid role format: %T = %v\n", roles, roles)
+	fmt.Printf("GetProjects: User ID: %v\n", userIDStr)
+
+	canReadAll, err := authz.HasPermission(c, authz.ProjectsReadAll)
+	if err != nil {
+		fmt.Printf("GetProjects: Error checking permissions: %v\n", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"status":  "error",
-			"message": "Server error - invalid role format",
+			"message": "Server error - could not check permissions",
 		})
 		return
 	}
-
-	userIDStr, ok := userID.(string)
-	if !ok {
-		fmt.Printf("GetProjects: Invalid userID format: %T = %v\n", userID, userID)
+	canManage, err := authz.HasPermission(c, authz.ProjectsWrite)
+	if err != nil {
+		fmt.Printf("GetProjects: Error checking permissions: %v\n", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"status":  "error",
-			"message": "Server error - invalid user ID format",
+			"message": "Server error - could not check permissions",
 		})
 		return
 	}
 
-	fmt.Printf("GetProjects: User ID: %v, Roles: %v\n", userIDStr, roleSlice)
-
-	// Role-based project access:
-	// - Admin: Can see all projects
-	// - PM: Can see projects they are members of
-	// - Employee: Can see projects they are members of
+	// Permission-based project access:
+	// - projects:read_all (Admin): Can see all projects
+	// - projects:write (PM): Can see projects where they are the PM
+	// - Others: Can see projects they are members of
 	var projects []models.Project
 
-	if slices.Contains(roleSlice, "Admin") {
+	if canReadAll {
 		// Admin can see all projects with member counts
 		fmt.Println("GetProjects: Admin access - fetching all projects with member counts")
 		rows, err := database.DB.Query(c, `
@@ -111,7 +111,7 @@ func GetProjects(c *gin.Context) {
 			})
 			return
 		}
-	} else if slices.Contains(roleSlice, "PM") {
+	} else if canManage {
 		// PM can see projects where they have PM role with member counts
 		fmt.Printf("GetProjects: PM access - fetching projects where user %s has PM role with member counts\n", userIDStr)
 		rows, err := database.DB.Query(c, `
@@ -357,6 +357,14 @@ func CreateProject(c *gin.Context) {
 
 	fmt.Printf("CreateProject: Successfully added user %s as PM of project %s\n", userIDStr, projectID)
 
+	after, ok := auditSnapshot(c, func() (json.RawMessage, error) { return audit.ProjectSnapshot(c, tx, projectID) })
+	if !ok {
+		return
+	}
+	if !recordAudit(c, tx, audit.Entry{Action: auditProjectCreate, TargetType: "project", TargetID: projectID, After: after}) {
+		return
+	}
+
 	// Commit the transaction
 	err = tx.Commit(c)
 	if err != nil {
@@ -412,7 +420,7 @@ func CreateProjectWithPM(c *gin.Context) {
 	var pmHasPMRole bool
 
 	// Check if user exists
-	err := database.DB.QueryRow(c, "SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)", projectData.PMUserID).Scan(&pmExists)
+	err := database.DB.QueryRow(c, "SELECT EXISTS(SELECT 1 FROM users WHERE id = $1 AND deactivated_at IS NULL)", projectData.PMUserID).Scan(&pmExists)
 	if err != nil {
 		fmt.Printf("CreateProjectWithPM user check error: %v\n", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -523,6 +531,14 @@ func CreateProjectWithPM(c *gin.Context) {
 
 	fmt.Printf("CreateProjectWithPM: Successfully added PM %s to project %s\n", projectData.PMUserID, projectID)
 
+	after, ok := auditSnapshot(c, func() (json.RawMessage, error) { return audit.ProjectSnapshot(c, tx, projectID) })
+	if !ok {
+		return
+	}
+	if !recordAudit(c, tx, audit.Entry{Action: auditProjectCreate, TargetType: "project", TargetID: projectID, After: after}) {
+		return
+	}
+
 	// Commit transaction
 	if err = tx.Commit(c); err != nil {
 		fmt.Printf("CreateProjectWithPM commit error: %v\n", err)
@@ -680,7 +696,23 @@ func UpdateProject(c *gin.Context) {
 	fmt.Printf("UpdateProject query: %s\n", query)
 	fmt.Printf("UpdateProject args: %v\n", args)
 
-	result, err := database.DB.Exec(c, query, args...)
+	tx, err := database.DB.Begin(c)
+	if err != nil {
+		fmt.Printf("UpdateProject transaction error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error starting database transaction",
+		})
+		return
+	}
+	defer tx.Rollback(c) // Will be ignored if transaction is committed
+
+	before, ok := auditSnapshot(c, func() (json.RawMessage, error) { return audit.ProjectSnapshot(c, tx, id) })
+	if !ok {
+		return
+	}
+
+	result, err := tx.Exec(c, query, args...)
 	if err != nil {
 		fmt.Printf("UpdateProject update error: %v\n", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -703,7 +735,7 @@ func UpdateProject(c *gin.Context) {
 
 	// Fetch the updated project to return
 	var updatedProject models.Project
-	err = database.DB.QueryRow(c,
+	err = tx.QueryRow(c,
 		"SELECT id, name, start_date, end_date FROM projects WHERE id = $1",
 		id).Scan(&updatedProject.ID, &updatedProject.Name, &updatedProject.StartDate, &updatedProject.EndDate)
 	if err != nil {
@@ -715,6 +747,23 @@ func UpdateProject(c *gin.Context) {
 		return
 	}
 
+	after, ok := auditSnapshot(c, func() (json.RawMessage, error) { return audit.ProjectSnapshot(c, tx, id) })
+	if !ok {
+		return
+	}
+	if !recordAudit(c, tx, audit.Entry{Action: auditProjectUpdate, TargetType: "project", TargetID: id, Before: before, After: after}) {
+		return
+	}
+
+	if err := tx.Commit(c); err != nil {
+		fmt.Printf("UpdateProject commit error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error committing project update",
+		})
+		return
+	}
+
 	fmt.Printf("UpdateProject: Successfully updated project %s\n", id)
 
 	c.JSON(http.StatusOK, gin.H{
@@ -777,6 +826,11 @@ func DeleteProject(c *gin.Context) {
 	}
 	defer tx.Rollback(c) // Will be ignored if transaction is committed
 
+	before, ok := auditSnapshot(c, func() (json.RawMessage, error) { return audit.ProjectSnapshot(c, tx, id) })
+	if !ok {
+		return
+	}
+
 	// First, remove all project members (hard delete to avoid foreign key constraint)
 	_, err = tx.Exec(c, "DELETE FROM project_members WHERE project_id = $1", id)
 	if err != nil {
@@ -810,6 +864,10 @@ func DeleteProject(c *gin.Context) {
 		return
 	}
 
+	if !recordAudit(c, tx, audit.Entry{Action: auditProjectDelete, TargetType: "project", TargetID: id, Before: before}) {
+		return
+	}
+
 	// Commit the transaction
 	err = tx.Commit(c)
 	if err != nil {
@@ -880,7 +938,7 @@ func AddProjectMember(c *gin.Context) {
 
 	// Check if user exists
 	var userExists bool
-	err = database.DB.QueryRow(c, "SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)", memberData.UserID).Scan(&userExists)
+	err = database.DB.QueryRow(c, "SELECT EXISTS(SELECT 1 FROM users WHERE id = $1 AND deactivated_at IS NULL)", memberData.UserID).Scan(&userExists)
 	if err != nil {
 		fmt.Printf("AddProjectMember user check error: %v\n", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -929,8 +987,19 @@ func AddProjectMember(c *gin.Context) {
 		memberData.RoleInProject = "Developer"
 	}
 
+	tx, err := database.DB.Begin(c)
+	if err != nil {
+		fmt.Printf("AddProjectMember transaction error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error starting database transaction",
+		})
+		return
+	}
+	defer tx.Rollback(c) // Will be ignored if transaction is committed
+
 	query := `INSERT INTO project_members (project_id, user_id, role_in_project, joined_at) VALUES ($1, $2, $3, $4)`
-	_, err = database.DB.Exec(c, query, memberData.ProjectID, memberData.UserID, memberData.RoleInProject, memberData.JoinedAt)
+	_, err = tx.Exec(c, query, memberData.ProjectID, memberData.UserID, memberData.RoleInProject, memberData.JoinedAt)
 	if err != nil {
 		fmt.Printf("AddProjectMember insert error: %v\n", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -940,6 +1009,19 @@ func AddProjectMember(c *gin.Context) {
 		return
 	}
 
+	if !recordAudit(c, tx, audit.Entry{Action: auditProjectMemberAdd, TargetType: "project", TargetID: projectID, After: memberData}) {
+		return
+	}
+
+	if err := tx.Commit(c); err != nil {
+		fmt.Printf("AddProjectMember commit error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error committing project member",
+		})
+		return
+	}
+
 	fmt.Printf("AddProjectMember: Successfully added user %s to project %s with role %s\n",
 		memberData.UserID, projectID, memberData.RoleInProject)
 
@@ -1036,8 +1118,19 @@ func RemoveProjectMember(c *gin.Context) {
 	}
 
 	// Update the project member record to set left_at to current date (soft delete)
+	tx, err := database.DB.Begin(c)
+	if err != nil {
+		fmt.Printf("RemoveProjectMember transaction error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error starting database transaction",
+		})
+		return
+	}
+	defer tx.Rollback(c) // Will be ignored if transaction is committed
+
 	query := `UPDATE project_members SET left_at = CURRENT_DATE WHERE project_id = $1 AND user_id = $2`
-	result, err := database.DB.Exec(c, query, projectID, userID)
+	result, err := tx.Exec(c, query, projectID, userID)
 	if err != nil {
 		fmt.Printf("RemoveProjectMember update error: %v\n", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -1058,6 +1151,24 @@ func RemoveProjectMember(c *gin.Context) {
 		return
 	}
 
+	if !recordAudit(c, tx, audit.Entry{
+		Action:     auditProjectMemberRemove,
+		TargetType: "project",
+		TargetID:   projectID,
+		Before:     gin.H{"user_id": userID},
+	}) {
+		return
+	}
+
+	if err := tx.Commit(c); err != nil {
+		fmt.Printf("RemoveProjectMember commit error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error committing member removal",
+		})
+		return
+	}
+
 	fmt.Printf("RemoveProjectMember: Successfully removed user %s from project %s\n", userID, projectID)
 
 	c.JSON(http.StatusOK, gin.H{
@@ -1081,41 +1192,29 @@ func GetAllMembersOfAllProjects(c *gin.Context) {
 		return
 	}
 
-	// Get user roles from context
-	roles, exists := c.Get("roles")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"status":  "error",
-			"message": "Unauthorized - user roles not found",
-		})
-		return
-	}
-
-	// Convert roles to string slice
-	roleSlice, ok := roles.([]string)
+	requestUserIDStr, ok := requestUserID.(string)
 	if !ok {
-		fmt.Printf("GetAllMembersOfAllProjects: Invalid role format: %T = %v\n", roles, roles)
+		fmt.Printf("GetAllMembersOfAllProjects: Invalid userID format: %T = %v\n", requestUserID, requestUserID)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"status":  "error",
-			"message": "Server error - invalid role format",
+			"message": "Server error - invalid user ID format",
 		})
 		return
 	}
 
-	requestUserIDStr, ok := requestUserID.(string)
-	if !ok {
-		fmt.Printf("GetAllMembersOfAllProjects: Invalid userID format: %T = %v\n", requestUserID, requestUserID)
+	fmt.Printf("GetAllMembersOfAllProjects: Request from PM user %s\n", requestUserIDStr)
+
+	// Only users allowed to read the members of their projects can access this function
+	hasAccess, err := authz.HasPermission(c, authz.ProjectsReadMembers)
+	if err != nil {
+		fmt.Printf("GetAllMembersOfAllProjects: Error checking permissions: %v\n", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"status":  "error",
-			"message": "Server error - invalid user ID format",
+			"message": "Server error - could not check permissions",
 		})
 		return
 	}
-
-	fmt.Printf("GetAllMembersOfAllProjects: Request from PM user %s, Roles: %v\n", requestUserIDStr, roleSlice)
-
-	// Only PM can access this function
-	if !slices.Contains(roleSlice, "PM") {
+	if !hasAccess {
 		c.JSON(http.StatusForbidden, gin.H{
 			"status":  "error",
 			"message": "Access denied - only PM can access project members",
@@ -1137,6 +1236,7 @@ func GetAllMembersOfAllProjects(c *gin.Context) {
 		INNER JOIN project_members pm_check ON p.id = pm_check.project_id
 		WHERE pm_check.user_id = $1
 		  AND pm_check.role_in_project = 'PM'
+		  AND u.deactivated_at IS NULL
 		  AND (pm.left_at IS NULL OR pm.left_at > CURRENT_DATE)
 		  AND (pm_check.left_at IS NULL OR pm_check.left_at > CURRENT_DATE)
 		GROUP BY u.id, u.employee_code, u.full_name, u.email, u.department_id, d.name
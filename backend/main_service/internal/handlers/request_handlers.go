@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/vdt/cv-management/internal/audit"
 	"github.com/vdt/cv-management/internal/database"
 	"github.com/vdt/cv-management/internal/models"
 )
@@ -108,6 +109,10 @@ func GetCVRequests(c *gin.Context) {
 func CreateCVRequest(c *gin.Context) {
 	// Get user ID from context (set by auth middleware)
 	requestedByID, exists := c.Get("userID")
+	if !exists {
+		// Requests created through a service account API key are attributed to the account owner
+		requestedByID, exists = c.Get("serviceAccountOwnerID")
+	}
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{
 			"status":  "error",
@@ -867,6 +872,16 @@ func UpdateCVRequestStatus(c *gin.Context) {
 		fmt.Printf("UpdateCVRequestStatus: Successfully updated CV %s status to 'Hủy yêu cầu'\n", cvID)
 	}
 
+	if !recordAudit(c, tx, audit.Entry{
+		Action:     auditCVRequestStatus,
+		TargetType: "cv_request",
+		TargetID:   id,
+		Before:     gin.H{"cv_id": cvID, "status": currentStatus},
+		After:      gin.H{"cv_id": cvID, "status": request.Status},
+	}) {
+		return
+	}
+
 	// Commit the transaction
 	err = tx.Commit(c)
 	if err != nil {
@@ -0,0 +1,441 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/vdt/cv-management/internal/audit"
+	"github.com/vdt/cv-management/internal/authz"
+	"github.com/vdt/cv-management/internal/database"
+	"github.com/vdt/cv-management/internal/models"
+)
+
+// GetPermissions returns every permission that can be granted to a role or an API key
+func GetPermissions(c *gin.Context) {
+	rows, err := database.DB.Query(c, "SELECT name, description FROM permissions ORDER BY name")
+	if err != nil {
+		fmt.Printf("GetPermissions error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error fetching permissions",
+		})
+		return
+	}
+	defer rows.Close()
+
+	permissions := []models.Permission{}
+	for rows.Next() {
+		var permission models.Permission
+		if err := rows.Scan(&permission.Name, &permission.Description); err != nil {
+			fmt.Printf("GetPermissions scan error: %v\n", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  "error",
+				"message": "Error parsing permission data",
+			})
+			return
+		}
+		permissions = append(permissions, permission)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   permissions,
+	})
+}
+
+// GetRolesWithPermissions returns all roles with their permission sets and member counts
+func GetRolesWithPermissions(c *gin.Context) {
+	fmt.Println("GetRolesWithPermissions: Fetching roles with permissions")
+
+	rows, err := database.DB.Query(c, `
+		SELECT r.id, r.name, r.is_system,
+		       COALESCE(array_agg(rp.permission ORDER BY rp.permission) FILTER (WHERE rp.permission IS NOT NULL), '{}'),
+		       (SELECT COUNT(*) FROM user_roles ur WHERE ur.role_id = r.id)
+		FROM roles r
+		LEFT JOIN role_permissions rp ON rp.role_id = r.id
+		GROUP BY r.id
+		ORDER BY r.name`)
+	if err != nil {
+		fmt.Printf("GetRolesWithPermissions error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error fetching roles",
+		})
+		return
+	}
+	defer rows.Close()
+
+	roles := []models.Role{}
+	for rows.Next() {
+		var role models.Role
+		if err := rows.Scan(&role.ID, &role.Name, &role.IsSystem, &role.Permissions, &role.UserCount); err != nil {
+			fmt.Printf("GetRolesWithPermissions scan error: %v\n", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  "error",
+				"message": "Error parsing role data",
+			})
+			return
+		}
+		roles = append(roles, role)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   roles,
+	})
+}
+
+// CreateRole creates a role with the given permission set
+func CreateRole(c *gin.Context) {
+	var request models.RoleRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid request data",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	request.Name = strings.TrimSpace(request.Name)
+	if !validateRolePermissions(c, request.Permissions) {
+		return
+	}
+
+	tx, err := database.DB.Begin(c)
+	if err != nil {
+		fmt.Printf("CreateRole error starting transaction: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error creating role",
+		})
+		return
+	}
+	defer tx.Rollback(c)
+
+	role := models.Role{Name: request.Name}
+	err = tx.QueryRow(c, "INSERT INTO roles (name) VALUES ($1) RETURNING id", request.Name).Scan(&role.ID)
+	if err != nil {
+		if isUniqueViolation(err) {
+			c.JSON(http.StatusConflict, gin.H{
+				"status":  "error",
+				"message": "A role with this name already exists",
+			})
+			return
+		}
+		fmt.Printf("CreateRole error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error creating role",
+		})
+		return
+	}
+
+	if err := setRolePermissions(c, tx, role.ID, request.Permissions); err != nil {
+		fmt.Printf("CreateRole error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error saving role permissions",
+		})
+		return
+	}
+
+	after, ok := auditSnapshot(c, func() (json.RawMessage, error) { return audit.RoleSnapshot(c, tx, role.ID) })
+	if !ok {
+		return
+	}
+	if !recordAudit(c, tx, audit.Entry{Action: auditRoleCreate, TargetType: "role", TargetID: role.ID, After: after}) {
+		return
+	}
+
+	if err := tx.Commit(c); err != nil {
+		fmt.Printf("CreateRole error committing transaction: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error creating role",
+		})
+		return
+	}
+	authz.Invalidate()
+
+	role.Permissions = request.Permissions
+	fmt.Printf("CreateRole: Created role %s with permissions %v\n", role.Name, role.Permissions)
+	c.JSON(http.StatusCreated, gin.H{
+		"status": "success",
+		"data":   role,
+	})
+}
+
+// UpdateRole renames a role and replaces its permission set.
+// System roles are referenced by name in the code, so they can't be renamed,
+// and the Admin role always keeps roles:manage so nobody can lock themselves out.
+func UpdateRole(c *gin.Context) {
+	roleID := c.Param("id")
+
+	var request models.RoleRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid request data",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	request.Name = strings.TrimSpace(request.Name)
+	if !validateRolePermissions(c, request.Permissions) {
+		return
+	}
+
+	tx, err := database.DB.Begin(c)
+	if err != nil {
+		fmt.Printf("UpdateRole error starting transaction: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error updating role",
+		})
+		return
+	}
+	defer tx.Rollback(c)
+
+	var currentName string
+	var isSystem bool
+	err = tx.QueryRow(c, "SELECT name, is_system FROM roles WHERE id = $1 FOR UPDATE", roleID).Scan(&currentName, &isSystem)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"status":  "error",
+				"message": "Role not found",
+			})
+			return
+		}
+		fmt.Printf("UpdateRole error fetching role: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error updating role",
+		})
+		return
+	}
+
+	before, ok := auditSnapshot(c, func() (json.RawMessage, error) { return audit.RoleSnapshot(c, tx, roleID) })
+	if !ok {
+		return
+	}
+
+	if isSystem && request.Name != currentName {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "System roles cannot be renamed",
+		})
+		return
+	}
+
+	if currentName == "Admin" && !slices.Contains(request.Permissions, authz.RolesManage) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": fmt.Sprintf("The Admin role must keep the %s permission", authz.RolesManage),
+		})
+		return
+	}
+
+	if _, err := tx.Exec(c, "UPDATE roles SET name = $1 WHERE id = $2", request.Name, roleID); err != nil {
+		if isUniqueViolation(err) {
+			c.JSON(http.StatusConflict, gin.H{
+				"status":  "error",
+				"message": "A role with this name already exists",
+			})
+			return
+		}
+		fmt.Printf("UpdateRole error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error updating role",
+		})
+		return
+	}
+
+	if err := setRolePermissions(c, tx, roleID, request.Permissions); err != nil {
+		fmt.Printf("UpdateRole error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error saving role permissions",
+		})
+		return
+	}
+
+	after, ok := auditSnapshot(c, func() (json.RawMessage, error) { return audit.RoleSnapshot(c, tx, roleID) })
+	if !ok {
+		return
+	}
+	if !recordAudit(c, tx, audit.Entry{Action: auditRoleUpdate, TargetType: "role", TargetID: roleID, Before: before, After: after}) {
+		return
+	}
+
+	if err := tx.Commit(c); err != nil {
+		fmt.Printf("UpdateRole error committing transaction: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error updating role",
+		})
+		return
+	}
+	authz.Invalidate()
+
+	fmt.Printf("UpdateRole: Updated role %s with permissions %v\n", request.Name, request.Permissions)
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data": models.Role{
+			ID:          roleID,
+			Name:        request.Name,
+			IsSystem:    isSystem,
+			Permissions: request.Permissions,
+		},
+	})
+}
+
+// DeleteRole deletes a custom role that is no longer assigned to any user
+func DeleteRole(c *gin.Context) {
+	roleID := c.Param("id")
+
+	var isSystem bool
+	var userCount int
+	err := database.DB.QueryRow(c,
+		`SELECT r.is_system, (SELECT COUNT(*) FROM user_roles ur WHERE ur.role_id = r.id)
+		FROM roles r WHERE r.id = $1`,
+		roleID).Scan(&isSystem, &userCount)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"status":  "error",
+				"message": "Role not found",
+			})
+			return
+		}
+		fmt.Printf("DeleteRole error fetching role: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error deleting role",
+		})
+		return
+	}
+
+	if isSystem {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "System roles cannot be deleted",
+		})
+		return
+	}
+
+	if userCount > 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"status":  "error",
+			"message": fmt.Sprintf("Role is still assigned to %d users", userCount),
+		})
+		return
+	}
+
+	before, ok := auditSnapshot(c, func() (json.RawMessage, error) { return audit.RoleSnapshot(c, database.DB, roleID) })
+	if !ok {
+		return
+	}
+
+	tx, err := database.DB.Begin(c)
+	if err != nil {
+		fmt.Printf("DeleteRole error starting transaction: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error deleting role",
+		})
+		return
+	}
+	defer tx.Rollback(c)
+
+	if _, err := tx.Exec(c, "DELETE FROM roles WHERE id = $1", roleID); err != nil {
+		fmt.Printf("DeleteRole error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error deleting role",
+		})
+		return
+	}
+	if !recordAudit(c, tx, audit.Entry{Action: auditRoleDelete, TargetType: "role", TargetID: roleID, Before: before}) {
+		return
+	}
+
+	if err := tx.Commit(c); err != nil {
+		fmt.Printf("DeleteRole error committing transaction: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error deleting role",
+		})
+		return
+	}
+	authz.Invalidate()
+
+	fmt.Printf("DeleteRole: Deleted role %s\n", roleID)
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Role deleted successfully",
+	})
+}
+
+// validateRolePermissions writes a 400 response and returns false if a permission doesn't exist
+func validateRolePermissions(c *gin.Context, permissions []string) bool {
+	for _, permission := range permissions {
+		valid, err := authz.IsValidPermission(c, permission)
+		if err != nil {
+			fmt.Printf("validateRolePermissions: %v\n", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  "error",
+				"message": "Error validating permissions",
+			})
+			return false
+		}
+		if !valid {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "error",
+				"message": fmt.Sprintf("Invalid permission: %s", permission),
+			})
+			return false
+		}
+	}
+	return true
+}
+
+// setRolePermissions replaces the permission set of a role
+func setRolePermissions(ctx context.Context, tx pgx.Tx, roleID string, permissions []string) error {
+	if _, err := tx.Exec(ctx, "DELETE FROM role_permissions WHERE role_id = $1", roleID); err != nil {
+		return fmt.Errorf("error clearing role permissions: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx,
+		`INSERT INTO role_permissions (role_id, permission)
+		SELECT $1, unnest($2::text[])
+		ON CONFLICT DO NOTHING`,
+		roleID, permissions); err != nil {
+		return fmt.Errorf("error inserting role permissions: %w", err)
+	}
+
+	return nil
+}
+
+// isUniqueViolation checks if the error is a PostgreSQL unique constraint violation
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+// isForeignKeyViolation checks if the error is a PostgreSQL foreign key constraint violation
+func isForeignKeyViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23503"
+}
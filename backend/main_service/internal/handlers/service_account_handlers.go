@@ -0,0 +1,497 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/vdt/cv-management/internal/audit"
+	"github.com/vdt/cv-management/internal/authz"
+	"github.com/vdt/cv-management/internal/database"
+	"github.com/vdt/cv-management/internal/models"
+	"github.com/vdt/cv-management/internal/utils"
+)
+
+const apiKeyColumns = `id, service_account_id, name, key_prefix, scopes, COALESCE(allowed_ips, '{}'),
+	expires_at, last_used_at, last_used_ip, revoked_at, created_by, created_at`
+
+// scanAPIKey scans a row selected with apiKeyColumns
+func scanAPIKey(row pgx.Row, key *models.APIKey) error {
+	return row.Scan(&key.ID, &key.ServiceAccountID, &key.Name, &key.KeyPrefix, &key.Scopes, &key.AllowedIPs,
+		&key.ExpiresAt, &key.LastUsedAt, &key.LastUsedIP, &key.RevokedAt, &key.CreatedBy, &key.CreatedAt)
+}
+
+// GetServiceAccounts returns all service accounts with their API keys (Admin only)
+func GetServiceAccounts(c *gin.Context) {
+	fmt.Println("GetServiceAccounts: Fetching service accounts")
+
+	rows, err := database.DB.Query(c,
+		`SELECT id, name, description, owner_id, created_at, disabled_at
+		FROM service_accounts ORDER BY name`)
+	if err != nil {
+		fmt.Printf("GetServiceAccounts error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error fetching service accounts",
+		})
+		return
+	}
+
+	accounts := []models.ServiceAccount{}
+	accountIndex := map[string]int{}
+	for rows.Next() {
+		var account models.ServiceAccount
+		if err := rows.Scan(&account.ID, &account.Name, &account.Description, &account.OwnerID,
+			&account.CreatedAt, &account.DisabledAt); err != nil {
+			rows.Close()
+			fmt.Printf("GetServiceAccounts scan error: %v\n", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  "error",
+				"message": "Error parsing service account data",
+			})
+			return
+		}
+		accountIndex[account.ID] = len(accounts)
+		accounts = append(accounts, account)
+	}
+	rows.Close()
+
+	keyRows, err := database.DB.Query(c, "SELECT "+apiKeyColumns+" FROM api_keys ORDER BY created_at")
+	if err != nil {
+		fmt.Printf("GetServiceAccounts key query error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error fetching API keys",
+		})
+		return
+	}
+	defer keyRows.Close()
+
+	for keyRows.Next() {
+		var key models.APIKey
+		if err := scanAPIKey(keyRows, &key); err != nil {
+			fmt.Printf("GetServiceAccounts key scan error: %v\n", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  "error",
+				"message": "Error parsing API key data",
+			})
+			return
+		}
+		if i, ok := accountIndex[key.ServiceAccountID]; ok {
+			accounts[i].Keys = append(accounts[i].Keys, key)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   accounts,
+	})
+}
+
+// CreateServiceAccount creates a service account owned by the calling Admin (Admin only)
+func CreateServiceAccount(c *gin.Context) {
+	ownerID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"status":  "error",
+			"message": "Unauthorized - user ID not found",
+		})
+		return
+	}
+
+	var request models.ServiceAccountCreateRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid request data",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	var description *string
+	if request.Description != "" {
+		description = &request.Description
+	}
+
+	account := models.ServiceAccount{
+		Name:        strings.TrimSpace(request.Name),
+		Description: description,
+	}
+
+	tx, err := database.DB.Begin(c)
+	if err != nil {
+		fmt.Printf("CreateServiceAccount error starting transaction: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error creating service account",
+		})
+		return
+	}
+	defer tx.Rollback(c)
+
+	err = tx.QueryRow(c,
+		`INSERT INTO service_accounts (name, description, owner_id)
+		VALUES ($1, $2, $3)
+		RETURNING id, owner_id, created_at`,
+		account.Name, account.Description, ownerID).Scan(&account.ID, &account.OwnerID, &account.CreatedAt)
+	if err != nil {
+		if isUniqueViolation(err) {
+			c.JSON(http.StatusConflict, gin.H{
+				"status":  "error",
+				"message": "A service account with this name already exists",
+			})
+			return
+		}
+		fmt.Printf("CreateServiceAccount error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error creating service account",
+		})
+		return
+	}
+
+	if !recordAudit(c, tx, audit.Entry{Action: auditServiceAccountAdd, TargetType: "service_account", TargetID: account.ID, After: account}) {
+		return
+	}
+
+	if err := tx.Commit(c); err != nil {
+		fmt.Printf("CreateServiceAccount error committing transaction: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error creating service account",
+		})
+		return
+	}
+
+	fmt.Printf("CreateServiceAccount: Created service account %s (%s)\n", account.Name, account.ID)
+	c.JSON(http.StatusCreated, gin.H{
+		"status": "success",
+		"data":   account,
+	})
+}
+
+// DisableServiceAccount disables a service account, which invalidates all of its keys (Admin only)
+func DisableServiceAccount(c *gin.Context) {
+	accountID := c.Param("id")
+
+	tx, err := database.DB.Begin(c)
+	if err != nil {
+		fmt.Printf("DisableServiceAccount error starting transaction: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error disabling service account",
+		})
+		return
+	}
+	defer tx.Rollback(c)
+
+	tag, err := tx.Exec(c,
+		"UPDATE service_accounts SET disabled_at = COALESCE(disabled_at, NOW()) WHERE id = $1",
+		accountID)
+	if err != nil {
+		fmt.Printf("DisableServiceAccount error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error disabling service account",
+		})
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "Service account not found",
+		})
+		return
+	}
+
+	if !recordAudit(c, tx, audit.Entry{Action: auditServiceAccountOff, TargetType: "service_account", TargetID: accountID}) {
+		return
+	}
+
+	if err := tx.Commit(c); err != nil {
+		fmt.Printf("DisableServiceAccount error committing transaction: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error disabling service account",
+		})
+		return
+	}
+
+	fmt.Printf("DisableServiceAccount: Disabled service account %s\n", accountID)
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Service account disabled",
+	})
+}
+
+// CreateAPIKey issues a new API key for a service account; the key is only returned in this response (Admin only).
+// The scopes must be permissions the caller has.
+func CreateAPIKey(c *gin.Context) {
+	accountID := c.Param("id")
+
+	createdBy, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"status":  "error",
+			"message": "Unauthorized - user ID not found",
+		})
+		return
+	}
+
+	var request models.APIKeyCreateRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid request data",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	// Scopes are permission names, checked exactly like the permissions of a role
+	for _, scope := range request.Scopes {
+		valid, err := authz.IsValidPermission(c, scope)
+		if err != nil {
+			fmt.Printf("CreateAPIKey: %v\n", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  "error",
+				"message": "Error validating scopes",
+			})
+			return
+		}
+		if !valid {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "error",
+				"message": fmt.Sprintf("Invalid scope: %s", scope),
+			})
+			return
+		}
+
+		// A key can't do more than the caller, otherwise service_accounts:manage would grant every permission
+		held, err := authz.HasPermission(c, scope)
+		if err != nil {
+			fmt.Printf("CreateAPIKey: %v\n", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  "error",
+				"message": "Error validating scopes",
+			})
+			return
+		}
+		if !held {
+			c.JSON(http.StatusForbidden, gin.H{
+				"status":  "error",
+				"message": fmt.Sprintf("You cannot grant the scope %s, which you do not have", scope),
+			})
+			return
+		}
+	}
+
+	if err := utils.ValidateIPAllowList(request.AllowedIPs); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	var expiresAt *time.Time
+	if request.ExpiresAt != "" {
+		parsed, err := time.Parse(time.RFC3339, request.ExpiresAt)
+		if err != nil || !parsed.After(time.Now()) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "error",
+				"message": "expires_at must be a future RFC3339 timestamp",
+			})
+			return
+		}
+		expiresAt = &parsed
+	}
+
+	var disabledAt *time.Time
+	err := database.DB.QueryRow(c, "SELECT disabled_at FROM service_accounts WHERE id = $1", accountID).Scan(&disabledAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"status":  "error",
+				"message": "Service account not found",
+			})
+			return
+		}
+		fmt.Printf("CreateAPIKey: Error fetching service account %s: %v\n", accountID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error fetching service account",
+		})
+		return
+	}
+	if disabledAt != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Service account is disabled",
+		})
+		return
+	}
+
+	key, prefix, hash, err := utils.GenerateAPIKey()
+	if err != nil {
+		fmt.Printf("CreateAPIKey: Error generating key: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error generating API key",
+		})
+		return
+	}
+
+	tx, err := database.DB.Begin(c)
+	if err != nil {
+		fmt.Printf("CreateAPIKey error starting transaction: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error creating API key",
+		})
+		return
+	}
+	defer tx.Rollback(c)
+
+	var response models.APIKeyCreateResponse
+	err = scanAPIKey(tx.QueryRow(c,
+		`INSERT INTO api_keys (service_account_id, name, key_prefix, key_hash, scopes, allowed_ips, expires_at, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING `+apiKeyColumns,
+		accountID, request.Name, prefix, hash, request.Scopes, request.AllowedIPs, expiresAt, createdBy),
+		&response.APIKey)
+	if err != nil {
+		fmt.Printf("CreateAPIKey: Error storing key: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error creating API key",
+		})
+		return
+	}
+	response.Key = key
+
+	// The key itself is never logged, only its prefix and settings
+	if !recordAudit(c, tx, audit.Entry{Action: auditAPIKeyCreate, TargetType: "api_key", TargetID: response.ID, After: response.APIKey}) {
+		return
+	}
+
+	if err := tx.Commit(c); err != nil {
+		fmt.Printf("CreateAPIKey error committing transaction: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error creating API key",
+		})
+		return
+	}
+
+	fmt.Printf("CreateAPIKey: Issued key %s for service account %s with scopes %v\n", prefix, accountID, request.Scopes)
+	c.JSON(http.StatusCreated, gin.H{
+		"status":  "success",
+		"message": "Store this key now, it will not be shown again",
+		"data":    response,
+	})
+}
+
+// RevokeAPIKey revokes an API key of a service account (Admin only)
+func RevokeAPIKey(c *gin.Context) {
+	accountID := c.Param("id")
+	keyID := c.Param("key_id")
+
+	tx, err := database.DB.Begin(c)
+	if err != nil {
+		fmt.Printf("RevokeAPIKey error starting transaction: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error revoking API key",
+		})
+		return
+	}
+	defer tx.Rollback(c)
+
+	tag, err := tx.Exec(c,
+		`UPDATE api_keys SET revoked_at = COALESCE(revoked_at, NOW())
+		WHERE id = $1 AND service_account_id = $2`,
+		keyID, accountID)
+	if err != nil {
+		fmt.Printf("RevokeAPIKey error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error revoking API key",
+		})
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "API key not found",
+		})
+		return
+	}
+
+	if !recordAudit(c, tx, audit.Entry{Action: auditAPIKeyRevoke, TargetType: "api_key", TargetID: keyID}) {
+		return
+	}
+
+	if err := tx.Commit(c); err != nil {
+		fmt.Printf("RevokeAPIKey error committing transaction: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error revoking API key",
+		})
+		return
+	}
+
+	fmt.Printf("RevokeAPIKey: Revoked key %s of service account %s\n", keyID, accountID)
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "API key revoked",
+	})
+}
+
+// GetAPIKeyUsage returns the most recent recorded uses of an API key (Admin only)
+func GetAPIKeyUsage(c *gin.Context) {
+	accountID := c.Param("id")
+	keyID := c.Param("key_id")
+
+	rows, err := database.DB.Query(c,
+		`SELECT u.used_at, u.ip, u.method, u.path, u.status_code
+		FROM api_key_usage u
+		JOIN api_keys k ON k.id = u.api_key_id
+		WHERE u.api_key_id = $1 AND k.service_account_id = $2
+		ORDER BY u.used_at DESC
+		LIMIT 200`,
+		keyID, accountID)
+	if err != nil {
+		fmt.Printf("GetAPIKeyUsage error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error fetching API key usage",
+		})
+		return
+	}
+	defer rows.Close()
+
+	usage := []models.APIKeyUsage{}
+	for rows.Next() {
+		var entry models.APIKeyUsage
+		if err := rows.Scan(&entry.UsedAt, &entry.IP, &entry.Method, &entry.Path, &entry.StatusCode); err != nil {
+			fmt.Printf("GetAPIKeyUsage scan error: %v\n", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  "error",
+				"message": "Error parsing API key usage",
+			})
+			return
+		}
+		usage = append(usage, entry)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   usage,
+	})
+}
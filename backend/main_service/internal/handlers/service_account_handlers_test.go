@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vdt/cv-management/internal/database"
+	"github.com/vdt/cv-management/internal/database/dbtest"
+)
+
+func TestCreateAPIKeyScopes(t *testing.T) {
+	dbtest.Setup(t)
+	ctx := context.Background()
+
+	// A support role that manages service accounts but only reads CVs otherwise
+	var callerID, accountID string
+	err := database.DB.QueryRow(ctx,
+		"INSERT INTO users (employee_code, full_name, email, password) VALUES ('SUP001', 'Support', 'support@vdt.local', 'hash') RETURNING id").
+		Scan(&callerID)
+	if err == nil {
+		_, err = database.DB.Exec(ctx,
+			`WITH role AS (INSERT INTO roles (name) VALUES ('Support') RETURNING id)
+			INSERT INTO role_permissions (role_id, permission)
+			SELECT role.id, p FROM role, unnest(ARRAY['service_accounts:manage', 'cv:read']) AS p`)
+	}
+	if err == nil {
+		err = database.DB.QueryRow(ctx,
+			"INSERT INTO service_accounts (name, owner_id) VALUES ('hr-sync', $1) RETURNING id", callerID).
+			Scan(&accountID)
+	}
+	if err != nil {
+		t.Fatalf("creating fixtures: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/service-accounts/:id/keys", func(c *gin.Context) {
+		c.Set("userID", callerID)
+		c.Set("roles", []string{"Support"})
+	}, CreateAPIKey)
+
+	for _, test := range []struct {
+		scopes []string
+		want   int
+	}{
+		{[]string{"cv:read"}, http.StatusCreated},
+		{[]string{"cv:read", "roles:manage"}, http.StatusForbidden},
+		{[]string{"users:access_all"}, http.StatusForbidden},
+		{[]string{"no:such_scope"}, http.StatusBadRequest},
+	} {
+		body, _ := json.Marshal(gin.H{"name": "key", "scopes": test.scopes})
+		request := httptest.NewRequest(http.MethodPost, "/service-accounts/"+accountID+"/keys", strings.NewReader(string(body)))
+		request.Header.Set("Content-Type", "application/json")
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, request)
+
+		if response.Code != test.want {
+			t.Errorf("scopes %v: got status %d, want %d (%s)", test.scopes, response.Code, test.want, response.Body)
+		}
+	}
+
+	var keys int
+	if err := database.DB.QueryRow(ctx, "SELECT COUNT(*) FROM api_keys").Scan(&keys); err != nil {
+		t.Fatalf("counting keys: %v", err)
+	}
+	if keys != 1 {
+		t.Fatalf("got %d API keys, want only the one scoped cv:read", keys)
+	}
+}
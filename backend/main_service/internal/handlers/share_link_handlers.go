@@ -0,0 +1,457 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/vdt/cv-management/internal/audit"
+	"github.com/vdt/cv-management/internal/authz"
+	"github.com/vdt/cv-management/internal/database"
+	"github.com/vdt/cv-management/internal/models"
+	"github.com/vdt/cv-management/internal/utils"
+)
+
+// Lifetime of a share link when none is requested, and the longest one allowed
+const (
+	defaultShareLinkHours = 7 * 24
+	maxShareLinkHours     = 30 * 24
+)
+
+// anonymisedCandidateName replaces the name in anonymised snapshots, numbered by position in the link
+const anonymisedCandidateName = "Ứng viên %d"
+
+const shareLinkColumns = `l.id, l.profile, l.expires_at, l.revoked_at, l.view_count, l.last_viewed_at, l.created_by, l.created_at,
+	COALESCE((SELECT array_agg(s.user_id::text ORDER BY s.position) FROM share_link_cvs s WHERE s.share_link_id = l.id), '{}')`
+
+// scanShareLink scans a row selected with shareLinkColumns
+func scanShareLink(row pgx.Row, link *models.ShareLink) error {
+	return row.Scan(&link.ID, &link.Profile, &link.ExpiresAt, &link.RevokedAt, &link.ViewCount,
+		&link.LastViewedAt, &link.CreatedBy, &link.CreatedAt, &link.UserIDs)
+}
+
+// CreateShareLink snapshots the CVs of the given users and returns a token for reading them without an account.
+// Every user must be reachable by the caller. The "full" profile contains what the caller is allowed to see;
+// the "anonymised" profile also drops the name and every field hidden from external viewers.
+func CreateShareLink(c *gin.Context) {
+	callerID := c.GetString("userID")
+
+	var request models.ShareLinkCreateRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid request data",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	hours := request.ExpiresInHours
+	if hours == 0 {
+		hours = defaultShareLinkHours
+	}
+	if hours > maxShareLinkHours {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": fmt.Sprintf("expires_in_hours must be at most %d", maxShareLinkHours),
+		})
+		return
+	}
+
+	userIDs := []string{}
+	for _, userID := range request.UserIDs {
+		if !slices.Contains(userIDs, userID) {
+			userIDs = append(userIDs, userID)
+		}
+	}
+
+	snapshots := make([]models.SharedCV, 0, len(userIDs))
+	for i, userID := range userIDs {
+		allowed, err := authz.CanAccessUser(c, userID)
+		if err != nil {
+			fmt.Printf("CreateShareLink: Error checking access to user %s: %v\n", userID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  "error",
+				"message": "Error checking access",
+			})
+			return
+		}
+		if !allowed {
+			authz.RecordDenial(c, authz.ResourceUser, userID)
+			c.JSON(http.StatusForbidden, gin.H{
+				"status":  "error",
+				"message": fmt.Sprintf("Forbidden - you cannot share the CV of user %s", userID),
+			})
+			return
+		}
+
+		relationship := authz.RelationshipExternal
+		if request.Profile == models.ShareProfileFull {
+			relationship, err = authz.ViewerRelationship(c, userID)
+			if err != nil {
+				fmt.Printf("CreateShareLink: Error resolving relationship to user %s: %v\n", userID, err)
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"status":  "error",
+					"message": "Error checking access",
+				})
+				return
+			}
+		}
+
+		snapshot, err := loadSharedCV(c, userID, relationship)
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "error",
+				"message": fmt.Sprintf("User %s has no CV or is deactivated", userID),
+			})
+			return
+		}
+		if err != nil {
+			fmt.Printf("CreateShareLink: Error loading CV of user %s: %v\n", userID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  "error",
+				"message": "Error loading CV",
+			})
+			return
+		}
+		if request.Profile == models.ShareProfileAnonymised {
+			snapshot.FullName = fmt.Sprintf(anonymisedCandidateName, i+1)
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+
+	token, hash, err := utils.GenerateShareToken()
+	if err != nil {
+		fmt.Printf("CreateShareLink: Error generating token: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error generating share link",
+		})
+		return
+	}
+
+	tx, err := database.DB.Begin(c)
+	if err != nil {
+		fmt.Printf("CreateShareLink: Error starting transaction: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Database error",
+		})
+		return
+	}
+	defer tx.Rollback(c)
+
+	var linkID string
+	err = tx.QueryRow(c,
+		`INSERT INTO share_links (token_hash, profile, expires_at, created_by)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id`,
+		hash, request.Profile, time.Now().Add(time.Duration(hours)*time.Hour), callerID).Scan(&linkID)
+	if err != nil {
+		fmt.Printf("CreateShareLink: Error storing share link: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error creating share link",
+		})
+		return
+	}
+
+	for i, snapshot := range snapshots {
+		data, err := json.Marshal(snapshot)
+		if err == nil {
+			_, err = tx.Exec(c,
+				"INSERT INTO share_link_cvs (share_link_id, user_id, position, snapshot) VALUES ($1, $2, $3, $4)",
+				linkID, userIDs[i], i, data)
+		}
+		if err != nil {
+			fmt.Printf("CreateShareLink: Error storing snapshot of user %s: %v\n", userIDs[i], err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  "error",
+				"message": "Error creating share link",
+			})
+			return
+		}
+	}
+
+	var response models.ShareLinkCreateResponse
+	if err := scanShareLink(tx.QueryRow(c, "SELECT "+shareLinkColumns+" FROM share_links l WHERE l.id = $1", linkID), &response.ShareLink); err != nil {
+		fmt.Printf("CreateShareLink: Error fetching share link %s: %v\n", linkID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error creating share link",
+		})
+		return
+	}
+
+	// The token itself is never logged; the snapshots are, since they are what leaves the company
+	if !recordAudit(c, tx, audit.Entry{
+		Action:     auditShareLinkCreate,
+		TargetType: "share_link",
+		TargetID:   linkID,
+		After:      gin.H{"link": response.ShareLink, "snapshots": snapshots},
+	}) {
+		return
+	}
+
+	if err := tx.Commit(c); err != nil {
+		fmt.Printf("CreateShareLink: Error committing transaction: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error creating share link",
+		})
+		return
+	}
+
+	response.Token = token
+	response.Path = "/api/shared/" + token
+
+	fmt.Printf("CreateShareLink: User %s shared %d CVs (%s) until %s\n", callerID, len(userIDs), request.Profile, response.ExpiresAt.Format(time.RFC3339))
+	c.JSON(http.StatusCreated, gin.H{
+		"status":  "success",
+		"message": "Store this link now, it will not be shown again",
+		"data":    response,
+	})
+}
+
+// loadSharedCV loads the CV of an active user with the fields hidden from the relationship removed.
+// It returns pgx.ErrNoRows when the user has no CV or is deactivated.
+func loadSharedCV(c *gin.Context, userID string, relationship authz.Relationship) (models.SharedCV, error) {
+	var details models.CVDetail
+	err := database.DB.QueryRow(c,
+		`SELECT d.id, d.full_name, d.job_title, d.summary, d.birthday, d.gender, d.email, d.phone, d.address,
+		d.cvpath, d.portraitpath
+		FROM cv
+		JOIN cv_details d ON d.cv_id = cv.id
+		JOIN users u ON u.id = cv.user_id
+		WHERE cv.user_id = $1 AND u.deactivated_at IS NULL`, userID).Scan(
+		&details.ID, &details.FullName, &details.JobTitle, &details.Summary, &details.Birthday, &details.Gender,
+		&details.Email, &details.Phone, &details.Address, &details.CVPath, &details.PortraitPath)
+	if err != nil {
+		return models.SharedCV{}, err
+	}
+
+	education, courses, skills, err := loadCVRelatedData(c, details.ID)
+	if err != nil {
+		return models.SharedCV{}, err
+	}
+
+	maskCVDetail(&details, relationship)
+
+	return models.SharedCV{
+		FullName:     details.FullName,
+		JobTitle:     details.JobTitle,
+		Summary:      details.Summary,
+		Birthday:     details.Birthday,
+		Gender:       details.Gender,
+		Email:        details.Email,
+		Phone:        details.Phone,
+		Address:      details.Address,
+		PortraitPath: details.PortraitPath,
+		CVPath:       details.CVPath,
+		Education:    education,
+		Courses:      courses,
+		Skills:       skills,
+	}, nil
+}
+
+// GetShareLinks returns the share links created by the caller, or every link for users:access_all
+func GetShareLinks(c *gin.Context) {
+	seeAll, err := authz.HasPermission(c, authz.UsersAccessAll)
+	if err != nil {
+		fmt.Printf("GetShareLinks: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error checking permissions",
+		})
+		return
+	}
+
+	rows, err := database.DB.Query(c,
+		"SELECT "+shareLinkColumns+" FROM share_links l WHERE $1 OR l.created_by = $2 ORDER BY l.created_at DESC",
+		seeAll, c.GetString("userID"))
+	if err != nil {
+		fmt.Printf("GetShareLinks: Error querying share links: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error fetching share links",
+		})
+		return
+	}
+	defer rows.Close()
+
+	links := []models.ShareLink{}
+	for rows.Next() {
+		var link models.ShareLink
+		if err := scanShareLink(rows, &link); err != nil {
+			fmt.Printf("GetShareLinks: Error scanning share link: %v\n", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  "error",
+				"message": "Error fetching share links",
+			})
+			return
+		}
+		links = append(links, link)
+	}
+	if err := rows.Err(); err != nil {
+		fmt.Printf("GetShareLinks: Error iterating share links: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error fetching share links",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   links,
+	})
+}
+
+// RevokeShareLink cuts off a share link immediately. Only its creator or users:access_all can revoke it.
+func RevokeShareLink(c *gin.Context) {
+	linkID := c.Param("id")
+
+	revokeAny, err := authz.HasPermission(c, authz.UsersAccessAll)
+	if err != nil {
+		fmt.Printf("RevokeShareLink: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error checking permissions",
+		})
+		return
+	}
+
+	tx, err := database.DB.Begin(c)
+	if err != nil {
+		fmt.Printf("RevokeShareLink: Error starting transaction: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error revoking share link",
+		})
+		return
+	}
+	defer tx.Rollback(c)
+
+	tag, err := tx.Exec(c,
+		`UPDATE share_links SET revoked_at = COALESCE(revoked_at, NOW())
+		WHERE id::text = $1 AND ($2 OR created_by = $3)`,
+		linkID, revokeAny, c.GetString("userID"))
+	if err != nil {
+		fmt.Printf("RevokeShareLink error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error revoking share link",
+		})
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "Share link not found",
+		})
+		return
+	}
+
+	if !recordAudit(c, tx, audit.Entry{Action: auditShareLinkRevoke, TargetType: "share_link", TargetID: linkID}) {
+		return
+	}
+
+	if err := tx.Commit(c); err != nil {
+		fmt.Printf("RevokeShareLink: Error committing transaction: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error revoking share link",
+		})
+		return
+	}
+
+	fmt.Printf("RevokeShareLink: Revoked share link %s\n", linkID)
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Share link revoked",
+	})
+}
+
+// GetSharedCVs serves the CV snapshots of a share link without authentication and counts the view.
+// Unknown, expired and revoked tokens all get the same 404.
+func GetSharedCVs(c *gin.Context) {
+	token := c.Param("token")
+
+	// Revocation must take effect immediately, so nothing along the way may cache the response
+	c.Header("Cache-Control", "no-store")
+	c.Header("X-Robots-Tag", "noindex")
+
+	notFound := func() {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "Share link not found or no longer valid",
+		})
+	}
+
+	if !strings.HasPrefix(token, utils.ShareTokenPrefix) {
+		notFound()
+		return
+	}
+
+	var linkID, profile string
+	var expiresAt time.Time
+	err := database.DB.QueryRow(c,
+		`UPDATE share_links SET view_count = view_count + 1, last_viewed_at = NOW()
+		WHERE token_hash = $1 AND revoked_at IS NULL AND expires_at > NOW()
+		RETURNING id, profile, expires_at`,
+		utils.HashShareToken(token)).Scan(&linkID, &profile, &expiresAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		notFound()
+		return
+	}
+	if err != nil {
+		fmt.Printf("GetSharedCVs: Error looking up share link: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error fetching shared CVs",
+		})
+		return
+	}
+
+	rows, err := database.DB.Query(c,
+		"SELECT snapshot FROM share_link_cvs WHERE share_link_id = $1 ORDER BY position", linkID)
+	if err != nil {
+		fmt.Printf("GetSharedCVs: Error querying snapshots of share link %s: %v\n", linkID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error fetching shared CVs",
+		})
+		return
+	}
+	cvs, err := pgx.CollectRows(rows, pgx.RowTo[models.SharedCV])
+	if err != nil {
+		fmt.Printf("GetSharedCVs: Error reading snapshots of share link %s: %v\n", linkID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error fetching shared CVs",
+		})
+		return
+	}
+
+	// Snapshots keep the object keys; viewers only get URLs that expire shortly after the visit
+	for i := range cvs {
+		urls := presignFiles(c, cvs[i].CVPath, cvs[i].PortraitPath)
+		cvs[i].CVURL, cvs[i].PortraitURL = urls[0], urls[1]
+		cvs[i].CVPath, cvs[i].PortraitPath = nil, nil
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data": gin.H{
+			"profile":    profile,
+			"expires_at": expiresAt,
+			"cvs":        cvs,
+		},
+	})
+}
@@ -0,0 +1,330 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/vdt/cv-management/internal/audit"
+	"github.com/vdt/cv-management/internal/database"
+	"github.com/vdt/cv-management/internal/models"
+	"github.com/vdt/cv-management/internal/storage"
+)
+
+// Defaults of the upload garbage collector
+const (
+	defaultUploadGCGrace    = 24 * time.Hour
+	defaultUploadGCInterval = 6 * time.Hour
+)
+
+// uploadGCBatch bounds how many uploads one run considers
+const uploadGCBatch = 1000
+
+// defaultUploadQuota is how many bytes of files one user may keep in storage when UPLOAD_QUOTA_BYTES is not set
+const defaultUploadQuota = 200 << 20
+
+// errUploadQuotaExceeded is returned by recordUpload when the upload would take its owner over the quota
+var errUploadQuotaExceeded = errors.New("upload quota exceeded")
+
+// uploadQuota returns the per-user quota from UPLOAD_QUOTA_BYTES; 0 disables it
+func uploadQuota() int64 {
+	value := os.Getenv("UPLOAD_QUOTA_BYTES")
+	if value == "" {
+		return defaultUploadQuota
+	}
+	quota, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || quota < 0 {
+		log.Printf("Invalid UPLOAD_QUOTA_BYTES %q, using %d", value, int64(defaultUploadQuota))
+		return defaultUploadQuota
+	}
+	return quota
+}
+
+// uploadObject is one stored object of an uploaded asset
+type uploadObject struct {
+	Key         string
+	ContentType string
+	Size        int64
+}
+
+// recordUpload tracks the objects of a new asset in the uploads table as pending until a CV references
+// the asset key. Every object of the owner not yet deleted from storage counts against the quota,
+// including superseded files waiting for the garbage collector.
+func recordUpload(ctx context.Context, ownerID, assetKey string, objects ...uploadObject) error {
+	tx, err := database.DB.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if quota := uploadQuota(); quota > 0 {
+		// Serialises the uploads of one owner, so concurrent requests can't both pass the check
+		if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock(hashtext('uploads:' || $1))", ownerID); err != nil {
+			return fmt.Errorf("error locking uploads of %s: %w", ownerID, err)
+		}
+
+		var used int64
+		err := tx.QueryRow(ctx,
+			"SELECT COALESCE(SUM(size), 0) FROM uploads WHERE owner_id = $1 AND status <> 'deleted'",
+			ownerID).Scan(&used)
+		if err != nil {
+			return fmt.Errorf("error computing storage used by %s: %w", ownerID, err)
+		}
+		for _, object := range objects {
+			used += object.Size
+		}
+		if used > quota {
+			return errUploadQuotaExceeded
+		}
+	}
+
+	for _, object := range objects {
+		_, err = tx.Exec(ctx,
+			"INSERT INTO uploads (key, asset_key, owner_id, content_type, size) VALUES ($1, $2, $3, $4, $5)",
+			object.Key, assetKey, ownerID, object.ContentType, object.Size)
+		if err != nil {
+			return fmt.Errorf("error recording upload %s: %w", object.Key, err)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	return nil
+}
+
+// syncUploadReferences marks the files referenced by the user's CV as attached to it and the files
+// it no longer references as superseded. A reference covers every rendition of the asset. Call it in every transaction that changes cvpath or portraitpath.
+func syncUploadReferences(ctx context.Context, tx pgx.Tx, userID string) error {
+	_, err := tx.Exec(ctx,
+		`UPDATE uploads u
+		SET status = 'attached', attached_user_id = $1, attached_at = COALESCE(u.attached_at, NOW()), released_at = NULL
+		FROM cv JOIN cv_details d ON d.cv_id = cv.id
+		WHERE cv.user_id = $1 AND u.asset_key IN (d.cvpath, d.portraitpath) AND u.status <> 'deleted'`,
+		userID)
+	if err != nil {
+		return fmt.Errorf("error attaching uploads of user %s: %w", userID, err)
+	}
+
+	_, err = tx.Exec(ctx,
+		`UPDATE uploads u
+		SET status = 'superseded', released_at = NOW()
+		WHERE u.attached_user_id = $1 AND u.status = 'attached'
+		  AND NOT EXISTS (
+			SELECT 1 FROM cv JOIN cv_details d ON d.cv_id = cv.id
+			WHERE cv.user_id = $1 AND u.asset_key IN (d.cvpath, d.portraitpath)
+		  )`,
+		userID)
+	if err != nil {
+		return fmt.Errorf("error releasing uploads of user %s: %w", userID, err)
+	}
+	return nil
+}
+
+// withRenditions adds the other stored objects of the referenced assets, e.g. every size of a photo
+func withRenditions(ctx context.Context, tx pgx.Tx, refs []string) ([]string, error) {
+	rows, err := tx.Query(ctx,
+		"SELECT key FROM uploads WHERE asset_key = ANY($1) AND key <> ALL($1) AND status <> 'deleted' ORDER BY key",
+		refs)
+	if err != nil {
+		return nil, fmt.Errorf("error finding renditions: %w", err)
+	}
+	renditions, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("error finding renditions: %w", err)
+	}
+	return append(refs, renditions...), nil
+}
+
+// StartUploadGC starts the job that deletes uploads never attached to a CV or superseded longer than
+// UPLOAD_GC_GRACE ago (default 24h), every UPLOAD_GC_INTERVAL (default 6h). A zero grace disables it;
+// UPLOAD_GC_DRY_RUN=true only logs what would be deleted.
+func StartUploadGC() {
+	grace := parseDurationEnv("UPLOAD_GC_GRACE", defaultUploadGCGrace)
+	interval := parseDurationEnv("UPLOAD_GC_INTERVAL", defaultUploadGCInterval)
+	dryRun, _ := strconv.ParseBool(os.Getenv("UPLOAD_GC_DRY_RUN"))
+
+	if grace <= 0 || interval <= 0 {
+		log.Printf("Upload garbage collection disabled")
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			report, err := CollectUploadGarbage(context.Background(), audit.SystemActor("upload_gc"), grace, dryRun)
+			if err != nil {
+				log.Printf("Upload garbage collection failed: %v", err)
+			} else if dryRun && len(report.Items) > 0 {
+				log.Printf("Upload garbage collection (dry run): %d orphaned uploads", len(report.Items))
+			} else if report.Deleted > 0 {
+				log.Printf("Upload garbage collection finished: %d objects deleted, %d bytes freed", report.Deleted, report.FreedBytes)
+			}
+			<-ticker.C
+		}
+	}()
+
+	log.Printf("Scheduled upload garbage collection every %s with a grace period of %s (dry run: %t)", interval, grace, dryRun)
+}
+
+func parseDurationEnv(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Invalid %s %q, using %s: %v", name, value, fallback, err)
+		return fallback
+	}
+	return parsed
+}
+
+// CollectUploadGarbage deletes orphaned uploads from storage. Uploads still shown by an active share link
+// are kept until the link ends. With dryRun it only reports what would be deleted.
+func CollectUploadGarbage(ctx context.Context, actor audit.Actor, grace time.Duration, dryRun bool) (models.UploadGCReport, error) {
+	report := models.UploadGCReport{DryRun: dryRun, Grace: grace.String(), Items: []models.UploadGCItem{}}
+
+	rows, err := database.DB.Query(ctx,
+		`SELECT key, status, size FROM uploads
+		WHERE (status = 'pending' AND created_at < $1) OR (status = 'superseded' AND released_at < $1)
+		ORDER BY created_at
+		LIMIT $2`,
+		time.Now().Add(-grace), uploadGCBatch)
+	if err != nil {
+		return report, fmt.Errorf("error finding orphaned uploads: %w", err)
+	}
+	candidates, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.UploadGCItem, error) {
+		var item models.UploadGCItem
+		err := row.Scan(&item.Key, &item.Status, &item.Size)
+		return item, err
+	})
+	if err != nil {
+		return report, fmt.Errorf("error finding orphaned uploads: %w", err)
+	}
+
+	var deletedKeys []string
+	for _, item := range candidates {
+		item.Action, err = collectUpload(ctx, item, dryRun)
+		if err != nil {
+			item.Action = "error"
+			item.Error = err.Error()
+			log.Printf("Upload garbage collection: error deleting %s: %v", item.Key, err)
+		}
+		if item.Action == "deleted" {
+			report.Deleted++
+			report.FreedBytes += item.Size
+			deletedKeys = append(deletedKeys, item.Key)
+		}
+		report.Items = append(report.Items, item)
+	}
+
+	if len(deletedKeys) > 0 {
+		err := audit.RecordWithActor(ctx, actor, audit.Entry{
+			Action:     auditUploadGC,
+			TargetType: "upload",
+			After:      gin.H{"deleted_keys": deletedKeys, "freed_bytes": report.FreedBytes},
+		})
+		if err != nil {
+			log.Printf("Upload garbage collection: error recording audit log: %v", err)
+		}
+	}
+
+	return report, nil
+}
+
+// collectUpload deletes one orphaned upload while holding its row, so a CV can't attach it meanwhile.
+// It returns the action taken: deleted, would_delete or referenced.
+func collectUpload(ctx context.Context, item models.UploadGCItem, dryRun bool) (string, error) {
+	tx, err := database.DB.Begin(ctx)
+	if err != nil {
+		return "", fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var referenced bool
+	err = tx.QueryRow(ctx,
+		`SELECT EXISTS (SELECT 1 FROM cv_details d WHERE u.asset_key IN (d.cvpath, d.portraitpath))
+			OR EXISTS (
+				SELECT 1 FROM share_link_cvs s JOIN share_links l ON l.id = s.share_link_id
+				WHERE l.revoked_at IS NULL AND l.expires_at > NOW()
+				  AND u.asset_key IN (s.snapshot->>'cv_path', s.snapshot->>'portrait_path')
+			)
+		FROM uploads u
+		WHERE u.key = $1 AND u.status = $2
+		FOR UPDATE OF u`,
+		item.Key, item.Status).Scan(&referenced)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Attached or collected since the query
+		return "referenced", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("error checking references: %w", err)
+	}
+	if referenced {
+		return "referenced", nil
+	}
+	if dryRun {
+		return "would_delete", nil
+	}
+
+	if err := storage.Store.Delete(ctx, item.Key); err != nil {
+		return "", err
+	}
+	if _, err := tx.Exec(ctx, "UPDATE uploads SET status = 'deleted', deleted_at = NOW() WHERE key = $1", item.Key); err != nil {
+		return "", fmt.Errorf("error marking upload deleted: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return "", fmt.Errorf("error committing transaction: %w", err)
+	}
+	return "deleted", nil
+}
+
+// GetUploadGCReport lists the orphaned uploads the garbage collector would delete now (dry run)
+func GetUploadGCReport(c *gin.Context) {
+	runUploadGC(c, true)
+}
+
+// RunUploadGC runs the upload garbage collector now. ?dry_run=true only reports.
+func RunUploadGC(c *gin.Context) {
+	dryRun, _ := strconv.ParseBool(c.Query("dry_run"))
+	runUploadGC(c, dryRun)
+}
+
+func runUploadGC(c *gin.Context, dryRun bool) {
+	grace := parseDurationEnv("UPLOAD_GC_GRACE", defaultUploadGCGrace)
+	if value := c.Query("grace"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed < time.Hour {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "error",
+				"message": "grace must be a duration of at least 1h, e.g. 48h",
+			})
+			return
+		}
+		grace = parsed
+	}
+
+	report, err := CollectUploadGarbage(c, audit.ActorFromContext(c), grace, dryRun)
+	if err != nil {
+		fmt.Printf("RunUploadGC: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Error collecting orphaned uploads",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   report,
+	})
+}
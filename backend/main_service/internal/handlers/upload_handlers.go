@@ -1,25 +1,64 @@
 package handlers
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/vdt/cv-management/internal/audit"
+	"github.com/vdt/cv-management/internal/scanner"
+	"github.com/vdt/cv-management/internal/storage"
 	"github.com/vdt/cv-management/internal/utils"
 )
 
-// UploadImageResponse represents the response structure for CV photo upload
+// UploadImageResponse represents the response structure for CV photo upload.
+// Key is what the CV stores (the print JPEG); URL is a short-lived presigned URL for previewing the upload.
+// Renditions lists every size and format stored for the photo, including the one Key points to.
 type UploadImageResponse struct {
-	URL          string `json:"url"`
-	OriginalName string `json:"original_name"`
-	Size         int64  `json:"size"`
-	Width        int    `json:"width"`
-	Height       int    `json:"height"`
-	AspectRatio  string `json:"aspect_ratio"`
+	Key          string           `json:"key"`
+	URL          string           `json:"url"`
+	OriginalName string           `json:"original_name"`
+	Size         int64            `json:"size"`
+	Width        int              `json:"width"`
+	Height       int              `json:"height"`
+	AspectRatio  string           `json:"aspect_ratio"`
+	Renditions   []ImageRendition `json:"renditions"`
+}
+
+// ImageRendition is one stored size and format of an uploaded photo
+type ImageRendition struct {
+	Name   string `json:"name"`
+	Format string `json:"format"`
+	Key    string `json:"key"`
+	URL    string `json:"url"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Size   int64  `json:"size"`
+}
+
+// cvPhotoOptions renders CV photos in 3:4 for lists (thumbnail), profile cards (card) and exports (print)
+var cvPhotoOptions = &utils.ImageProcessingOptions{
+	AspectRatio: utils.AspectRatio3x4,
+	Sizes: []utils.RenditionSize{
+		{Name: "thumbnail", MaxWidth: 150, MaxHeight: 200},
+		{Name: "card", MaxWidth: 300, MaxHeight: 400},
+		{Name: "print", MaxWidth: 600, MaxHeight: 800},
+	},
+	Quality: 90, // High quality for professional photos
 }
 
-// UploadPDFResponse represents the response structure for PDF upload
+// cvPhotoPrimary is the rendition CVs reference; the others are found through it
+const (
+	cvPhotoPrimarySize   = "print"
+	cvPhotoPrimaryFormat = utils.ImageFormatJPEG
+)
+
+// UploadPDFResponse represents the response structure for CV document upload
 type UploadPDFResponse struct {
+	Key          string `json:"key"`
 	URL          string `json:"url"`
 	OriginalName string `json:"original_name"`
 	Size         int64  `json:"size"`
@@ -28,28 +67,15 @@ type UploadPDFResponse struct {
 
 // UploadCVPhoto handles CV profile photo upload with predefined settings
 func UploadCVPhoto(c *gin.Context) {
-	// Parse multipart form
-	err := c.Request.ParseMultipartForm(10 << 20) // 10MB max memory
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"status":  "error",
-			"message": "Failed to parse multipart form",
-		})
-		return
-	}
-
-	// Get the uploaded file
-	fileHeader, err := c.FormFile("image")
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"status":  "error",
-			"message": "No image file provided. Use 'image' field name.",
-		})
+	// Stream the upload to a temporary file
+	file, ok := receiveUpload(c, "image", utils.MaxImageSize)
+	if !ok {
 		return
 	}
+	defer file.Close()
 
-	// Validate the image file
-	if err := utils.ValidateImageFile(fileHeader); err != nil {
+	// Validate the image content
+	if err := utils.ValidateImageFile(file); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"status":  "error",
 			"message": fmt.Sprintf("Invalid image file: %v", err),
@@ -57,65 +83,91 @@ func UploadCVPhoto(c *gin.Context) {
 		return
 	}
 
-	// Use predefined settings for CV photos
-	options := &utils.ImageProcessingOptions{
-		AspectRatio: utils.AspectRatio3x4, // CV photos use 3:4 ratio
-		MaxWidth:    600,                  // Suitable for CV display
-		MaxHeight:   800,                  // 600 * 4/3 = 800
-		Quality:     90,                   // High quality for professional photos
+	if !scanUpload(c, file) {
+		return
 	}
 
-	// Get original image dimensions
-	originalWidth, originalHeight, err := utils.GetImageDimensions(fileHeader)
+	// Render every size in JPEG and WebP, without the upload's metadata
+	reader, err := file.Reader()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"status":  "error",
-			"message": "Failed to get image dimensions",
+			"message": "Failed to read uploaded file",
 		})
 		return
 	}
-
-	// Process the image
-	processedImageData, err := utils.ProcessImage(fileHeader, options)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
+	renditions, err := utils.ProcessImage(reader, cvPhotoOptions)
+	if errors.Is(err, utils.ErrImageTooLarge) {
+		c.JSON(http.StatusBadRequest, gin.H{
 			"status":  "error",
-			"message": fmt.Sprintf("Failed to process image: %v", err),
+			"message": fmt.Sprintf("Invalid image file: %v", err),
 		})
 		return
 	}
-
-	// Create Digital Ocean Spaces client
-	spacesClient, err := utils.NewSpacesClient()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"status":  "error",
-			"message": "Failed to initialize storage client",
+			"message": fmt.Sprintf("Failed to process image: %v", err),
 		})
 		return
 	}
 
-	// Upload processed image to Digital Ocean Spaces in cv-photos folder
-	imageURL, err := spacesClient.UploadFile(fileHeader, processedImageData, "cv-photos")
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"status":  "error",
-			"message": fmt.Sprintf("Failed to upload image: %v", err),
-		})
+	// All renditions live under one asset prefix in the cv-photos folder and are tracked under the primary key
+	assetPrefix := storage.NewAssetPrefix(storage.FolderCVPhotos)
+	imageKey := storage.RenditionKey(assetPrefix, cvPhotoPrimarySize, "image/"+cvPhotoPrimaryFormat)
+	objects := make([]uploadObject, len(renditions))
+	for i, rendition := range renditions {
+		objects[i] = uploadObject{
+			Key:         storage.RenditionKey(assetPrefix, rendition.Name, rendition.ContentType),
+			ContentType: rendition.ContentType,
+			Size:        int64(len(rendition.Data)),
+		}
+	}
+	if !reserveUpload(c, imageKey, objects...) {
 		return
 	}
 
-	// Calculate final dimensions
-	finalWidth, finalHeight := calculateFinalDimensions(originalWidth, originalHeight, options)
-
-	// Return success response
 	response := UploadImageResponse{
-		URL:          imageURL,
-		OriginalName: fileHeader.Filename,
-		Size:         int64(len(processedImageData)),
-		Width:        finalWidth,
-		Height:       finalHeight,
-		AspectRatio:  "3:4",
+		Key:          imageKey,
+		OriginalName: file.Filename,
+		AspectRatio:  string(cvPhotoOptions.AspectRatio),
+		Renditions:   make([]ImageRendition, 0, len(renditions)),
+	}
+	for i, rendition := range renditions {
+		object := objects[i]
+		err := storage.Store.Put(c, object.Key, bytes.NewReader(rendition.Data), object.Size, object.ContentType)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  "error",
+				"message": fmt.Sprintf("Failed to upload image: %v", err),
+			})
+			return
+		}
+
+		url, err := storage.Store.PresignGet(c, object.Key, storage.PresignTTL())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  "error",
+				"message": fmt.Sprintf("Failed to presign image: %v", err),
+			})
+			return
+		}
+
+		response.Renditions = append(response.Renditions, ImageRendition{
+			Name:   rendition.Name,
+			Format: rendition.Format,
+			Key:    object.Key,
+			URL:    url,
+			Width:  rendition.Width,
+			Height: rendition.Height,
+			Size:   object.Size,
+		})
+		if object.Key == imageKey {
+			response.URL = url
+			response.Size = object.Size
+			response.Width = rendition.Width
+			response.Height = rendition.Height
+		}
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -125,126 +177,217 @@ func UploadCVPhoto(c *gin.Context) {
 	})
 }
 
-// calculateFinalDimensions calculates the final dimensions after processing for 3:4 ratio
-func calculateFinalDimensions(originalWidth, originalHeight int, options *utils.ImageProcessingOptions) (int, int) {
-	// CV photos always use 3:4 ratio
-	targetRatio := 3.0 / 4.0
-
-	// Calculate current aspect ratio
-	currentRatio := float64(originalWidth) / float64(originalHeight)
-
-	var newWidth, newHeight int
-
-	if currentRatio > targetRatio {
-		// Image is too wide, crop width
-		newHeight = originalHeight
-		newWidth = int(float64(newHeight) * targetRatio)
-	} else {
-		// Image is too tall, crop height
-		newWidth = originalWidth
-		newHeight = int(float64(newWidth) / targetRatio)
+// UploadPDF handles CV document upload to file storage. Besides PDFs it accepts DOCX and ODT documents,
+// which are kept as uploaded and parsed from their text.
+func UploadPDF(c *gin.Context) {
+	// Stream the upload to a temporary file
+	file, ok := receiveUpload(c, "pdf", utils.MaxPDFSize)
+	if !ok {
+		return
 	}
+	defer file.Close()
 
-	// Apply max constraints (600x800 for CV photos)
-	finalWidth := newWidth
-	finalHeight := newHeight
-
-	if newWidth > 600 {
-		finalWidth = 600
-		finalHeight = 800
+	// Validate the document content
+	if err := utils.ValidateCVDocument(file); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": fmt.Sprintf("Invalid CV file: %v", err),
+		})
+		return
 	}
 
-	if finalHeight > 800 {
-		finalHeight = 800
-		finalWidth = 600
+	if !scanUpload(c, file) {
+		return
 	}
 
-	return finalWidth, finalHeight
-}
-
-// UploadPDF handles PDF file upload to Digital Ocean Spaces
-func UploadPDF(c *gin.Context) {
-	// Parse multipart form with larger memory limit for PDFs
-	err := c.Request.ParseMultipartForm(25 << 20) // 25MB max memory
+	// Upload the document in cv-documents folder
+	pdfKey := storage.NewKey(storage.FolderCVDocuments, file.ContentType)
+	if !reserveUpload(c, pdfKey, uploadObject{Key: pdfKey, ContentType: file.ContentType, Size: file.Size}) {
+		return
+	}
+	reader, err := file.Reader()
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
+		c.JSON(http.StatusInternalServerError, gin.H{
 			"status":  "error",
-			"message": "Failed to parse multipart form",
+			"message": "Failed to read uploaded file",
+		})
+		return
+	}
+	err = storage.Store.Put(c, pdfKey, reader, file.Size, file.ContentType)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": fmt.Sprintf("Failed to upload CV file: %v", err),
 		})
 		return
 	}
 
-	// Get the uploaded file
-	fileHeader, err := c.FormFile("pdf")
+	pdfURL, err := storage.Store.PresignGet(c, pdfKey, storage.PresignTTL())
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
+		c.JSON(http.StatusInternalServerError, gin.H{
 			"status":  "error",
-			"message": "No PDF file provided. Use 'pdf' field name.",
+			"message": fmt.Sprintf("Failed to presign CV file: %v", err),
 		})
 		return
 	}
 
-	// Validate the PDF file
-	if err := utils.ValidatePDFFile(fileHeader); err != nil {
+	// Return success response
+	response := UploadPDFResponse{
+		Key:          pdfKey,
+		URL:          pdfURL,
+		OriginalName: file.Filename,
+		Size:         file.Size,
+		ContentType:  file.ContentType,
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   response,
+	})
+}
+
+// receiveUpload streams the file field of the request to a temporary file.
+// On failure it writes the error response and returns false.
+func receiveUpload(c *gin.Context, field string, maxSize int64) (*utils.ReceivedFile, bool) {
+	file, err := utils.ReceiveUpload(c.Writer, c.Request, field, maxSize)
+	switch {
+	case errors.Is(err, utils.ErrFileTooLarge):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"status":  "error",
+			"message": fmt.Sprintf("File exceeds the maximum size of %dMB", maxSize>>20),
+		})
+		return nil, false
+	case errors.Is(err, utils.ErrNoFile):
 		c.JSON(http.StatusBadRequest, gin.H{
 			"status":  "error",
-			"message": fmt.Sprintf("Invalid PDF file: %v", err),
+			"message": fmt.Sprintf("No file provided. Use '%s' field name.", field),
 		})
-		return
+		return nil, false
+	case err != nil:
+		fmt.Printf("receiveUpload: %v\n", err)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Failed to parse multipart form",
+		})
+		return nil, false
 	}
+	return file, true
+}
 
-	// Read the file data
-	file, err := fileHeader.Open()
+// scanUpload runs the malware scanner on the upload before anything is stored. Scanning fails closed:
+// if the scanner can't give a verdict the upload is refused. On failure it writes the error response.
+func scanUpload(c *gin.Context, file *utils.ReceivedFile) bool {
+	reader, err := file.Reader()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"status":  "error",
-			"message": "Failed to open uploaded file",
+			"message": "Failed to read uploaded file",
 		})
-		return
+		return false
 	}
-	defer file.Close()
 
-	// Read file content into memory
-	fileData := make([]byte, fileHeader.Size)
-	_, err = file.Read(fileData)
+	result, err := scanner.Default.Scan(c, reader)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
+		fmt.Printf("scanUpload: Error scanning %s: %v\n", file.Filename, err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{
 			"status":  "error",
-			"message": "Failed to read file content",
+			"message": "File could not be checked for malware, please try again later",
 		})
-		return
+		return false
 	}
+	if result.Infected {
+		if !recordAuditEvent(c, audit.Entry{
+			Action:     auditUploadRejected,
+			TargetType: "upload",
+			After: gin.H{
+				"filename":     file.Filename,
+				"size":         file.Size,
+				"content_type": file.ContentType,
+				"signature":    result.Signature,
+				"scanner":      scanner.Default.Name(),
+			},
+		}) {
+			return false
+		}
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"status":  "error",
+			"message": "File rejected: malware detected",
+		})
+		return false
+	}
+	return true
+}
 
-	// Create Digital Ocean Spaces client
-	spacesClient, err := utils.NewSpacesClient()
+// reserveUpload records the objects of an asset against the caller's quota before they are stored, so the
+// garbage collector knows every object even if this request fails later. On failure it writes the error response.
+func reserveUpload(c *gin.Context, assetKey string, objects ...uploadObject) bool {
+	err := recordUpload(c, c.GetString("userID"), assetKey, objects...)
+	if errors.Is(err, errUploadQuotaExceeded) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"status":  "error",
+			"message": fmt.Sprintf("Upload quota of %dMB exceeded. Replaced files are freed automatically after a while.", uploadQuota()>>20),
+		})
+		return false
+	}
 	if err != nil {
+		fmt.Printf("reserveUpload: %v\n", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"status":  "error",
-			"message": "Failed to initialize storage client",
+			"message": "Failed to upload file",
+		})
+		return false
+	}
+	return true
+}
+
+// ServeLocalFile serves a file of the local storage backend through a presigned URL.
+// The signature is the only authorization, exactly like a presigned S3 URL.
+func ServeLocalFile(c *gin.Context) {
+	local, ok := storage.Store.(*storage.Local)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "File not found",
 		})
 		return
 	}
 
-	// Upload PDF to Digital Ocean Spaces in cv-documents folder
-	pdfURL, err := spacesClient.UploadFile(fileHeader, fileData, "cv-documents")
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
+	key := strings.TrimPrefix(c.Param("key"), "/")
+	if err := local.Verify(key, c.Query("expires"), c.Query("signature")); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{
 			"status":  "error",
-			"message": fmt.Sprintf("Failed to upload PDF: %v", err),
+			"message": fmt.Sprintf("Invalid file URL: %v", err),
 		})
 		return
 	}
 
-	// Return success response
-	response := UploadPDFResponse{
-		URL:          pdfURL,
-		OriginalName: fileHeader.Filename,
-		Size:         fileHeader.Size,
-		ContentType:  "application/pdf",
+	info, err := local.Stat(c, key)
+	if err != nil {
+		writeFileError(c, key, err)
+		return
+	}
+	body, err := local.Get(c, key)
+	if err != nil {
+		writeFileError(c, key, err)
+		return
 	}
+	defer body.Close()
 
-	c.JSON(http.StatusOK, gin.H{
-		"status": "success",
-		"data":   response,
+	c.Header("Cache-Control", "private, no-store")
+	c.DataFromReader(http.StatusOK, info.Size, info.ContentType, body, nil)
+}
+
+func writeFileError(c *gin.Context, key string, err error) {
+	if errors.Is(err, storage.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "File not found",
+		})
+		return
+	}
+	fmt.Printf("ServeLocalFile: Error reading %s: %v\n", key, err)
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"status":  "error",
+		"message": "Error reading file",
 	})
 }
@@ -1,26 +1,28 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
-	"slices"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/vdt/cv-management/internal/audit"
+	"github.com/vdt/cv-management/internal/authz"
 	"github.com/vdt/cv-management/internal/database"
 	"github.com/vdt/cv-management/internal/models"
 )
 
-// GetUsersInDepartment returns users from a specific department (Admin and BUL/Lead)
-// Admin users always have access to this function regardless of department
+// GetUsersInDepartment returns users from a specific department (requires users:read_department)
 func GetUsersInDepartment(c *gin.Context) {
 	fmt.Printf("=== GetUsersInDepartment Debug Info ===\n")
 
-	// Get user ID and roles from context (set by AuthMiddleware)
+	// Get user ID from context (set by AuthMiddleware)
 	userID, userIDExists := c.Get("userID")
-	roles, rolesExist := c.Get("roles")
 
 	if !userIDExists {
 		fmt.Println("GetUsersInDepartment: User ID not found in context")
@@ -31,49 +33,9 @@ func GetUsersInDepartment(c *gin.Context) {
 		return
 	}
 
-	if !rolesExist {
-		fmt.Println("GetUsersInDepartment: Roles not found in context")
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"status":  "error",
-			"message": "Unauthorized - user roles not found",
-		})
-		return
-	}
-
-	roleSlice, ok := roles.([]string)
-	if !ok {
-		fmt.Printf("GetUsersInDepartment: Invalid role format: %T = %v\n", roles, roles)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"status":  "error",
-			"message": "Server error - invalid role format",
-		})
-		return
-	}
-
-	fmt.Printf("GetUsersInDepartment: User ID: %v, Roles: %v\n", userID, roleSlice)
+	fmt.Printf("GetUsersInDepartment: User ID: %v\n", userID)
 	fmt.Printf("GetUsersInDepartment: Checking access for department: %s\n", c.Param("department_id"))
 
-	// Check if user has Admin or BUL/Lead role
-	// Admin users always have access to this function
-	isAdmin := contains(roleSlice, "Admin")
-	isBULLead := contains(roleSlice, "BUL/Lead")
-
-	// Admin users always have unrestricted access
-	if isAdmin {
-		fmt.Printf("GetUsersInDepartment: Admin access granted - proceeding without restrictions\n")
-	} else if isBULLead {
-		fmt.Printf("GetUsersInDepartment: BUL/Lead access granted\n")
-	} else {
-		fmt.Printf("GetUsersInDepartment: Access denied - user does not have Admin or BUL/Lead role\n")
-		c.JSON(http.StatusForbidden, gin.H{
-			"status":  "error",
-			"message": "Forbidden - only Admin or BUL/Lead users can access this endpoint",
-		})
-		return
-	}
-
-	fmt.Printf("GetUsersInDepartment: Access granted - Admin: %v, BUL/Lead: %v\n", isAdmin, isBULLead)
-
 	// Get department ID from URL parameter
 	departmentID := c.Param("department_id")
 	if departmentID == "" {
@@ -93,7 +55,7 @@ func GetUsersInDepartment(c *gin.Context) {
 		       COALESCE(d.name, '') as department_name
 		FROM users u
 		LEFT JOIN departments d ON u.department_id = d.id
-		WHERE u.department_id = $1
+		WHERE u.department_id = $1 AND u.deactivated_at IS NULL
 		ORDER BY u.full_name`, departmentID)
 
 	if err != nil {
@@ -158,13 +120,12 @@ func GetUsersInDepartment(c *gin.Context) {
 	})
 }
 
-// GetUsersInProject returns users from a specific project (PM and Admin only)
+// GetUsersInProject returns users from a specific project (requires users:read_project and managing the project)
 func GetUsersInProject(c *gin.Context) {
 	fmt.Printf("=== GetUsersInProject Debug Info ===\n")
 
-	// Get user ID and roles from context (set by AuthMiddleware)
+	// Get user ID from context (set by AuthMiddleware)
 	userID, userIDExists := c.Get("userID")
-	roles, rolesExist := c.Get("roles")
 
 	if !userIDExists {
 		fmt.Println("GetUsersInProject: User ID not found in context")
@@ -175,40 +136,7 @@ func GetUsersInProject(c *gin.Context) {
 		return
 	}
 
-	if !rolesExist {
-		fmt.Println("GetUsersInProject: Roles not found in context")
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"status":  "error",
-			"message": "Unauthorized - user roles not found",
-		})
-		return
-	}
-
-	roleSlice, ok := roles.([]string)
-	if !ok {
-		fmt.Printf("GetUsersInProject: Invalid role format: %T = %v\n", roles, roles)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"status":  "error",
-			"message": "Server error - invalid role format",
-		})
-		return
-	}
-
-	fmt.Printf("GetUsersInProject: User ID: %v, Roles: %v\n", userID, roleSlice)
-
-	// Check if user has PM or Admin role
-	hasAccess := contains(roleSlice, "PM") || contains(roleSlice, "Admin")
-	if !hasAccess {
-		fmt.Printf("GetUsersInProject: Access denied - user does not have PM or Admin role\n")
-		c.JSON(http.StatusForbidden, gin.H{
-			"status":  "error",
-			"message": "Forbidden - only PM and Admin users can access this endpoint",
-		})
-		return
-	}
-
-	// Check if user is Admin for different logic
-	isAdmin := contains(roleSlice, "Admin")
+	fmt.Printf("GetUsersInProject: User ID: %v\n", userID)
 
 	// Get project ID from URL parameter
 	projectID := c.Param("project_id")
@@ -223,37 +151,6 @@ func GetUsersInProject(c *gin.Context) {
 
 	fmt.Printf("GetUsersInProject: Fetching users from project %s\n", projectID)
 
-	// For PM users, verify they are a member of this project
-	// Admin users can access any project without membership check
-	if !isAdmin {
-		var pmMemberCount int
-		err := database.DB.QueryRow(c, `
-			SELECT COUNT(*)
-			FROM project_members
-			WHERE project_id = $1 AND user_id = $2
-			  AND (left_at IS NULL OR left_at > CURRENT_DATE)`, projectID, userID).Scan(&pmMemberCount)
-
-		if err != nil {
-			fmt.Printf("GetUsersInProject error checking PM membership: %v\n", err)
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"status":  "error",
-				"message": "Error verifying project access",
-			})
-			return
-		}
-
-		if pmMemberCount == 0 {
-			fmt.Printf("GetUsersInProject: PM %s is not a member of project %s\n", userID, projectID)
-			c.JSON(http.StatusForbidden, gin.H{
-				"status":  "error",
-				"message": "Forbidden - you are not a member of this project",
-			})
-			return
-		}
-	} else {
-		fmt.Printf("GetUsersInProject: Admin user %s accessing project %s (no membership check required)\n", userID, projectID)
-	}
-
 	// Query database for users in the specified project (including those who have left)
 	rows, err := database.DB.Query(c, `
 		SELECT u.id, u.employee_code, u.full_name, u.email, u.department_id,
@@ -387,10 +284,13 @@ func GetUsersPaginated(c *gin.Context) {
 	const perPage = 10
 	offset := (page - 1) * perPage
 
-	fmt.Printf("GetUsersPaginated: Fetching page %d with offset %d\n", page, offset)
+	// status=deactivated lists deleted users that can still be restored
+	deactivated := c.Query("status") == "deactivated"
+
+	fmt.Printf("GetUsersPaginated: Fetching page %d with offset %d (deactivated: %t)\n", page, offset, deactivated)
 
 	// Fetch paginated users from the database
-	paginatedResponse, err := getUsersPaginated(c, page, perPage, offset)
+	paginatedResponse, err := getUsersPaginated(c, page, perPage, offset, deactivated)
 	if err != nil {
 		fmt.Printf("GetUsersPaginated error: %v\n", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -430,7 +330,7 @@ func GetUsersByRole(c *gin.Context) {
 		LEFT JOIN departments d ON u.department_id = d.id
 		INNER JOIN user_roles ur ON u.id = ur.user_id
 		INNER JOIN roles r ON ur.role_id = r.id
-		WHERE r.name = $1
+		WHERE r.name = $1 AND u.deactivated_at IS NULL
 		ORDER BY u.full_name`, roleName)
 
 	if err != nil {
@@ -507,7 +407,7 @@ func GetPMUsers(c *gin.Context) {
 		LEFT JOIN departments d ON u.department_id = d.id
 		INNER JOIN user_roles ur ON u.id = ur.user_id
 		INNER JOIN roles r ON ur.role_id = r.id
-		WHERE r.name = 'PM'
+		WHERE r.name = 'PM' AND u.deactivated_at IS NULL
 		ORDER BY u.full_name`)
 
 	if err != nil {
@@ -722,6 +622,11 @@ func UpdateUser(c *gin.Context) {
 	}
 	defer tx.Rollback(c)
 
+	before, ok := auditSnapshot(c, func() (json.RawMessage, error) { return audit.UserSnapshot(c, tx, id) })
+	if !ok {
+		return
+	}
+
 	// Update user basic information
 	_, err = tx.Exec(c, `
 		UPDATE users
@@ -780,6 +685,14 @@ func UpdateUser(c *gin.Context) {
 		fmt.Printf("UpdateUser: Updated roles for user %s: %v\n", id, updateData.RoleNames)
 	}
 
+	after, ok := auditSnapshot(c, func() (json.RawMessage, error) { return audit.UserSnapshot(c, tx, id) })
+	if !ok {
+		return
+	}
+	if !recordAudit(c, tx, audit.Entry{Action: auditUserUpdate, TargetType: "user", TargetID: id, Before: before, After: after}) {
+		return
+	}
+
 	// Commit the transaction
 	err = tx.Commit(c)
 	if err != nil {
@@ -809,7 +722,7 @@ func UpdateUser(c *gin.Context) {
 	})
 }
 
-// DeleteUser deletes a user by ID
+// DeleteUser deactivates a user (soft delete); the purge job deletes them permanently later
 func DeleteUser(c *gin.Context) {
 	fmt.Printf("=== DeleteUser Debug Info ===\n")
 
@@ -867,7 +780,7 @@ func DeleteUser(c *gin.Context) {
 		return
 	}
 
-	// Start a transaction to ensure data consistency
+	// Start a transaction so the deactivation and its audit entry are saved together
 	tx, err := database.DB.Begin(c)
 	if err != nil {
 		fmt.Printf("DeleteUser transaction begin error: %v\n", err)
@@ -879,82 +792,148 @@ func DeleteUser(c *gin.Context) {
 	}
 	defer tx.Rollback(c)
 
-	// Delete in proper order to handle foreign key constraints
+	before, ok := auditSnapshot(c, func() (json.RawMessage, error) { return audit.UserSnapshot(c, tx, id) })
+	if !ok {
+		return
+	}
 
-	// 1. Delete user roles
-	_, err = tx.Exec(c, "DELETE FROM user_roles WHERE user_id = $1", id)
+	// Deactivate instead of deleting: roles, project memberships, CV and requests are kept as history.
+	// The purge job deletes the user permanently once the retention period has passed.
+	var deactivatedAt time.Time
+	err = tx.QueryRow(c,
+		"UPDATE users SET deactivated_at = NOW() WHERE id = $1 AND deactivated_at IS NULL RETURNING deactivated_at",
+		id).Scan(&deactivatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		fmt.Printf("DeleteUser: User %s is already deactivated\n", id)
+		c.JSON(http.StatusConflict, gin.H{
+			"status":  "error",
+			"message": "User is already deactivated",
+		})
+		return
+	}
 	if err != nil {
-		fmt.Printf("DeleteUser error deleting user roles: %v\n", err)
+		fmt.Printf("DeleteUser error deactivating user: %v\n", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"status":  "error",
-			"message": "Error deleting user roles",
+			"message": "Error deactivating user",
 		})
 		return
 	}
-	fmt.Printf("DeleteUser: Deleted user roles for user %s\n", id)
 
-	// 2. Delete project members (hard delete to avoid foreign key constraint)
-	_, err = tx.Exec(c, "DELETE FROM project_members WHERE user_id = $1", id)
+	// Nobody can keep acting as a deactivated user
+	_, err = tx.Exec(c, "UPDATE impersonation_sessions SET ended_at = NOW() WHERE user_id = $1 AND ended_at IS NULL", id)
 	if err != nil {
-		fmt.Printf("DeleteUser error deleting project members: %v\n", err)
+		fmt.Printf("DeleteUser error ending impersonation sessions: %v\n", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"status":  "error",
-			"message": "Error removing user from projects",
+			"message": "Error deactivating user",
 		})
 		return
 	}
-	fmt.Printf("DeleteUser: Removed user %s from all projects\n", id)
 
-	// 3. Delete CV update requests (CASCADE will handle cv_details)
-	_, err = tx.Exec(c, "DELETE FROM cv_update_requests WHERE cv_id IN (SELECT id FROM cv WHERE user_id = $1)", id)
+	after, ok := auditSnapshot(c, func() (json.RawMessage, error) { return audit.UserSnapshot(c, tx, id) })
+	if !ok {
+		return
+	}
+	if !recordAudit(c, tx, audit.Entry{Action: auditUserDeactivate, TargetType: "user", TargetID: id, Before: before, After: after}) {
+		return
+	}
+
+	// Commit the transaction
+	err = tx.Commit(c)
 	if err != nil {
-		fmt.Printf("DeleteUser error deleting CV update requests: %v\n", err)
+		fmt.Printf("DeleteUser transaction commit error: %v\n", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"status":  "error",
-			"message": "Error deleting CV update requests",
+			"message": "Error committing transaction",
 		})
 		return
 	}
-	fmt.Printf("DeleteUser: Deleted CV update requests for user %s\n", id)
 
-	// 4. Delete CV (CASCADE will handle cv_details)
-	_, err = tx.Exec(c, "DELETE FROM cv WHERE user_id = $1", id)
+	fmt.Printf("DeleteUser: Successfully deactivated user %s\n", id)
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "User deactivated successfully",
+		"data": gin.H{
+			"id":             id,
+			"deactivated_at": deactivatedAt,
+		},
+	})
+}
+
+// RestoreUser reactivates a deactivated user that has not been purged yet
+func RestoreUser(c *gin.Context) {
+	id := c.Param("id")
+
+	tx, err := database.DB.Begin(c)
 	if err != nil {
-		fmt.Printf("DeleteUser error deleting CV: %v\n", err)
+		fmt.Printf("RestoreUser transaction begin error: %v\n", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"status":  "error",
-			"message": "Error deleting user CV",
+			"message": "Error starting transaction",
 		})
 		return
 	}
-	fmt.Printf("DeleteUser: Deleted CV for user %s\n", id)
+	defer tx.Rollback(c)
 
-	// 5. Finally, delete the user
-	result, err := tx.Exec(c, "DELETE FROM users WHERE id = $1", id)
+	var deactivatedAt, erasedAt *time.Time
+	err = tx.QueryRow(c, "SELECT deactivated_at, erased_at FROM users WHERE id = $1 FOR UPDATE", id).
+		Scan(&deactivatedAt, &erasedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "User not found",
+		})
+		return
+	}
 	if err != nil {
-		fmt.Printf("DeleteUser error deleting user: %v\n", err)
+		fmt.Printf("RestoreUser error fetching user: %v\n", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"status":  "error",
-			"message": "Error deleting user",
+			"message": "Error fetching user",
+		})
+		return
+	}
+	if deactivatedAt == nil {
+		c.JSON(http.StatusConflict, gin.H{
+			"status":  "error",
+			"message": "User is not deactivated",
+		})
+		return
+	}
+	// An erased account has nothing left to restore: no name, password or roles
+	if erasedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{
+			"status":  "error",
+			"message": "User data was erased, the account cannot be restored",
 		})
 		return
 	}
 
-	// Check if user was actually deleted
-	rowsAffected := result.RowsAffected()
-	if rowsAffected == 0 {
-		fmt.Printf("DeleteUser: No rows affected when deleting user %s\n", id)
-		c.JSON(http.StatusNotFound, gin.H{
+	before, ok := auditSnapshot(c, func() (json.RawMessage, error) { return audit.UserSnapshot(c, tx, id) })
+	if !ok {
+		return
+	}
+
+	if _, err := tx.Exec(c, "UPDATE users SET deactivated_at = NULL, deactivated_by_sync = FALSE WHERE id = $1", id); err != nil {
+		fmt.Printf("RestoreUser error restoring user: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
 			"status":  "error",
-			"message": "User not found",
+			"message": "Error restoring user",
 		})
 		return
 	}
 
-	// Commit the transaction
-	err = tx.Commit(c)
-	if err != nil {
-		fmt.Printf("DeleteUser transaction commit error: %v\n", err)
+	after, ok := auditSnapshot(c, func() (json.RawMessage, error) { return audit.UserSnapshot(c, tx, id) })
+	if !ok {
+		return
+	}
+	if !recordAudit(c, tx, audit.Entry{Action: auditUserRestore, TargetType: "user", TargetID: id, Before: before, After: after}) {
+		return
+	}
+
+	if err := tx.Commit(c); err != nil {
+		fmt.Printf("RestoreUser transaction commit error: %v\n", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"status":  "error",
 			"message": "Error committing transaction",
@@ -962,13 +941,21 @@ func DeleteUser(c *gin.Context) {
 		return
 	}
 
-	fmt.Printf("DeleteUser: Successfully deleted user %s\n", id)
+	restoredUser, err := getSingleUserByID(c, id)
+	if err != nil {
+		fmt.Printf("RestoreUser error fetching restored user: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "User restored but error fetching user data",
+		})
+		return
+	}
+
+	fmt.Printf("RestoreUser: Restored user %s\n", id)
 	c.JSON(http.StatusOK, gin.H{
 		"status":  "success",
-		"message": "User deleted successfully",
-		"data": gin.H{
-			"id": id,
-		},
+		"message": "User restored successfully",
+		"data":    restoredUser,
 	})
 }
 
@@ -1020,15 +1007,15 @@ func GetRoles(c *gin.Context) {
 	})
 }
 
-// Helper function to check if a slice contains a string
-func contains(slice []string, item string) bool {
-	return slices.Contains(slice, item)
-}
-
-// getAllUsers fetches all users from the database (Admin access)
+// getAllUsers fetches the active users the caller can reach
 func getAllUsers(c *gin.Context) ([]models.User, error) {
 	fmt.Println("getAllUsers: Fetching all users from database")
 
+	filter, args, err := authz.UserAccessFilter(c, "u.id", 1)
+	if err != nil {
+		return nil, fmt.Errorf("error checking access: %w", err)
+	}
+
 	rows, err := database.DB.Query(c, `
 		SELECT u.id, u.employee_code, u.full_name, u.email, u.department_id,
 		       COALESCE(d.name, '') as department_name,
@@ -1041,7 +1028,8 @@ func getAllUsers(c *gin.Context) ([]models.User, error) {
 		       ) as project_names
 		FROM users u
 		LEFT JOIN departments d ON u.department_id = d.id
-		ORDER BY u.full_name`)
+		WHERE u.deactivated_at IS NULL AND `+filter+`
+		ORDER BY u.full_name`, args...)
 
 	if err != nil {
 		return nil, fmt.Errorf("error querying all users: %w", err)
@@ -1103,13 +1091,19 @@ func getAllUsers(c *gin.Context) ([]models.User, error) {
 	return users, nil
 }
 
-// getUsersPaginated fetches paginated users from the database (Admin access)
-func getUsersPaginated(c *gin.Context, page, perPage, offset int) (models.PaginatedUsersResponse, error) {
+// getUsersPaginated fetches a page of the users the caller can reach
+func getUsersPaginated(c *gin.Context, page, perPage, offset int, deactivated bool) (models.PaginatedUsersResponse, error) {
 	fmt.Printf("getUsersPaginated: Fetching page %d with %d users per page (offset: %d)\n", page, perPage, offset)
 
 	// First, get the total count of users
+	countFilter, countArgs, err := authz.UserAccessFilter(c, "u.id", 2)
+	if err != nil {
+		return models.PaginatedUsersResponse{}, fmt.Errorf("error checking access: %w", err)
+	}
 	var totalUsers int
-	err := database.DB.QueryRow(c, `SELECT COUNT(*) FROM users`).Scan(&totalUsers)
+	err = database.DB.QueryRow(c,
+		`SELECT COUNT(*) FROM users u WHERE (u.deactivated_at IS NOT NULL) = $1 AND `+countFilter,
+		append([]any{deactivated}, countArgs...)...).Scan(&totalUsers)
 	if err != nil {
 		return models.PaginatedUsersResponse{}, fmt.Errorf("error counting users: %w", err)
 	}
@@ -1120,6 +1114,10 @@ func getUsersPaginated(c *gin.Context, page, perPage, offset int) (models.Pagina
 	hasPrev := page > 1
 
 	// Fetch the paginated users
+	filter, filterArgs, err := authz.UserAccessFilter(c, "u.id", 4)
+	if err != nil {
+		return models.PaginatedUsersResponse{}, fmt.Errorf("error checking access: %w", err)
+	}
 	rows, err := database.DB.Query(c, `
 		SELECT u.id, u.employee_code, u.full_name, u.email, u.department_id,
 		       COALESCE(d.name, '') as department_name,
@@ -1129,11 +1127,13 @@ func getUsersPaginated(c *gin.Context, page, perPage, offset int) (models.Pagina
 		           JOIN projects p ON pm.project_id = p.id
 		           WHERE pm.user_id = u.id
 		             AND (pm.left_at IS NULL OR pm.left_at > CURRENT_DATE)
-		       ) as project_names
+		       ) as project_names,
+		       u.deactivated_at
 		FROM users u
 		LEFT JOIN departments d ON u.department_id = d.id
+		WHERE (u.deactivated_at IS NOT NULL) = $3 AND `+filter+`
 		ORDER BY u.full_name
-		LIMIT $1 OFFSET $2`, perPage, offset)
+		LIMIT $1 OFFSET $2`, append([]any{perPage, offset, deactivated}, filterArgs...)...)
 
 	if err != nil {
 		return models.PaginatedUsersResponse{}, fmt.Errorf("error querying paginated users: %w", err)
@@ -1147,7 +1147,7 @@ func getUsersPaginated(c *gin.Context, page, perPage, offset int) (models.Pagina
 		var projectNamesStr string
 
 		err := rows.Scan(&user.ID, &user.EmployeeCode, &user.FullName,
-			&user.Email, &user.DepartmentID, &deptName, &projectNamesStr)
+			&user.Email, &user.DepartmentID, &deptName, &projectNamesStr, &user.DeactivatedAt)
 		if err != nil {
 			return models.PaginatedUsersResponse{}, fmt.Errorf("error scanning user: %w", err)
 		}
@@ -1251,6 +1251,7 @@ func getUsersFromPMProjects(c *gin.Context, pmUserID string) ([]models.User, err
 		INNER JOIN project_members pm_user ON u.id = pm_user.user_id
 		INNER JOIN project_members pm_pm ON pm_user.project_id = pm_pm.project_id
 		WHERE pm_pm.user_id = $1
+		  AND u.deactivated_at IS NULL
 		  AND (pm_user.left_at IS NULL OR pm_user.left_at > CURRENT_DATE)
 		ORDER BY u.full_name`, pmUserID)
 
@@ -1325,7 +1326,7 @@ func getUsersFromSameDepartment(c *gin.Context, bulUserID string) ([]models.User
 		       COALESCE(d.name, '') as department_name
 		FROM users u
 		LEFT JOIN departments d ON u.department_id = d.id
-		WHERE u.department_id = $1
+		WHERE u.department_id = $1 AND u.deactivated_at IS NULL
 		ORDER BY u.full_name`, bulDepartmentID)
 
 	if err != nil {
@@ -1388,11 +1389,12 @@ func getSingleUserByID(c *gin.Context, userID string) (models.User, error) {
 		           JOIN projects p ON pm.project_id = p.id
 		           WHERE pm.user_id = u.id
 		             AND (pm.left_at IS NULL OR pm.left_at > CURRENT_DATE)
-		       ) as project_names
+		       ) as project_names,
+		       u.deactivated_at
 		FROM users u
 		LEFT JOIN departments d ON u.department_id = d.id
 		WHERE u.id = $1`, userID).Scan(&user.ID, &user.EmployeeCode, &user.FullName,
-		&user.Email, &user.DepartmentID, &deptName, &projectNamesStr)
+		&user.Email, &user.DepartmentID, &deptName, &projectNamesStr, &user.DeactivatedAt)
 
 	if err != nil {
 		return user, fmt.Errorf("error querying user: %w", err)
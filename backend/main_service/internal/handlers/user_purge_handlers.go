@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/vdt/cv-management/internal/audit"
+	"github.com/vdt/cv-management/internal/database"
+)
+
+// defaultUserPurgeRetentionDays is how long a deactivated user can still be restored
+const defaultUserPurgeRetentionDays = 90
+
+// errUserStillReferenced means the user owns records that must outlive them (service accounts, impersonation history)
+var errUserStillReferenced = errors.New("user is still referenced")
+
+// StartUserPurge starts the daily job that permanently deletes users deactivated longer than
+// USER_PURGE_RETENTION_DAYS ago (default 90). A zero or negative retention disables the purge.
+func StartUserPurge() {
+	retentionDays := defaultUserPurgeRetentionDays
+	if value := os.Getenv("USER_PURGE_RETENTION_DAYS"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			log.Printf("Invalid USER_PURGE_RETENTION_DAYS %q, using %d: %v", value, retentionDays, err)
+		} else {
+			retentionDays = parsed
+		}
+	}
+
+	if retentionDays <= 0 {
+		log.Printf("User purge disabled")
+		return
+	}
+	retention := time.Duration(retentionDays) * 24 * time.Hour
+
+	go func() {
+		ticker := time.NewTicker(24 * time.Hour)
+		defer ticker.Stop()
+
+		for {
+			purged, err := PurgeDeactivatedUsers(context.Background(), retention)
+			if err != nil {
+				log.Printf("User purge failed: %v", err)
+			} else if purged > 0 {
+				log.Printf("User purge finished: %d users permanently deleted", purged)
+			}
+			<-ticker.C
+		}
+	}()
+
+	log.Printf("Scheduled user purge with a retention of %d days", retentionDays)
+}
+
+// PurgeDeactivatedUsers permanently deletes users deactivated before the retention period.
+// Each user is purged in its own transaction so one failure doesn't block the others.
+func PurgeDeactivatedUsers(ctx context.Context, retention time.Duration) (int, error) {
+	rows, err := database.DB.Query(ctx,
+		"SELECT id FROM users WHERE deactivated_at < $1 ORDER BY deactivated_at",
+		time.Now().Add(-retention))
+	if err != nil {
+		return 0, fmt.Errorf("error finding users to purge: %w", err)
+	}
+	userIDs, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return 0, fmt.Errorf("error finding users to purge: %w", err)
+	}
+
+	purged := 0
+	for _, userID := range userIDs {
+		err := purgeUser(ctx, userID, retention)
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			// Restored since the query
+		case errors.Is(err, errUserStillReferenced):
+			log.Printf("User purge: skipping user %s, still referenced by service accounts or impersonation history", userID)
+		case err != nil:
+			log.Printf("User purge: error purging user %s: %v", userID, err)
+		default:
+			purged++
+		}
+	}
+
+	return purged, nil
+}
+
+// purgeUser deletes a deactivated user with their roles, project memberships and CV
+func purgeUser(ctx context.Context, userID string, retention time.Duration) error {
+	tx, err := database.DB.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock the user and make sure nobody restored them in the meantime
+	var id string
+	err = tx.QueryRow(ctx,
+		"SELECT id FROM users WHERE id = $1 AND deactivated_at < $2 FOR UPDATE",
+		userID, time.Now().Add(-retention)).Scan(&id)
+	if err != nil {
+		return err
+	}
+
+	// Keep the user and their CV in the audit log, since both are gone after this
+	user, err := audit.UserSnapshot(ctx, tx, userID)
+	if err != nil {
+		return err
+	}
+	cv, err := audit.CVSnapshot(ctx, tx, userID)
+	if err != nil {
+		return err
+	}
+
+	// Delete in proper order to handle foreign key constraints
+	statements := []string{
+		"DELETE FROM user_roles WHERE user_id = $1",
+		"DELETE FROM project_members WHERE user_id = $1",
+		// Requests the user sent to others stay, without a requester
+		"UPDATE cv_update_requests SET requested_by = NULL WHERE requested_by = $1",
+		"DELETE FROM cv_update_requests WHERE cv_id IN (SELECT id FROM cv WHERE user_id = $1)",
+		// CASCADE handles cv_details and the education, course and skill records
+		"DELETE FROM cv WHERE user_id = $1",
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(ctx, statement, userID); err != nil {
+			return fmt.Errorf("error running %q: %w", statement, err)
+		}
+	}
+
+	// The files of the deleted CV are left to the upload garbage collector
+	if err := syncUploadReferences(ctx, tx, userID); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, "DELETE FROM users WHERE id = $1", userID); err != nil {
+		if isForeignKeyViolation(err) {
+			return errUserStillReferenced
+		}
+		return fmt.Errorf("error deleting user: %w", err)
+	}
+
+	err = audit.RecordTx(ctx, tx, audit.SystemActor("user_purge"), audit.Entry{
+		Action:     auditUserPurge,
+		TargetType: "user",
+		TargetID:   userID,
+		Before:     map[string]json.RawMessage{"user": user, "cv": cv},
+	})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,115 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/vdt/cv-management/internal/database"
+	"github.com/vdt/cv-management/internal/utils"
+)
+
+// authenticateAPIKey validates a service account API key and adds the service account info to context.
+// API key requests never get a userID or roles, so they are rejected by every route that does not
+// require a permission the key has as a scope.
+func authenticateAPIKey(c *gin.Context, key string) {
+	prefix, ok := utils.ParseAPIKeyPrefix(key)
+	if !ok {
+		abortInvalidAPIKey(c)
+		return
+	}
+
+	var (
+		keyID, keyHash, serviceAccountID, ownerID string
+		scopes, allowedIPs                        []string
+		expiresAt, revokedAt, disabledAt          *time.Time
+	)
+	err := database.DB.QueryRow(c,
+		`SELECT k.id, k.key_hash, k.scopes, COALESCE(k.allowed_ips, '{}'), k.expires_at, k.revoked_at,
+			sa.id, sa.owner_id, sa.disabled_at
+		FROM api_keys k
+		JOIN service_accounts sa ON sa.id = k.service_account_id
+		WHERE k.key_prefix = $1`,
+		prefix).Scan(&keyID, &keyHash, &scopes, &allowedIPs, &expiresAt, &revokedAt,
+		&serviceAccountID, &ownerID, &disabledAt)
+	if err != nil {
+		if !errors.Is(err, pgx.ErrNoRows) {
+			fmt.Printf("AuthMiddleware: Error looking up API key %s: %v\n", prefix, err)
+		}
+		abortInvalidAPIKey(c)
+		return
+	}
+
+	if !utils.CheckAPIKeyHash(key, keyHash) {
+		abortInvalidAPIKey(c)
+		return
+	}
+
+	if revokedAt != nil || disabledAt != nil || (expiresAt != nil && time.Now().After(*expiresAt)) {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"status":  "error",
+			"message": "API key is revoked, expired or disabled",
+		})
+		c.Abort()
+		return
+	}
+
+	clientIP := c.ClientIP()
+	if !utils.IPAllowed(clientIP, allowedIPs) {
+		fmt.Printf("AuthMiddleware: API key %s used from disallowed IP %s\n", prefix, clientIP)
+		c.JSON(http.StatusForbidden, gin.H{
+			"status":  "error",
+			"message": "API key is not allowed from this IP address",
+		})
+		c.Abort()
+		return
+	}
+
+	// Set service account info to context
+	c.Set("apiKeyID", keyID)
+	c.Set("serviceAccountID", serviceAccountID)
+	c.Set("serviceAccountOwnerID", ownerID)
+	c.Set("scopes", scopes)
+
+	c.Next()
+
+	// Record the key use once the response status is known
+	if _, err := database.DB.Exec(c,
+		"UPDATE api_keys SET last_used_at = NOW(), last_used_ip = $1 WHERE id = $2",
+		clientIP, keyID); err != nil {
+		fmt.Printf("AuthMiddleware: Error updating last use of API key %s: %v\n", prefix, err)
+	}
+	if _, err := database.DB.Exec(c,
+		`INSERT INTO api_key_usage (api_key_id, ip, method, path, status_code)
+		VALUES ($1, $2, $3, $4, $5)`,
+		keyID, clientIP, c.Request.Method, c.Request.URL.Path, c.Writer.Status()); err != nil {
+		fmt.Printf("AuthMiddleware: Error recording usage of API key %s: %v\n", prefix, err)
+	}
+}
+
+func abortInvalidAPIKey(c *gin.Context) {
+	c.JSON(http.StatusUnauthorized, gin.H{
+		"status":  "error",
+		"message": "Invalid API key",
+	})
+	c.Abort()
+}
+
+// UserOnly rejects API key requests on routes whose handlers do not check the user ID themselves
+func UserOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, exists := c.Get("userID"); !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"status":  "error",
+				"message": "Unauthorized - user ID not found",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
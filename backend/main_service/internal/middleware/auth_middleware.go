@@ -1,16 +1,25 @@
 package middleware
 
 import (
+	"fmt"
 	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/vdt/cv-management/internal/authz"
+	"github.com/vdt/cv-management/internal/database"
 	"github.com/vdt/cv-management/internal/utils"
 )
 
-// AuthMiddleware validates JWT tokens and adds user info to context
+// AuthMiddleware validates JWT tokens (or service account API keys) and adds user info to context
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		// Service accounts may send their key in the X-API-Key header
+		if apiKey := c.GetHeader("X-API-Key"); apiKey != "" {
+			authenticateAPIKey(c, apiKey)
+			return
+		}
+
 		// Get the Authorization header
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -36,6 +45,12 @@ func AuthMiddleware() gin.HandlerFunc {
 		// Get the token
 		tokenString := headerParts[1]
 
+		// Service accounts may also send their key as a bearer token
+		if utils.IsAPIKey(tokenString) {
+			authenticateAPIKey(c, tokenString)
+			return
+		}
+
 		// Validate token
 		claims, err := utils.ValidateToken(tokenString)
 		if err != nil {
@@ -47,56 +62,108 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		// Deactivated users lose access right away rather than when their token expires
+		var active bool
+		err = database.DB.QueryRow(c,
+			"SELECT EXISTS (SELECT 1 FROM users WHERE id = $1 AND deactivated_at IS NULL)",
+			claims.UserID).Scan(&active)
+		if err != nil {
+			fmt.Printf("AuthMiddleware: Error checking user %s: %v\n", claims.UserID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  "error",
+				"message": "Server error - could not verify user",
+			})
+			c.Abort()
+			return
+		}
+		if !active {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"status":  "error",
+				"message": "Account is deactivated or no longer exists",
+			})
+			c.Abort()
+			return
+		}
+
 		// Set claims to context
 		c.Set("userID", claims.UserID)
 		c.Set("roles", claims.Roles)
 
+		if claims.ImpersonatorID != "" {
+			handleImpersonation(c, claims)
+			return
+		}
+
 		c.Next()
 	}
 }
 
-// RoleMiddleware checks if the user has the required role
-func RoleMiddleware(requiredRoles ...string) gin.HandlerFunc {
+// RequirePermission checks that the caller has at least one of the permissions,
+// either through the permissions of their roles or through the scopes of their API key
+func RequirePermission(permissions ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Get roles from context (set by AuthMiddleware)
-		rolesInterface, exists := c.Get("roles")
-		if !exists {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"status":  "error",
-				"message": "Unauthorized - user roles not found",
-			})
-			c.Abort()
-			return
+		for _, permission := range permissions {
+			allowed, err := authz.HasPermission(c, permission)
+			if err != nil {
+				fmt.Printf("RequirePermission: Error checking permission %s: %v\n", permission, err)
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"status":  "error",
+					"message": "Server error - could not check permissions",
+				})
+				c.Abort()
+				return
+			}
+			if allowed {
+				c.Next()
+				return
+			}
 		}
 
-		roles, ok := rolesInterface.([]string)
-		if !ok {
+		c.JSON(http.StatusForbidden, gin.H{
+			"status":  "error",
+			"message": "Forbidden - insufficient permissions",
+		})
+		c.Abort()
+	}
+}
+
+// RequireUserAccess checks that the caller can reach the user identified by the route parameter
+func RequireUserAccess(param string) gin.HandlerFunc {
+	return requireResourceAccess(authz.ResourceUser, param, authz.CanAccessUser)
+}
+
+// RequireDepartmentAccess checks that the caller can reach the department identified by the route parameter
+func RequireDepartmentAccess(param string) gin.HandlerFunc {
+	return requireResourceAccess(authz.ResourceDepartment, param, authz.CanAccessDepartment)
+}
+
+// RequireProjectManagement checks that the caller manages the project identified by the route parameter
+func RequireProjectManagement(param string) gin.HandlerFunc {
+	return requireResourceAccess(authz.ResourceProject, param, authz.CanManageProject)
+}
+
+// requireResourceAccess runs a resource-scoped check and records the attempt when it is denied
+func requireResourceAccess(resourceType, param string, check func(*gin.Context, string) (bool, error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		resourceID := c.Param(param)
+
+		allowed, err := check(c, resourceID)
+		if err != nil {
+			fmt.Printf("Access check for %s %s failed: %v\n", resourceType, resourceID, err)
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"status":  "error",
-				"message": "Server error - invalid role format",
+				"message": "Server error - could not check access",
 			})
 			c.Abort()
 			return
 		}
 
-		// Check if user has any of the required roles
-		hasRole := false
-		for _, role := range roles {
-			for _, requiredRole := range requiredRoles {
-				if role == requiredRole {
-					hasRole = true
-					break
-				}
-			}
-			if hasRole {
-				break
-			}
-		}
-
-		if !hasRole {
+		if !allowed {
+			fmt.Printf("Access denied to %s %s for %s %s\n", resourceType, resourceID, c.Request.Method, c.Request.URL.Path)
+			authz.RecordDenial(c, resourceType, resourceID)
 			c.JSON(http.StatusForbidden, gin.H{
 				"status":  "error",
-				"message": "Forbidden - insufficient permissions",
+				"message": fmt.Sprintf("Forbidden - you do not have access to this %s", resourceType),
 			})
 			c.Abort()
 			return
@@ -105,23 +172,3 @@ func RoleMiddleware(requiredRoles ...string) gin.HandlerFunc {
 		c.Next()
 	}
 }
-
-// AdminOnly is a shortcut middleware for Admin role
-func AdminOnly() gin.HandlerFunc {
-	return RoleMiddleware("Admin")
-}
-
-// PMOnly is a shortcut middleware for PM role
-func PMOnly() gin.HandlerFunc {
-	return RoleMiddleware("PM")
-}
-
-// BULOnly is a shortcut middleware for BUL role
-func BULOnly() gin.HandlerFunc {
-	return RoleMiddleware("BUL/Lead")
-}
-
-// AdminOrPMOrBUL is a shortcut middleware for Admin, PM, or BUL roles
-func AdminOrPMOrBUL() gin.HandlerFunc {
-	return RoleMiddleware("Admin", "PM", "BUL/Lead")
-}
@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vdt/cv-management/internal/database"
+	"github.com/vdt/cv-management/internal/utils"
+)
+
+// handleImpersonation validates an impersonation token's session, blocks destructive requests
+// and records the request with both the Admin and the impersonated user
+func handleImpersonation(c *gin.Context, claims *utils.Claims) {
+	var endedAt *time.Time
+	err := database.DB.QueryRow(c,
+		"SELECT ended_at FROM impersonation_sessions WHERE id = $1 AND impersonator_id = $2 AND user_id = $3",
+		claims.ImpersonationID, claims.ImpersonatorID, claims.UserID).Scan(&endedAt)
+	if err != nil || endedAt != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"status":  "error",
+			"message": "Impersonation session has ended",
+		})
+		c.Abort()
+		return
+	}
+
+	c.Set("impersonatorID", claims.ImpersonatorID)
+	c.Set("impersonationID", claims.ImpersonationID)
+	c.Header("X-Impersonated-By", claims.ImpersonatorID)
+
+	// Deletes are never allowed while impersonating; other destructive routes use NotWhileImpersonating
+	if c.Request.Method == http.MethodDelete {
+		abortImpersonationBlocked(c)
+	} else {
+		c.Next()
+	}
+
+	if _, err := database.DB.Exec(c,
+		`INSERT INTO impersonation_requests (session_id, impersonator_id, user_id, method, path, status_code, ip)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		claims.ImpersonationID, claims.ImpersonatorID, claims.UserID,
+		c.Request.Method, c.Request.URL.Path, c.Writer.Status(), c.ClientIP()); err != nil {
+		fmt.Printf("AuthMiddleware: Error recording impersonated request %s %s: %v\n", c.Request.Method, c.Request.URL.Path, err)
+	}
+}
+
+// NotWhileImpersonating blocks destructive or security sensitive routes for impersonation tokens
+func NotWhileImpersonating() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, impersonating := c.Get("impersonatorID"); impersonating {
+			abortImpersonationBlocked(c)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func abortImpersonationBlocked(c *gin.Context) {
+	c.JSON(http.StatusForbidden, gin.H{
+		"status":  "error",
+		"message": "This action is not allowed while impersonating a user",
+	})
+	c.Abort()
+}
@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// requestIDPattern limits client supplied request IDs to safe, reasonably sized values
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{8,64}$`)
+
+// RequestID assigns every request an ID (or keeps a valid incoming X-Request-ID) and echoes it in the response
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader("X-Request-ID")
+		if !requestIDPattern.MatchString(requestID) {
+			requestID = uuid.NewString()
+		}
+
+		c.Set("requestID", requestID)
+		c.Header("X-Request-ID", requestID)
+
+		c.Next()
+	}
+}
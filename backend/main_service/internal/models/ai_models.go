@@ -5,11 +5,13 @@ type ParseCVRequest struct {
 	FilePath string `json:"file_path" binding:"required"`
 }
 
-// ParseCVResponse represents the response from the AI service
+// ParseCVResponse represents the response from the AI service. Confidence holds the confidence of each
+// field from 0 (not found) to 1, keyed by its JSON name; list fields have one for the whole list.
 type ParseCVResponse struct {
-	Status   string `json:"status"`
-	FilePath string `json:"file_path"`
-	Data     any    `json:"data"`
+	Status     string             `json:"status"`
+	FilePath   string             `json:"file_path"`
+	Data       any                `json:"data"`
+	Confidence map[string]float64 `json:"confidence,omitempty"`
 }
 
 // AIServiceRequest represents the request sent to the AI service
@@ -17,9 +19,15 @@ type AIServiceRequest struct {
 	FilePath string `json:"file_path"`
 }
 
-// AIServiceResponse represents the response from the AI service
+// AIServiceTextRequest represents the request sent to the AI service to parse a CV from its text
+type AIServiceTextRequest struct {
+	Text string `json:"text"`
+}
+
+// AIServiceResponse represents the response from the AI service, with its confidence as in ParseCVResponse
 type AIServiceResponse struct {
-	Status   string `json:"status"`
-	FilePath string `json:"file_path"`
-	Data     any    `json:"data"`
+	Status     string             `json:"status"`
+	FilePath   string             `json:"file_path"`
+	Data       any                `json:"data"`
+	Confidence map[string]float64 `json:"confidence,omitempty"`
 }
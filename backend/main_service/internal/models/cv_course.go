@@ -11,6 +11,7 @@ type CVCourse struct {
 	CourseName   string     `json:"course_name" db:"course_name"`
 	Organization *string    `json:"organization,omitempty" db:"organization"`
 	FinishDate   *time.Time `json:"finish_date,omitempty" db:"finish_date"`
+	Provenance
 }
 
 // CVCourseRequest represents the request structure for creating/updating course records
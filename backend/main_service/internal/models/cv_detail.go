@@ -19,6 +19,11 @@ type CVDetail struct {
 	CVPath       *string    `json:"cv_path,omitempty" db:"cvpath"`
 	PortraitPath *string    `json:"portrait_path,omitempty" db:"portraitpath"`
 	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
+	// Provenance of the fields, by column name. Fields without an entry are empty or predate it.
+	Provenance map[string]Provenance `json:"provenance,omitempty" db:"provenance"`
+	// Short-lived presigned download URLs for CVPath and PortraitPath, which hold private object keys
+	CVURL       *string `json:"cv_url,omitempty" db:"-"`
+	PortraitURL *string `json:"portrait_url,omitempty" db:"-"`
 	// Related data (not stored in cv_details table but loaded separately)
 	Education []CVEducation `json:"education,omitempty" db:"-"`
 	Courses   []CVCourse    `json:"courses,omitempty" db:"-"`
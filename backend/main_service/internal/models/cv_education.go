@@ -8,6 +8,7 @@ type CVEducation struct {
 	Degree         *string `json:"degree,omitempty" db:"degree"`
 	Major          *string `json:"major,omitempty" db:"major"`
 	GraduationYear *int    `json:"graduation_year,omitempty" db:"graduation_year"`
+	Provenance
 }
 
 // CVEducationRequest represents the request structure for creating/updating education records
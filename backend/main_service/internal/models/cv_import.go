@@ -0,0 +1,22 @@
+package models
+
+// BulkCVImportResult represents the result of a bulk CV import, one result per manifest row
+type BulkCVImportResult struct {
+	TotalFiles      int              `json:"total_files"`
+	SuccessfulFiles int              `json:"successful_files"`
+	FailedFiles     int              `json:"failed_files"`
+	Results         []CVImportResult `json:"results"`
+}
+
+// CVImportResult represents the result of importing a single CV file. FileKey is set once the file is
+// attached to the user's CV, ParseJobID once its parsing is queued.
+type CVImportResult struct {
+	FileName     string `json:"file_name"`
+	EmployeeCode string `json:"employee_code"`
+	Email        string `json:"email"`
+	FullName     string `json:"full_name"`
+	FileKey      string `json:"file_key,omitempty"`
+	ParseJobID   string `json:"parse_job_id,omitempty"`
+	Success      bool   `json:"success"`
+	Error        string `json:"error,omitempty"`
+}
@@ -0,0 +1,102 @@
+package models
+
+import (
+	"time"
+)
+
+// States of a merge proposal, comparing parsed data with the stored CV
+const (
+	MergeNew       = "new"       // nothing stored yet
+	MergeChanged   = "changed"   // stored, but the parsed value differs
+	MergeUnchanged = "unchanged" // stored with the same value, or nothing was parsed
+)
+
+// ParsedCV is the CV data extracted by the AI service (its ResumeSchema)
+type ParsedCV struct {
+	FullName  string               `json:"full_name"`
+	JobTitle  string               `json:"job_title"`
+	Summary   string               `json:"summary"`
+	Birthday  string               `json:"birthday"`
+	Gender    string               `json:"gender"`
+	Email     string               `json:"email"`
+	Phone     string               `json:"phone"`
+	Address   string               `json:"address"`
+	Education []CVEducationRequest `json:"education"`
+	Courses   []CVCourseRequest    `json:"courses"`
+	Skills    []CVSkillRequest     `json:"skills"`
+	// Confidence of each field from 0 to 1, keyed by its JSON name, as the parser returned it
+	Confidence map[string]float64 `json:"confidence,omitempty"`
+}
+
+// CVMergePreviewRequest asks to compare parsed data with the caller's CV. The data is given
+// directly or through the succeeded parse job that produced it.
+type CVMergePreviewRequest struct {
+	ParseJobID string    `json:"parse_job_id" binding:"omitempty,uuid"`
+	Parsed     *ParsedCV `json:"parsed"`
+}
+
+// CVMergeApplyRequest applies the accepted proposals of a preview. BaseUpdatedAt is the one returned by
+// the preview; if the CV changed since, the proposals are stale and nothing is applied.
+type CVMergeApplyRequest struct {
+	CVMergePreviewRequest
+	BaseUpdatedAt *time.Time       `json:"base_updated_at"`
+	Accept        CVMergeSelection `json:"accept"`
+}
+
+// CVMergeSelection lists accepted proposals: field names and list item proposal IDs
+type CVMergeSelection struct {
+	Fields    []string `json:"fields"`
+	Education []string `json:"education"`
+	Courses   []string `json:"courses"`
+	Skills    []string `json:"skills"`
+}
+
+// CVMergePreview holds one proposal per parsed field and list item
+type CVMergePreview struct {
+	BaseUpdatedAt *time.Time          `json:"base_updated_at"` // nil when the caller has no CV yet
+	Fields        []FieldProposal     `json:"fields"`
+	Education     []EducationProposal `json:"education"`
+	Courses       []CourseProposal    `json:"courses"`
+	Skills        []SkillProposal     `json:"skills"`
+}
+
+// FieldProposal proposes a value for a CV field. Dates are formatted as YYYY-MM-DD. Confidence is the
+// parser's, when it gave one.
+type FieldProposal struct {
+	Field      string   `json:"field"`
+	Status     string   `json:"status"`
+	Current    *string  `json:"current"`
+	Proposed   *string  `json:"proposed"`
+	Confidence *float64 `json:"confidence,omitempty"`
+}
+
+// EducationProposal proposes a parsed education entry, paired with the stored entry it matches.
+// Parsed values only fill or replace stored ones; an empty parsed value keeps the stored one.
+type EducationProposal struct {
+	ID         string             `json:"id"`
+	Status     string             `json:"status"`
+	MatchScore float64            `json:"match_score,omitempty"`
+	Current    *CVEducation       `json:"current,omitempty"`
+	Proposed   CVEducationRequest `json:"proposed"`
+	Confidence *float64           `json:"confidence,omitempty"`
+}
+
+// CourseProposal proposes a parsed course, paired with the stored course it matches
+type CourseProposal struct {
+	ID         string          `json:"id"`
+	Status     string          `json:"status"`
+	MatchScore float64         `json:"match_score,omitempty"`
+	Current    *CVCourse       `json:"current,omitempty"`
+	Proposed   CVCourseRequest `json:"proposed"`
+	Confidence *float64        `json:"confidence,omitempty"`
+}
+
+// SkillProposal proposes a parsed skill, paired with the stored skill it matches
+type SkillProposal struct {
+	ID         string         `json:"id"`
+	Status     string         `json:"status"`
+	MatchScore float64        `json:"match_score,omitempty"`
+	Current    *CVSkill       `json:"current,omitempty"`
+	Proposed   CVSkillRequest `json:"proposed"`
+	Confidence *float64       `json:"confidence,omitempty"`
+}
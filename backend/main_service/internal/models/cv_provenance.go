@@ -0,0 +1,30 @@
+package models
+
+// Sources of CV data
+const (
+	SourceManual = "manual" // entered by the owner
+	SourceAI     = "ai"     // extracted from a CV file
+	SourceAdmin  = "admin"  // entered by an administrator
+)
+
+// Provenance tells where a CV value comes from and whether the owner verified it. Confidence is the
+// parser's confidence from 0 to 1, for AI-extracted values.
+type Provenance struct {
+	Source     string   `json:"source" db:"source"`
+	Verified   bool     `json:"verified" db:"verified"`
+	Confidence *float64 `json:"confidence,omitempty" db:"confidence"`
+}
+
+// CVVerification lists CV data by field name and list item ID
+type CVVerification struct {
+	Fields    []string `json:"fields"`
+	Education []string `json:"education"`
+	Courses   []string `json:"courses"`
+	Skills    []string `json:"skills"`
+}
+
+// CVVerifyRequest marks the listed fields and items of the caller's CV as verified, or all of it
+type CVVerifyRequest struct {
+	CVVerification
+	All bool `json:"all"`
+}
@@ -6,6 +6,7 @@ type CVSkill struct {
 	CVID        string  `json:"cv_id" db:"cv_id"`
 	SkillName   string  `json:"skill_name" db:"skill_name"`
 	Description *string `json:"description,omitempty" db:"description"`
+	Provenance
 }
 
 // CVSkillRequest represents the request structure for creating/updating skill records
@@ -4,4 +4,6 @@ package models
 type Department struct {
 	ID   string `json:"id" db:"id"`
 	Name string `json:"name" db:"name"`
+	// ManagerID is the user leading the department, if any
+	ManagerID *string `json:"manager_id,omitempty" db:"manager_id"`
 }
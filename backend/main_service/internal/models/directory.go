@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+)
+
+// DirectorySyncResult represents the outcome of a directory (LDAP / AD) synchronisation run
+type DirectorySyncResult struct {
+	StartedAt    time.Time `json:"started_at"`
+	FinishedAt   time.Time `json:"finished_at"`
+	TotalEntries int       `json:"total_entries"`
+	Created      int       `json:"created"`
+	Updated      int       `json:"updated"`
+	Deactivated  int       `json:"deactivated"`
+	Skipped      int       `json:"skipped"`
+	Errors       []string  `json:"errors,omitempty"`
+}
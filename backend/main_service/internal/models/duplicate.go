@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+)
+
+// DuplicateCandidate is a pair of users that are likely the same person, waiting for an Admin to
+// merge or dismiss it. Score goes from 0 to 1; Reasons lists the signals behind it.
+type DuplicateCandidate struct {
+	ID         string            `json:"id"`
+	UserA      DuplicateUser     `json:"user_a"`
+	UserB      DuplicateUser     `json:"user_b"`
+	Score      float64           `json:"score"`
+	Reasons    []DuplicateReason `json:"reasons"`
+	Status     string            `json:"status"`
+	DetectedAt time.Time         `json:"detected_at"`
+	ResolvedBy *string           `json:"resolved_by,omitempty"`
+	ResolvedAt *time.Time        `json:"resolved_at,omitempty"`
+}
+
+// DuplicateUser is one side of a duplicate pair
+type DuplicateUser struct {
+	ID           string     `json:"id"`
+	EmployeeCode string     `json:"employee_code"`
+	FullName     string     `json:"full_name"`
+	Email        string     `json:"email"`
+	Deactivated  bool       `json:"deactivated"`
+	CreatedAt    *time.Time `json:"created_at,omitempty"`
+}
+
+// DuplicateReason is a signal that two users are the same person, with how much it weighs in the score
+type DuplicateReason struct {
+	Signal     string  `json:"signal"` // employee_code, phone, name, birthday or cv_content
+	Similarity float64 `json:"similarity"`
+	Weight     float64 `json:"weight"`
+}
+
+// DuplicateScanResult summarises a duplicate scan
+type DuplicateScanResult struct {
+	Users   int `json:"users"`   // active users compared
+	Flagged int `json:"flagged"` // pending pairs after the scan
+	New     int `json:"new"`     // pairs flagged for the first time
+}
+
+// DuplicateMergeRequest names the user of a pair that survives the merge
+type DuplicateMergeRequest struct {
+	KeepUserID string `json:"keep_user_id" binding:"required,uuid"`
+}
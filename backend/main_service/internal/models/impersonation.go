@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+)
+
+// ImpersonationSession represents an Admin acting as another user ("view as user")
+type ImpersonationSession struct {
+	ID             string     `json:"id" db:"id"`
+	ImpersonatorID string     `json:"impersonator_id" db:"impersonator_id"`
+	Impersonator   string     `json:"impersonator_name" db:"-"`
+	UserID         string     `json:"user_id" db:"user_id"`
+	UserName       string     `json:"user_name" db:"-"`
+	Reason         string     `json:"reason" db:"reason"`
+	StartedAt      time.Time  `json:"started_at" db:"started_at"`
+	ExpiresAt      time.Time  `json:"expires_at" db:"expires_at"`
+	EndedAt        *time.Time `json:"ended_at,omitempty" db:"ended_at"`
+	RequestCount   int        `json:"request_count" db:"-"`
+}
+
+// ImpersonationRequest represents one request made with an impersonation token
+type ImpersonationRequest struct {
+	Method     string    `json:"method" db:"method"`
+	Path       string    `json:"path" db:"path"`
+	StatusCode int       `json:"status_code" db:"status_code"`
+	IP         string    `json:"ip" db:"ip"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+}
+
+// StartImpersonationRequest represents the data needed to start impersonating a user
+type StartImpersonationRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
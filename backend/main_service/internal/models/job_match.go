@@ -0,0 +1,67 @@
+package models
+
+import (
+	"time"
+)
+
+// JobMatchRequest describes a role to staff: structured requirements, or a free-text job description
+// that is reduced to them. Structured requirements given alongside the description take precedence.
+type JobMatchRequest struct {
+	MustHave    []string `json:"must_have"`
+	NiceToHave  []string `json:"nice_to_have"`
+	Degree      string   `json:"degree"` // minimum degree, e.g. "Bachelor" or "Thạc sĩ"
+	MinYears    int      `json:"min_years" binding:"min=0,max=50"`
+	Description string   `json:"description"`
+	Limit       int      `json:"limit" binding:"min=0,max=500"`
+}
+
+// JobProfile is the requirement profile the CVs were scored against, after reducing the description
+type JobProfile struct {
+	MustHave   []string `json:"must_have"`
+	NiceToHave []string `json:"nice_to_have"`
+	Degree     string   `json:"degree,omitempty"`
+	MinYears   int      `json:"min_years,omitempty"`
+}
+
+// JobMatchResult ranks the CVs the caller can see against the profile
+type JobMatchResult struct {
+	Profile JobProfile `json:"profile"`
+	Total   int        `json:"total"`
+	Matches []JobMatch `json:"matches"`
+}
+
+// JobMatch is the score of one CV from 0 to 100, with what it is made of. Breakdown holds the score
+// of each criterion from 0 to 1; criteria the profile doesn't ask for are left out.
+type JobMatch struct {
+	UserID            string             `json:"user_id"`
+	EmployeeCode      string             `json:"employee_code"`
+	FullName          string             `json:"full_name"`
+	JobTitle          string             `json:"job_title"`
+	Department        string             `json:"department,omitempty"`
+	Score             float64            `json:"score"`
+	Breakdown         map[string]float64 `json:"breakdown"`
+	MatchedSkills     []SkillMatch       `json:"matched_skills"`
+	MissingSkills     []string           `json:"missing_skills"`
+	MissingNiceToHave []string           `json:"missing_nice_to_have"`
+	Degree            string             `json:"degree,omitempty"` // highest degree in the CV
+	ExperienceYears   *int               `json:"experience_years,omitempty"`
+	LastUpdatedAt     *time.Time         `json:"last_updated_at,omitempty"`
+	FreshnessDays     *int               `json:"freshness_days,omitempty"` // days since last_updated_at
+	Availability      Availability       `json:"availability"`
+}
+
+// SkillMatch pairs a required skill with the CV skill that covers it
+type SkillMatch struct {
+	Required   string  `json:"required"`
+	Skill      string  `json:"skill"`
+	MustHave   bool    `json:"must_have"`
+	Similarity float64 `json:"similarity"`
+}
+
+// Availability tells whether the employee is free, from their current project memberships.
+// AvailableFrom is set when every current membership has an end date.
+type Availability struct {
+	Available       bool       `json:"available"`
+	CurrentProjects []string   `json:"current_projects"`
+	AvailableFrom   *time.Time `json:"available_from,omitempty"`
+}
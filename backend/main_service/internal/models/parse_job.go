@@ -0,0 +1,33 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// States of a parse job
+const (
+	ParseJobQueued    = "queued"
+	ParseJobRunning   = "running"
+	ParseJobSucceeded = "succeeded"
+	ParseJobFailed    = "failed"
+)
+
+// ParseJob represents a CV parsing request processed in the background.
+// Result holds the AI service response once the job succeeded. Jobs of a bulk import also fill the
+// CV of CVUserID with the result.
+type ParseJob struct {
+	ID          string          `json:"id" db:"id"`
+	OwnerID     string          `json:"owner_id" db:"owner_id"`
+	FilePath    string          `json:"file_path" db:"file_ref"`
+	CVUserID    *string         `json:"cv_user_id,omitempty" db:"cv_user_id"`
+	Status      string          `json:"status" db:"status"`
+	Attempts    int             `json:"attempts" db:"attempts"`
+	MaxAttempts int             `json:"max_attempts" db:"max_attempts"`
+	RunAfter    time.Time       `json:"run_after" db:"run_after"`
+	Result      json.RawMessage `json:"result,omitempty" db:"result"`
+	Error       *string         `json:"error,omitempty" db:"error"`
+	FinishedAt  *time.Time      `json:"finished_at,omitempty" db:"finished_at"`
+	CreatedAt   time.Time       `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at" db:"updated_at"`
+}
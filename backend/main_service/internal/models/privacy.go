@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+)
+
+// ErasureRequest represents a user's request to have their personal data erased
+type ErasureRequest struct {
+	ID             string     `json:"id" db:"id"`
+	UserID         string     `json:"user_id" db:"user_id"`
+	UserName       string     `json:"user_name,omitempty" db:"-"`
+	Reason         *string    `json:"reason,omitempty" db:"reason"`
+	Status         string     `json:"status" db:"status"`
+	ReviewedBy     *string    `json:"reviewed_by,omitempty" db:"reviewed_by"`
+	ReviewedAt     *time.Time `json:"reviewed_at,omitempty" db:"reviewed_at"`
+	ReviewNote     *string    `json:"review_note,omitempty" db:"review_note"`
+	PendingObjects []string   `json:"pending_objects,omitempty" db:"pending_objects"`
+	Error          *string    `json:"error,omitempty" db:"error"`
+	CompletedAt    *time.Time `json:"completed_at,omitempty" db:"completed_at"`
+	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
+}
+
+// ErasureRequestCreate represents the data sent by a user asking for erasure
+type ErasureRequestCreate struct {
+	Reason string `json:"reason"`
+}
+
+// ErasureReview represents an Admin's decision on an erasure request
+type ErasureReview struct {
+	Note string `json:"note"`
+}
+
+// DataExportManifest describes the content of a personal data export archive
+type DataExportManifest struct {
+	UserID      string    `json:"user_id"`
+	GeneratedAt time.Time `json:"generated_at"`
+	Files       []string  `json:"files"`
+	Errors      []string  `json:"errors,omitempty"`
+}
@@ -2,6 +2,21 @@ package models
 
 // Role represents a role in the system
 type Role struct {
-	ID   string `json:"id" db:"id"`
-	Name string `json:"name" db:"name"`
+	ID          string   `json:"id" db:"id"`
+	Name        string   `json:"name" db:"name"`
+	IsSystem    bool     `json:"is_system,omitempty" db:"is_system"`
+	Permissions []string `json:"permissions,omitempty" db:"-"`
+	UserCount   int      `json:"user_count,omitempty" db:"-"`
+}
+
+// Permission represents an action that can be granted to a role or an API key
+type Permission struct {
+	Name        string `json:"name" db:"name"`
+	Description string `json:"description" db:"description"`
+}
+
+// RoleRequest represents the data needed to create or update a role and its permission set
+type RoleRequest struct {
+	Name        string   `json:"name" binding:"required"`
+	Permissions []string `json:"permissions"`
 }
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"time"
+)
+
+// ServiceAccount represents a non-human account used by machine integrations
+type ServiceAccount struct {
+	ID          string     `json:"id" db:"id"`
+	Name        string     `json:"name" db:"name"`
+	Description *string    `json:"description,omitempty" db:"description"`
+	OwnerID     string     `json:"owner_id" db:"owner_id"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	DisabledAt  *time.Time `json:"disabled_at,omitempty" db:"disabled_at"`
+	Keys        []APIKey   `json:"keys,omitempty" db:"-"`
+}
+
+// APIKey represents a hashed API key belonging to a service account (the secret is never stored)
+type APIKey struct {
+	ID               string     `json:"id" db:"id"`
+	ServiceAccountID string     `json:"service_account_id" db:"service_account_id"`
+	Name             string     `json:"name" db:"name"`
+	KeyPrefix        string     `json:"key_prefix" db:"key_prefix"`
+	Scopes           []string   `json:"scopes" db:"scopes"`
+	AllowedIPs       []string   `json:"allowed_ips,omitempty" db:"allowed_ips"`
+	ExpiresAt        *time.Time `json:"expires_at,omitempty" db:"expires_at"`
+	LastUsedAt       *time.Time `json:"last_used_at,omitempty" db:"last_used_at"`
+	LastUsedIP       *string    `json:"last_used_ip,omitempty" db:"last_used_ip"`
+	RevokedAt        *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+	CreatedBy        string     `json:"created_by" db:"created_by"`
+	CreatedAt        time.Time  `json:"created_at" db:"created_at"`
+}
+
+// APIKeyUsage represents one recorded use of an API key
+type APIKeyUsage struct {
+	UsedAt     time.Time `json:"used_at" db:"used_at"`
+	IP         string    `json:"ip" db:"ip"`
+	Method     string    `json:"method" db:"method"`
+	Path       string    `json:"path" db:"path"`
+	StatusCode int       `json:"status_code" db:"status_code"`
+}
+
+// ServiceAccountCreateRequest represents the data needed to create a service account
+type ServiceAccountCreateRequest struct {
+	Name        string `json:"name" binding:"required"`
+	Description string `json:"description"`
+}
+
+// APIKeyCreateRequest represents the data needed to issue an API key
+type APIKeyCreateRequest struct {
+	Name       string   `json:"name" binding:"required"`
+	Scopes     []string `json:"scopes" binding:"required,min=1"`
+	AllowedIPs []string `json:"allowed_ips"`
+	ExpiresAt  string   `json:"expires_at,omitempty"` // RFC3339, optional
+}
+
+// APIKeyCreateResponse returns the plaintext key exactly once together with its metadata
+type APIKeyCreateResponse struct {
+	APIKey
+	Key string `json:"key"`
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"time"
+)
+
+// Redaction profiles of a share link
+const (
+	ShareProfileAnonymised = "anonymised"
+	ShareProfileFull       = "full"
+)
+
+// ShareLink represents an expiring, revocable link to snapshots of one or more CVs (the token is never stored)
+type ShareLink struct {
+	ID           string     `json:"id" db:"id"`
+	Profile      string     `json:"profile" db:"profile"`
+	UserIDs      []string   `json:"user_ids" db:"-"`
+	ExpiresAt    time.Time  `json:"expires_at" db:"expires_at"`
+	RevokedAt    *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+	ViewCount    int        `json:"view_count" db:"view_count"`
+	LastViewedAt *time.Time `json:"last_viewed_at,omitempty" db:"last_viewed_at"`
+	CreatedBy    string     `json:"created_by" db:"created_by"`
+	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
+}
+
+// ShareLinkCreateRequest represents the data needed to share CVs
+type ShareLinkCreateRequest struct {
+	UserIDs        []string `json:"user_ids" binding:"required,min=1,max=50,dive,uuid"`
+	Profile        string   `json:"profile" binding:"required,oneof=anonymised full"`
+	ExpiresInHours int      `json:"expires_in_hours" binding:"omitempty,min=1"` // default 7 days, at most 30 days
+}
+
+// ShareLinkCreateResponse returns the plaintext token exactly once together with the link
+type ShareLinkCreateResponse struct {
+	ShareLink
+	Token string `json:"token"`
+	Path  string `json:"path"`
+}
+
+// SharedCV is the snapshot of a CV served through a share link
+type SharedCV struct {
+	FullName     string        `json:"full_name"`
+	JobTitle     string        `json:"job_title"`
+	Summary      string        `json:"summary"`
+	Birthday     *time.Time    `json:"birthday,omitempty"`
+	Gender       *string       `json:"gender,omitempty"`
+	Email        *string       `json:"email,omitempty"`
+	Phone        *string       `json:"phone,omitempty"`
+	Address      *string       `json:"address,omitempty"`
+	PortraitPath *string       `json:"portrait_path,omitempty"`
+	CVPath       *string       `json:"cv_path,omitempty"`
+	PortraitURL  *string       `json:"portrait_url,omitempty"` // presigned when served, never stored
+	CVURL        *string       `json:"cv_url,omitempty"`       // presigned when served, never stored
+	Education    []CVEducation `json:"education,omitempty"`
+	Courses      []CVCourse    `json:"courses,omitempty"`
+	Skills       []CVSkill     `json:"skills,omitempty"`
+}
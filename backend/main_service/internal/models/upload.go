@@ -0,0 +1,28 @@
+package models
+
+// Upload statuses, see the uploads table
+const (
+	UploadPending    = "pending"
+	UploadAttached   = "attached"
+	UploadSuperseded = "superseded"
+	UploadDeleted    = "deleted"
+)
+
+// UploadGCItem is one orphaned upload considered by the garbage collector
+type UploadGCItem struct {
+	Key    string `json:"key"`
+	Status string `json:"status"`
+	Size   int64  `json:"size"`
+	// deleted, would_delete (dry run), referenced (still used by a share link) or error
+	Action string `json:"action"`
+	Error  string `json:"error,omitempty"`
+}
+
+// UploadGCReport summarises one garbage collection run
+type UploadGCReport struct {
+	DryRun     bool           `json:"dry_run"`
+	Grace      string         `json:"grace"`
+	Items      []UploadGCItem `json:"items"`
+	Deleted    int            `json:"deleted"`
+	FreedBytes int64          `json:"freed_bytes"`
+}
@@ -6,16 +6,17 @@ import (
 
 // User represents a user in the system
 type User struct {
-	ID           string     `json:"id" db:"id"`
-	EmployeeCode string     `json:"employee_code" db:"employee_code"`
-	FullName     string     `json:"full_name" db:"full_name"`
-	Email        string     `json:"email" db:"email"`
-	Password     string     `json:"-" db:"password"` // Not returned in JSON responses
-	DepartmentID string     `json:"department_id,omitempty" db:"department_id"`
-	Department   Department `json:"department,omitempty" db:"-"`
-	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
-	Roles        []Role     `json:"roles,omitempty" db:"-"`
-	Projects     []string   `json:"projects,omitempty" db:"-"` // List of project names
+	ID            string     `json:"id" db:"id"`
+	EmployeeCode  string     `json:"employee_code" db:"employee_code"`
+	FullName      string     `json:"full_name" db:"full_name"`
+	Email         string     `json:"email" db:"email"`
+	Password      string     `json:"-" db:"password"` // Not returned in JSON responses
+	DepartmentID  string     `json:"department_id,omitempty" db:"department_id"`
+	Department    Department `json:"department,omitempty" db:"-"`
+	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
+	DeactivatedAt *time.Time `json:"deactivated_at,omitempty" db:"deactivated_at"` // Set when the user is deleted (soft delete)
+	Roles         []Role     `json:"roles,omitempty" db:"-"`
+	Projects      []string   `json:"projects,omitempty" db:"-"` // List of project names
 }
 
 // UserLogin represents login credentials
@@ -0,0 +1,149 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// clamdChunkSize is the size of the INSTREAM chunks, well below clamd's default StreamMaxLength
+const clamdChunkSize = 64 << 10
+
+// Clamd scans files with a ClamAV daemon over its INSTREAM protocol. Each scan uses its own connection.
+type Clamd struct {
+	network string
+	address string
+	timeout time.Duration
+}
+
+// NewClamd creates a clamd scanner for an address like tcp://localhost:3310 or unix:///run/clamav/clamd.ctl.
+// An address without a scheme is treated as TCP.
+func NewClamd(address string, timeout time.Duration) (*Clamd, error) {
+	network, addr := "tcp", address
+	if scheme, rest, found := strings.Cut(address, "://"); found {
+		network, addr = scheme, rest
+	}
+	if network != "tcp" && network != "unix" {
+		return nil, fmt.Errorf("unsupported clamd address %q (expected tcp:// or unix://)", address)
+	}
+	if addr == "" {
+		return nil, fmt.Errorf("clamd address is empty")
+	}
+	return &Clamd{network: network, address: addr, timeout: timeout}, nil
+}
+
+// Name identifies the scanner in logs
+func (s *Clamd) Name() string {
+	return "clamd"
+}
+
+// Ping checks that the daemon is reachable
+func (s *Clamd) Ping(ctx context.Context) error {
+	reply, err := s.command(ctx, "zPING\x00", nil)
+	if err != nil {
+		return err
+	}
+	if reply != "PONG" {
+		return fmt.Errorf("unexpected clamd reply to PING: %q", reply)
+	}
+	return nil
+}
+
+// Scan streams the content to clamd and parses its verdict
+func (s *Clamd) Scan(ctx context.Context, r io.Reader) (Result, error) {
+	reply, err := s.command(ctx, "zINSTREAM\x00", r)
+	if err != nil {
+		return Result{}, err
+	}
+	return parseClamdReply(reply)
+}
+
+// command sends one null-terminated command, followed by the body as INSTREAM chunks when given,
+// and returns the reply without its terminator
+func (s *Clamd) command(ctx context.Context, command string, body io.Reader) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, s.network, s.address)
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to clamd: %w", err)
+	}
+	defer conn.Close()
+
+	deadline, _ := ctx.Deadline()
+	if err := conn.SetDeadline(deadline); err != nil {
+		return "", fmt.Errorf("failed to set clamd deadline: %w", err)
+	}
+
+	if _, err := io.WriteString(conn, command); err != nil {
+		return "", fmt.Errorf("failed to send clamd command: %w", err)
+	}
+	if body != nil {
+		if err := writeChunks(conn, body); err != nil {
+			return "", err
+		}
+	}
+
+	reply, err := bufio.NewReader(conn).ReadBytes(0)
+	if err != nil && !(err == io.EOF && len(reply) > 0) {
+		return "", fmt.Errorf("failed to read clamd reply: %w", err)
+	}
+	return string(bytes.TrimRight(reply, "\x00\n")), nil
+}
+
+// writeChunks sends the body as length-prefixed chunks (4-byte big-endian size) ended by a zero-length chunk
+func writeChunks(w io.Writer, body io.Reader) error {
+	buf := make([]byte, clamdChunkSize)
+	size := make([]byte, 4)
+	for {
+		n, err := io.ReadFull(body, buf)
+		if n > 0 {
+			binary.BigEndian.PutUint32(size, uint32(n))
+			if _, werr := w.Write(size); werr != nil {
+				return fmt.Errorf("failed to stream file to clamd: %w", werr)
+			}
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				return fmt.Errorf("failed to stream file to clamd: %w", werr)
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read file for scanning: %w", err)
+		}
+	}
+
+	binary.BigEndian.PutUint32(size, 0)
+	if _, err := w.Write(size); err != nil {
+		return fmt.Errorf("failed to stream file to clamd: %w", err)
+	}
+	return nil
+}
+
+// parseClamdReply understands "stream: OK", "stream: <signature> FOUND" and "<message> ERROR"
+func parseClamdReply(reply string) (Result, error) {
+	// Replies to a z-command may be prefixed with a session id like "1: "
+	message := strings.TrimSpace(reply)
+	if _, rest, found := strings.Cut(message, "stream: "); found {
+		message = rest
+	}
+
+	switch {
+	case message == "OK":
+		return Result{}, nil
+	case strings.HasSuffix(message, " FOUND"):
+		return Result{Infected: true, Signature: strings.TrimSuffix(message, " FOUND")}, nil
+	case strings.HasSuffix(message, " ERROR"):
+		return Result{}, fmt.Errorf("clamd error: %s", strings.TrimSuffix(message, " ERROR"))
+	default:
+		return Result{}, fmt.Errorf("unexpected clamd reply: %q", reply)
+	}
+}
@@ -0,0 +1,172 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// eicar is the standard antivirus test file
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// clamdStub speaks enough of the clamd protocol for the scanner: zPING and zINSTREAM.
+// reply decides the answer to a stream from its content; a nil reply never answers.
+type clamdStub struct {
+	address string
+	reply   func(content []byte) []byte
+	// streamed is the content of the last INSTREAM
+	streamed chan []byte
+}
+
+func startClamdStub(t *testing.T, reply func(content []byte) []byte) *clamdStub {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("starting clamd stub: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	stub := &clamdStub{address: "tcp://" + listener.Addr().String(), reply: reply, streamed: make(chan []byte, 1)}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go stub.serve(conn)
+		}
+	}()
+	return stub
+}
+
+func (s *clamdStub) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	command, err := reader.ReadString(0)
+	if err != nil {
+		return
+	}
+
+	switch command {
+	case "zPING\x00":
+		conn.Write([]byte("PONG\x00"))
+	case "zINSTREAM\x00":
+		var content bytes.Buffer
+		size := make([]byte, 4)
+		for {
+			if _, err := io.ReadFull(reader, size); err != nil {
+				return
+			}
+			n := binary.BigEndian.Uint32(size)
+			if n == 0 {
+				break
+			}
+			if _, err := io.CopyN(&content, reader, int64(n)); err != nil {
+				return
+			}
+		}
+		s.streamed <- content.Bytes()
+		if s.reply == nil {
+			// Hang until the client gives up
+			io.Copy(io.Discard, reader)
+			return
+		}
+		conn.Write(s.reply(content.Bytes()))
+	default:
+		conn.Write([]byte("UNKNOWN COMMAND\x00"))
+	}
+}
+
+// virusScan answers like clamd with the EICAR signature loaded
+func virusScan(content []byte) []byte {
+	if bytes.Contains(content, []byte(eicar)) {
+		return []byte("stream: Eicar-Test-Signature FOUND\x00")
+	}
+	return []byte("stream: OK\x00")
+}
+
+func newTestClamd(t *testing.T, address string, timeout time.Duration) *Clamd {
+	t.Helper()
+	clamd, err := NewClamd(address, timeout)
+	if err != nil {
+		t.Fatalf("creating clamd scanner: %v", err)
+	}
+	return clamd
+}
+
+func TestClamdPing(t *testing.T) {
+	stub := startClamdStub(t, virusScan)
+	if err := newTestClamd(t, stub.address, time.Second).Ping(context.Background()); err != nil {
+		t.Fatalf("ping: %v", err)
+	}
+}
+
+func TestClamdScanClean(t *testing.T) {
+	stub := startClamdStub(t, virusScan)
+	// Larger than one chunk, so the file is streamed in several
+	content := strings.Repeat("curriculum vitae ", clamdChunkSize/8)
+
+	result, err := newTestClamd(t, stub.address, time.Second).Scan(context.Background(), strings.NewReader(content))
+	if err != nil {
+		t.Fatalf("scan: %v", err)
+	}
+	if result.Infected {
+		t.Fatalf("clean file reported infected: %+v", result)
+	}
+	if streamed := <-stub.streamed; string(streamed) != content {
+		t.Fatalf("clamd received %d bytes, want the %d bytes of the file", len(streamed), len(content))
+	}
+}
+
+func TestClamdScanInfected(t *testing.T) {
+	stub := startClamdStub(t, virusScan)
+
+	result, err := newTestClamd(t, stub.address, time.Second).Scan(context.Background(), strings.NewReader(eicar))
+	if err != nil {
+		t.Fatalf("scan: %v", err)
+	}
+	if !result.Infected || result.Signature != "Eicar-Test-Signature" {
+		t.Fatalf("got %+v, want infected with Eicar-Test-Signature", result)
+	}
+}
+
+// The failures below must all return an error, so the upload is refused rather than stored unscanned
+func TestClamdScanFailsClosed(t *testing.T) {
+	refused, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("finding a free port: %v", err)
+	}
+	refusedAddress := "tcp://" + refused.Addr().String()
+	refused.Close()
+
+	for _, test := range []struct {
+		name    string
+		address func(t *testing.T) string
+	}{
+		{"error reply", func(t *testing.T) string {
+			return startClamdStub(t, func([]byte) []byte { return []byte("INSTREAM size limit exceeded. ERROR\x00") }).address
+		}},
+		{"unexpected reply", func(t *testing.T) string {
+			return startClamdStub(t, func([]byte) []byte { return []byte("stream: maybe\x00") }).address
+		}},
+		{"connection closed without reply", func(t *testing.T) string {
+			return startClamdStub(t, func([]byte) []byte { return nil }).address
+		}},
+		{"timeout", func(t *testing.T) string { return startClamdStub(t, nil).address }},
+		{"connection refused", func(*testing.T) string { return refusedAddress }},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			clamd := newTestClamd(t, test.address(t), 200*time.Millisecond)
+			result, err := clamd.Scan(context.Background(), strings.NewReader("curriculum vitae"))
+			if err == nil {
+				t.Fatalf("scan succeeded with %+v, want an error", result)
+			}
+		})
+	}
+}
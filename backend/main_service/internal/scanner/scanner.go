@@ -0,0 +1,83 @@
+// Package scanner checks uploaded files for malware before they are stored, behind one interface,
+// so the backend can run without a scanner in development and against clamd in production.
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// defaultTimeout bounds one scan when SCANNER_TIMEOUT is not set
+const defaultTimeout = 30 * time.Second
+
+// Result is the verdict of a scan. Signature names the threat found in an infected file.
+type Result struct {
+	Infected  bool
+	Signature string
+}
+
+// Scanner scans a file's content. An error means no verdict was reached, and the upload must be refused.
+type Scanner interface {
+	Scan(ctx context.Context, r io.Reader) (Result, error)
+	Name() string
+}
+
+// Default is the scanner chosen at startup by Init
+var Default Scanner = Noop{}
+
+// Init constructs the scanner selected by SCANNER (none or clamd, default none)
+func Init() error {
+	backend := getEnv("SCANNER", "none")
+
+	timeout := defaultTimeout
+	if value := os.Getenv("SCANNER_TIMEOUT"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			return fmt.Errorf("invalid SCANNER_TIMEOUT %q", value)
+		}
+		timeout = parsed
+	}
+
+	switch backend {
+	case "none":
+		Default = Noop{}
+	case "clamd":
+		clamd, err := NewClamd(getEnv("CLAMD_ADDRESS", "tcp://localhost:3310"), timeout)
+		if err != nil {
+			return err
+		}
+		Default = clamd
+		// Not fatal: the daemon may still be loading its signatures. Uploads are refused until it answers.
+		if err := clamd.Ping(context.Background()); err != nil {
+			fmt.Printf("Warning: clamd is not reachable yet: %v\n", err)
+		}
+	default:
+		return fmt.Errorf("unknown SCANNER %q (expected none or clamd)", backend)
+	}
+
+	fmt.Printf("Using %s malware scanner\n", Default.Name())
+	return nil
+}
+
+// Noop accepts every file. It is meant for development only.
+type Noop struct{}
+
+// Scan reads nothing and reports the file clean
+func (Noop) Scan(ctx context.Context, r io.Reader) (Result, error) {
+	return Result{}, nil
+}
+
+// Name identifies the scanner in logs
+func (Noop) Name() string {
+	return "none"
+}
+
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Folders of uploaded CV files. Stored object keys always start with one of them.
+const (
+	FolderCVPhotos    = "cv-photos"
+	FolderCVDocuments = "cv-documents"
+)
+
+// NewKey returns a unique key in the folder with the extension of the content type.
+// The client's filename is not used: it says nothing about the content.
+func NewKey(folder, contentType string) string {
+	return path.Join(folder, uuid.New().String()+extensionFor(contentType))
+}
+
+// NewAssetPrefix returns a unique prefix in the folder grouping the renditions of one uploaded image
+func NewAssetPrefix(folder string) string {
+	return path.Join(folder, uuid.New().String())
+}
+
+// RenditionKey returns the key of a rendition of the asset, e.g. cv-photos/<id>/card.webp
+func RenditionKey(assetPrefix, name, contentType string) string {
+	return path.Join(assetPrefix, name+extensionFor(contentType))
+}
+
+func extensionFor(contentType string) string {
+	switch contentType {
+	case "image/jpeg":
+		return ".jpg"
+	case "image/png":
+		return ".png"
+	case "image/gif":
+		return ".gif"
+	case "image/webp":
+		return ".webp"
+	case "application/pdf":
+		return ".pdf"
+	case "application/vnd.openxmlformats-officedocument.wordprocessingml.document":
+		return ".docx"
+	case "application/vnd.oasis.opendocument.text":
+		return ".odt"
+	default:
+		return ""
+	}
+}
+
+// ContentType determines the content type based on file extension
+func ContentType(filename string) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".jpg", ".jpeg":
+		return "image/jpeg"
+	case ".png":
+		return "image/png"
+	case ".gif":
+		return "image/gif"
+	case ".webp":
+		return "image/webp"
+	case ".pdf":
+		return "application/pdf"
+	case ".docx":
+		return "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+	case ".odt":
+		return "application/vnd.oasis.opendocument.text"
+	default:
+		return "application/octet-stream"
+	}
+}
+
+// KeyFromRef returns the object key of a stored file reference. Besides keys, it understands
+// the public URLs stored before storage became private and the presigned URLs handed out since.
+// "" means the reference is not understood.
+func KeyFromRef(fileRef string) string {
+	if !strings.HasPrefix(fileRef, "http://") && !strings.HasPrefix(fileRef, "https://") {
+		return strings.TrimPrefix(fileRef, "/")
+	}
+
+	parsed, err := url.Parse(fileRef)
+	if err != nil {
+		return ""
+	}
+	key := strings.TrimPrefix(parsed.Path, "/")
+	// Presigned URLs of the local backend are served by the API
+	key = strings.TrimPrefix(key, strings.TrimPrefix(localFilesPath, "/"))
+	// Path-style S3 URLs start with the bucket
+	if !IsCVFileKey(key) {
+		if _, rest, found := strings.Cut(key, "/"); found {
+			key = rest
+		}
+	}
+	return key
+}
+
+// IsCVFileKey checks that the key points to an uploaded CV photo or document
+func IsCVFileKey(key string) bool {
+	if !validKey(key) {
+		return false
+	}
+	return strings.HasPrefix(key, FolderCVPhotos+"/") || strings.HasPrefix(key, FolderCVDocuments+"/")
+}
+
+// validKey rejects keys that could escape the storage root
+func validKey(key string) bool {
+	return key != "" && !strings.HasPrefix(key, "/") && path.Clean(key) == key && !strings.HasPrefix(key, "..")
+}
+
+func checkKey(key string) error {
+	if !validKey(key) {
+		return fmt.Errorf("invalid object key %q", key)
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// localFilesPath is the API route that serves presigned local files (see handlers.ServeLocalFile)
+const localFilesPath = "/api/files/"
+
+// LocalConfig holds the configuration of the local disk backend
+type LocalConfig struct {
+	Dir     string // root directory of the objects
+	BaseURL string // public URL of this API, used in presigned URLs
+	Secret  string // key signing the presigned URLs
+}
+
+// Local stores objects as files under a directory. Presigned URLs point to the API itself and
+// carry an HMAC signature over the key and expiry, checked by Verify.
+type Local struct {
+	dir     string
+	baseURL string
+	secret  []byte
+}
+
+// NewLocal creates the local disk backend, creating the directory if needed
+func NewLocal(config LocalConfig) (*Local, error) {
+	if config.Secret == "" {
+		return nil, fmt.Errorf("missing signing secret (STORAGE_SIGNING_SECRET or JWT_SECRET)")
+	}
+	if err := os.MkdirAll(config.Dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %w", err)
+	}
+
+	return &Local{
+		dir:     config.Dir,
+		baseURL: strings.TrimSuffix(config.BaseURL, "/"),
+		secret:  []byte(config.Secret),
+	}, nil
+}
+
+func (l *Local) path(key string) (string, error) {
+	if err := checkKey(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(l.dir, filepath.FromSlash(key)), nil
+}
+
+// Put writes the object to a temporary file first, so readers never see a partial object
+func (l *Local) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return fmt.Errorf("failed to create folder: %w", err)
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := io.Copy(file, body); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+
+	if err := os.Rename(file.Name(), path); err != nil {
+		return fmt.Errorf("failed to store file: %w", err)
+	}
+	return nil
+}
+
+func (l *Local) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	return file, nil
+}
+
+// Delete removes the object. Deleting a missing object is not an error, as with S3.
+func (l *Local) Delete(ctx context.Context, key string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to delete file: %w", err)
+	}
+	return nil
+}
+
+func (l *Local) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	path, err := l.path(key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return ObjectInfo{}, ErrNotFound
+	}
+	if err != nil {
+		return ObjectInfo{}, fmt.Errorf("failed to stat file: %w", err)
+	}
+
+	return ObjectInfo{
+		Key:         key,
+		Size:        info.Size(),
+		ContentType: ContentType(key),
+		ModifiedAt:  info.ModTime(),
+	}, nil
+}
+
+func (l *Local) PresignGet(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	if err := checkKey(key); err != nil {
+		return "", err
+	}
+
+	expires := strconv.FormatInt(time.Now().Add(ttl).Unix(), 10)
+	query := url.Values{"expires": {expires}, "signature": {l.sign(key, expires)}}
+	return l.baseURL + localFilesPath + key + "?" + query.Encode(), nil
+}
+
+// Verify checks the signature and expiry of a presigned URL
+func (l *Local) Verify(key, expires, signature string) error {
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid expiry")
+	}
+	if !hmac.Equal([]byte(l.sign(key, expires)), []byte(signature)) {
+		return fmt.Errorf("invalid signature")
+	}
+	if time.Now().Unix() > expiresAt {
+		return fmt.Errorf("URL expired")
+	}
+	return nil
+}
+
+func (l *Local) sign(key, expires string) string {
+	mac := hmac.New(sha256.New, l.secret)
+	mac.Write([]byte(key + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
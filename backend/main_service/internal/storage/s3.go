@@ -0,0 +1,178 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// S3Config holds the configuration of an S3-compatible backend (AWS, MinIO, ...)
+type S3Config struct {
+	Endpoint       string // empty for AWS itself
+	Region         string
+	Bucket         string
+	AccessKey      string
+	SecretKey      string
+	ForcePathStyle bool // MinIO and most self-hosted services need path-style URLs
+}
+
+// SpacesConfig holds the configuration for Digital Ocean Spaces
+type SpacesConfig struct {
+	Endpoint  string // e.g. https://sgp1.digitaloceanspaces.com
+	Region    string // derived from the endpoint when empty
+	Bucket    string
+	AccessKey string
+	SecretKey string
+}
+
+// S3 stores objects privately in an S3-compatible bucket
+type S3 struct {
+	client   *s3.S3
+	uploader *s3manager.Uploader
+	bucket   string
+}
+
+// NewS3 creates a backend for a generic S3-compatible service
+func NewS3(config S3Config) (*S3, error) {
+	if config.Bucket == "" || config.AccessKey == "" || config.SecretKey == "" {
+		return nil, fmt.Errorf("missing required S3 configuration (bucket, access key, secret key)")
+	}
+
+	awsConfig := &aws.Config{
+		Credentials:      credentials.NewStaticCredentials(config.AccessKey, config.SecretKey, ""),
+		Region:           aws.String(config.Region),
+		S3ForcePathStyle: aws.Bool(config.ForcePathStyle),
+	}
+	if config.Endpoint != "" {
+		awsConfig.Endpoint = aws.String(config.Endpoint)
+	}
+
+	sess, err := session.NewSession(awsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+
+	client := s3.New(sess)
+	return &S3{
+		client:   client,
+		uploader: s3manager.NewUploaderWithClient(client),
+		bucket:   config.Bucket,
+	}, nil
+}
+
+// NewSpaces creates a backend for Digital Ocean Spaces, which is S3 with virtual-hosted buckets
+func NewSpaces(config SpacesConfig) (*S3, error) {
+	if config.Endpoint == "" {
+		return nil, fmt.Errorf("missing required Digital Ocean Spaces configuration (endpoint)")
+	}
+
+	region := config.Region
+	if region == "" {
+		// https://sgp1.digitaloceanspaces.com -> sgp1
+		if parsed, err := url.Parse(config.Endpoint); err == nil {
+			region, _, _ = strings.Cut(parsed.Host, ".")
+		}
+	}
+
+	return NewS3(S3Config{
+		Endpoint:  config.Endpoint,
+		Region:    region,
+		Bucket:    config.Bucket,
+		AccessKey: config.AccessKey,
+		SecretKey: config.SecretKey,
+	})
+}
+
+func (s *S3) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+
+	_, err := s.uploader.UploadWithContext(ctx, &s3manager.UploadInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		Body:        body,
+		ContentType: aws.String(contentType),
+		ACL:         aws.String("private"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload object: %w", err)
+	}
+	return nil
+}
+
+func (s *S3) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	output, err := s.client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, s3Error("download", err)
+	}
+	return output.Body, nil
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	_, err := s.client.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return s3Error("delete", err)
+	}
+	return nil
+}
+
+func (s *S3) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	output, err := s.client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return ObjectInfo{}, s3Error("stat", err)
+	}
+
+	return ObjectInfo{
+		Key:         key,
+		Size:        aws.Int64Value(output.ContentLength),
+		ContentType: aws.StringValue(output.ContentType),
+		ModifiedAt:  aws.TimeValue(output.LastModified),
+	}, nil
+}
+
+func (s *S3) PresignGet(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	if err := checkKey(key); err != nil {
+		return "", err
+	}
+
+	request, _ := s.client.GetObjectRequest(&s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	presignedURL, err := request.Presign(ttl)
+	if err != nil {
+		return "", fmt.Errorf("failed to presign object: %w", err)
+	}
+	return presignedURL, nil
+}
+
+// s3Error maps a missing object to ErrNotFound
+func s3Error(operation string, err error) error {
+	var failure awserr.RequestFailure
+	if errors.As(err, &failure) && failure.StatusCode() == http.StatusNotFound {
+		return ErrNotFound
+	}
+	return fmt.Errorf("failed to %s object: %w", operation, err)
+}
@@ -0,0 +1,119 @@
+// Package storage keeps uploaded files (CV documents, portraits) behind one interface, so the
+// backend can run on local disk, a generic S3-compatible service (MinIO) or Digital Ocean Spaces.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+)
+
+// ErrNotFound is returned when an object does not exist
+var ErrNotFound = errors.New("object not found")
+
+// defaultPresignTTL is how long a presigned download URL stays valid when STORAGE_PRESIGN_TTL is not set
+const defaultPresignTTL = 15 * time.Minute
+
+// ObjectInfo describes a stored object
+type ObjectInfo struct {
+	Key         string
+	Size        int64
+	ContentType string
+	ModifiedAt  time.Time
+}
+
+// Storage stores private objects by key. Objects are only readable by others through presigned URLs.
+type Storage interface {
+	Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+	Stat(ctx context.Context, key string) (ObjectInfo, error)
+	PresignGet(ctx context.Context, key string, ttl time.Duration) (string, error)
+}
+
+// Store is the storage backend chosen at startup by Init
+var Store Storage
+
+// Init constructs the backend selected by STORAGE_BACKEND (local, s3 or spaces).
+// Without STORAGE_BACKEND, Spaces is used when DO_SPACES_BUCKET is set and local disk otherwise.
+func Init() error {
+	backend := os.Getenv("STORAGE_BACKEND")
+	if backend == "" {
+		backend = "local"
+		if os.Getenv("DO_SPACES_BUCKET") != "" {
+			backend = "spaces"
+		}
+	}
+
+	var err error
+	switch backend {
+	case "local":
+		Store, err = NewLocal(LocalConfig{
+			Dir:     getEnv("STORAGE_LOCAL_DIR", "./uploads"),
+			BaseURL: getEnv("STORAGE_PUBLIC_URL", "http://localhost:"+getEnv("SERVER_PORT", "8080")),
+			Secret:  getEnv("STORAGE_SIGNING_SECRET", os.Getenv("JWT_SECRET")),
+		})
+	case "s3":
+		forcePathStyle, _ := strconv.ParseBool(getEnv("S3_FORCE_PATH_STYLE", "true"))
+		Store, err = NewS3(S3Config{
+			Endpoint:       os.Getenv("S3_ENDPOINT"),
+			Region:         getEnv("S3_REGION", "us-east-1"),
+			Bucket:         os.Getenv("S3_BUCKET"),
+			AccessKey:      os.Getenv("S3_ACCESS_KEY"),
+			SecretKey:      os.Getenv("S3_SECRET_KEY"),
+			ForcePathStyle: forcePathStyle,
+		})
+	case "spaces":
+		Store, err = NewSpaces(SpacesConfig{
+			Endpoint:  os.Getenv("DO_SPACES_ENDPOINT"),
+			Region:    os.Getenv("DO_SPACES_REGION"),
+			Bucket:    os.Getenv("DO_SPACES_BUCKET"),
+			AccessKey: os.Getenv("DO_SPACES_KEY"),
+			SecretKey: os.Getenv("DO_SPACES_SECRET"),
+		})
+	default:
+		return fmt.Errorf("unknown STORAGE_BACKEND %q (expected local, s3 or spaces)", backend)
+	}
+	if err != nil {
+		return fmt.Errorf("error initializing %s storage: %w", backend, err)
+	}
+
+	fmt.Printf("Using %s file storage\n", backend)
+	return nil
+}
+
+// PresignTTL returns the lifetime of presigned download URLs from STORAGE_PRESIGN_TTL (default 15m)
+func PresignTTL() time.Duration {
+	if value := os.Getenv("STORAGE_PRESIGN_TTL"); value != "" {
+		if ttl, err := time.ParseDuration(value); err == nil && ttl > 0 {
+			return ttl
+		}
+	}
+	return defaultPresignTTL
+}
+
+// ReadAll downloads a whole object
+func ReadAll(ctx context.Context, key string) ([]byte, error) {
+	body, err := Store.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object %s: %w", key, err)
+	}
+	return data, nil
+}
+
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,102 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// APIKeyPrefix marks a credential as a service account API key rather than a JWT
+const APIKeyPrefix = "cvm_"
+
+// GenerateAPIKey creates a new API key and returns the full key (shown once), its lookup prefix and its hash.
+// Keys look like cvm_<prefix>_<secret>; only the prefix and the SHA-256 hash are stored.
+func GenerateAPIKey() (key string, prefix string, hash string, err error) {
+	prefixBytes := make([]byte, 6)
+	if _, err := rand.Read(prefixBytes); err != nil {
+		return "", "", "", fmt.Errorf("failed to generate key prefix: %w", err)
+	}
+
+	secretBytes := make([]byte, 32)
+	if _, err := rand.Read(secretBytes); err != nil {
+		return "", "", "", fmt.Errorf("failed to generate key secret: %w", err)
+	}
+
+	prefix = hex.EncodeToString(prefixBytes)
+	key = APIKeyPrefix + prefix + "_" + hex.EncodeToString(secretBytes)
+	return key, prefix, HashAPIKey(key), nil
+}
+
+// IsAPIKey checks whether a credential has the API key format
+func IsAPIKey(credential string) bool {
+	return strings.HasPrefix(credential, APIKeyPrefix)
+}
+
+// ParseAPIKeyPrefix extracts the lookup prefix from an API key
+func ParseAPIKeyPrefix(key string) (string, bool) {
+	if !IsAPIKey(key) {
+		return "", false
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(key, APIKeyPrefix), "_", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", false
+	}
+
+	return parts[0], true
+}
+
+// HashAPIKey returns the hex encoded SHA-256 hash of an API key.
+// Keys carry 256 bits of randomness, so a fast hash is sufficient (unlike passwords).
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// CheckAPIKeyHash compares an API key with its stored hash in constant time
+func CheckAPIKeyHash(key, hash string) bool {
+	return subtle.ConstantTimeCompare([]byte(HashAPIKey(key)), []byte(hash)) == 1
+}
+
+// ValidateIPAllowList checks that every entry is an IP address or a CIDR range
+func ValidateIPAllowList(entries []string) error {
+	for _, entry := range entries {
+		if net.ParseIP(entry) != nil {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(entry); err != nil {
+			return fmt.Errorf("invalid IP address or CIDR range: %s", entry)
+		}
+	}
+	return nil
+}
+
+// IPAllowed checks if the IP matches the allow-list. An empty allow-list allows every IP.
+func IPAllowed(ip string, allowList []string) bool {
+	if len(allowList) == 0 {
+		return true
+	}
+
+	parsedIP := net.ParseIP(ip)
+	if parsedIP == nil {
+		return false
+	}
+
+	for _, entry := range allowList {
+		if allowedIP := net.ParseIP(entry); allowedIP != nil {
+			if allowedIP.Equal(parsedIP) {
+				return true
+			}
+			continue
+		}
+		if _, network, err := net.ParseCIDR(entry); err == nil && network.Contains(parsedIP) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -21,10 +21,17 @@ const TokenExpiration = time.Hour * 24 // 24 hours
 // RefreshTokenExpiration defines how long a refresh token is valid
 const RefreshTokenExpiration = time.Hour * 24 * 7 // 7 days
 
+// ImpersonationTokenExpiration defines how long an impersonation token is valid
+const ImpersonationTokenExpiration = time.Minute * 15
+
 // Claims represents the JWT claims
 type Claims struct {
 	UserID string   `json:"user_id"`
 	Roles  []string `json:"roles"`
+	// ImpersonatorID and ImpersonationID are only set on impersonation tokens:
+	// UserID is then the impersonated user and ImpersonatorID the Admin acting as them
+	ImpersonatorID  string `json:"impersonator_id,omitempty"`
+	ImpersonationID string `json:"impersonation_id,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -67,6 +74,25 @@ func GenerateToken(userID string, roles []string) (string, error) {
 	return token.SignedString(jwtSecret)
 }
 
+// GenerateImpersonationToken generates a short-lived access token that lets an Admin act as another user
+func GenerateImpersonationToken(impersonatorID, userID string, roles []string, impersonationID string, expiresAt time.Time) (string, error) {
+	claims := &Claims{
+		UserID:          userID,
+		Roles:           roles,
+		ImpersonatorID:  impersonatorID,
+		ImpersonationID: impersonationID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Subject:   userID,
+			ID:        impersonationID,
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(jwtSecret)
+}
+
 // ValidateToken validates a JWT access token
 func ValidateToken(tokenString string) (*Claims, error) {
 	claims := &Claims{}
@@ -0,0 +1,342 @@
+package utils
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Upload size limits
+const (
+	MaxImageSize = 10 * 1024 * 1024 // 10MB
+	MaxPDFSize   = 20 * 1024 * 1024 // 20MB
+)
+
+// multipartOverhead is what the request body may carry on top of the file (boundaries, headers, other fields)
+const multipartOverhead = 1 << 20
+
+// sniffLen is how many leading bytes are inspected to determine the content type
+const sniffLen = 512
+
+// Errors of ReceiveUpload and ReceiveUploads
+var (
+	ErrFileTooLarge = errors.New("file too large")
+	ErrNoFile       = errors.New("no file provided")
+)
+
+// Content types of word processor documents
+const (
+	ContentTypeDOCX = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+	ContentTypeODT  = "application/vnd.oasis.opendocument.text"
+)
+
+// ImageContentTypes are the image formats accepted for upload
+var ImageContentTypes = []string{"image/jpeg", "image/png", "image/gif", "image/webp"}
+
+// DocumentContentTypes are the CV document formats accepted for upload and parsing
+var DocumentContentTypes = []string{"application/pdf", ContentTypeDOCX, ContentTypeODT}
+
+// magicNumbers maps leading bytes to the content type they identify. WebP is checked separately
+// because its signature has the file size in the middle.
+var magicNumbers = []struct {
+	prefix      []byte
+	contentType string
+}{
+	{[]byte("%PDF-"), "application/pdf"},
+	{[]byte{0xFF, 0xD8, 0xFF}, "image/jpeg"},
+	{[]byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1A, '\n'}, "image/png"},
+	{[]byte("GIF87a"), "image/gif"},
+	{[]byte("GIF89a"), "image/gif"},
+}
+
+// ReceivedFile is an uploaded file spooled to a temporary file. Close removes it.
+type ReceivedFile struct {
+	Filename    string // base name as sent by the client, informational only
+	Size        int64
+	ContentType string // sniffed from the content, never taken from the client
+	file        *os.File
+}
+
+// Reader returns the content from the start. Every call rewinds the same underlying file.
+func (f *ReceivedFile) Reader() (io.ReadSeeker, error) {
+	if _, err := f.file.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to rewind uploaded file: %w", err)
+	}
+	return f.file, nil
+}
+
+// ReadAt reads the content at an offset, e.g. to open the file as a ZIP archive
+func (f *ReceivedFile) ReadAt(p []byte, off int64) (int, error) {
+	return f.file.ReadAt(p, off)
+}
+
+// Close removes the temporary file
+func (f *ReceivedFile) Close() error {
+	f.file.Close()
+	return os.Remove(f.file.Name())
+}
+
+// ReceiveUpload streams the multipart field of the request to a temporary file without buffering it in
+// memory, stopping with ErrFileTooLarge as soon as it exceeds maxSize. Other fields are skipped.
+func ReceiveUpload(w http.ResponseWriter, r *http.Request, field string, maxSize int64) (*ReceivedFile, error) {
+	files, err := ReceiveUploads(w, r, map[string]int64{field: maxSize})
+	if err != nil {
+		return nil, err
+	}
+	return files[field], nil
+}
+
+// ReceiveUploads is ReceiveUpload for several file fields, each with its own size limit. Every field
+// is required; on error the files received so far are removed.
+func ReceiveUploads(w http.ResponseWriter, r *http.Request, maxSizes map[string]int64) (map[string]*ReceivedFile, error) {
+	total := int64(multipartOverhead)
+	for _, maxSize := range maxSizes {
+		total += maxSize
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, total)
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse multipart form: %w", err)
+	}
+
+	files := make(map[string]*ReceivedFile, len(maxSizes))
+	fail := func(err error) (map[string]*ReceivedFile, error) {
+		for _, file := range files {
+			file.Close()
+		}
+		return nil, err
+	}
+	for len(files) < len(maxSizes) {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			for field := range maxSizes {
+				if files[field] == nil {
+					return fail(fmt.Errorf("%w: %s", ErrNoFile, field))
+				}
+			}
+		}
+		if err != nil {
+			return fail(uploadReadError(err))
+		}
+		maxSize, wanted := maxSizes[part.FormName()]
+		if !wanted || files[part.FormName()] != nil || part.FileName() == "" {
+			part.Close()
+			continue
+		}
+
+		received, err := spoolPart(part, maxSize)
+		part.Close()
+		if err != nil {
+			return fail(err)
+		}
+		received.Filename = filepath.Base(part.FileName())
+		files[part.FormName()] = received
+	}
+	return files, nil
+}
+
+// SpoolFile copies the content to a temporary file like an uploaded file, failing with ErrFileTooLarge
+// beyond maxSize. The name is kept as the file name.
+func SpoolFile(r io.Reader, name string, maxSize int64) (*ReceivedFile, error) {
+	received, err := spoolPart(r, maxSize)
+	if err != nil {
+		return nil, err
+	}
+	received.Filename = filepath.Base(name)
+	return received, nil
+}
+
+func spoolPart(part io.Reader, maxSize int64) (*ReceivedFile, error) {
+	tmp, err := os.CreateTemp("", "upload-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	received := &ReceivedFile{file: tmp}
+
+	size, err := io.Copy(tmp, io.LimitReader(part, maxSize+1))
+	if err == nil && size > maxSize {
+		err = ErrFileTooLarge
+	}
+	if err != nil {
+		received.Close()
+		return nil, uploadReadError(err)
+	}
+	received.Size = size
+
+	head := make([]byte, sniffLen)
+	n, err := tmp.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		received.Close()
+		return nil, fmt.Errorf("failed to read uploaded file: %w", err)
+	}
+	received.ContentType = SniffContentType(head[:n])
+	if received.ContentType == "application/zip" {
+		received.ContentType = SniffZipDocument(tmp, size)
+	}
+
+	return received, nil
+}
+
+func uploadReadError(err error) error {
+	var maxBytesErr *http.MaxBytesError
+	if errors.Is(err, ErrFileTooLarge) || errors.As(err, &maxBytesErr) {
+		return ErrFileTooLarge
+	}
+	return fmt.Errorf("failed to read uploaded file: %w", err)
+}
+
+// SniffContentType determines the content type from the leading bytes of a file
+func SniffContentType(head []byte) string {
+	for _, magic := range magicNumbers {
+		if bytes.HasPrefix(head, magic.prefix) {
+			return magic.contentType
+		}
+	}
+	if len(head) >= 12 && string(head[0:4]) == "RIFF" && string(head[8:12]) == "WEBP" {
+		return "image/webp"
+	}
+	return http.DetectContentType(head)
+}
+
+// SniffZipDocument tells DOCX and ODT documents apart from other ZIP archives by their entries:
+// an ODT declares its type in a "mimetype" entry, a DOCX has a word/document.xml part
+func SniffZipDocument(r io.ReaderAt, size int64) string {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return "application/octet-stream"
+	}
+
+	for _, entry := range archive.File {
+		switch entry.Name {
+		case "word/document.xml":
+			return ContentTypeDOCX
+		case "mimetype":
+			content, err := entry.Open()
+			if err != nil {
+				continue
+			}
+			mimetype, _ := io.ReadAll(io.LimitReader(content, 128))
+			content.Close()
+			if strings.TrimSpace(string(mimetype)) == ContentTypeODT {
+				return ContentTypeODT
+			}
+		}
+	}
+	return "application/zip"
+}
+
+// SniffFile determines the content type of a file on disk, looking into ZIP archives for documents
+func SniffFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	head := make([]byte, sniffLen)
+	n, err := file.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+
+	contentType := SniffContentType(head[:n])
+	if contentType == "application/zip" {
+		info, err := file.Stat()
+		if err != nil {
+			return "", fmt.Errorf("failed to read file: %w", err)
+		}
+		contentType = SniffZipDocument(file, info.Size())
+	}
+	return contentType, nil
+}
+
+// IsValidImageType checks if the file is a valid image type
+func IsValidImageType(filename string) bool {
+	ext := strings.ToLower(filepath.Ext(filename))
+	validTypes := []string{".jpg", ".jpeg", ".png", ".gif", ".webp"}
+
+	for _, validType := range validTypes {
+		if ext == validType {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateFileSize checks if the file size is within limits (max 10MB)
+func ValidateFileSize(size int64) error {
+	if size > MaxImageSize {
+		return fmt.Errorf("file size exceeds maximum limit of 10MB")
+	}
+	return nil
+}
+
+// IsValidPDFType checks if the file is a PDF
+func IsValidPDFType(filename string) bool {
+	ext := strings.ToLower(filepath.Ext(filename))
+	return ext == ".pdf"
+}
+
+// IsValidDocumentType checks if the file name has the extension of a CV document format
+func IsValidDocumentType(filename string) bool {
+	return slices.Contains([]string{".pdf", ".docx", ".odt"}, strings.ToLower(filepath.Ext(filename)))
+}
+
+// ValidateImageFile validates that the uploaded content is an image in a supported format,
+// whatever its file name claims
+func ValidateImageFile(file *ReceivedFile) error {
+	if !slices.Contains(ImageContentTypes, file.ContentType) {
+		return fmt.Errorf("invalid file type. Supported formats: JPG, JPEG, PNG, GIF, WebP")
+	}
+
+	if err := ValidateFileSize(file.Size); err != nil {
+		return err
+	}
+
+	// Decode the header to ensure the content is actually a readable image
+	reader, err := file.Reader()
+	if err != nil {
+		return err
+	}
+	if _, _, err := image.DecodeConfig(reader); err != nil {
+		return fmt.Errorf("invalid image file: %w", err)
+	}
+
+	return nil
+}
+
+// ValidatePDFFile validates that the uploaded content is a PDF, whatever its file name claims
+func ValidatePDFFile(file *ReceivedFile) error {
+	if file.ContentType != "application/pdf" {
+		return fmt.Errorf("invalid file type. Only PDF files are supported")
+	}
+
+	if file.Size > MaxPDFSize {
+		return fmt.Errorf("PDF file size exceeds maximum limit of 20MB")
+	}
+
+	return nil
+}
+
+// ValidateCVDocument validates that the uploaded content is a PDF, DOCX or ODT document, whatever its
+// file name claims
+func ValidateCVDocument(file *ReceivedFile) error {
+	if !slices.Contains(DocumentContentTypes, file.ContentType) {
+		return fmt.Errorf("invalid file type. Supported formats: PDF, DOCX, ODT")
+	}
+
+	if file.Size > MaxPDFSize {
+		return fmt.Errorf("file size exceeds maximum limit of 20MB")
+	}
+
+	return nil
+}
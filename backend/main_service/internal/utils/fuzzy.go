@@ -0,0 +1,84 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// stripMarks removes combining marks after decomposition, turning "ệ" into "e"
+var stripMarks = transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+
+// NormalizeText lowercases, strips diacritics and collapses punctuation and whitespace, so that
+// "Đại học Bách Khoa - Hà Nội" and "dai hoc bach khoa ha noi" compare equal
+func NormalizeText(s string) string {
+	s = strings.NewReplacer("đ", "d", "Đ", "d").Replace(s)
+	if stripped, _, err := transform.String(stripMarks, s); err == nil {
+		s = stripped
+	}
+	s = strings.ToLower(s)
+
+	return strings.Join(strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '+' && r != '#'
+	}), " ")
+}
+
+// Similarity returns how alike two strings are after NormalizeText, from 0 to 1. It takes the better of
+// the edit distance ratio, which forgives typos, and the word overlap, which forgives reordered words.
+func Similarity(a, b string) float64 {
+	a, b = NormalizeText(a), NormalizeText(b)
+	if a == b {
+		return 1
+	}
+	if a == "" || b == "" {
+		return 0
+	}
+	return max(editSimilarity(a, b), wordOverlap(a, b))
+}
+
+// editSimilarity is 1 minus the Levenshtein distance relative to the longer string
+func editSimilarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+
+	return 1 - float64(previous[len(rb)])/float64(max(len(ra), len(rb)))
+}
+
+// wordOverlap is the Dice coefficient of the two sets of words
+func wordOverlap(a, b string) float64 {
+	wordsA := map[string]bool{}
+	for _, word := range strings.Fields(a) {
+		wordsA[word] = true
+	}
+	wordsB := map[string]bool{}
+	for _, word := range strings.Fields(b) {
+		wordsB[word] = true
+	}
+
+	shared := 0
+	for word := range wordsA {
+		if wordsB[word] {
+			shared++
+		}
+	}
+	return 2 * float64(shared) / float64(len(wordsA)+len(wordsB))
+}
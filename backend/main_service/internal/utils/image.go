@@ -2,16 +2,19 @@ package utils
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"image"
-	"image/gif"
+	"image/color"
+	_ "image/gif" // register the GIF decoder
 	"image/jpeg"
-	"image/png"
+	_ "image/png" // register the PNG decoder
 	"io"
-	"mime/multipart"
 	"strings"
 
+	"github.com/HugoSmits86/nativewebp"
 	"github.com/disintegration/imaging"
+	_ "golang.org/x/image/webp" // register the WebP decoder
 )
 
 // AspectRatio represents the target aspect ratio for image scaling
@@ -22,47 +25,100 @@ const (
 	AspectRatio3x4 AspectRatio = "3:4" // 3:4 aspect ratio (0.75)
 )
 
+// Image formats every rendition is encoded in
+const (
+	ImageFormatJPEG = "jpeg"
+	ImageFormatWebP = "webp"
+)
+
+// MaxImagePixels is the largest image ProcessImage decodes, checked from the image header first:
+// a small file can declare huge dimensions, and decoding allocates 4 bytes per pixel.
+// 50 megapixels covers the photos of current phone cameras.
+const MaxImagePixels = 50_000_000
+
+// ErrImageTooLarge is returned by ProcessImage for images over MaxImagePixels
+var ErrImageTooLarge = errors.New("image dimensions too large")
+
+// RenditionSize is one size an uploaded image is rendered in
+type RenditionSize struct {
+	Name      string
+	MaxWidth  int
+	MaxHeight int
+}
+
 // ImageProcessingOptions holds options for image processing
 type ImageProcessingOptions struct {
 	AspectRatio AspectRatio
-	MaxWidth    int
-	MaxHeight   int
-	Quality     int // JPEG quality (1-100)
+	Sizes       []RenditionSize
+	Quality     int // JPEG quality (1-100); WebP renditions are lossless
+}
+
+// Rendition is an encoded image derived from an upload
+type Rendition struct {
+	Name        string
+	Format      string
+	ContentType string
+	Width       int
+	Height      int
+	Data        []byte
 }
 
 // DefaultImageOptions returns default image processing options
 func DefaultImageOptions() *ImageProcessingOptions {
 	return &ImageProcessingOptions{
 		AspectRatio: AspectRatio3x4, // Default to 3:4
-		MaxWidth:    800,
-		MaxHeight:   1067, // Adjusted for 3:4 ratio (800 * 4/3)
-		Quality:     85,
+		Sizes: []RenditionSize{
+			{Name: "original", MaxWidth: 800, MaxHeight: 1067}, // Adjusted for 3:4 ratio (800 * 4/3)
+		},
+		Quality: 85,
 	}
 }
 
-// ProcessImage processes an uploaded image file with scaling and aspect ratio adjustment
-func ProcessImage(fileHeader *multipart.FileHeader, options *ImageProcessingOptions) ([]byte, error) {
-	// Open the uploaded file
-	file, err := fileHeader.Open()
+// ProcessImage decodes an uploaded image, applies its EXIF orientation and renders every size of the options
+// in JPEG and WebP. The renditions are encoded from pixels only, so no metadata of the upload (EXIF, GPS,
+// ICC, comments) survives.
+func ProcessImage(r io.Reader, options *ImageProcessingOptions) ([]Rendition, error) {
+	// Check the dimensions in the header before allocating the pixels, then decode from the start again
+	var header bytes.Buffer
+	width, height, err := GetImageDimensions(io.TeeReader(r, &header))
 	if err != nil {
-		return nil, fmt.Errorf("failed to open uploaded file: %w", err)
+		return nil, err
+	}
+	if int64(width)*int64(height) > MaxImagePixels {
+		return nil, fmt.Errorf("%w: %dx%d pixels", ErrImageTooLarge, width, height)
 	}
-	defer file.Close()
 
-	// Decode the image
-	img, format, err := image.Decode(file)
+	// Decode the image, rotating/flipping it as its EXIF orientation says
+	img, err := imaging.Decode(io.MultiReader(&header, r), imaging.AutoOrientation(true))
 	if err != nil {
 		return nil, fmt.Errorf("failed to decode image: %w", err)
 	}
 
-	// Process the image based on aspect ratio
-	processedImg, err := scaleToAspectRatio(img, options.AspectRatio, options.MaxWidth, options.MaxHeight)
-	if err != nil {
-		return nil, fmt.Errorf("failed to scale image: %w", err)
+	var renditions []Rendition
+	for _, size := range options.Sizes {
+		// Process the image based on aspect ratio
+		scaled, err := scaleToAspectRatio(img, options.AspectRatio, size.MaxWidth, size.MaxHeight)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scale image: %w", err)
+		}
+
+		for _, format := range []string{ImageFormatJPEG, ImageFormatWebP} {
+			data, err := encodeImage(scaled, format, options.Quality)
+			if err != nil {
+				return nil, err
+			}
+			renditions = append(renditions, Rendition{
+				Name:        size.Name,
+				Format:      format,
+				ContentType: "image/" + format,
+				Width:       scaled.Bounds().Dx(),
+				Height:      scaled.Bounds().Dy(),
+				Data:        data,
+			})
+		}
 	}
 
-	// Encode the processed image
-	return encodeImage(processedImg, format, options.Quality)
+	return renditions, nil
 }
 
 // scaleToAspectRatio scales an image to the specified aspect ratio
@@ -129,43 +185,30 @@ func scaleToAspectRatio(img image.Image, aspectRatio AspectRatio, maxWidth, maxH
 func encodeImage(img image.Image, format string, quality int) ([]byte, error) {
 	var buf bytes.Buffer
 
-	switch strings.ToLower(format) {
-	case "jpeg", "jpg":
-		err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+	switch format {
+	case ImageFormatJPEG:
+		// JPEG has no alpha channel; transparent areas would turn black
+		flattened := imaging.Overlay(imaging.New(img.Bounds().Dx(), img.Bounds().Dy(), color.White), img, image.Pt(0, 0), 1)
+		err := jpeg.Encode(&buf, flattened, &jpeg.Options{Quality: quality})
 		if err != nil {
 			return nil, fmt.Errorf("failed to encode JPEG: %w", err)
 		}
-	case "png":
-		err := png.Encode(&buf, img)
+	case ImageFormatWebP:
+		err := nativewebp.Encode(&buf, img, nil)
 		if err != nil {
-			return nil, fmt.Errorf("failed to encode PNG: %w", err)
-		}
-	case "gif":
-		err := gif.Encode(&buf, img, nil)
-		if err != nil {
-			return nil, fmt.Errorf("failed to encode GIF: %w", err)
+			return nil, fmt.Errorf("failed to encode WebP: %w", err)
 		}
 	default:
-		// Default to JPEG for unsupported formats
-		err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
-		if err != nil {
-			return nil, fmt.Errorf("failed to encode as JPEG: %w", err)
-		}
+		return nil, fmt.Errorf("unsupported image format: %s", format)
 	}
 
 	return buf.Bytes(), nil
 }
 
 // GetImageDimensions returns the dimensions of an uploaded image
-func GetImageDimensions(fileHeader *multipart.FileHeader) (int, int, error) {
-	file, err := fileHeader.Open()
-	if err != nil {
-		return 0, 0, fmt.Errorf("failed to open file: %w", err)
-	}
-	defer file.Close()
-
+func GetImageDimensions(r io.Reader) (int, int, error) {
 	// Read only the image header to get dimensions
-	config, _, err := image.DecodeConfig(file)
+	config, _, err := image.DecodeConfig(r)
 	if err != nil {
 		return 0, 0, fmt.Errorf("failed to decode image config: %w", err)
 	}
@@ -173,43 +216,6 @@ func GetImageDimensions(fileHeader *multipart.FileHeader) (int, int, error) {
 	return config.Width, config.Height, nil
 }
 
-// ValidateImageFile validates if the uploaded file is a valid image
-func ValidateImageFile(fileHeader *multipart.FileHeader) error {
-	// Check file extension
-	if !IsValidImageType(fileHeader.Filename) {
-		return fmt.Errorf("invalid file type. Supported formats: JPG, JPEG, PNG, GIF, WebP")
-	}
-
-	// Check file size
-	if err := ValidateFileSize(fileHeader.Size); err != nil {
-		return err
-	}
-
-	// Try to decode the image to ensure it's valid
-	file, err := fileHeader.Open()
-	if err != nil {
-		return fmt.Errorf("failed to open file: %w", err)
-	}
-	defer file.Close()
-
-	// Read a small portion to validate it's actually an image
-	_, err = io.CopyN(io.Discard, file, 512) // Read first 512 bytes
-	if err != nil && err != io.EOF {
-		return fmt.Errorf("failed to read file: %w", err)
-	}
-
-	// Reset file pointer
-	file.Seek(0, 0)
-
-	// Try to decode the image
-	_, _, err = image.DecodeConfig(file)
-	if err != nil {
-		return fmt.Errorf("invalid image file: %w", err)
-	}
-
-	return nil
-}
-
 // GetAspectRatioFromString converts string to AspectRatio type
 func GetAspectRatioFromString(ratio string) (AspectRatio, error) {
 	switch strings.ToLower(ratio) {
@@ -0,0 +1,249 @@
+package utils
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// ErrDirectoryInvalidCredentials is returned when the directory rejects the user's password
+var ErrDirectoryInvalidCredentials = errors.New("invalid directory credentials")
+
+// ErrDirectoryUserNotFound is returned when no directory entry matches the login name
+var ErrDirectoryUserNotFound = errors.New("user not found in directory")
+
+// Active Directory flags the account as disabled with bit 0x2 of userAccountControl
+const adAccountDisabled = 0x2
+
+// LDAPConfig holds the configuration for LDAP / Active Directory
+type LDAPConfig struct {
+	URL                string
+	BindDN             string
+	BindPassword       string
+	BaseDN             string
+	UserFilter         string // Filter used at login, %s is replaced with the escaped email
+	SyncFilter         string // Filter used by the directory sync
+	AttrEmployeeCode   string
+	AttrFullName       string
+	AttrEmail          string
+	AttrDepartment     string
+	StartTLS           bool
+	InsecureSkipVerify bool
+	Timeout            time.Duration
+}
+
+// DirectoryEntry represents a person read from the directory
+type DirectoryEntry struct {
+	DN           string
+	EmployeeCode string
+	FullName     string
+	Email        string
+	Department   string
+	Disabled     bool
+}
+
+// DirectoryClient is implemented by anything that can authenticate and list directory users.
+// The LDAP implementation is used in production; tests can substitute an in-memory stand-in.
+type DirectoryClient interface {
+	Authenticate(email, password string) (*DirectoryEntry, error)
+	SearchUsers() ([]DirectoryEntry, error)
+}
+
+// LDAPClient authenticates users with an LDAP bind and reads user entries for the directory sync
+type LDAPClient struct {
+	config *LDAPConfig
+}
+
+// AuthProvider returns the configured login provider ("local" or "ldap")
+func AuthProvider() string {
+	provider := strings.ToLower(os.Getenv("AUTH_PROVIDER"))
+	if provider == "" {
+		return "local"
+	}
+	return provider
+}
+
+// LoadLDAPConfig reads the LDAP configuration from environment variables
+func LoadLDAPConfig() (*LDAPConfig, error) {
+	config := &LDAPConfig{
+		URL:                os.Getenv("LDAP_URL"),
+		BindDN:             os.Getenv("LDAP_BIND_DN"),
+		BindPassword:       os.Getenv("LDAP_BIND_PASSWORD"),
+		BaseDN:             os.Getenv("LDAP_BASE_DN"),
+		UserFilter:         getEnvDefault("LDAP_USER_FILTER", "(&(objectClass=person)(mail=%s))"),
+		SyncFilter:         getEnvDefault("LDAP_SYNC_FILTER", "(&(objectClass=person)(mail=*))"),
+		AttrEmployeeCode:   getEnvDefault("LDAP_ATTR_EMPLOYEE_CODE", "employeeID"),
+		AttrFullName:       getEnvDefault("LDAP_ATTR_FULL_NAME", "displayName"),
+		AttrEmail:          getEnvDefault("LDAP_ATTR_EMAIL", "mail"),
+		AttrDepartment:     getEnvDefault("LDAP_ATTR_DEPARTMENT", "department"),
+		StartTLS:           os.Getenv("LDAP_START_TLS") == "true",
+		InsecureSkipVerify: os.Getenv("LDAP_INSECURE_SKIP_VERIFY") == "true",
+		Timeout:            10 * time.Second,
+	}
+
+	if seconds, err := strconv.Atoi(os.Getenv("LDAP_TIMEOUT_SECONDS")); err == nil && seconds > 0 {
+		config.Timeout = time.Duration(seconds) * time.Second
+	}
+
+	// Validate required environment variables
+	if config.URL == "" || config.BaseDN == "" {
+		return nil, fmt.Errorf("missing required LDAP configuration (LDAP_URL, LDAP_BASE_DN)")
+	}
+
+	return config, nil
+}
+
+// NewLDAPClient creates a new LDAP client from the environment configuration
+func NewLDAPClient() (*LDAPClient, error) {
+	config, err := LoadLDAPConfig()
+	if err != nil {
+		return nil, err
+	}
+	return &LDAPClient{config: config}, nil
+}
+
+// connect opens a connection and binds with the service account
+func (lc *LDAPClient) connect() (*ldap.Conn, error) {
+	conn, err := ldap.DialURL(lc.config.URL, ldap.DialWithTLSConfig(&tls.Config{
+		InsecureSkipVerify: lc.config.InsecureSkipVerify,
+	}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to LDAP server: %w", err)
+	}
+	conn.SetTimeout(lc.config.Timeout)
+
+	if lc.config.StartTLS {
+		if err := conn.StartTLS(&tls.Config{InsecureSkipVerify: lc.config.InsecureSkipVerify}); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to start TLS: %w", err)
+		}
+	}
+
+	if lc.config.BindDN != "" {
+		if err := conn.Bind(lc.config.BindDN, lc.config.BindPassword); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to bind with service account: %w", err)
+		}
+	}
+
+	return conn, nil
+}
+
+// attributes returns the list of attributes requested from the directory
+func (lc *LDAPClient) attributes() []string {
+	return []string{
+		lc.config.AttrEmployeeCode,
+		lc.config.AttrFullName,
+		lc.config.AttrEmail,
+		lc.config.AttrDepartment,
+		"userAccountControl",
+	}
+}
+
+// toDirectoryEntry maps an LDAP entry to a DirectoryEntry using the configured attribute names
+func (lc *LDAPClient) toDirectoryEntry(entry *ldap.Entry) DirectoryEntry {
+	result := DirectoryEntry{
+		DN:           entry.DN,
+		EmployeeCode: strings.TrimSpace(entry.GetAttributeValue(lc.config.AttrEmployeeCode)),
+		FullName:     strings.TrimSpace(entry.GetAttributeValue(lc.config.AttrFullName)),
+		Email:        strings.ToLower(strings.TrimSpace(entry.GetAttributeValue(lc.config.AttrEmail))),
+		Department:   strings.TrimSpace(entry.GetAttributeValue(lc.config.AttrDepartment)),
+	}
+
+	if uac, err := strconv.Atoi(entry.GetAttributeValue("userAccountControl")); err == nil {
+		result.Disabled = uac&adAccountDisabled != 0
+	}
+
+	return result
+}
+
+// Authenticate looks up the user by email and verifies the password with an LDAP bind
+func (lc *LDAPClient) Authenticate(email, password string) (*DirectoryEntry, error) {
+	// An empty password would turn the bind into an unauthenticated bind that always succeeds
+	if password == "" {
+		return nil, ErrDirectoryInvalidCredentials
+	}
+
+	conn, err := lc.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	searchRequest := ldap.NewSearchRequest(
+		lc.config.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, int(lc.config.Timeout.Seconds()), false,
+		fmt.Sprintf(lc.config.UserFilter, ldap.EscapeFilter(email)),
+		lc.attributes(),
+		nil,
+	)
+
+	result, err := conn.Search(searchRequest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search directory: %w", err)
+	}
+
+	if len(result.Entries) == 0 {
+		return nil, ErrDirectoryUserNotFound
+	}
+	if len(result.Entries) > 1 {
+		return nil, fmt.Errorf("login name %s matches %d directory entries", email, len(result.Entries))
+	}
+
+	entry := lc.toDirectoryEntry(result.Entries[0])
+
+	// Verify the password by binding as the user
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrDirectoryInvalidCredentials
+		}
+		return nil, fmt.Errorf("failed to bind as user: %w", err)
+	}
+
+	return &entry, nil
+}
+
+// SearchUsers returns every user entry matched by the sync filter
+func (lc *LDAPClient) SearchUsers() ([]DirectoryEntry, error) {
+	conn, err := lc.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	searchRequest := ldap.NewSearchRequest(
+		lc.config.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		lc.config.SyncFilter,
+		lc.attributes(),
+		nil,
+	)
+
+	// Use paging so large Active Directory forests do not hit the server size limit
+	result, err := conn.SearchWithPaging(searchRequest, 500)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search directory: %w", err)
+	}
+
+	entries := make([]DirectoryEntry, 0, len(result.Entries))
+	for _, entry := range result.Entries {
+		entries = append(entries, lc.toDirectoryEntry(entry))
+	}
+
+	return entries, nil
+}
+
+// getEnvDefault gets an environment variable or returns a default value
+func getEnvDefault(key, defaultValue string) string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
@@ -0,0 +1,29 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// ShareTokenPrefix marks a token as a CV share link token
+const ShareTokenPrefix = "cvs_"
+
+// GenerateShareToken creates a new share link token and returns it (shown once) with its hash.
+// Tokens look like cvs_<secret>; only the SHA-256 hash is stored.
+func GenerateShareToken() (token string, hash string, err error) {
+	secretBytes := make([]byte, 32)
+	if _, err := rand.Read(secretBytes); err != nil {
+		return "", "", fmt.Errorf("failed to generate share token: %w", err)
+	}
+
+	token = ShareTokenPrefix + hex.EncodeToString(secretBytes)
+	return token, HashShareToken(token), nil
+}
+
+// HashShareToken returns the hex SHA-256 hash under which a share token is stored
+func HashShareToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
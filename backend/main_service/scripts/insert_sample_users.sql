@@ -123,6 +123,7 @@ BEGIN
         ) RETURNING id INTO new_user_id;
         
         INSERT INTO user_roles (user_id, role_id) VALUES (new_user_id, bul_role_id);
+        UPDATE departments SET manager_id = new_user_id WHERE id = banking_dept_id;
         
         -- Create CV entry
         INSERT INTO cv (id, user_id, status)
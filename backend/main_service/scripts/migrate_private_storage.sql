@@ -0,0 +1,13 @@
+-- Convert CV file references from public Spaces URLs to object keys.
+-- The backend still understands the old URLs, so this can run at any time after deploying.
+UPDATE cv_details
+SET cvpath = regexp_replace(cvpath, '^https?://[^/]*digitaloceanspaces\.com/', '')
+WHERE cvpath ~ '^https?://[^/]*digitaloceanspaces\.com/';
+
+UPDATE cv_details
+SET portraitpath = regexp_replace(portraitpath, '^https?://[^/]*digitaloceanspaces\.com/', '')
+WHERE portraitpath ~ '^https?://[^/]*digitaloceanspaces\.com/';
+
+-- Objects uploaded before this change are still public-read. Make them private in the bucket, e.g.:
+--   s3cmd setacl s3://$DO_SPACES_BUCKET/cv-photos/ --acl-private --recursive
+--   s3cmd setacl s3://$DO_SPACES_BUCKET/cv-documents/ --acl-private --recursive
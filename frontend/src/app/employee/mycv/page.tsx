@@ -303,7 +303,7 @@ export default function MyCVPage() {
     if (e.target.files && e.target.files[0]) {
       const file = e.target.files[0];
 
-      // Validate PDF file using service function
+      // Validate CV file using service function
       const validationError = validatePDFFile(file);
       if (validationError) {
         setError(validationError);
@@ -331,7 +331,7 @@ export default function MyCVPage() {
     if (e.dataTransfer.files && e.dataTransfer.files[0]) {
       const file = e.dataTransfer.files[0];
 
-      // Validate PDF file using service function
+      // Validate CV file using service function
       const validationError = validatePDFFile(file);
       if (validationError) {
         setError(validationError);
@@ -349,7 +349,7 @@ export default function MyCVPage() {
   // Handle upload and parse CV using service
   const handleUploadAndParse = async () => {
     if (!cvFile) {
-      setError('Vui lòng chọn file PDF trước');
+      setError('Vui lòng chọn file CV trước');
       return;
     }
 
@@ -367,7 +367,7 @@ export default function MyCVPage() {
       // Step 2: Populate form with parsed data
       if (result.parsedData) {
         try {
-          const mappedData = mapParsedDataToCVRequest(result.parsedData, formData, result.uploadResult.url);
+          const mappedData = mapParsedDataToCVRequest(result.parsedData, formData, result.uploadResult.key);
 
           // Check if we got any meaningful data
           const hasData = mappedData.full_name || mappedData.job_title || mappedData.summary ||
@@ -384,7 +384,7 @@ export default function MyCVPage() {
             // Still set the CV path for reference
             setFormData(prev => ({
               ...prev,
-              cv_path: result.uploadResult.url
+              cv_path: result.uploadResult.key
             }));
           }
         } catch (mappingError) {
@@ -393,7 +393,7 @@ export default function MyCVPage() {
           // Still set the CV path for reference
           setFormData(prev => ({
             ...prev,
-            cv_path: result.uploadResult.url
+            cv_path: result.uploadResult.key
           }));
         }
       } else {
@@ -402,7 +402,7 @@ export default function MyCVPage() {
         if (result.uploadResult?.url) {
           setFormData(prev => ({
             ...prev,
-            cv_path: result.uploadResult.url
+            cv_path: result.uploadResult.key
           }));
         }
       }
@@ -535,9 +535,9 @@ export default function MyCVPage() {
                     {/* Action Buttons */}
                     <div className="flex gap-3">
                       {/* View Original CV Button */}
-                      {existingCV.details?.cv_path && (
+                      {existingCV.details?.cv_url && (
                         <Button
-                          onClick={() => window.open(existingCV.details?.cv_path || '', '_blank')}
+                          onClick={() => window.open(existingCV.details?.cv_url || '', '_blank')}
                           variant="outline"
                           size="sm"
                           className="text-blue-600 border-blue-300 hover:bg-blue-50 hover:border-blue-400 transition-colors"
@@ -616,9 +616,9 @@ export default function MyCVPage() {
                       <div className="grid grid-cols-3 gap-6">
                         {/* Profile Image - First 1/3 */}
                         <div className="col-span-1">
-                          {existingCV.details?.portrait_path ? (
+                          {existingCV.details?.portrait_url ? (
                             <Image
-                              src={existingCV.details.portrait_path}
+                              src={existingCV.details.portrait_url}
                               alt="Profile photo"
                               width={96}
                               height={128}
@@ -769,7 +769,7 @@ export default function MyCVPage() {
                         Tải lên CV để tự động điền thông tin
                       </h2>
                       <p className="mt-2 text-gray-600">
-                        Tải lên CV hiện tại của bạn ở định dạng PDF để tự động điền vào các trường thông tin bên dưới.
+                        Tải lên CV hiện tại của bạn ở định dạng PDF, DOCX hoặc ODT để tự động điền vào các trường thông tin bên dưới.
                       </p>
                     </div>
                     {/* Note: CV path handling would need to be implemented differently */}
@@ -790,7 +790,7 @@ export default function MyCVPage() {
                       ref={fileInputRef}
                       type="file"
                       className="hidden"
-                      accept=".pdf"
+                      accept=".pdf,.docx,.odt"
                       onChange={handleFileChange}
                     />
 
@@ -808,10 +808,10 @@ export default function MyCVPage() {
                       <>
                         <Upload className={`h-8 w-8 mx-auto mb-2 ${error ? 'text-red-500' : 'text-blue-500'}`} />
                         <p className="text-sm font-medium mb-1">
-                          {cvFile ? cvFile.name : 'Kéo và thả hoặc click để chọn file PDF'}
+                          {cvFile ? cvFile.name : 'Kéo và thả hoặc click để chọn file PDF, DOCX hoặc ODT'}
                         </p>
                         <p className="text-xs text-gray-500">
-                          Chỉ hỗ trợ file PDF, tối đa 10MB
+                          Hỗ trợ file PDF, DOCX, ODT, tối đa 10MB
                         </p>
                         {cvFile && (
                           <div className="mt-2 py-1 px-2 bg-green-100 text-green-800 rounded-full text-xs font-semibold inline-flex items-center">
@@ -987,7 +987,7 @@ export default function MyCVPage() {
                       Ảnh chân dung
                     </label>
                     <ImageUpload
-                      currentImageUrl={formData.portrait_path}
+                      currentImageUrl={existingCV?.details?.portrait_url}
                       onImageChange={handleImageChange}
                       disabled={formLoading}
                     />
@@ -48,9 +48,9 @@ export default function ImageUpload({
       // Clean up object URL
       URL.revokeObjectURL(objectUrl);
 
-      // Update with actual uploaded URL
+      // Preview through the short-lived URL, store the object key
       setPreviewUrl(uploadResult.url);
-      onImageChange(uploadResult.url);
+      onImageChange(uploadResult.key);
 
     } catch (err) {
       setError(err instanceof Error ? err.message : 'Failed to upload image');
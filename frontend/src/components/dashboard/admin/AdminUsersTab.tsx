@@ -1298,9 +1298,9 @@ export default function AdminUsersTab() {
                 {/* Top Row - Primary Actions */}
                 <div className="flex items-center gap-2">
                   {/* View Original CV Button */}
-                  {selectedUserCV?.details?.cv_path && (
+                  {selectedUserCV?.details?.cv_url && (
                     <a
-                      href={selectedUserCV.details.cv_path}
+                      href={selectedUserCV.details.cv_url}
                       target="_blank"
                       rel="noopener noreferrer"
                       className="inline-flex items-center px-4 py-2 bg-[#83C21E] text-white rounded-lg hover:bg-[#6fa01a] transition-all duration-200 text-sm font-medium shadow-md hover:shadow-lg transform hover:-translate-y-0.5"
@@ -1847,9 +1847,9 @@ export default function AdminUsersTab() {
                   <div className="grid grid-cols-3 gap-6">
                     {/* Profile Image - First 1/3 */}
                     <div className="col-span-1">
-                      {selectedUserCV.details?.portrait_path ? (
+                      {selectedUserCV.details?.portrait_url ? (
                         <Image
-                          src={selectedUserCV.details.portrait_path}
+                          src={selectedUserCV.details.portrait_url}
                           alt="Profile photo"
                           width={96}
                           height={128}
@@ -430,9 +430,9 @@ export default function BULMembersTab({ user }: BULMembersTabProps) {
                 {/* Top Row - Primary Actions */}
                 <div className="flex items-center gap-2">
                   {/* View Original CV Button */}
-                  {selectedMemberCV?.details?.cv_path && (
+                  {selectedMemberCV?.details?.cv_url && (
                     <a
-                      href={selectedMemberCV.details.cv_path}
+                      href={selectedMemberCV.details.cv_url}
                       target="_blank"
                       rel="noopener noreferrer"
                       className="inline-flex items-center px-4 py-2 bg-[#83C21E] text-white rounded-lg hover:bg-[#6fa01a] transition-all duration-200 text-sm font-medium shadow-md hover:shadow-lg transform hover:-translate-y-0.5"
@@ -584,9 +584,9 @@ export default function BULMembersTab({ user }: BULMembersTabProps) {
                   <div className="grid grid-cols-3 gap-6">
                     {/* Profile Image - First 1/3 */}
                     <div className="col-span-1">
-                      {selectedMemberCV.details?.portrait_path ? (
+                      {selectedMemberCV.details?.portrait_url ? (
                         <Image
-                          src={selectedMemberCV.details.portrait_path}
+                          src={selectedMemberCV.details.portrait_url}
                           alt="Profile photo"
                           width={96}
                           height={128}
@@ -69,6 +69,8 @@ export interface CVDetail {
   address?: string;
   cv_path?: string;
   portrait_path?: string;
+  cv_url?: string; // short-lived download URL for cv_path
+  portrait_url?: string; // short-lived download URL for portrait_path
   created_at?: string;
   // Related data
   education?: CVEducation[];
@@ -85,6 +87,7 @@ export interface CV {
   details?: CVDetail;
   updater_name?: string;
   updater_employee_code?: string;
+  hidden_fields?: string[]; // sensitive fields hidden from the viewer by the visibility policy
 }
 
 export interface CVCreateRequest {
@@ -199,6 +202,66 @@ export const adminUpdateCV = async (userId: string, cvData: CVCreateRequest): Pr
   }
 };
 
+export type MergeStatus = 'new' | 'changed' | 'unchanged';
+
+export interface MergeItemProposal<Current, Proposed> {
+  id: string; // pass back in CVMergeSelection
+  status: MergeStatus;
+  match_score?: number;
+  current?: Current;
+  proposed: Proposed;
+}
+
+// Per-field and per-item proposals comparing parsed CV data with the stored CV
+export interface CVMergePreview {
+  base_updated_at: string | null; // pass back when applying
+  fields: { field: string; status: MergeStatus; current: string | null; proposed: string | null }[];
+  education: MergeItemProposal<CVEducation, CVEducationRequest>[];
+  courses: MergeItemProposal<CVCourse, CVCourseRequest>[];
+  skills: MergeItemProposal<CVSkill, CVSkillRequest>[];
+}
+
+export interface CVMergeSelection {
+  fields?: string[];
+  education?: string[];
+  courses?: string[];
+  skills?: string[];
+}
+
+// Compare the result of a parse job with the current user's CV
+export const previewCVMerge = async (parseJobId: string): Promise<CVMergePreview> => {
+  try {
+    setAuthToken();
+    const response = await axios.post(`${API_URL}/cv/merge/preview`, { parse_job_id: parseJobId });
+    return response.data.data;
+  } catch (error) {
+    console.error('CV merge preview error:', error);
+    if (axios.isAxiosError(error) && error.response) {
+      throw new Error(error.response.data.message || 'Failed to compare parsed CV');
+    }
+    throw new Error('Failed to compare parsed CV. Please try again.');
+  }
+};
+
+// Apply the accepted proposals of a preview; fails with 409 if the CV changed since
+export const applyCVMerge = async (parseJobId: string, preview: CVMergePreview, accept: CVMergeSelection): Promise<{message: string}> => {
+  try {
+    setAuthToken();
+    const response = await axios.post(`${API_URL}/cv/merge/apply`, {
+      parse_job_id: parseJobId,
+      base_updated_at: preview.base_updated_at,
+      accept,
+    });
+    return { message: response.data.message };
+  } catch (error) {
+    console.error('CV merge apply error:', error);
+    if (axios.isAxiosError(error) && error.response) {
+      throw new Error(error.response.data.message || 'Failed to merge CV');
+    }
+    throw new Error('Failed to merge CV. Please try again.');
+  }
+};
+
 // Alias for backward compatibility
 export const getCVByUserID = getUserCVByUserId;
 export const getCVById = getUserCVByUserId;
@@ -3,12 +3,24 @@ import axios from 'axios';
 const API_URL = 'http://localhost:8080/api';
 
 export interface UploadImageResponse {
-  url: string;
+  key: string; // stored in the CV
+  url: string; // short-lived preview URL
   original_name: string;
   size: number;
   width: number;
   height: number;
   aspect_ratio: string;
+  renditions: ImageRendition[]; // every stored size and format, including the one key points to
+}
+
+export interface ImageRendition {
+  name: 'thumbnail' | 'card' | 'print';
+  format: 'jpeg' | 'webp';
+  key: string;
+  url: string;
+  width: number;
+  height: number;
+  size: number;
 }
 
 export interface UploadResponse {
@@ -18,7 +30,8 @@ export interface UploadResponse {
 }
 
 export interface UploadPDFResponse {
-  url: string;
+  key: string; // stored in the CV
+  url: string; // short-lived preview URL
   original_name: string;
   size: number;
   content_type: string;
@@ -76,19 +89,54 @@ export const uploadPDFFile = async (file: File): Promise<UploadPDFResponse> => {
 
 
 
-// Parse CV from uploaded file
-export const parseCVFromFile = async (fileUrl: string): Promise<ParseCVResponse> => {
+export interface ParseJob {
+  id: string;
+  file_path: string;
+  status: 'queued' | 'running' | 'succeeded' | 'failed';
+  attempts: number;
+  max_attempts: number;
+  result?: ParseCVResponse;
+  error?: string;
+}
+
+const PARSE_POLL_INTERVAL_MS = 2000;
+const PARSE_TIMEOUT_MS = 10 * 60 * 1000;
+
+// Get the state of a CV parsing job
+export const getParseJob = async (jobId: string): Promise<ParseJob> => {
+  const response = await axios.get(`${API_URL}/ai/parse-jobs/${jobId}`);
+  return response.data.data;
+};
+
+// Parse CV from uploaded file. Parsing runs as a background job, polled until it finishes.
+export const parseCVFromFile = async (fileKey: string): Promise<ParseCVResponse> => {
   try {
     const response = await axios.post(`${API_URL}/ai/parse-cv`, {
-      file_path: fileUrl
+      file_path: fileKey
     });
 
-    return response.data;
+    let job: ParseJob = response.data.data;
+    const deadline = Date.now() + PARSE_TIMEOUT_MS;
+    while (job.status === 'queued' || job.status === 'running') {
+      if (Date.now() > deadline) {
+        throw new Error('CV parsing is taking too long. Please try again later.');
+      }
+      await new Promise((resolve) => setTimeout(resolve, PARSE_POLL_INTERVAL_MS));
+      job = await getParseJob(job.id);
+    }
+
+    if (job.status === 'failed' || !job.result) {
+      throw new Error(job.error || 'Failed to parse CV');
+    }
+    return job.result;
   } catch (error) {
     console.error('CV parsing error:', error);
     if (axios.isAxiosError(error) && error.response) {
       throw new Error(error.response.data.message || 'Failed to parse CV');
     }
+    if (error instanceof Error) {
+      throw error;
+    }
     throw new Error('Failed to parse CV. Please try again.');
   }
 };
@@ -104,7 +152,7 @@ export const uploadAndParseCV = async (file: File): Promise<{
     const uploadResult = await uploadPDFFile(file);
 
     // Step 2: Parse CV from uploaded file
-    const parseResult = await parseCVFromFile(uploadResult.url);
+    const parseResult = await parseCVFromFile(uploadResult.key);
 
     return {
       uploadResult,
@@ -134,11 +182,20 @@ export const validateImageFile = (file: File): string | null => {
   return null; // No validation errors
 };
 
-// Validate PDF file
+// CV document formats accepted for parsing
+const CV_DOCUMENT_TYPES = [
+  'application/pdf',
+  'application/vnd.openxmlformats-officedocument.wordprocessingml.document',
+  'application/vnd.oasis.opendocument.text',
+];
+const CV_DOCUMENT_EXTENSIONS = ['.pdf', '.docx', '.odt'];
+
+// Validate CV document file (PDF, DOCX or ODT)
 export const validatePDFFile = (file: File): string | null => {
-  // Check file type
-  if (file.type !== 'application/pdf') {
-    return 'Chỉ chấp nhận file PDF để phân tích CV';
+  // Check file type; browsers don't always know the Word/ODT MIME types, so fall back to the extension
+  const extension = file.name.slice(file.name.lastIndexOf('.')).toLowerCase();
+  if (!CV_DOCUMENT_TYPES.includes(file.type) && !CV_DOCUMENT_EXTENSIONS.includes(extension)) {
+    return 'Chỉ chấp nhận file PDF, DOCX hoặc ODT để phân tích CV';
   }
 
   // Check file size (5MB max for CV parsing)